@@ -0,0 +1,297 @@
+// Package bankstmt 解析银行对账单（CSV / OFX）为统一的流水行。
+//
+// 老挝、泰国各银行导出的 CSV 列名不统一，这里按常见别名识别列；
+// OFX 兼容 1.x 的 SGML 写法（标签可不闭合）与 2.x 的 XML 写法。
+package bankstmt
+
+import (
+	"backend/money"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line 对账单中的一条流水。Amount 为正表示入账，为负表示出账（付款）。
+type Line struct {
+	Date         time.Time
+	Amount       money.Amount
+	Currency     string
+	Counterparty string
+	Reference    string
+	Description  string
+}
+
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+)
+
+// DetectFormat 根据文件名与内容判断格式
+func DetectFormat(filename string, data []byte) string {
+	lower := strings.ToLower(filename)
+	if strings.HasSuffix(lower, ".ofx") || strings.HasSuffix(lower, ".qfx") {
+		return FormatOFX
+	}
+	head := data
+	if len(head) > 2048 {
+		head = head[:2048]
+	}
+	up := bytes.ToUpper(head)
+	if bytes.Contains(up, []byte("OFXHEADER")) || bytes.Contains(up, []byte("<OFX>")) {
+		return FormatOFX
+	}
+	return FormatCSV
+}
+
+// Parse 按指定格式解析；format 为空时自动识别
+func Parse(filename string, data []byte, format string) ([]Line, error) {
+	if format == "" {
+		format = DetectFormat(filename, data)
+	}
+	switch strings.ToLower(format) {
+	case FormatOFX:
+		return ParseOFX(data)
+	case FormatCSV:
+		return ParseCSV(bytes.NewReader(data))
+	}
+	return nil, errors.New("不支持的对账单格式: " + format)
+}
+
+// CSV 列名别名（统一小写、去空格后比较）
+var csvAliases = map[string][]string{
+	"date":         {"date", "txn_date", "transaction date", "transactiondate", "posting date", "post date", "value date", "日期", "交易日期", "记账日期"},
+	"amount":       {"amount", "txn_amount", "transaction amount", "金额", "交易金额"},
+	"debit":        {"debit", "withdrawal", "withdrawals", "debit amount", "out", "支出", "借方", "借方金额"},
+	"credit":       {"credit", "deposit", "deposits", "credit amount", "in", "收入", "贷方", "贷方金额"},
+	"currency":     {"currency", "ccy", "cur", "币种"},
+	"counterparty": {"counterparty", "payee", "beneficiary", "name", "account name", "对方户名", "收款人", "对方名称"},
+	"reference":    {"reference", "ref", "reference no", "ref no", "fitid", "transaction id", "流水号", "参考号", "交易流水号"},
+	"description":  {"description", "memo", "narrative", "details", "remark", "摘要", "备注", "用途"},
+}
+
+// ParseCSV 解析 CSV 对账单。必须包含日期列，以及 amount 或 debit/credit 列之一。
+func ParseCSV(r io.Reader) ([]Line, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("读取表头失败")
+	}
+	idx := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		for key, aliases := range csvAliases {
+			if _, done := idx[key]; done {
+				continue
+			}
+			for _, a := range aliases {
+				if h == a {
+					idx[key] = i
+					break
+				}
+			}
+		}
+	}
+	if _, ok := idx["date"]; !ok {
+		return nil, errors.New("CSV 缺少日期列")
+	}
+	_, hasAmount := idx["amount"]
+	_, hasDebit := idx["debit"]
+	_, hasCredit := idx["credit"]
+	if !hasAmount && !hasDebit && !hasCredit {
+		return nil, errors.New("CSV 缺少金额列（amount 或 debit/credit）")
+	}
+
+	var lines []Line
+	row := 1
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			return nil, errors.New("读取CSV失败，第" + strconv.Itoa(row) + "行")
+		}
+		get := func(key string) string {
+			if p, ok := idx[key]; ok && p < len(rec) {
+				return strings.TrimSpace(rec[p])
+			}
+			return ""
+		}
+		ds := get("date")
+		if ds == "" {
+			continue
+		}
+		d, err := ParseDate(ds)
+		if err != nil {
+			return nil, errors.New("第" + strconv.Itoa(row) + "行日期无法识别: " + ds)
+		}
+		var amount money.Amount
+		if hasAmount && get("amount") != "" {
+			amount, err = ParseAmount(get("amount"))
+			if err != nil {
+				return nil, errors.New("第" + strconv.Itoa(row) + "行金额无法识别: " + get("amount"))
+			}
+		} else {
+			if s := get("debit"); s != "" {
+				v, err := ParseAmount(s)
+				if err != nil {
+					return nil, errors.New("第" + strconv.Itoa(row) + "行支出金额无法识别: " + s)
+				}
+				if v < 0 {
+					v = -v
+				}
+				amount -= v
+			}
+			if s := get("credit"); s != "" {
+				v, err := ParseAmount(s)
+				if err != nil {
+					return nil, errors.New("第" + strconv.Itoa(row) + "行收入金额无法识别: " + s)
+				}
+				if v < 0 {
+					v = -v
+				}
+				amount += v
+			}
+		}
+		if amount == 0 {
+			continue
+		}
+		lines = append(lines, Line{
+			Date:         d,
+			Amount:       amount,
+			Currency:     strings.ToUpper(get("currency")),
+			Counterparty: get("counterparty"),
+			Reference:    get("reference"),
+			Description:  get("description"),
+		})
+	}
+	return lines, nil
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006/01/02",
+	"2006/1/2",
+	"02/01/2006",
+	"2/1/2006",
+	"02-01-2006",
+	"02.01.2006",
+	"20060102",
+	"02-Jan-2006",
+	"02 Jan 2006",
+	"Jan 02, 2006",
+}
+
+// ParseDate 识别常见的银行日期格式（日/月/年优先于月/日/年，与老挝、泰国银行一致）
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	// 带时间部分的日期：只取日期
+	if i := strings.IndexAny(s, " T"); i > 0 {
+		return ParseDate(s[:i])
+	}
+	return time.Time{}, errors.New("无法识别的日期")
+}
+
+// ParseAmount 解析金额：去除千分位、货币符号；括号或尾部负号表示负数
+func ParseAmount(s string) (money.Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg = true
+		s = strings.Trim(s, "()")
+	}
+	if strings.HasSuffix(s, "-") {
+		neg = true
+		s = strings.TrimSuffix(s, "-")
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '+' {
+			b.WriteRune(c)
+		}
+	}
+	v, err := money.Parse(b.String())
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+var (
+	ofxTxnRe    = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	ofxCurdefRe = regexp.MustCompile(`(?i)<CURDEF>\s*([A-Za-z]{3})`)
+)
+
+func ofxTag(block, tag string) string {
+	re := regexp.MustCompile(`(?i)<` + tag + `>\s*([^<\r\n]*)`)
+	if m := re.FindStringSubmatch(block); len(m) == 2 {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// ParseOFX 解析 OFX 对账单中的 STMTTRN 交易
+func ParseOFX(data []byte) ([]Line, error) {
+	text := string(data)
+	currency := ""
+	if m := ofxCurdefRe.FindStringSubmatch(text); len(m) == 2 {
+		currency = strings.ToUpper(m[1])
+	}
+	blocks := ofxTxnRe.FindAllStringSubmatch(text, -1)
+	if len(blocks) == 0 {
+		return nil, errors.New("OFX 中未找到交易记录")
+	}
+	lines := make([]Line, 0, len(blocks))
+	for _, b := range blocks {
+		block := b[1]
+		ds := ofxTag(block, "DTPOSTED")
+		if len(ds) < 8 {
+			return nil, errors.New("OFX 交易缺少 DTPOSTED")
+		}
+		d, err := time.Parse("20060102", ds[:8])
+		if err != nil {
+			return nil, errors.New("OFX 日期无法识别: " + ds)
+		}
+		amount, err := ParseAmount(ofxTag(block, "TRNAMT"))
+		if err != nil {
+			return nil, errors.New("OFX 金额无法识别")
+		}
+		cur := currency
+		if c := ofxTag(block, "CURSYM"); len(c) >= 3 {
+			cur = strings.ToUpper(c[:3])
+		}
+		ref := ofxTag(block, "CHECKNUM")
+		if ref == "" {
+			ref = ofxTag(block, "REFNUM")
+		}
+		if ref == "" {
+			ref = ofxTag(block, "FITID")
+		}
+		lines = append(lines, Line{
+			Date:         d,
+			Amount:       amount,
+			Currency:     cur,
+			Counterparty: ofxTag(block, "NAME"),
+			Reference:    ref,
+			Description:  ofxTag(block, "MEMO"),
+		})
+	}
+	return lines, nil
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// periodLockMsg 检查基地在给定日期所属的会计期间是否已结账；已结账时返回错误信息，否则返回空串
+// baseID 为 0（平台级记录）时不受期间控制
+func periodLockMsg(baseID uint, dates ...time.Time) string {
+	if baseID == 0 {
+		return ""
+	}
+	for _, d := range dates {
+		if d.IsZero() {
+			continue
+		}
+		period := d.Format("2006-01")
+		var cnt int64
+		db.DB.Model(&models.AccountingPeriod{}).
+			Where("base_id = ? AND period = ? AND status = ?", baseID, period, models.PeriodStatusClosed).
+			Count(&cnt)
+		if cnt > 0 {
+			return "会计期间 " + period + " 已结账，不能新增、修改或删除该期间的记录"
+		}
+	}
+	return ""
+}
+
+// periodLockErr 同 periodLockMsg，以 error 形式返回，便于在事务辅助函数中使用
+func periodLockErr(baseID uint, dates ...time.Time) error {
+	if msg := periodLockMsg(baseID, dates...); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// optionalBaseID 可选基地ID转换（nil 视为 0）
+func optionalBaseID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+type periodActionReq struct {
+	BaseID uint   `json:"base_id"`
+	Period string `json:"period"` // YYYY-MM
+	Note   string `json:"note"`
+}
+
+// ListAccountingPeriods 会计期间列表（仅返回已建立记录的期间；未建立的期间视为 open）
+// 参数：base_id、year(YYYY)
+func ListAccountingPeriods(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Preload("Base").Order("period desc")
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	if y := r.URL.Query().Get("year"); len(y) == 4 {
+		q = q.Where("period LIKE ?", y+"-%")
+	}
+	var rows []models.AccountingPeriod
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// ListAccountingPeriodLogs 结账/反结账审计记录
+func ListAccountingPeriodLogs(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Preload("User").Order("created_at desc")
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	if p := r.URL.Query().Get("period"); p != "" {
+		q = q.Where("period = ?", p)
+	}
+	var rows []models.AccountingPeriodLog
+	q.Limit(500).Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// CloseAccountingPeriod 结账：admin 任意基地，base_agent 仅本人基地
+func CloseAccountingPeriod(w http.ResponseWriter, r *http.Request) {
+	setAccountingPeriodStatus(w, r, models.PeriodStatusClosed)
+}
+
+// ReopenAccountingPeriod 反结账（仅管理员，须填写说明）
+func ReopenAccountingPeriod(w http.ResponseWriter, r *http.Request) {
+	setAccountingPeriodStatus(w, r, models.PeriodStatusOpen)
+}
+
+func setAccountingPeriodStatus(w http.ResponseWriter, r *http.Request, status string) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	uid := claimUserID(claims)
+	var req periodActionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse("2006-01", req.Period); err != nil {
+		http.Error(w, "期间格式应为 YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if status == models.PeriodStatusOpen {
+		if role != "admin" {
+			http.Error(w, "只有管理员可以反结账", http.StatusForbidden)
+			return
+		}
+		if req.Note == "" {
+			http.Error(w, "反结账须填写说明", http.StatusBadRequest)
+			return
+		}
+	}
+	baseID, msg := resolveBaseID(role, claimBaseIDs(claims), req.BaseID)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	var p models.AccountingPeriod
+	if err := tx.Where("base_id = ? AND period = ?", baseID, req.Period).First(&p).Error; err != nil {
+		p = models.AccountingPeriod{BaseID: baseID, Period: req.Period, Status: models.PeriodStatusOpen}
+		if err := tx.Create(&p).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "创建会计期间失败", http.StatusInternalServerError)
+			return
+		}
+	}
+	if p.Status == status {
+		tx.Rollback()
+		if status == models.PeriodStatusClosed {
+			http.Error(w, "该期间已结账", http.StatusBadRequest)
+		} else {
+			http.Error(w, "该期间未结账", http.StatusBadRequest)
+		}
+		return
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"status": status, "note": req.Note, "updated_at": now}
+	action := "close"
+	if status == models.PeriodStatusClosed {
+		updates["closed_by"] = uid
+		updates["closed_at"] = now
+	} else {
+		action = "reopen"
+		updates["reopened_by"] = uid
+		updates["reopened_at"] = now
+	}
+	if err := tx.Model(&p).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "更新会计期间失败", http.StatusInternalServerError)
+		return
+	}
+	logEntry := models.AccountingPeriodLog{PeriodID: p.ID, BaseID: baseID, Period: req.Period, Action: action, Note: req.Note, UserID: uid}
+	if err := tx.Create(&logEntry).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "记录审计日志失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.Preload("Base").First(&p, p.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
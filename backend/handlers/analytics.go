@@ -4,49 +4,91 @@ import (
     "backend/db"
     "backend/middleware"
     "backend/models"
+    "backend/money"
     "encoding/json"
     "net/http"
+    "sort"
+    "strconv"
+    "strings"
     "time"
 )
 
 type ExpenseByBase struct {
-    Base  string  `json:"base"`
-    Total float64 `json:"total"`
+    Base  string       `json:"base"`
+    Total money.Amount `json:"total"`
 }
 
 type PurchaseBySupplier struct {
-    Supplier string  `json:"supplier"`
-    Total    float64 `json:"total"`
-    Count    int64   `json:"count"`
+    Supplier string       `json:"supplier"`
+    Total    money.Amount `json:"total"`
+    Count    int64        `json:"count"`
 }
 
 type PurchaseByBase struct {
-    Base  string  `json:"base"`
-    Total float64 `json:"total"`
+    Base  string       `json:"base"`
+    Total money.Amount `json:"total"`
+}
+
+// CurrencyTotal 按单据原币种的合计：Amount 为原币金额，Converted 为折算到目标币种的金额
+type CurrencyTotal struct {
+    Currency  string       `json:"currency"`
+    Amount    money.Amount `json:"amount"`
+    Converted money.Amount `json:"converted"`
 }
 
 type TimeRangeSummaryResponse struct {
-    StartDate string               `json:"start_date"`
-    EndDate   string               `json:"end_date"`
+    StartDate string `json:"start_date"`
+    EndDate   string `json:"end_date"`
+    Currency  string `json:"currency"` // 报表币种（target_currency）
     // 开支（BaseExpense）
-    TotalExpense   float64         `json:"total_expense"`
-    ExpenseByBase  []ExpenseByBase `json:"expense_by_base"`
+    TotalExpense      money.Amount    `json:"total_expense"`
+    ExpenseByBase     []ExpenseByBase `json:"expense_by_base"`
+    ExpenseByCurrency []CurrencyTotal `json:"expense_by_currency"`
     // 采购（PurchaseEntry）
-    TotalPurchase         float64              `json:"total_purchase"`
+    TotalPurchase         money.Amount         `json:"total_purchase"`
     PurchaseBySupplier    []PurchaseBySupplier `json:"purchase_by_supplier"`
     PurchaseByBase        []PurchaseByBase     `json:"purchase_by_base"`
+    PurchaseByCurrency    []CurrencyTotal      `json:"purchase_by_currency"`
 }
 
-// getRatesMap 返回 currency->rate_to_cny 的映射，默认 CNY=1
-func getRatesMap() map[string]float64 {
-    rates := map[string]float64{"CNY": 1}
-    var rows []models.ExchangeRate
-    db.DB.Find(&rows)
-    for _, r := range rows {
-        c := r.Currency
-        if c == "" { continue }
-        rates[c] = r.RateToCNY
+// reportCurrencies 分析报表可选的目标币种
+var reportCurrencies = []string{"CNY", "LAK", "THB"}
+
+// parseTargetCurrency 读取 target_currency 参数（默认 CNY），返回币种或错误信息
+func parseTargetCurrency(r *http.Request) (string, string) {
+    c := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("target_currency")))
+    if c == "" { return "CNY", "" }
+    for _, x := range reportCurrencies { if x == c { return c, "" } }
+    return "", "target_currency 仅支持 " + strings.Join(reportCurrencies, "/")
+}
+
+// recordCurrencySQL 单据自身币种（未填写的历史数据按 CNY）
+func recordCurrencySQL(alias string) string {
+    return "COALESCE(NULLIF(" + alias + ".currency,''),'CNY')"
+}
+
+// addCurrencyTotal 累加原币与折算金额，保持首次出现的顺序
+func addCurrencyTotal(list []CurrencyTotal, curr string, amount, converted money.Amount) []CurrencyTotal {
+    for i := range list {
+        if list[i].Currency == curr { list[i].Amount += amount; list[i].Converted += converted; return list }
     }
+    return append(list, CurrencyTotal{Currency: curr, Amount: amount, Converted: converted})
+}
+
+// roundCurrencyTotals 折算金额逐日累加后统一按目标币种取整，按折算金额降序
+func roundCurrencyTotals(list []CurrencyTotal, target string) []CurrencyTotal {
+    for i := range list { list[i].Converted = list[i].Converted.RoundFor(target) }
+    sort.Slice(list, func(i, j int) bool { return list[i].Converted > list[j].Converted })
+    return list
+}
+
+// getRatesMap 返回某日生效的 currency->rate_to_cny 映射，默认 CNY=1；
+// 需逐笔按交易日期折算时使用 loadRateBook
+func getRatesMap(on time.Time) map[string]float64 {
+    rb := loadRateBook(db.DB)
+    rates := map[string]float64{"CNY": 1}
+    for c := range rb.current { rates[c] = rb.RateOn(c, on) }
+    for c := range rb.history { rates[c] = rb.RateOn(c, on) }
     return rates
 }
 
@@ -59,6 +101,11 @@ func AnalyticsSummary(w http.ResponseWriter, r *http.Request) {
     }
     roleIfc := claims["role"]
     role, _ := roleIfc.(string)
+    target, msg := parseTargetCurrency(r)
+    if msg != "" {
+        http.Error(w, msg, http.StatusBadRequest)
+        return
+    }
 
     start := r.URL.Query().Get("start_date")
     end := r.URL.Query().Get("end_date")
@@ -79,86 +126,153 @@ func AnalyticsSummary(w http.ResponseWriter, r *http.Request) {
     // 可选：基地限制（base_agent/captain）
     var baseIDs []uint
     if role == "base_agent" || role == "captain" {
-        var codes []string
-        if v, ok := claims["bases"]; ok && v != nil {
-            if arr, ok2 := v.([]interface{}); ok2 {
-                for _, x := range arr { if s, ok3 := x.(string); ok3 { codes = append(codes, s) } }
-            }
-        }
-        if len(codes) > 0 {
-            var bs []models.Base
-            if err := db.DB.Where("code IN ?", codes).Find(&bs).Error; err == nil {
-                for _, b := range bs { baseIDs = append(baseIDs, b.ID) }
-            }
-        }
+        baseIDs = claimBaseIDs(claims)
     }
 
-    resp := TimeRangeSummaryResponse{StartDate: start, EndDate: end}
-    rates := getRatesMap()
+    resp := TimeRangeSummaryResponse{StartDate: start, EndDate: end, Currency: target}
+    rb := loadRateBook(db.DB)
 
-    // 1) 开支总额：先按币种汇总，再按汇率折算为CNY
-    var expByCurr []struct{ Curr string; Total float64 }
-    expByCurrQ := db.DB.Table("base_expenses be").
-        Select("COALESCE(b.currency,'CNY') as curr, COALESCE(SUM(be.amount),0) as total").
-        Joins("LEFT JOIN bases b ON b.id = be.base_id").
-        Where("be.date >= ? AND be.date < ?", startTime, endTime)
-    if len(baseIDs) > 0 { expByCurrQ = expByCurrQ.Where("be.base_id IN ?", baseIDs) }
-    expByCurrQ.Group("curr").Scan(&expByCurr)
-    for _, r := range expByCurr { rate := rates[r.Curr]; if rate == 0 { rate = 1 }; resp.TotalExpense += r.Total * rate }
-
-    // 1.1) 各基地开支（折算为CNY）
-    var expByBase []struct{ Name string; Curr string; Total float64 }
-    expByBaseQ := db.DB.Table("base_expenses be").
-        Select("b.name as name, COALESCE(b.currency,'CNY') as curr, COALESCE(SUM(be.amount),0) as total").
-        Joins("LEFT JOIN bases b ON be.base_id = b.id").
-        Where("be.date >= ? AND be.date < ?", startTime, endTime)
-    if len(baseIDs) > 0 { expByBaseQ = expByBaseQ.Where("be.base_id IN ?", baseIDs) }
-    expByBaseQ.Group("b.id").Order("total DESC").Scan(&expByBase)
-    for _, x := range expByBase { rate := rates[x.Curr]; if rate == 0 { rate = 1 }; resp.ExpenseByBase = append(resp.ExpenseByBase, ExpenseByBase{Base: x.Name, Total: x.Total * rate}) }
-
-    // 2) 采购总额：先按币种汇总，再折算为CNY
-    var purByCurr []struct{ Curr string; Total float64 }
-    purByCurrQ := db.DB.Table("purchase_entries pe").
-        Select("COALESCE(b.currency,'CNY') as curr, COALESCE(SUM(pe.total_amount),0) as total").
-        Joins("LEFT JOIN bases b ON b.id = pe.base_id").
-        Where("pe.purchase_date >= ? AND pe.purchase_date < ?", startTime, endTime)
-    if len(baseIDs) > 0 { purByCurrQ = purByCurrQ.Where("pe.base_id IN ?", baseIDs) }
-    purByCurrQ.Group("curr").Scan(&purByCurr)
-    for _, r := range purByCurr { rate := rates[r.Curr]; if rate == 0 { rate = 1 }; resp.TotalPurchase += r.Total * rate }
-
-    // 2.1) 各供应商采购总额（折算为CNY）
-    var purBySupp []struct{ Supplier string; Curr string; Total float64; Cnt int64 }
-    purBySuppQ := db.DB.Table("purchase_entries pe").
-        Select("s.name as supplier, COALESCE(b.currency,'CNY') as curr, COALESCE(SUM(pe.total_amount),0) as total, COUNT(pe.id) as cnt").
-        Joins("LEFT JOIN suppliers s ON pe.supplier_id = s.id").
-        Joins("LEFT JOIN bases b ON b.id = pe.base_id").
-        Where("pe.purchase_date >= ? AND pe.purchase_date < ?", startTime, endTime)
-    if len(baseIDs) > 0 { purBySuppQ = purBySuppQ.Where("pe.base_id IN ?", baseIDs) }
-    purBySuppQ.Group("s.id, curr").Order("total DESC").Scan(&purBySupp)
+    // 整月部分读取月度汇总表，首尾不足整月的部分按原始单据逐日折算
+    fullFrom, fullTo, rawRanges := splitMonthlyRange(startTime, endTime)
+    convCol := "m." + mvAmountColumn(mvExpense, target)
+
+    // 1) 开支（按分摊计入各基地）：按 基地+单据币种 汇总原币及折算为目标币种的金额
+    var expRows []struct{ BaseID uint; Name string; Curr string; Total money.Amount; Conv money.Amount }
+    for _, rg := range rawRanges {
+        var dayRows []struct{ BaseID uint; Name string; Curr string; Day string; Total money.Amount }
+        expQ := db.DB.Table(allocatedExpenses("be")).
+            Select("COALESCE(be.base_id,0) as base_id, b.name as name, " + recordCurrencySQL("be") + " as curr, DATE_FORMAT(be.date,'%Y-%m-%d') as day, COALESCE(SUM(be.amount),0) as total").
+            Joins("LEFT JOIN bases b ON b.id = be.base_id").
+            Where("be.date >= ? AND be.date < ?", rg[0], rg[1]).
+            Where("be.status IN ?", models.ExpenseCountedStatuses)
+        if len(baseIDs) > 0 { expQ = expQ.Where("be.base_id IN ?", baseIDs) }
+        expQ.Group("be.base_id, b.name, curr, day").Scan(&dayRows)
+        for _, x := range dayRows {
+            expRows = append(expRows, struct{ BaseID uint; Name string; Curr string; Total money.Amount; Conv money.Amount }{x.BaseID, x.Name, x.Curr, x.Total, rb.convertRaw(x.Total, x.Curr, target, parseRateDay(x.Day))})
+        }
+    }
+    if fullFrom != "" {
+        mq := db.DB.Table("mv_base_expense_month m").
+            Select("m.base_id as base_id, b.name as name, m.currency as curr, COALESCE(SUM(m.total_amount),0) as total, COALESCE(SUM(" + convCol + "),0) as conv").
+            Joins("LEFT JOIN bases b ON b.id = m.base_id").
+            Where("m.month >= ? AND m.month < ?", fullFrom, fullTo)
+        if len(baseIDs) > 0 { mq = mq.Where("m.base_id IN ?", baseIDs) }
+        var mvRows []struct{ BaseID uint; Name string; Curr string; Total money.Amount; Conv money.Amount }
+        mq.Group("m.base_id, b.name, m.currency").Scan(&mvRows)
+        expRows = append(expRows, mvRows...)
+    }
+    // 1.1) 各基地开支（折算为目标币种）
+    expBase := map[uint]*ExpenseByBase{}
+    var expOrder []uint
+    for _, x := range expRows {
+        conv := x.Conv
+        resp.TotalExpense += conv
+        resp.ExpenseByCurrency = addCurrencyTotal(resp.ExpenseByCurrency, x.Curr, x.Total, conv)
+        eb, ok := expBase[x.BaseID]
+        if !ok { eb = &ExpenseByBase{Base: x.Name}; expBase[x.BaseID] = eb; expOrder = append(expOrder, x.BaseID) }
+        eb.Total += conv
+    }
+    resp.TotalExpense = resp.TotalExpense.RoundFor(target)
+    resp.ExpenseByCurrency = roundCurrencyTotals(resp.ExpenseByCurrency, target)
+    for _, id := range expOrder { eb := *expBase[id]; eb.Total = eb.Total.RoundFor(target); resp.ExpenseByBase = append(resp.ExpenseByBase, eb) }
+    sort.Slice(resp.ExpenseByBase, func(i, j int) bool { return resp.ExpenseByBase[i].Total > resp.ExpenseByBase[j].Total })
+
+    // 2) 采购：按 供应商+基地+单据币种 汇总原币及折算为目标币种的金额
+    type purRow struct{ SupplierID *uint; Supplier string; BaseID uint; Base string; Curr string; Total money.Amount; Conv money.Amount; Cnt int64 }
+    var purRows []purRow
+    for _, rg := range rawRanges {
+        var dayRows []struct{ SupplierID *uint; Supplier string; BaseID uint; Base string; Curr string; Day string; Total money.Amount; Cnt int64 }
+        purQ := db.DB.Table("purchase_entries pe").
+            Select("pe.supplier_id as supplier_id, s.name as supplier, pe.base_id as base_id, b.name as base, " + recordCurrencySQL("pe") + " as curr, DATE_FORMAT(pe.purchase_date,'%Y-%m-%d') as day, COALESCE(SUM(pe.total_amount),0) as total, COUNT(pe.id) as cnt").
+            Joins("LEFT JOIN suppliers s ON pe.supplier_id = s.id").
+            Joins("LEFT JOIN bases b ON b.id = pe.base_id").
+            Where("pe.purchase_date >= ? AND pe.purchase_date < ?", rg[0], rg[1])
+        if len(baseIDs) > 0 { purQ = purQ.Where("pe.base_id IN ?", baseIDs) }
+        purQ.Group("pe.supplier_id, s.name, pe.base_id, b.name, curr, day").Scan(&dayRows)
+        for _, x := range dayRows {
+            purRows = append(purRows, purRow{x.SupplierID, x.Supplier, x.BaseID, x.Base, x.Curr, x.Total, rb.convertRaw(x.Total, x.Curr, target, parseRateDay(x.Day)), x.Cnt})
+        }
+    }
+    if fullFrom != "" {
+        mq := db.DB.Table("mv_supplier_monthly_spend m").
+            Select("NULLIF(m.supplier_id,0) as supplier_id, s.name as supplier, m.base_id as base_id, b.name as base, m.currency as curr, COALESCE(SUM(m.total_purchase),0) as total, COALESCE(SUM(m." + mvAmountColumn(mvSupplier, target) + "),0) as conv, COALESCE(SUM(m.purchase_count),0) as cnt").
+            Joins("LEFT JOIN suppliers s ON s.id = m.supplier_id").
+            Joins("LEFT JOIN bases b ON b.id = m.base_id").
+            Where("m.month >= ? AND m.month < ? AND m.purchase_count > 0", fullFrom, fullTo)
+        if len(baseIDs) > 0 { mq = mq.Where("m.base_id IN ?", baseIDs) }
+        var mvRows []purRow
+        mq.Group("m.supplier_id, s.name, m.base_id, b.name, m.currency").Scan(&mvRows)
+        purRows = append(purRows, mvRows...)
+    }
+    // 2.1) 各供应商采购总额 / 2.2) 各基地采购总额（折算为目标币种）
     aggSupp := map[string]PurchaseBySupplier{}
-    for _, x := range purBySupp { rate := rates[x.Curr]; if rate == 0 { rate = 1 }; ps := aggSupp[x.Supplier]; ps.Supplier = x.Supplier; ps.Total += x.Total * rate; ps.Count += x.Cnt; aggSupp[x.Supplier] = ps }
-    for _, v := range aggSupp { resp.PurchaseBySupplier = append(resp.PurchaseBySupplier, v) }
-
-    // 2.2) 各基地采购总额（折算为CNY）
-    var purByBase []struct{ Base string; Curr string; Total float64 }
-    purByBaseQ := db.DB.Table("purchase_entries pe").
-        Select("b.name as base, COALESCE(b.currency,'CNY') as curr, COALESCE(SUM(pe.total_amount),0) as total").
-        Joins("LEFT JOIN bases b ON pe.base_id = b.id").
-        Where("pe.purchase_date >= ? AND pe.purchase_date < ?", startTime, endTime)
-    if len(baseIDs) > 0 { purByBaseQ = purByBaseQ.Where("pe.base_id IN ?", baseIDs) }
-    purByBaseQ.Group("b.id").Order("total DESC").Scan(&purByBase)
-    for _, x := range purByBase { rate := rates[x.Curr]; if rate == 0 { rate = 1 }; resp.PurchaseByBase = append(resp.PurchaseByBase, PurchaseByBase{Base: x.Base, Total: x.Total * rate}) }
+    purBase := map[uint]*PurchaseByBase{}
+    var purOrder []uint
+    for _, x := range purRows {
+        conv := x.Conv
+        resp.TotalPurchase += conv
+        resp.PurchaseByCurrency = addCurrencyTotal(resp.PurchaseByCurrency, x.Curr, x.Total, conv)
+        ps := aggSupp[x.Supplier]; ps.Supplier = x.Supplier; ps.Total += conv; ps.Count += x.Cnt; aggSupp[x.Supplier] = ps
+        pb, ok := purBase[x.BaseID]
+        if !ok { pb = &PurchaseByBase{Base: x.Base}; purBase[x.BaseID] = pb; purOrder = append(purOrder, x.BaseID) }
+        pb.Total += conv
+    }
+    resp.TotalPurchase = resp.TotalPurchase.RoundFor(target)
+    resp.PurchaseByCurrency = roundCurrencyTotals(resp.PurchaseByCurrency, target)
+    for _, v := range aggSupp { v.Total = v.Total.RoundFor(target); resp.PurchaseBySupplier = append(resp.PurchaseBySupplier, v) }
+    sort.Slice(resp.PurchaseBySupplier, func(i, j int) bool { return resp.PurchaseBySupplier[i].Total > resp.PurchaseBySupplier[j].Total })
+    for _, id := range purOrder { pb := *purBase[id]; pb.Total = pb.Total.RoundFor(target); resp.PurchaseByBase = append(resp.PurchaseByBase, pb) }
+    sort.Slice(resp.PurchaseByBase, func(i, j int) bool { return resp.PurchaseByBase[i].Total > resp.PurchaseByBase[j].Total })
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(resp)
 }
 
+// splitMonthlyRange 将 [start, end) 拆为可读月度汇总的整月区间 [fullFrom, fullTo)（YYYY-MM，无整月时为空）
+// 及首尾需按原始单据统计的日期区间
+func splitMonthlyRange(start, end time.Time) (string, string, [][2]time.Time) {
+    first := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+    if first.Before(start) { first = first.AddDate(0, 1, 0) }
+    last := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, end.Location())
+    if !first.Before(last) { return "", "", [][2]time.Time{{start, end}} }
+    var raw [][2]time.Time
+    if start.Before(first) { raw = append(raw, [2]time.Time{start, first}) }
+    if last.Before(end) { raw = append(raw, [2]time.Time{last, end}) }
+    return first.Format("2006-01"), last.Format("2006-01"), raw
+}
+
+// dailyBaseTotal 按 基地+单据币种+日期 汇总的金额
+type dailyBaseTotal struct{ BaseID uint; Base string; Curr string; Day string; Total money.Amount }
+
+type baseTotal struct {
+    Base     string       `json:"base"`
+    Total    money.Amount `json:"total"`
+    Currency string       `json:"currency"`
+}
+
+// sumDailyByBase 逐日按当日生效汇率折算为目标币种后按基地合计，按金额降序
+func sumDailyByBase(rows []dailyBaseTotal, target string) []baseTotal {
+    rb := loadRateBook(db.DB)
+    idx := map[uint]int{}
+    out := make([]baseTotal, 0)
+    for _, r0 := range rows {
+        i, ok := idx[r0.BaseID]
+        if !ok { i = len(out); idx[r0.BaseID] = i; out = append(out, baseTotal{Base: r0.Base, Currency: target}) }
+        out[i].Total += rb.convertRaw(r0.Total, r0.Curr, target, parseRateDay(r0.Day))
+    }
+    for i := range out { out[i].Total = out[i].Total.RoundFor(target) }
+    sort.Slice(out, func(i, j int) bool { return out[i].Total > out[j].Total })
+    return out
+}
+
 // ExpenseByBaseDetail 统计每个基地开支，支持按类别筛选
 // GET params: start_date, end_date, category_id?, category_name?
 func ExpenseByBaseDetail(w http.ResponseWriter, r *http.Request) {
     claims, err := middleware.ParseJWT(r)
     if err != nil { http.Error(w, "未授权", http.StatusUnauthorized); return }
     role, _ := claims["role"].(string)
+    target, msg := parseTargetCurrency(r)
+    if msg != "" { http.Error(w, msg, http.StatusBadRequest); return }
     start := r.URL.Query().Get("start_date"); end := r.URL.Query().Get("end_date")
     if start == "" || end == "" { http.Error(w, "start_date/end_date 必填", http.StatusBadRequest); return }
     st, es := time.Parse("2006-01-02", start); et, ee := time.Parse("2006-01-02", end)
@@ -168,34 +282,28 @@ func ExpenseByBaseDetail(w http.ResponseWriter, r *http.Request) {
     // 角色范围限定
     var baseIDs []uint
     if role == "base_agent" || role == "captain" {
-        var codes []string
-        if v, ok := claims["bases"]; ok && v != nil { if arr, ok2 := v.([]interface{}); ok2 { for _, x := range arr { if s, ok3 := x.(string); ok3 { codes = append(codes, s) } } } }
-        if len(codes) > 0 {
-            var bs []models.Base; _ = db.DB.Where("code IN ?", codes).Find(&bs).Error
-            for _, b := range bs { baseIDs = append(baseIDs, b.ID) }
-        }
+        baseIDs = claimBaseIDs(claims)
     }
 
-    q := db.DB.Table("base_expenses be").
-        Select("b.name as base, COALESCE(b.currency,'CNY') as curr, COALESCE(SUM(be.amount),0) as total").
+    q := db.DB.Table(allocatedExpenses("be")).
+        Select("COALESCE(be.base_id,0) as base_id, b.name as base, " + recordCurrencySQL("be") + " as curr, DATE_FORMAT(be.date,'%Y-%m-%d') as day, COALESCE(SUM(be.amount),0) as total").
         Joins("LEFT JOIN bases b ON b.id = be.base_id").
-        Where("be.date >= ? AND be.date < ?", st, et)
+        Where("be.date >= ? AND be.date < ?", st, et).
+        Where("be.status IN ?", models.ExpenseCountedStatuses)
     if len(baseIDs) > 0 { q = q.Where("be.base_id IN ?", baseIDs) }
 
-    // 类别筛选
+    // 类别筛选包含全部下级类别
     if cid := r.URL.Query().Get("category_id"); cid != "" {
-        q = q.Where("be.category_id = ?", cid)
+        id, _ := strconv.ParseUint(cid, 10, 64)
+        q = q.Where("be.category_id IN ?", categoryWithDescendants(uint(id)))
     } else if cname := r.URL.Query().Get("category_name"); cname != "" {
         var cat models.ExpenseCategory
-        if err := db.DB.Where("name = ?", cname).First(&cat).Error; err == nil { q = q.Where("be.category_id = ?", cat.ID) } else { q = q.Where("1=0") }
-    }
-    type Row struct{ Base string `json:"base"`; Curr string; Total float64 `json:"total"` }
-    var rowsRaw []Row
-    q.Group("b.id").Order("total DESC").Scan(&rowsRaw)
-    rates := getRatesMap()
-    // 转CNY
-    out := make([]struct{ Base string `json:"base"`; Total float64 `json:"total"` }, 0, len(rowsRaw))
-    for _, r0 := range rowsRaw { rate := rates[r0.Curr]; if rate == 0 { rate = 1 }; out = append(out, struct{ Base string `json:"base"`; Total float64 `json:"total"` }{ Base: r0.Base, Total: r0.Total*rate }) }
+        if err := db.DB.Where("name = ?", cname).First(&cat).Error; err == nil { q = q.Where("be.category_id IN ?", categoryWithDescendants(cat.ID)) } else { q = q.Where("1=0") }
+    }
+    var rowsRaw []dailyBaseTotal
+    q.Group("base_id, b.name, curr, day").Scan(&rowsRaw)
+    // 逐日按当日生效汇率折算为目标币种
+    out := sumDailyByBase(rowsRaw, target)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(out)
 }
@@ -206,6 +314,8 @@ func RequisitionByBase(w http.ResponseWriter, r *http.Request) {
     claims, err := middleware.ParseJWT(r)
     if err != nil { http.Error(w, "未授权", http.StatusUnauthorized); return }
     role, _ := claims["role"].(string)
+    target, msg := parseTargetCurrency(r)
+    if msg != "" { http.Error(w, msg, http.StatusBadRequest); return }
     start := r.URL.Query().Get("start_date"); end := r.URL.Query().Get("end_date")
     if start == "" || end == "" { http.Error(w, "start_date/end_date 必填", http.StatusBadRequest); return }
     st, es := time.Parse("2006-01-02", start); et, ee := time.Parse("2006-01-02", end)
@@ -214,14 +324,12 @@ func RequisitionByBase(w http.ResponseWriter, r *http.Request) {
 
     var baseIDs []uint
     if role == "base_agent" || role == "captain" {
-        var codes []string
-        if v, ok := claims["bases"]; ok && v != nil { if arr, ok2 := v.([]interface{}); ok2 { for _, x := range arr { if s, ok3 := x.(string); ok3 { codes = append(codes, s) } } } }
-        if len(codes) > 0 { var bs []models.Base; _ = db.DB.Where("code IN ?", codes).Find(&bs).Error; for _, b := range bs { baseIDs = append(baseIDs, b.ID) } }
+        baseIDs = claimBaseIDs(claims)
     }
 
     // 统计按基地汇总的申领总额（也可改为数量）
     q := db.DB.Table("material_requisitions mr").
-        Select("b.name as base, COALESCE(b.currency,'CNY') as curr, COALESCE(SUM(mr.total_amount),0) as total").
+        Select("mr.base_id as base_id, b.name as base, " + recordCurrencySQL("mr") + " as curr, DATE_FORMAT(mr.request_date,'%Y-%m-%d') as day, COALESCE(SUM(mr.total_amount),0) as total").
         Joins("LEFT JOIN bases b ON b.id = mr.base_id").
         Where("mr.request_date >= ? AND mr.request_date < ?", st, et)
     if len(baseIDs) > 0 { q = q.Where("mr.base_id IN ?", baseIDs) }
@@ -229,12 +337,9 @@ func RequisitionByBase(w http.ResponseWriter, r *http.Request) {
     if pid := r.URL.Query().Get("product_id"); pid != "" { q = q.Where("mr.product_id = ?", pid) }
     if pname := r.URL.Query().Get("product_name"); pname != "" { q = q.Where("mr.product_name = ?", pname) }
 
-    type Row struct{ Base string `json:"base"`; Curr string; Total float64 `json:"total"` }
-    var rowsRaw []Row
-    q.Group("b.id").Order("total DESC").Scan(&rowsRaw)
-    rates := getRatesMap()
-    out := make([]struct{ Base string `json:"base"`; Total float64 `json:"total"` }, 0, len(rowsRaw))
-    for _, r0 := range rowsRaw { rate := rates[r0.Curr]; if rate == 0 { rate = 1 }; out = append(out, struct{ Base string `json:"base"`; Total float64 `json:"total"` }{ Base: r0.Base, Total: r0.Total*rate }) }
+    var rowsRaw []dailyBaseTotal
+    q.Group("base_id, b.name, curr, day").Scan(&rowsRaw)
+    out := sumDailyByBase(rowsRaw, target)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(out)
 }
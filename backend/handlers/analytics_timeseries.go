@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// 趋势统计的指标与维度
+var (
+	timeseriesMetrics    = []string{"expense", "purchase", "requisition", "payment"}
+	timeseriesBreakdowns = []string{"base", "supplier", "category", "product"}
+)
+
+// timeseriesMaxBuckets 单次查询的最大时间桶数
+const timeseriesMaxBuckets = 1000
+
+// tsKey 维度的键与名称表达式，以及所需的关联
+type tsKey struct {
+	key   string
+	label string
+	joins []string
+}
+
+// tsSource 某指标的数据来源：日期、金额、币种、基地列，及支持的维度
+type tsSource struct {
+	table   string
+	joins   []string
+	date    string
+	amount  string
+	curr    string
+	baseCol string
+	where   string
+	args    []interface{}
+	keys    map[string]tsKey
+	// 按维度改用的明细来源（如按商品统计采购时取采购明细行）
+	detail map[string]*tsSource
+}
+
+func timeseriesSources() map[string]*tsSource {
+	baseKey := func(col string) tsKey {
+		return tsKey{col, "b.name", []string{"LEFT JOIN bases b ON b.id = " + col}}
+	}
+	supplierKey := func(col string) tsKey {
+		return tsKey{col, "s.name", []string{"LEFT JOIN suppliers s ON s.id = " + col}}
+	}
+	return map[string]*tsSource{
+		"expense": {
+			table: allocatedExpenses("be"), date: "be.date", amount: "be.amount", curr: recordCurrencySQL("be"), baseCol: "be.base_id",
+			where: "be.status IN ?", args: []interface{}{models.ExpenseCountedStatuses},
+			keys: map[string]tsKey{
+				"base":     baseKey("be.base_id"),
+				"category": {"be.category_id", "c.name", []string{"LEFT JOIN expense_categories c ON c.id = be.category_id"}},
+			},
+		},
+		"purchase": {
+			table: "purchase_entries pe", date: "pe.purchase_date", amount: "pe.total_amount", curr: recordCurrencySQL("pe"), baseCol: "pe.base_id",
+			keys: map[string]tsKey{
+				"base":     baseKey("pe.base_id"),
+				"supplier": supplierKey("pe.supplier_id"),
+			},
+			detail: map[string]*tsSource{
+				"product": {
+					table: "purchase_entry_items pei", joins: []string{"JOIN purchase_entries pe ON pe.id = pei.purchase_entry_id"},
+					date: "pe.purchase_date", amount: "pei.amount", curr: recordCurrencySQL("pe"), baseCol: "pe.base_id",
+					keys: map[string]tsKey{"product": {"pei.product_name", "pei.product_name", nil}},
+				},
+			},
+		},
+		"requisition": {
+			table: "material_requisitions mr", date: "mr.request_date", amount: "mr.total_amount", curr: recordCurrencySQL("mr"), baseCol: "mr.base_id",
+			keys: map[string]tsKey{
+				"base":    baseKey("mr.base_id"),
+				"product": {"mr.product_name", "mr.product_name", nil},
+			},
+		},
+		// 付款不含以预付款/余额抵扣（credit）的部分，避免与预付时的付款重复
+		"payment": {
+			table: "payment_records pm", joins: []string{"JOIN payable_records pr ON pr.id = pm.payable_record_id"},
+			date: "pm.payment_date", amount: "pm.payment_amount", curr: recordCurrencySQL("pm"), baseCol: "pr.base_id",
+			where: "pm.payment_method <> ?", args: []interface{}{"credit"},
+			keys: map[string]tsKey{
+				"base":     baseKey("pr.base_id"),
+				"supplier": supplierKey("pr.supplier_id"),
+			},
+		},
+	}
+}
+
+// tsRow 按 维度+单据币种+日期 汇总的金额
+type tsRow struct {
+	K     string
+	Label string
+	Curr  string
+	Day   string
+	Total money.Amount
+}
+
+// query 查询 [start, end) 内按日汇总的金额；breakdown 不受支持时返回 false
+func (src *tsSource) query(claims jwt.MapClaims, baseID string, breakdown string, start, end time.Time) ([]tsRow, bool) {
+	if d, ok := src.detail[breakdown]; ok {
+		return d.query(claims, baseID, breakdown, start, end)
+	}
+	keyExpr, labelExpr := "''", "''"
+	joins := append([]string{}, src.joins...)
+	if breakdown != "" {
+		k, ok := src.keys[breakdown]
+		if !ok {
+			return nil, false
+		}
+		keyExpr, labelExpr = "CAST("+k.key+" AS CHAR)", k.label
+		joins = append(joins, k.joins...)
+	}
+	q := db.DB.Table(src.table)
+	for _, j := range joins {
+		q = q.Joins(j)
+	}
+	q = q.Select(keyExpr+" as k, "+labelExpr+" as label, "+src.curr+" as curr, DATE_FORMAT("+src.date+",'%Y-%m-%d') as day, COALESCE(SUM("+src.amount+"),0) as total").
+		Where(src.date+" >= ? AND "+src.date+" < ?", start, end)
+	if src.where != "" {
+		q = q.Where(src.where, src.args...)
+	}
+	q = timeseriesScope(q, claims, src.baseCol, baseID)
+	var rows []tsRow
+	q.Group("k, label, curr, day").Scan(&rows)
+	return rows, true
+}
+
+// timeseriesScope 非管理员限定为其基地；base_id 参数进一步筛选
+func timeseriesScope(q *gorm.DB, claims jwt.MapClaims, col, baseID string) *gorm.DB {
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			return q.Where("1 = 0")
+		}
+		q = q.Where(col+" IN ?", ids)
+	}
+	if baseID != "" {
+		q = q.Where(col+" = ?", baseID)
+	}
+	return q
+}
+
+// bucketOf 日期所在时间桶：day 为当日，week 为所在周的周一，month 为 YYYY-MM
+func bucketOf(d time.Time, bucket string) string {
+	switch bucket {
+	case "week":
+		return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7)).Format("2006-01-02")
+	case "month":
+		return d.Format("2006-01")
+	}
+	return d.Format("2006-01-02")
+}
+
+// TimeseriesPoint 某时间桶的金额及去年同期值
+type TimeseriesPoint struct {
+	Bucket       string       `json:"bucket"`
+	Value        money.Amount `json:"value"`
+	PreviousYear money.Amount `json:"previous_year"`
+	YoYPercent   *float64     `json:"yoy_pct"` // 同比增减（%），去年同期为 0 时为空
+}
+
+// TimeseriesSeries 某指标（及维度值）的时间序列
+type TimeseriesSeries struct {
+	Metric       string            `json:"metric"`
+	Key          string            `json:"key,omitempty"`
+	Label        string            `json:"label"`
+	Total        money.Amount      `json:"total"`
+	PreviousYear money.Amount      `json:"previous_year"`
+	YoYPercent   *float64          `json:"yoy_pct"`
+	Points       []TimeseriesPoint `json:"points"`
+}
+
+// yoyPercent 同比（%），保留两位小数；去年同期不为正时返回 nil
+func yoyPercent(cur, prev money.Amount) *float64 {
+	if prev <= 0 {
+		return nil
+	}
+	p := marginPercent(cur-prev, prev)
+	return &p
+}
+
+// AnalyticsTimeseries 开支、采购、物资申领、付款按日/周/月的趋势，附去年同期值
+// GET 参数：
+//   - start_date、end_date（默认本年初至今天）、bucket=day / week / month（默认）
+//   - metrics：逗号分隔，默认全部（expense, purchase, requisition, payment）
+//   - breakdown：base / supplier / category / product（可选）；指标不支持该维度时列入 skipped_metrics
+//   - top：按维度拆分时每个指标只保留金额最大的前 N 项，其余合并为“其他”
+//   - base_id、target_currency
+//
+// 按周统计时去年同期取前 52 周（364 天）以对齐星期，按日、按月取前一年同日
+func AnalyticsTimeseries(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	target, msg := parseTargetCurrency(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	bucket := query.Get("bucket")
+	if bucket == "" {
+		bucket = "month"
+	}
+	if bucket != "day" && bucket != "week" && bucket != "month" {
+		http.Error(w, "bucket 仅支持 day / week / month", http.StatusBadRequest)
+		return
+	}
+	breakdown := query.Get("breakdown")
+	if breakdown != "" && !containsString(timeseriesBreakdowns, breakdown) {
+		http.Error(w, "breakdown 仅支持 "+strings.Join(timeseriesBreakdowns, "/"), http.StatusBadRequest)
+		return
+	}
+	metrics := timeseriesMetrics
+	if m := strings.TrimSpace(query.Get("metrics")); m != "" {
+		metrics = nil
+		for _, x := range strings.Split(m, ",") {
+			x = strings.TrimSpace(x)
+			if !containsString(timeseriesMetrics, x) {
+				http.Error(w, "metrics 仅支持 "+strings.Join(timeseriesMetrics, "/"), http.StatusBadRequest)
+				return
+			}
+			if !containsString(metrics, x) {
+				metrics = append(metrics, x)
+			}
+		}
+	}
+	top, _ := strconv.Atoi(query.Get("top"))
+
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	var buckets []string
+	inRange := map[string]bool{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		b := bucketOf(d, bucket)
+		if !inRange[b] {
+			inRange[b] = true
+			buckets = append(buckets, b)
+			if len(buckets) > timeseriesMaxBuckets {
+				http.Error(w, "时间桶过多，请缩短区间或改用更大的 bucket", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	// 去年同期：日期平移到本期后归入本期的时间桶
+	back := func(d time.Time) time.Time { return d.AddDate(-1, 0, 0) }
+	forward := func(d time.Time) time.Time { return d.AddDate(1, 0, 0) }
+	if bucket == "week" {
+		back = func(d time.Time) time.Time { return d.AddDate(0, 0, -364) }
+		forward = func(d time.Time) time.Time { return d.AddDate(0, 0, 364) }
+	}
+
+	type acc struct {
+		label     string
+		cur, prev map[string]money.Amount
+		total     money.Amount
+	}
+	rb := loadRateBook(db.DB)
+	sources := timeseriesSources()
+	baseID := query.Get("base_id")
+	var series []TimeseriesSeries
+	skipped := []string{}
+	for _, metric := range metrics {
+		src := sources[metric]
+		curRows, ok := src.query(claims, baseID, breakdown, start, end.AddDate(0, 0, 1))
+		if !ok {
+			skipped = append(skipped, metric)
+			continue
+		}
+		prevRows, _ := src.query(claims, baseID, breakdown, back(start), back(end).AddDate(0, 0, 1))
+		byKey := map[string]*acc{}
+		var order []string
+		get := func(x tsRow) *acc {
+			a, ok := byKey[x.K]
+			if !ok {
+				a = &acc{label: x.Label, cur: map[string]money.Amount{}, prev: map[string]money.Amount{}}
+				if breakdown == "" {
+					a.label = "合计"
+				} else if a.label == "" {
+					a.label = "未指定"
+				}
+				byKey[x.K] = a
+				order = append(order, x.K)
+			}
+			return a
+		}
+		for _, x := range curRows {
+			d := parseRateDay(x.Day)
+			v := rb.convertRaw(x.Total, x.Curr, target, d)
+			a := get(x)
+			a.cur[bucketOf(d, bucket)] += v
+			a.total += v
+		}
+		for _, x := range prevRows {
+			d := parseRateDay(x.Day)
+			b := bucketOf(forward(d), bucket)
+			if !inRange[b] {
+				continue
+			}
+			get(x).prev[b] += rb.convertRaw(x.Total, x.Curr, target, d)
+		}
+		sort.SliceStable(order, func(i, j int) bool { return byKey[order[i]].total > byKey[order[j]].total })
+		if top > 0 && len(order) > top {
+			other := &acc{label: "其他", cur: map[string]money.Amount{}, prev: map[string]money.Amount{}}
+			for _, k := range order[top:] {
+				a := byKey[k]
+				for b, v := range a.cur {
+					other.cur[b] += v
+				}
+				for b, v := range a.prev {
+					other.prev[b] += v
+				}
+			}
+			order = append(order[:top], "*")
+			byKey["*"] = other
+		}
+		if len(order) == 0 && breakdown == "" {
+			order = []string{""}
+			byKey[""] = &acc{label: "合计", cur: map[string]money.Amount{}, prev: map[string]money.Amount{}}
+		}
+		for _, k := range order {
+			a := byKey[k]
+			s := TimeseriesSeries{Metric: metric, Key: k, Label: a.label, Points: make([]TimeseriesPoint, 0, len(buckets))}
+			for _, b := range buckets {
+				p := TimeseriesPoint{Bucket: b, Value: a.cur[b].RoundFor(target), PreviousYear: a.prev[b].RoundFor(target)}
+				p.YoYPercent = yoyPercent(p.Value, p.PreviousYear)
+				s.Total += p.Value
+				s.PreviousYear += p.PreviousYear
+				s.Points = append(s.Points, p)
+			}
+			s.YoYPercent = yoyPercent(s.Total, s.PreviousYear)
+			series = append(series, s)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start_date":      start.Format("2006-01-02"),
+		"end_date":        end.Format("2006-01-02"),
+		"bucket":          bucket,
+		"breakdown":       breakdown,
+		"currency":        target,
+		"buckets":         buckets,
+		"series":          series,
+		"skipped_metrics": skipped,
+	})
+}
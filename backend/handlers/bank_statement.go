@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"backend/bankstmt"
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 匹配阈值：得分达到该值才作为建议匹配
+const bankMatchThreshold = 40
+
+// ImportBankStatement 导入银行对账单（CSV/OFX），解析为流水行并自动建议匹配
+// multipart 字段：file(必填)、base_id、bank_name、account_no、currency(行内缺省币种)、format(csv|ofx，可自动识别)、window_days(日期窗口，默认30)
+func ImportBankStatement(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	if role != "admin" && role != "base_agent" {
+		http.Error(w, "无权导入对账单", http.StatusForbidden)
+		return
+	}
+	uid := claimUserID(claims)
+	if uid == 0 {
+		http.Error(w, "token缺少用户信息", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, "上传数据过大或格式错误", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "缺少文件", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "读取文件失败", http.StatusBadRequest)
+		return
+	}
+
+	reqBaseID, _ := strconv.ParseUint(strings.TrimSpace(r.FormValue("base_id")), 10, 64)
+	baseID, msg := resolveBaseID(role, claimBaseIDs(claims), uint(reqBaseID))
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(r.FormValue("format")))
+	if format == "" {
+		format = bankstmt.DetectFormat(header.Filename, data)
+	}
+	parsed, err := bankstmt.Parse(header.Filename, data, format)
+	if err != nil {
+		http.Error(w, "解析对账单失败: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(parsed) == 0 {
+		http.Error(w, "对账单中没有有效流水", http.StatusBadRequest)
+		return
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(r.FormValue("currency")))
+	if currency == "" {
+		var base models.Base
+		if err := db.DB.First(&base, baseID).Error; err == nil && base.Currency != "" {
+			currency = base.Currency
+		} else {
+			currency = "CNY"
+		}
+	}
+	windowDays, _ := strconv.Atoi(r.FormValue("window_days"))
+	if windowDays <= 0 {
+		windowDays = 30
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	stmt := models.BankStatement{
+		BaseID:     baseID,
+		BankName:   strings.TrimSpace(r.FormValue("bank_name")),
+		AccountNo:  strings.TrimSpace(r.FormValue("account_no")),
+		Currency:   currency,
+		Format:     format,
+		FileName:   header.Filename,
+		LineCount:  len(parsed),
+		ImportedBy: uid,
+	}
+	if err := tx.Create(&stmt).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存对账单失败", http.StatusInternalServerError)
+		return
+	}
+	lines := make([]models.BankStatementLine, 0, len(parsed))
+	for _, p := range parsed {
+		cur := p.Currency
+		if cur == "" {
+			cur = currency
+		}
+		lines = append(lines, models.BankStatementLine{
+			StatementID:  stmt.ID,
+			BaseID:       baseID,
+			TxnDate:      p.Date,
+			Amount:       p.Amount,
+			Currency:     cur,
+			Counterparty: p.Counterparty,
+			Reference:    p.Reference,
+			Description:  p.Description,
+			Status:       models.BankLineStatusUnmatched,
+		})
+	}
+	for i := range lines {
+		matchBankLine(&lines[i], windowDays)
+	}
+	if err := tx.Create(&lines).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存对账单流水失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+
+	db.DB.Preload("MatchedPayable").Preload("MatchedPayable.Supplier").
+		Where("statement_id = ?", stmt.ID).Order("txn_date asc, id asc").Find(&lines)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"statement": stmt,
+		"lines":     lines,
+	})
+}
+
+// matchBankLine 为一条出账流水建议匹配的应付款：
+// - 参考号已存在于同基地的还款记录中则标记为重复（避免重复登记）
+// - 否则在同基地、同币种的未结清应付款中，按金额、日期窗口、供应商名称打分
+func matchBankLine(line *models.BankStatementLine, windowDays int) {
+	line.Status = models.BankLineStatusUnmatched
+	line.MatchedPayableID = nil
+	line.MatchScore = 0
+	if line.Amount >= 0 {
+		return // 入账流水不参与应付款匹配
+	}
+	if ref := strings.TrimSpace(line.Reference); ref != "" {
+		var existing models.PaymentRecord
+		if err := db.DB.Joins("JOIN payable_records ON payable_records.id = payment_records.payable_record_id").
+			Where("payment_records.reference_number = ? AND payable_records.base_id = ?", ref, line.BaseID).
+			First(&existing).Error; err == nil {
+			line.Status = models.BankLineStatusDuplicate
+			line.PaymentRecordID = &existing.ID
+			line.MatchedPayableID = &existing.PayableRecordID
+			line.MatchScore = 100
+			return
+		}
+	}
+
+	amount := -line.Amount
+	var candidates []models.PayableRecord
+	db.DB.Preload("Supplier").
+		Where("base_id = ? AND currency = ? AND status IN ?", line.BaseID, line.Currency,
+			[]string{models.PayableStatusPending, models.PayableStatusPartial}).
+		Where("remaining_amount >= ?", amount).
+		Find(&candidates)
+
+	text := strings.ToLower(line.Counterparty + " " + line.Description)
+	bestScore := 0
+	var bestID uint
+	for _, c := range candidates {
+		score := 0
+		// 金额：与剩余应付完全一致得分最高，部分付款次之
+		if c.RemainingAmount == amount {
+			score += 50
+		} else {
+			score += 20
+		}
+		// 日期：以到期日为准，无到期日时以创建时间为准
+		ref := c.CreatedAt
+		if c.DueDate != nil {
+			ref = *c.DueDate
+		}
+		days := math.Abs(line.TxnDate.Sub(ref).Hours() / 24)
+		if days <= float64(windowDays) {
+			score += int(20 * (1 - days/float64(windowDays+1)))
+		}
+		// 供应商名称：完整包含得满分，按词部分包含得一半
+		if c.Supplier != nil && c.Supplier.Name != "" {
+			name := strings.ToLower(strings.TrimSpace(c.Supplier.Name))
+			if strings.Contains(text, name) {
+				score += 30
+			} else {
+				for _, tok := range strings.Fields(name) {
+					if len([]rune(tok)) >= 2 && strings.Contains(text, tok) {
+						score += 15
+						break
+					}
+				}
+			}
+		}
+		if score > bestScore {
+			bestScore = score
+			bestID = c.ID
+		}
+	}
+	if bestID != 0 && bestScore >= bankMatchThreshold {
+		id := bestID
+		line.MatchedPayableID = &id
+		line.MatchScore = bestScore
+		line.Status = models.BankLineStatusProposed
+	}
+}
+
+// ListBankStatements 对账单导入批次列表（base_agent 仅本人基地）
+func ListBankStatements(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	q := db.DB.Preload("Base").Preload("Importer").Order("created_at desc")
+	if role == "base_agent" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	} else if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	var rows []models.BankStatement
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// ListBankStatementLines 对账单流水及匹配建议；支持 statement_id、status 过滤
+func ListBankStatementLines(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	q := db.DB.Preload("MatchedPayable").Preload("MatchedPayable.Supplier").Order("txn_date asc, id asc")
+	if role == "base_agent" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	if sid := r.URL.Query().Get("statement_id"); sid != "" {
+		q = q.Where("statement_id = ?", sid)
+	}
+	if st := r.URL.Query().Get("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	var lines []models.BankStatementLine
+	q.Find(&lines)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lines)
+}
+
+// RematchBankStatement 重新为某对账单中未确认的流水计算匹配建议
+func RematchBankStatement(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	sid, _ := strconv.ParseUint(r.URL.Query().Get("statement_id"), 10, 64)
+	if sid == 0 {
+		http.Error(w, "statement_id 必填", http.StatusBadRequest)
+		return
+	}
+	var stmt models.BankStatement
+	if err := db.DB.First(&stmt, sid).Error; err != nil {
+		http.Error(w, "对账单不存在", http.StatusNotFound)
+		return
+	}
+	if role == "base_agent" && !containsUint(claimBaseIDs(claims), stmt.BaseID) {
+		http.Error(w, "无权操作该对账单", http.StatusForbidden)
+		return
+	}
+	windowDays, _ := strconv.Atoi(r.URL.Query().Get("window_days"))
+	if windowDays <= 0 {
+		windowDays = 30
+	}
+	var lines []models.BankStatementLine
+	db.DB.Where("statement_id = ? AND status IN ?", stmt.ID,
+		[]string{models.BankLineStatusUnmatched, models.BankLineStatusProposed}).Find(&lines)
+	for i := range lines {
+		matchBankLine(&lines[i], windowDays)
+		db.DB.Model(&lines[i]).Select("status", "matched_payable_id", "match_score", "payment_record_id").Updates(&lines[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"rematched": len(lines)})
+}
+
+// ConfirmBankLinesRequest 确认匹配请求；payable_id 为空时使用系统建议
+type ConfirmBankLinesRequest struct {
+	Items []struct {
+		LineID    uint  `json:"line_id"`
+		PayableID *uint `json:"payable_id,omitempty"`
+	} `json:"items"`
+}
+
+// ConfirmBankLines 确认流水与应付款的匹配，并为每条确认的流水生成还款记录
+func ConfirmBankLines(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	if role != "admin" && role != "base_agent" {
+		http.Error(w, "无权确认匹配", http.StatusForbidden)
+		return
+	}
+	uid := claimUserID(claims)
+	if uid == 0 {
+		http.Error(w, "token缺少用户信息", http.StatusUnauthorized)
+		return
+	}
+	var req ConfirmBankLinesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Items) == 0 {
+		http.Error(w, "请求数据格式错误", http.StatusBadRequest)
+		return
+	}
+	allowed := claimBaseIDs(claims)
+
+	type result struct {
+		LineID    uint   `json:"line_id"`
+		PaymentID uint   `json:"payment_id,omitempty"`
+		Error     string `json:"error,omitempty"`
+	}
+	results := make([]result, 0, len(req.Items))
+	for _, it := range req.Items {
+		res := result{LineID: it.LineID}
+		paymentID, msg := confirmBankLine(it.LineID, it.PayableID, role, allowed, uid)
+		if msg != "" {
+			res.Error = msg
+		} else {
+			res.PaymentID = paymentID
+		}
+		results = append(results, res)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+// confirmBankLine 单条确认：在一个事务内创建还款、更新应付款与流水状态
+func confirmBankLine(lineID uint, payableID *uint, role string, allowed []uint, uid uint) (uint, string) {
+	var line models.BankStatementLine
+	if err := db.DB.First(&line, lineID).Error; err != nil {
+		return 0, "流水不存在"
+	}
+	if role == "base_agent" && !containsUint(allowed, line.BaseID) {
+		return 0, "无权操作该流水"
+	}
+	if line.Status != models.BankLineStatusUnmatched && line.Status != models.BankLineStatusProposed {
+		return 0, "该流水已处理"
+	}
+	if line.Amount >= 0 {
+		return 0, "入账流水不能登记为还款"
+	}
+	target := line.MatchedPayableID
+	if payableID != nil && *payableID != 0 {
+		target = payableID
+	}
+	if target == nil {
+		return 0, "未指定应付款"
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return 0, "数据库事务启动失败"
+	}
+	var payable models.PayableRecord
+	if err := lockPayable(tx, &payable, *target); err != nil {
+		tx.Rollback()
+		return 0, "应付款记录不存在"
+	}
+	if payable.BaseID != line.BaseID {
+		tx.Rollback()
+		return 0, "应付款与流水不属于同一基地"
+	}
+	if payable.Currency != line.Currency {
+		tx.Rollback()
+		return 0, "应付款与流水币种不一致"
+	}
+	if payable.Status == models.PayableStatusPaid {
+		tx.Rollback()
+		return 0, "此应付款已付清，无法继续还款"
+	}
+	amount := -line.Amount
+	if amount > payable.RemainingAmount {
+		tx.Rollback()
+		return 0, "还款金额不能超过剩余应付金额"
+	}
+	if role != "admin" && paymentNeedsApproval(payable.Currency, amount) {
+		tx.Rollback()
+		return 0, "金额超过审批阈值，请由管理员确认或提交付款申请"
+	}
+
+	notes := "银行对账单导入"
+	if line.Counterparty != "" || line.Description != "" {
+		notes = fmt.Sprintf("银行对账单导入：%s %s", line.Counterparty, line.Description)
+	}
+	payment := models.PaymentRecord{
+		PayableRecordID: payable.ID,
+		PaymentAmount:   amount,
+		Currency:        payable.Currency,
+		PaymentDate:     line.TxnDate,
+		PaymentMethod:   models.PaymentMethodBankTransfer,
+		ReferenceNumber: line.Reference,
+		Notes:           strings.TrimSpace(notes),
+		CreatedBy:       uid,
+	}
+	if err := applyPayment(tx, &payable, &payment); err != nil {
+		tx.Rollback()
+		return 0, err.Error()
+	}
+	// 仅未处理的流水可确认：并发确认同一流水时，后提交者更新不到行而回滚，避免重复登记还款
+	now := time.Now()
+	res := tx.Model(&models.BankStatementLine{}).
+		Where("id = ? AND status IN ?", line.ID, []string{models.BankLineStatusUnmatched, models.BankLineStatusProposed}).
+		Updates(map[string]interface{}{
+			"status":             models.BankLineStatusConfirmed,
+			"matched_payable_id": payable.ID,
+			"payment_record_id":  payment.ID,
+			"confirmed_by":       uid,
+			"confirmed_at":       now,
+		})
+	if res.Error != nil {
+		tx.Rollback()
+		return 0, "更新流水状态失败"
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return 0, "该流水已处理"
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, "提交事务失败"
+	}
+	refreshMonthly(mvSupplier, payment.PaymentDate)
+	return payment.ID, ""
+}
+
+// IgnoreBankLine 将流水标记为忽略（如手续费、内部转账）
+func IgnoreBankLine(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if id == 0 {
+		http.Error(w, "无效的流水ID", http.StatusBadRequest)
+		return
+	}
+	var line models.BankStatementLine
+	if err := db.DB.First(&line, id).Error; err != nil {
+		http.Error(w, "流水不存在", http.StatusNotFound)
+		return
+	}
+	if role == "base_agent" && !containsUint(claimBaseIDs(claims), line.BaseID) {
+		http.Error(w, "无权操作该流水", http.StatusForbidden)
+		return
+	}
+	if line.Status == models.BankLineStatusConfirmed {
+		http.Error(w, "已确认的流水不能忽略", http.StatusBadRequest)
+		return
+	}
+	db.DB.Model(&line).Update("status", models.BankLineStatusIgnored)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
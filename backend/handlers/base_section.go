@@ -362,6 +362,16 @@ func DeleteBaseSection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 已被开支、物资申领、收入记录、开支分摊或分摊规则引用的分区不能删除
+	var refCount int64
+	for _, m := range []interface{}{&models.BaseExpense{}, &models.MaterialRequisition{}, &models.RevenueRecord{}, &models.ExpenseAllocation{}, &models.AllocationRuleLine{}} {
+		db.DB.Model(m).Where("section_id = ?", section.ID).Count(&refCount)
+		if refCount > 0 {
+			http.Error(w, "该分区已被开支、物资申领、收入记录或分摊引用，不能删除", http.StatusConflict)
+			return
+		}
+	}
+
 	// 删除基地分区
 	if err := db.DB.Delete(&section).Error; err != nil {
 		http.Error(w, "删除基地分区失败", http.StatusInternalServerError)
@@ -0,0 +1,607 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// budgetWarning 新增/修改开支后预算的执行情况（达到预警比例或超支时返回）
+type budgetWarning struct {
+	BudgetID   uint         `json:"budget_id"`
+	PeriodType string       `json:"period_type"`
+	Period     string       `json:"period"`
+	CategoryID *uint        `json:"category_id,omitempty"`
+	Currency   string       `json:"currency"`
+	Budget     money.Amount `json:"budget"`
+	Actual     money.Amount `json:"actual"` // 含本笔（预算币种）
+	Percent    float64      `json:"percent"`
+	Threshold  int          `json:"threshold"` // 已达到的最高预警比例
+	Hard       bool         `json:"hard"`
+	Exceeded   bool         `json:"exceeded"`
+	Message    string       `json:"message"`
+}
+
+// budgetPercent 执行比例（%），保留两位小数
+func budgetPercent(actual, budget money.Amount) float64 {
+	if budget <= 0 {
+		return 0
+	}
+	p := actual.Float64() / budget.Float64() * 100
+	return float64(int64(p*100+0.5)) / 100
+}
+
+// reachedThreshold 已达到的最高预警比例，未达到任何比例返回 0
+func reachedThreshold(b *models.Budget, percent float64) int {
+	reached := 0
+	for _, t := range b.Thresholds() {
+		if percent >= float64(t) {
+			reached = t
+		}
+	}
+	return reached
+}
+
+// budgetScopeLabel 预算范围描述（用于提示信息）
+func budgetScopeLabel(q *gorm.DB, b *models.Budget) string {
+	label := b.Period
+	if b.CategoryID != nil {
+		var cat models.ExpenseCategory
+		if q.Select("name").First(&cat, *b.CategoryID).Error == nil {
+			label += " " + cat.Name
+		}
+	}
+	return label
+}
+
+// applicableBudgets 某基地某日期适用的预算：当月、当年，不限类别或为该类别及其上级类别
+func applicableBudgets(q *gorm.DB, baseID, categoryID uint, d time.Time) []models.Budget {
+	var list []models.Budget
+	q.Where("base_id = ?", baseID).
+		Where("(period_type = ? AND period = ?) OR (period_type = ? AND period = ?)",
+			models.BudgetPeriodMonth, d.Format("2006-01"), models.BudgetPeriodYear, d.Format("2006")).
+		Where("category_id IS NULL OR category_id IN ?", loadCategoryTree().Ancestors(categoryID)).
+		Find(&list)
+	return list
+}
+
+// budgetActual 预算期间内的实际支出（开支按分摊计入），逐日按当日汇率折算为预算币种；excludeExpenseID 用于修改开支时排除原记录
+func budgetActual(q *gorm.DB, rb *rateBook, b *models.Budget, excludeExpenseID uint) money.Amount {
+	start, end := b.Range()
+	type dayTotal struct {
+		Curr  string
+		Day   string
+		Total money.Amount
+	}
+	var total money.Amount
+	add := func(rows []dayTotal) {
+		for _, x := range rows {
+			total += rb.convertRaw(x.Total, x.Curr, b.Currency, parseRateDay(x.Day))
+		}
+	}
+
+	var exp []dayTotal
+	eq := q.Table(allocatedExpenses("be")).
+		Select(recordCurrencySQL("be")+" as curr, DATE_FORMAT(be.date,'%Y-%m-%d') as day, COALESCE(SUM(be.amount),0) as total").
+		Where("be.base_id = ? AND be.date >= ? AND be.date < ?", b.BaseID, start, end).
+		Where("be.status IN ?", models.ExpenseCountedStatuses)
+	if b.CategoryID != nil {
+		eq = eq.Where("be.category_id IN ?", categoryWithDescendants(*b.CategoryID))
+	}
+	if excludeExpenseID != 0 {
+		eq = eq.Where("be.id <> ?", excludeExpenseID)
+	}
+	eq.Group("curr, day").Scan(&exp)
+	add(exp)
+
+	if b.CategoryID == nil && b.IncludePurchases {
+		var pur []dayTotal
+		q.Table("purchase_entries pe").
+			Select(recordCurrencySQL("pe")+" as curr, DATE_FORMAT(pe.purchase_date,'%Y-%m-%d') as day, COALESCE(SUM(pe.total_amount),0) as total").
+			Where("pe.base_id = ? AND pe.purchase_date >= ? AND pe.purchase_date < ?", b.BaseID, start, end).
+			Group("curr, day").Scan(&pur)
+		add(pur)
+	}
+	if b.CategoryID == nil && b.IncludeRequisitions {
+		var reqs []dayTotal
+		q.Table("material_requisitions mr").
+			Select(recordCurrencySQL("mr")+" as curr, DATE_FORMAT(mr.request_date,'%Y-%m-%d') as day, COALESCE(SUM(mr.total_amount),0) as total").
+			Where("mr.base_id = ? AND mr.request_date >= ? AND mr.request_date < ?", b.BaseID, start, end).
+			Group("curr, day").Scan(&reqs)
+		add(reqs)
+	}
+	return total.RoundFor(b.Currency)
+}
+
+// checkExpenseBudgets 计算一笔开支计入后各适用预算的执行情况（有分摊时按分摊金额计入各基地）：
+// 超出硬预算时返回错误信息（应拒绝保存）；否则返回达到预警比例或超出软预算的提示。
+// 应在保存开支的同一事务内调用，硬预算行锁持有至事务结束
+func checkExpenseBudgets(q *gorm.DB, exp *models.BaseExpense) ([]budgetWarning, string) {
+	var rb *rateBook
+	var warnings []budgetWarning
+	for _, share := range expenseShares(q, exp) {
+		budgets := applicableBudgets(q, share.BaseID, exp.CategoryID, exp.Date)
+		if len(budgets) == 0 {
+			continue
+		}
+		// 硬预算加行锁：并发录入同一预算范围的开支须依次校验，避免各自通过后合计超出预算
+		for _, b := range budgets {
+			if b.Hard {
+				q.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Budget{}, b.ID)
+			}
+		}
+		if rb == nil {
+			rb = loadRateBook(q)
+		}
+		ws, msg := checkShareBudgets(q, rb, exp, share.Amount, budgets)
+		if msg != "" {
+			return nil, msg
+		}
+		warnings = append(warnings, ws...)
+	}
+	return warnings, ""
+}
+
+// checkShareBudgets 开支计入某基地的金额对该基地各适用预算的影响
+func checkShareBudgets(q *gorm.DB, rb *rateBook, exp *models.BaseExpense, amount money.Amount, budgets []models.Budget) ([]budgetWarning, string) {
+	var warnings []budgetWarning
+	for i := range budgets {
+		b := &budgets[i]
+		actual := budgetActual(q, rb, b, exp.ID)
+		projected := actual + rb.Convert(amount, exp.Currency, b.Currency, exp.Date)
+		label := budgetScopeLabel(q, b)
+		if b.Hard && projected > b.Amount {
+			return nil, fmt.Sprintf("超出硬预算（%s）：预算 %s %s，已用 %s，本笔计入后 %s",
+				label, b.Amount.StringFixed(money.Decimals(b.Currency)), b.Currency,
+				actual.StringFixed(money.Decimals(b.Currency)), projected.StringFixed(money.Decimals(b.Currency)))
+		}
+		percent := budgetPercent(projected, b.Amount)
+		reached := reachedThreshold(b, percent)
+		exceeded := projected > b.Amount
+		if reached == 0 && !exceeded {
+			continue
+		}
+		msg := fmt.Sprintf("预算（%s）已使用 %.2f%%", label, percent)
+		if exceeded {
+			msg = fmt.Sprintf("已超出预算（%s）：使用 %.2f%%", label, percent)
+		}
+		warnings = append(warnings, budgetWarning{
+			BudgetID: b.ID, PeriodType: b.PeriodType, Period: b.Period, CategoryID: b.CategoryID,
+			Currency: b.Currency, Budget: b.Amount, Actual: projected, Percent: percent,
+			Threshold: reached, Hard: b.Hard, Exceeded: exceeded, Message: msg,
+		})
+	}
+	return warnings, ""
+}
+
+// recordBudgetAlerts 按当前实际支出记录新达到的预警比例（已记录的不重复）
+func recordBudgetAlerts(q *gorm.DB, b *models.Budget, actual money.Amount) {
+	percent := budgetPercent(actual, b.Amount)
+	var existing []int
+	q.Model(&models.BudgetAlert{}).Where("budget_id = ?", b.ID).Pluck("threshold", &existing)
+	for _, t := range b.Thresholds() {
+		if percent < float64(t) {
+			break
+		}
+		found := false
+		for _, e := range existing {
+			if e == t {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		q.Create(&models.BudgetAlert{BudgetID: b.ID, BaseID: b.BaseID, Threshold: t, Actual: actual, Percent: percent})
+	}
+}
+
+// refreshBudgetAlerts 开支变动后重新评估其适用预算的预警
+func refreshBudgetAlerts(q *gorm.DB, baseID *uint, categoryID uint, d time.Time) {
+	if baseID == nil || *baseID == 0 {
+		return
+	}
+	budgets := applicableBudgets(q, *baseID, categoryID, d)
+	if len(budgets) == 0 {
+		return
+	}
+	rb := loadRateBook(q)
+	for i := range budgets {
+		recordBudgetAlerts(q, &budgets[i], budgetActual(q, rb, &budgets[i], 0))
+	}
+}
+
+type budgetReq struct {
+	BaseID              uint         `json:"base_id"`
+	CategoryID          *uint        `json:"category_id"`
+	PeriodType          string       `json:"period_type"`
+	Period              string       `json:"period"`
+	Amount              money.Amount `json:"amount"`
+	Currency            string       `json:"currency"`
+	IncludePurchases    bool         `json:"include_purchases"`
+	IncludeRequisitions bool         `json:"include_requisitions"`
+	AlertPercents       string       `json:"alert_percents"`
+	Hard                bool         `json:"hard"`
+	Note                string       `json:"note"`
+}
+
+// validateBudget 校验并规范化预算参数，写入 b；id 为修改时的预算ID（新增为 0）
+func validateBudget(req budgetReq, id uint, b *models.Budget) string {
+	if req.BaseID == 0 {
+		return "必须指定基地"
+	}
+	var base models.Base
+	if err := db.DB.First(&base, req.BaseID).Error; err != nil {
+		return "指定的基地不存在"
+	}
+	pt := strings.ToLower(strings.TrimSpace(req.PeriodType))
+	if pt == "" {
+		pt = models.BudgetPeriodMonth
+	}
+	period := strings.TrimSpace(req.Period)
+	switch pt {
+	case models.BudgetPeriodMonth:
+		if _, err := time.Parse("2006-01", period); err != nil {
+			return "月度预算的 period 格式应为 YYYY-MM"
+		}
+	case models.BudgetPeriodYear:
+		if _, err := time.Parse("2006", period); err != nil {
+			return "年度预算的 period 格式应为 YYYY"
+		}
+	default:
+		return "period_type 仅支持 month / year"
+	}
+	if req.Amount <= 0 {
+		return "预算金额必须大于0"
+	}
+	if req.CategoryID != nil && *req.CategoryID == 0 {
+		req.CategoryID = nil
+	}
+	if req.CategoryID != nil {
+		var cat models.ExpenseCategory
+		if err := db.DB.First(&cat, *req.CategoryID).Error; err != nil {
+			return "指定的费用类别不存在"
+		}
+		if req.IncludePurchases || req.IncludeRequisitions {
+			return "按类别的预算不能计入采购或物资申领"
+		}
+	}
+	cur := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if cur == "" {
+		cur = base.Currency
+	}
+	if cur == "" {
+		cur = "CNY"
+	}
+	// 同一基地、类别、期间只能有一条预算
+	dup := db.DB.Model(&models.Budget{}).Where("base_id = ? AND period_type = ? AND period = ?", req.BaseID, pt, period)
+	if req.CategoryID != nil {
+		dup = dup.Where("category_id = ?", *req.CategoryID)
+	} else {
+		dup = dup.Where("category_id IS NULL")
+	}
+	if id != 0 {
+		dup = dup.Where("id <> ?", id)
+	}
+	var cnt int64
+	dup.Count(&cnt)
+	if cnt > 0 {
+		return "该基地、类别在此期间已有预算"
+	}
+
+	b.BaseID = req.BaseID
+	b.CategoryID = req.CategoryID
+	b.PeriodType = pt
+	b.Period = period
+	b.Amount = req.Amount.RoundFor(cur)
+	b.Currency = cur
+	b.IncludePurchases = req.IncludePurchases
+	b.IncludeRequisitions = req.IncludeRequisitions
+	b.AlertPercents = strings.TrimSpace(req.AlertPercents)
+	if b.AlertPercents == "" {
+		b.AlertPercents = "80,100"
+	}
+	var parts []string
+	for _, t := range b.Thresholds() {
+		parts = append(parts, strconv.Itoa(t))
+	}
+	if len(parts) == 0 {
+		return "alert_percents 应为逗号分隔的正整数，如 80,100"
+	}
+	b.AlertPercents = strings.Join(parts, ",")
+	b.Hard = req.Hard
+	b.Note = req.Note
+	return ""
+}
+
+// ListBudgets 预算列表
+// 参数：base_id、category_id、period_type、period、year(YYYY，含该年各月及年度预算)
+func ListBudgets(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := budgetScope(claims, r).Preload("Base").Preload("Category").Order("period desc, base_id, category_id")
+	var rows []models.Budget
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// budgetScope 按角色与查询参数过滤预算
+func budgetScope(claims jwt.MapClaims, r *http.Request) *gorm.DB {
+	q := db.DB.Model(&models.Budget{})
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	qs := r.URL.Query()
+	if bid := qs.Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	if cid := qs.Get("category_id"); cid != "" {
+		q = q.Where("category_id = ?", cid)
+	}
+	if pt := qs.Get("period_type"); pt != "" {
+		q = q.Where("period_type = ?", pt)
+	}
+	if p := qs.Get("period"); p != "" {
+		q = q.Where("period = ?", p)
+	} else if y := qs.Get("year"); len(y) == 4 {
+		q = q.Where("period = ? OR period LIKE ?", y, y+"-%")
+	}
+	return q
+}
+
+// CreateBudget 新增预算（仅管理员）
+func CreateBudget(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权限", http.StatusForbidden)
+		return
+	}
+	var req budgetReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	var b models.Budget
+	if msg := validateBudget(req, 0, &b); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	b.CreatedBy = claimUserID(claims)
+	if err := db.DB.Create(&b).Error; err != nil {
+		http.Error(w, "创建预算失败", http.StatusInternalServerError)
+		return
+	}
+	recordBudgetAlerts(db.DB, &b, budgetActual(db.DB, loadRateBook(db.DB), &b, 0))
+	db.DB.Preload("Base").Preload("Category").First(&b, b.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// UpdateBudget 修改预算（仅管理员）；已记录的预警清空后按新预算重新评估
+func UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权限", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var b models.Budget
+	if err := db.DB.First(&b, id).Error; err != nil {
+		http.Error(w, "预算不存在", http.StatusNotFound)
+		return
+	}
+	var req budgetReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if msg := validateBudget(req, b.ID, &b); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Omit("Base", "Category").Save(&b).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存预算失败", http.StatusInternalServerError)
+		return
+	}
+	tx.Where("budget_id = ?", b.ID).Delete(&models.BudgetAlert{})
+	recordBudgetAlerts(tx, &b, budgetActual(tx, loadRateBook(tx), &b, 0))
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.Preload("Base").Preload("Category").First(&b, b.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// DeleteBudget 删除预算及其预警（仅管理员）
+func DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权限", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if id == 0 {
+		http.Error(w, "id 必填", http.StatusBadRequest)
+		return
+	}
+	db.DB.Where("budget_id = ?", id).Delete(&models.BudgetAlert{})
+	if res := db.DB.Delete(&models.Budget{}, id); res.RowsAffected == 0 {
+		http.Error(w, "预算不存在", http.StatusNotFound)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// budgetReportRow 预算执行情况
+type budgetReportRow struct {
+	Budget    models.Budget `json:"budget"`
+	Actual    money.Amount  `json:"actual"`
+	Remaining money.Amount  `json:"remaining"`
+	Percent   float64       `json:"percent"`
+	Threshold int           `json:"threshold"` // 已达到的最高预警比例
+	Status    string        `json:"status"`    // ok / warning / exceeded
+	// 折算到报表币种
+	BudgetConverted money.Amount `json:"budget_converted"`
+	ActualConverted money.Amount `json:"actual_converted"`
+}
+
+// BudgetReport 预算执行（预算 vs 实际）：实际支出取开支（基地级预算可含采购/申领），折算为预算币种；
+// 同时按 target_currency（默认 CNY）折算汇总。筛选参数同 ListBudgets，未指定期间时默认本月及本年预算。
+// 报表生成时会记录新达到的预警。
+func BudgetReport(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	target, msg := parseTargetCurrency(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	q := budgetScope(claims, r)
+	qs := r.URL.Query()
+	if qs.Get("period") == "" && qs.Get("year") == "" {
+		now := time.Now()
+		q = q.Where("(period_type = ? AND period = ?) OR (period_type = ? AND period = ?)",
+			models.BudgetPeriodMonth, now.Format("2006-01"), models.BudgetPeriodYear, now.Format("2006"))
+	}
+	var budgets []models.Budget
+	q.Preload("Base").Preload("Category").Order("period desc, base_id, category_id").Find(&budgets)
+
+	rb := loadRateBook(db.DB)
+	today := time.Now()
+	rows := make([]budgetReportRow, 0, len(budgets))
+	var totalBudget, totalActual money.Amount
+	for i := range budgets {
+		b := &budgets[i]
+		actual := budgetActual(db.DB, rb, b, 0)
+		recordBudgetAlerts(db.DB, b, actual)
+		percent := budgetPercent(actual, b.Amount)
+		row := budgetReportRow{
+			Budget: *b, Actual: actual, Remaining: b.Amount - actual,
+			Percent: percent, Threshold: reachedThreshold(b, percent), Status: "ok",
+		}
+		if actual > b.Amount {
+			row.Status = "exceeded"
+		} else if row.Threshold > 0 {
+			row.Status = "warning"
+		}
+		// 预算币种与报表币种不同时，按期末（进行中的期间按今天）汇率折算
+		_, end := b.Range()
+		on := end.AddDate(0, 0, -1)
+		if on.After(today) {
+			on = today
+		}
+		row.BudgetConverted = rb.Convert(b.Amount, b.Currency, target, on)
+		row.ActualConverted = rb.Convert(actual, b.Currency, target, on)
+		totalBudget += row.BudgetConverted
+		totalActual += row.ActualConverted
+		rows = append(rows, row)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"currency":     target,
+		"rows":         rows,
+		"total_budget": totalBudget,
+		"total_actual": totalActual,
+		"percent":      budgetPercent(totalActual, totalBudget),
+	})
+}
+
+// ListBudgetAlerts 预算预警列表，参数：base_id、acknowledged(0/1)
+func ListBudgetAlerts(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Preload("Budget.Base").Preload("Budget.Category").Order("created_at desc")
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	switch r.URL.Query().Get("acknowledged") {
+	case "0", "false":
+		q = q.Where("acknowledged = ?", false)
+	case "1", "true":
+		q = q.Where("acknowledged = ?", true)
+	}
+	var rows []models.BudgetAlert
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// AcknowledgeBudgetAlert 确认预算预警
+func AcknowledgeBudgetAlert(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var alert models.BudgetAlert
+	if err := db.DB.First(&alert, id).Error; err != nil {
+		http.Error(w, "预警不存在", http.StatusNotFound)
+		return
+	}
+	if claimRole(claims) != "admin" && !containsUint(claimBaseIDs(claims), alert.BaseID) {
+		http.Error(w, "无权操作该基地", http.StatusForbidden)
+		return
+	}
+	uid := claimUserID(claims)
+	now := time.Now()
+	db.DB.Model(&alert).Updates(map[string]interface{}{"acknowledged": true, "acknowledged_by": uid, "acknowledged_at": now})
+	db.DB.First(&alert, alert.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 消耗预测的默认参数
+const (
+	consumptionLookbackDays = 182  // 统计近期消耗的天数
+	consumptionHistoryYears = 3    // 季节性使用的历史年数
+	consumptionMaxDaysLeft  = 730  // 库存可用天数的推算上限
+	consumptionSeasonMin    = 365  // 计算季节性所需的最短历史（天）
+	consumptionDefaultAlpha = 0.3  // 指数平滑系数
+	consumptionDefaultMA    = 4    // 移动平均窗口（周）
+	consumptionMaxLookback  = 1095 // lookback_days 上限
+)
+
+// ConsumptionSeason 某自然月的季节指数：该月日均消耗 / 全期日均消耗
+type ConsumptionSeason struct {
+	Month    int     `json:"month"`
+	AvgDaily float64 `json:"avg_daily"`
+	Index    float64 `json:"index"`
+}
+
+// ConsumptionMonth 未来某月的预计消耗
+type ConsumptionMonth struct {
+	Month    string  `json:"month"`
+	Quantity float64 `json:"quantity"`
+	Index    float64 `json:"seasonal_index"`
+}
+
+// ConsumptionBase 某基地近期的消耗
+type ConsumptionBase struct {
+	BaseID   uint    `json:"base_id"`
+	Base     string  `json:"base"`
+	Quantity float64 `json:"quantity"`
+	AvgDaily float64 `json:"avg_daily"`
+	Share    float64 `json:"share"` // 占近期消耗比例（%）
+}
+
+// ConsumptionRow 某商品的消耗统计与预测（数量均为商品基准单位）
+type ConsumptionRow struct {
+	ProductID        uint                `json:"product_id"`
+	ProductName      string              `json:"product_name"`
+	Unit             string              `json:"unit"`
+	StockQuantity    float64             `json:"stock_quantity"`
+	LookbackQuantity float64             `json:"lookback_quantity"`
+	ActiveDays       int                 `json:"active_days"` // 近期有申领的天数
+	AvgDaily         float64             `json:"avg_daily"`
+	AvgWeekly        float64             `json:"avg_weekly"`
+	ForecastDaily    float64             `json:"forecast_daily"` // 模型预测的当前日均消耗
+	ForecastWeekly   float64             `json:"forecast_weekly"`
+	HorizonQuantity  float64             `json:"horizon_quantity"` // 未来 horizon_days 天的预计消耗（含季节调整）
+	AllBasesDaily    float64             `json:"all_bases_forecast_daily"`
+	DaysOfStockLeft  *float64            `json:"days_of_stock_left"` // 按全部基地的消耗推算；无消耗时为空
+	StockoutDate     string              `json:"stockout_date,omitempty"`
+	BeyondHorizon    bool                `json:"beyond_horizon,omitempty"` // 推算上限内库存不会用完
+	Seasonal         bool                `json:"seasonal"`                 // 历史满一年，季节指数可用
+	Seasonality      []ConsumptionSeason `json:"seasonality,omitempty"`
+	MonthlyForecast  []ConsumptionMonth  `json:"monthly_forecast"`
+	Weekly           []float64           `json:"weekly"` // 近期每周消耗，时间升序
+	Bases            []ConsumptionBase   `json:"bases"`
+}
+
+func round3(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+// weeklyTotals 以 end 为最后一天、向前 weeks 周的每周合计，时间升序
+func weeklyTotals(daily map[string]float64, end time.Time, weeks int) []float64 {
+	out := make([]float64, weeks)
+	for i := 0; i < weeks*7; i++ {
+		d := end.AddDate(0, 0, -i)
+		out[weeks-1-i/7] += daily[d.Format("2006-01-02")]
+	}
+	return out
+}
+
+// sesLevel 简单指数平滑的末期水平
+func sesLevel(series []float64, alpha float64) float64 {
+	if len(series) == 0 {
+		return 0
+	}
+	level := series[0]
+	for _, x := range series[1:] {
+		level = alpha*x + (1-alpha)*level
+	}
+	return level
+}
+
+// movingAverage 最近 window 期的平均
+func movingAverage(series []float64, window int) float64 {
+	if window > len(series) {
+		window = len(series)
+	}
+	if window <= 0 {
+		return 0
+	}
+	var sum float64
+	for _, x := range series[len(series)-window:] {
+		sum += x
+	}
+	return sum / float64(window)
+}
+
+// seasonalIndices 按自然月计算季节指数（自首次申领日起至 end）；历史不足一年时 ok 为 false
+func seasonalIndices(daily map[string]float64, first, end time.Time) ([13]float64, []ConsumptionSeason, bool) {
+	var idx [13]float64
+	if first.IsZero() || end.Sub(first).Hours()/24 < consumptionSeasonMin {
+		return idx, nil, false
+	}
+	var qty, days [13]float64
+	var total, totalDays float64
+	for d := first; !d.After(end); d = d.AddDate(0, 0, 1) {
+		q := daily[d.Format("2006-01-02")]
+		qty[d.Month()] += q
+		days[d.Month()]++
+		total += q
+		totalDays++
+	}
+	if total <= 0 {
+		return idx, nil, false
+	}
+	overall := total / totalDays
+	out := make([]ConsumptionSeason, 0, 12)
+	for m := 1; m <= 12; m++ {
+		if days[m] == 0 {
+			idx[m] = 1
+			continue
+		}
+		avg := qty[m] / days[m]
+		idx[m] = avg / overall
+		out = append(out, ConsumptionSeason{Month: m, AvgDaily: round3(avg), Index: math.Round(idx[m]*100) / 100})
+	}
+	return idx, out, true
+}
+
+// seasonFactor 相对当前月份的季节系数：预测水平反映当前季节，换算到目标月份
+func seasonFactor(idx [13]float64, seasonal bool, cur, target time.Month) float64 {
+	if !seasonal || idx[cur] <= 0 {
+		return 1
+	}
+	return idx[target] / idx[cur]
+}
+
+// ConsumptionForecast 物资消耗统计与预测：按商品（可按基地筛选）统计近期日均、周均消耗，
+// 计算季节指数，并以移动平均或指数平滑预测消耗、推算库存可用天数，便于雨季前集中采购。
+// GET 参数：
+//   - product_id、q（商品名称关键字）、base_id
+//   - lookback_days：近期统计天数（默认 182）
+//   - method=ses（默认，alpha 默认 0.3）/ ma（window 为周数，默认 4）
+//   - horizon_days：预计消耗的天数（默认 30）；months_ahead：按月预测的月数（默认 6）
+//
+// 库存为全局库存（入库 - 出库），可用天数按全部基地的预测消耗推算
+func ConsumptionForecast(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	intParam := func(name string, def, min, max int) (int, bool) {
+		s := query.Get(name)
+		if s == "" {
+			return def, true
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, false
+		}
+		return n, true
+	}
+	lookback, ok := intParam("lookback_days", consumptionLookbackDays, 7, consumptionMaxLookback)
+	if !ok {
+		http.Error(w, "lookback_days 应为 7-1095", http.StatusBadRequest)
+		return
+	}
+	horizon, ok := intParam("horizon_days", 30, 1, 365)
+	if !ok {
+		http.Error(w, "horizon_days 应为 1-365", http.StatusBadRequest)
+		return
+	}
+	monthsAhead, ok := intParam("months_ahead", 6, 0, 24)
+	if !ok {
+		http.Error(w, "months_ahead 应为 0-24", http.StatusBadRequest)
+		return
+	}
+	method := query.Get("method")
+	if method == "" {
+		method = "ses"
+	}
+	if method != "ses" && method != "ma" {
+		http.Error(w, "method 仅支持 ses / ma", http.StatusBadRequest)
+		return
+	}
+	alpha := consumptionDefaultAlpha
+	if s := query.Get("alpha"); s != "" {
+		if alpha, err = strconv.ParseFloat(s, 64); err != nil || alpha <= 0 || alpha > 1 {
+			http.Error(w, "alpha 应在 (0, 1] 之间", http.StatusBadRequest)
+			return
+		}
+	}
+	window, ok := intParam("window", consumptionDefaultMA, 1, 52)
+	if !ok {
+		http.Error(w, "window 应为 1-52（周）", http.StatusBadRequest)
+		return
+	}
+
+	// 基地范围：管理员与仓库管理员不限，其余角色限其基地
+	role := claimRole(claims)
+	var allowed []uint
+	restricted := role != "admin" && role != "warehouse_admin"
+	if restricted {
+		allowed = claimBaseIDs(claims)
+	}
+	var baseFilter uint
+	if s := query.Get("base_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "base_id 无效", http.StatusBadRequest)
+			return
+		}
+		baseFilter = uint(id)
+		if restricted && !containsUint(allowed, baseFilter) {
+			http.Error(w, "无权查看该基地", http.StatusForbidden)
+			return
+		}
+	}
+	inScope := func(baseID uint) bool {
+		if baseFilter != 0 {
+			return baseID == baseFilter
+		}
+		return !restricted || containsUint(allowed, baseID)
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	histStart := today.AddDate(-consumptionHistoryYears, 0, 0)
+	lookStart := today.AddDate(0, 0, -lookback+1)
+	weeks := (lookback + 6) / 7
+
+	// 商品筛选
+	pq := db.DB.Model(&models.Product{}).Select("id, name, base_unit")
+	if pid := query.Get("product_id"); pid != "" {
+		pq = pq.Where("id = ?", pid)
+	}
+	if kw := strings.TrimSpace(query.Get("q")); kw != "" {
+		pq = pq.Where("name LIKE ?", "%"+kw+"%")
+	}
+	var products []models.Product
+	pq.Find(&products)
+	productByID := make(map[uint]models.Product, len(products))
+	ids := make([]uint, 0, len(products))
+	for _, p := range products {
+		productByID[p.ID] = p
+		ids = append(ids, p.ID)
+	}
+	if len(ids) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"rows": []ConsumptionRow{}})
+		return
+	}
+
+	// 历史申领：按 商品+基地+日期 汇总（全部基地，供库存推算；统计时按范围筛选）
+	var rows []struct {
+		ProductID uint
+		BaseID    uint
+		Day       string
+		Qty       float64
+	}
+	db.DB.Table("material_requisitions mr").
+		Select("mr.product_id as product_id, mr.base_id as base_id, DATE_FORMAT(mr.request_date,'%Y-%m-%d') as day, COALESCE(SUM(mr.quantity_base),0) as qty").
+		Where("mr.product_id IN ? AND mr.request_date >= ? AND mr.request_date < ?", ids, histStart, today.AddDate(0, 0, 1)).
+		Group("mr.product_id, mr.base_id, day").Scan(&rows)
+
+	type productData struct {
+		scoped, all map[string]float64
+		first       time.Time
+		byBase      map[uint]float64
+	}
+	data := map[uint]*productData{}
+	for _, x := range rows {
+		pd, ok := data[x.ProductID]
+		if !ok {
+			pd = &productData{scoped: map[string]float64{}, all: map[string]float64{}, byBase: map[uint]float64{}}
+			data[x.ProductID] = pd
+		}
+		d := parseRateDay(x.Day)
+		pd.all[x.Day] += x.Qty
+		if !inScope(x.BaseID) {
+			continue
+		}
+		pd.scoped[x.Day] += x.Qty
+		if pd.first.IsZero() || d.Before(pd.first) {
+			pd.first = d
+		}
+		if !d.Before(lookStart) {
+			pd.byBase[x.BaseID] += x.Qty
+		}
+	}
+
+	// 全局库存：入库按商品名称、出库按商品 ID（与库存列表一致）
+	names := make([]string, 0, len(products))
+	for _, p := range products {
+		names = append(names, p.Name)
+	}
+	var inAgg []struct {
+		ProductName string
+		Qty         float64
+	}
+	db.DB.Table("purchase_entry_items").Select("product_name, COALESCE(SUM(quantity_base),0) as qty").
+		Where("product_name IN ?", names).Group("product_name").Scan(&inAgg)
+	inMap := map[string]float64{}
+	for _, a := range inAgg {
+		inMap[a.ProductName] = a.Qty
+	}
+	var outAgg []struct {
+		ProductID uint
+		Qty       float64
+	}
+	db.DB.Table("material_requisitions").Select("product_id, COALESCE(SUM(quantity_base),0) as qty").
+		Where("product_id IN ?", ids).Group("product_id").Scan(&outAgg)
+	outMap := map[uint]float64{}
+	for _, a := range outAgg {
+		outMap[a.ProductID] = a.Qty
+	}
+
+	baseNames := map[uint]string{}
+	var bases []models.Base
+	db.DB.Select("id, name").Find(&bases)
+	for _, b := range bases {
+		baseNames[b.ID] = b.Name
+	}
+
+	forecast := func(series []float64) float64 {
+		if method == "ma" {
+			return movingAverage(series, window)
+		}
+		return sesLevel(series, alpha)
+	}
+
+	out := make([]ConsumptionRow, 0)
+	for _, id := range ids {
+		pd := data[id]
+		if pd == nil || len(pd.scoped) == 0 {
+			continue
+		}
+		p := productByID[id]
+		row := ConsumptionRow{ProductID: id, ProductName: p.Name, Unit: p.BaseUnit, Bases: []ConsumptionBase{}}
+		stock := inMap[p.Name] - outMap[id]
+		if stock < 0 {
+			stock = 0
+		}
+		row.StockQuantity = round3(stock)
+
+		for d := lookStart; !d.After(today); d = d.AddDate(0, 0, 1) {
+			if q := pd.scoped[d.Format("2006-01-02")]; q > 0 {
+				row.LookbackQuantity += q
+				row.ActiveDays++
+			}
+		}
+		row.AvgDaily = row.LookbackQuantity / float64(lookback)
+		row.AvgWeekly = row.AvgDaily * 7
+
+		weekly := weeklyTotals(pd.scoped, today, weeks)
+		row.ForecastWeekly = forecast(weekly)
+		row.ForecastDaily = row.ForecastWeekly / 7
+		row.AllBasesDaily = forecast(weeklyTotals(pd.all, today, weeks)) / 7
+
+		idx, seasons, seasonal := seasonalIndices(pd.scoped, pd.first, today)
+		row.Seasonal, row.Seasonality = seasonal, seasons
+		for i := 1; i <= horizon; i++ {
+			row.HorizonQuantity += row.ForecastDaily * seasonFactor(idx, seasonal, today.Month(), today.AddDate(0, 0, i).Month())
+		}
+		row.MonthlyForecast = make([]ConsumptionMonth, 0, monthsAhead)
+		firstOfMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for i := 1; i <= monthsAhead; i++ {
+			m := firstOfMonth.AddDate(0, i, 0)
+			days := float64(m.AddDate(0, 1, -1).Day())
+			f := seasonFactor(idx, seasonal, today.Month(), m.Month())
+			row.MonthlyForecast = append(row.MonthlyForecast, ConsumptionMonth{Month: m.Format("2006-01"), Quantity: round3(row.ForecastDaily * days * f), Index: math.Round(f*100) / 100})
+		}
+
+		// 库存可用天数：按全部基地的预测日均消耗（含季节调整）逐日扣减；季节指数取全部基地的历史
+		if row.AllBasesDaily > 0 {
+			var allFirst time.Time
+			for day := range pd.all {
+				if d := parseRateDay(day); allFirst.IsZero() || d.Before(allFirst) {
+					allFirst = d
+				}
+			}
+			allIdx, _, allSeasonal := seasonalIndices(pd.all, allFirst, today)
+			left, cum := stock, 0.0
+			days := -1.0
+			for i := 1; i <= consumptionMaxDaysLeft; i++ {
+				f := row.AllBasesDaily * seasonFactor(allIdx, allSeasonal, today.Month(), today.AddDate(0, 0, i).Month())
+				if f > 0 && cum+f >= left {
+					days = float64(i-1) + (left-cum)/f
+					break
+				}
+				cum += f
+			}
+			if days < 0 {
+				days = consumptionMaxDaysLeft
+				row.BeyondHorizon = true
+			} else {
+				row.StockoutDate = today.AddDate(0, 0, int(math.Ceil(days))).Format("2006-01-02")
+			}
+			days = math.Round(days*10) / 10
+			row.DaysOfStockLeft = &days
+		}
+
+		for baseID, q := range pd.byBase {
+			b := ConsumptionBase{BaseID: baseID, Base: baseNames[baseID], Quantity: round3(q), AvgDaily: round3(q / float64(lookback))}
+			if row.LookbackQuantity > 0 {
+				b.Share = math.Round(q/row.LookbackQuantity*10000) / 100
+			}
+			row.Bases = append(row.Bases, b)
+		}
+		sort.Slice(row.Bases, func(i, j int) bool { return row.Bases[i].Quantity > row.Bases[j].Quantity })
+
+		for i := range weekly {
+			weekly[i] = round3(weekly[i])
+		}
+		row.Weekly = weekly
+		row.LookbackQuantity = round3(row.LookbackQuantity)
+		row.AvgDaily, row.AvgWeekly = round3(row.AvgDaily), round3(row.AvgWeekly)
+		row.ForecastDaily, row.ForecastWeekly = round3(row.ForecastDaily), round3(row.ForecastWeekly)
+		row.AllBasesDaily, row.HorizonQuantity = round3(row.AllBasesDaily), round3(row.HorizonQuantity)
+		out = append(out, row)
+	}
+	// 库存最先用完的排在前面；无消耗或推算上限内不会用完的排后
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		ai := a.DaysOfStockLeft != nil && !a.BeyondHorizon
+		bi := b.DaysOfStockLeft != nil && !b.BeyondHorizon
+		if ai != bi {
+			return ai
+		}
+		if ai && *a.DaysOfStockLeft != *b.DaysOfStockLeft {
+			return *a.DaysOfStockLeft < *b.DaysOfStockLeft
+		}
+		return a.LookbackQuantity > b.LookbackQuantity
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"as_of":         today.Format("2006-01-02"),
+		"lookback_days": lookback,
+		"horizon_days":  horizon,
+		"method":        method,
+		"rows":          out,
+	})
+}
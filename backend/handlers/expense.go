@@ -4,31 +4,45 @@ import (
 	"backend/db"
 	"backend/middleware"
 	"backend/models"
+	"backend/money"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 type ExpenseReq struct {
-	Date       string  `json:"date"`
-	CategoryID uint    `json:"category_id"` // 修改为 category_id
-	Amount     float64 `json:"amount"`
-	Currency   string  `json:"currency"`
-	Detail     string  `json:"detail"`
-	BaseID     uint    `json:"base_id"` // base_id：管理员可指定任一基地
+	Date       string       `json:"date"`
+	CategoryID uint         `json:"category_id"` // 修改为 category_id
+	Amount     money.Amount `json:"amount"`
+	Currency   string       `json:"currency"`
+	Detail     string       `json:"detail"`
+	BaseID     uint         `json:"base_id"` // base_id：管理员可指定任一基地
+	PaidBy     string       `json:"paid_by"` // company（默认）/ employee 员工垫付
+	SectionID  *uint        `json:"section_id"`
 }
 
 // 批量新增开支
 type ExpenseBatchResp struct {
-	Created []models.BaseExpense `json:"created"`
-	Failed  int                  `json:"failed"`
-	Message string               `json:"message"`
+	Created        []models.BaseExpense `json:"created"`
+	Failed         int                  `json:"failed"`
+	Message        string               `json:"message"`
+	BudgetWarnings []budgetWarning      `json:"budget_warnings,omitempty"` // 预算预警（超出硬预算的行计入 failed）
+}
+
+// expenseResp 开支记录附带预算预警
+type expenseResp struct {
+	models.BaseExpense
+	BudgetWarnings []budgetWarning `json:"budget_warnings,omitempty"`
 }
 
 func CreateExpenseBatch(w http.ResponseWriter, r *http.Request) {
@@ -66,6 +80,7 @@ func CreateExpenseBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var created []models.BaseExpense
+	var budgetWarns []budgetWarning
 	failed := 0
 
 	// 获取创建人姓名
@@ -105,7 +120,8 @@ func CreateExpenseBatch(w http.ResponseWriter, r *http.Request) {
 
 	for _, req := range items {
 		// 基本校验
-		if req.Date == "" || req.CategoryID == 0 || req.Amount <= 0 {
+		paidBy, ok := normalizePaidBy(req.PaidBy)
+		if req.Date == "" || req.CategoryID == 0 || req.Amount <= 0 || !ok {
 			failed++
 			continue
 		}
@@ -165,10 +181,15 @@ func CreateExpenseBatch(w http.ResponseWriter, r *http.Request) {
 		}
 		// 解析日期
 		t, _ := time.Parse("2006-01-02", req.Date)
+		// 已结账期间不允许新增
+		if baseID != nil && periodLockMsg(*baseID, t) != "" {
+			failed++
+			continue
+		}
 		exp := models.BaseExpense{
 			Date:       t,
 			CategoryID: req.CategoryID,
-			Amount:     req.Amount,
+			Amount:     req.Amount.RoundFor(req.Currency),
 			Currency: func() string {
 				if req.Currency != "" {
 					return req.Currency
@@ -183,12 +204,32 @@ func CreateExpenseBatch(w http.ResponseWriter, r *http.Request) {
 		}
 		if baseID != nil {
 			exp.BaseID = baseID
+			sectionID, msg := resolveSectionID(*baseID, req.SectionID, exp.CreatedBy)
+			if msg != "" {
+				failed++
+				continue
+			}
+			exp.SectionID = sectionID
+		}
+		exp.PaidBy = paidBy
+		exp.Status = initialExpenseStatus(role, exp.BaseID)
+		// 同一批次中先前的行已在事务内，预算校验会一并计入
+		warns, msg := checkExpenseBudgets(tx, &exp)
+		if msg != "" {
+			failed++
+			continue
 		}
 		if err := tx.Create(&exp).Error; err != nil {
 			failed++
 			continue
 		}
+		if err := postExpenseJournal(tx, &exp); err != nil {
+			tx.Delete(&exp)
+			failed++
+			continue
+		}
 		created = append(created, exp)
+		budgetWarns = append(budgetWarns, warns...)
 	}
 
 	if err := tx.Commit().Error; err != nil {
@@ -196,11 +237,15 @@ func CreateExpenseBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// 预加载后返回
+	dates := make([]time.Time, 0, len(created))
 	for i := range created {
 		db.DB.Preload("Base").Preload("Category").First(&created[i], created[i].ID)
+		refreshBudgetAlerts(db.DB, created[i].BaseID, created[i].CategoryID, created[i].Date)
+		dates = append(dates, created[i].Date)
 	}
+	refreshMonthly(mvExpense, dates...)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ExpenseBatchResp{Created: created, Failed: failed, Message: "ok"})
+	json.NewEncoder(w).Encode(ExpenseBatchResp{Created: created, Failed: failed, Message: "ok", BudgetWarnings: budgetWarns})
 }
 
 // UploadExpenseReceipt 接收基地开支票据上传
@@ -354,6 +399,11 @@ func CreateExpense(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "金额必须大于0", http.StatusBadRequest)
 		return
 	}
+	paidBy, ok := normalizePaidBy(req.PaidBy)
+	if !ok {
+		http.Error(w, "paid_by 仅支持 company / employee", http.StatusBadRequest)
+		return
+	}
 
 	// 验证费用类别是否存在且有效
 	var category models.ExpenseCategory
@@ -415,6 +465,10 @@ func CreateExpense(w http.ResponseWriter, r *http.Request) {
 	}
 
 	t, _ := time.Parse("2006-01-02", req.Date)
+	if msg := periodLockMsg(baseID, t); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 
 	// 获取创建人姓名
 	var creator models.User
@@ -426,7 +480,7 @@ func CreateExpense(w http.ResponseWriter, r *http.Request) {
 	expense := models.BaseExpense{
 		Date:       t,
 		CategoryID: req.CategoryID,
-		Amount:     req.Amount,
+		Amount:     req.Amount.RoundFor(req.Currency),
 		Currency: func() string {
 			if req.Currency != "" {
 				return req.Currency
@@ -443,16 +497,49 @@ func CreateExpense(w http.ResponseWriter, r *http.Request) {
 	// Only set BaseID if it's not zero (to handle optional base for admin users)
 	if baseID != 0 {
 		expense.BaseID = &baseID
+		// 分区：未指定时默认为录入人担任队长的分区
+		sectionID, msg := resolveSectionID(baseID, req.SectionID, expense.CreatedBy)
+		if msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		expense.SectionID = sectionID
 	}
+	expense.PaidBy = paidBy
+	expense.Status = initialExpenseStatus(role, expense.BaseID)
 
-	if err := db.DB.Create(&expense).Error; err != nil {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	// 预算校验：超出硬预算拒绝，其余预警随结果返回
+	warnings, msg := checkExpenseBudgets(tx, &expense)
+	if msg != "" {
+		tx.Rollback()
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	if err := tx.Create(&expense).Error; err != nil {
+		tx.Rollback()
 		http.Error(w, "创建开支记录失败", http.StatusInternalServerError)
 		return
 	}
+	if err := postExpenseJournal(tx, &expense); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
 
+	refreshBudgetAlerts(db.DB, expense.BaseID, expense.CategoryID, expense.Date)
+	refreshMonthly(mvExpense, expense.Date)
 	// 预加载关联数据
 	db.DB.Preload("Base").Preload("Category").First(&expense, expense.ID)
-	json.NewEncoder(w).Encode(expense)
+	json.NewEncoder(w).Encode(expenseResp{BaseExpense: expense, BudgetWarnings: warnings})
 }
 
 func ListExpense(w http.ResponseWriter, r *http.Request) {
@@ -462,7 +549,15 @@ func ListExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var expenses []models.BaseExpense
-	query := db.DB.Preload("Base").Preload("Category").Order("date desc")
+	query := expenseListQuery(claims, r).Preload("Base").Preload("Category").Preload("Section").Preload("Allocations.Base").Preload("Allocations.Section").Order("date desc")
+	query.Find(&expenses)
+	fillCreatorNames(expenses)
+	json.NewEncoder(w).Encode(expenses)
+}
+
+// expenseListQuery 开支列表的角色范围与筛选条件（列表与导出共用）
+func expenseListQuery(claims jwt.MapClaims, r *http.Request) *gorm.DB {
+	query := db.DB.Model(&models.BaseExpense{})
 	uid := uint(claims["uid"].(float64))
 	role := claims["role"].(string)
 	if role == "base_agent" || role == "captain" {
@@ -522,12 +617,22 @@ func ListExpense(w http.ResponseWriter, r *http.Request) {
 		// 支持通过类别名称过滤
 		var category models.ExpenseCategory
 		if err := db.DB.Where("name = ?", cat).First(&category).Error; err == nil {
-			query = query.Where("category_id = ?", category.ID)
+			query = query.Where("category_id IN ?", categoryWithDescendants(category.ID))
 		}
 	}
 	if cid := r.URL.Query().Get("category_id"); cid != "" {
-		// 支持通过类别ID过滤
-		query = query.Where("category_id = ?", cid)
+		// 支持通过类别ID过滤（含下级类别）
+		id, _ := strconv.ParseUint(cid, 10, 64)
+		query = query.Where("category_id IN ?", categoryWithDescendants(uint(id)))
+	}
+	if st := r.URL.Query().Get("status"); st != "" {
+		query = query.Where("status = ?", st)
+	}
+	if pb := r.URL.Query().Get("paid_by"); pb != "" {
+		query = query.Where("paid_by = ?", pb)
+	}
+	if sid := r.URL.Query().Get("section_id"); sid != "" {
+		query = query.Where("section_id = ?", sid)
 	}
 	if ym := r.URL.Query().Get("month"); ym != "" {
 		// 修复日期范围查询 - 使用正确的月份结束日期
@@ -537,9 +642,11 @@ func ListExpense(w http.ResponseWriter, r *http.Request) {
 		endDate := nextMonth.Format("2006-01-02")
 		query = query.Where("date >= ? AND date < ?", startDate, endDate)
 	}
-	query.Find(&expenses)
+	return query
+}
 
-	// 补全CreatorName（兼容历史数据为空的记录）
+// fillCreatorNames 补全CreatorName（兼容历史数据为空的记录）
+func fillCreatorNames(expenses []models.BaseExpense) {
 	missingIDs := make(map[uint]struct{})
 	for _, e := range expenses {
 		if e.CreatedBy != 0 && (e.CreatorName == "" || e.CreatorName == "-") {
@@ -566,7 +673,6 @@ func ListExpense(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	json.NewEncoder(w).Encode(expenses)
 }
 
 func UpdateExpense(w http.ResponseWriter, r *http.Request) {
@@ -588,9 +694,33 @@ func UpdateExpense(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "无权修改", http.StatusForbidden)
 		return
 	}
+	if item.Status == models.ExpenseStatusReimbursed {
+		http.Error(w, "已报销的开支不能修改", http.StatusConflict)
+		return
+	}
 	var req ExpenseReq
 	json.NewDecoder(r.Body).Decode(&req)
+	paidBy := item.PaidBy
+	if req.PaidBy != "" {
+		p, ok := normalizePaidBy(req.PaidBy)
+		if !ok {
+			http.Error(w, "paid_by 仅支持 company / employee", http.StatusBadRequest)
+			return
+		}
+		paidBy = p
+	}
+	// 被驳回的开支修改后重新提交；非管理员修改已审批的开支需重新审批
+	status := item.Status
+	if status == models.ExpenseStatusRejected || (status == models.ExpenseStatusApproved && role != "admin") {
+		status = initialExpenseStatus(role, item.BaseID)
+	}
 	t, _ := time.Parse("2006-01-02", req.Date)
+	oldDate := item.Date
+	// 原日期与新日期所在期间均须未结账
+	if msg := periodLockMsg(optionalBaseID(item.BaseID), item.Date, t); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 
 	// 验证费用类别（如果提供了新的类别）
 	if req.CategoryID != 0 && req.CategoryID != item.CategoryID {
@@ -602,29 +732,88 @@ func UpdateExpense(w http.ResponseWriter, r *http.Request) {
 		item.CategoryID = req.CategoryID
 	}
 
-	db.DB.Model(&item).Updates(models.BaseExpense{
+	// 分区：传入 section_id 时修改（0 表示取消分区）
+	sectionID := item.SectionID
+	if req.SectionID != nil {
+		var msg string
+		if sectionID, msg = resolveSectionID(optionalBaseID(item.BaseID), req.SectionID, 0); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	cur := item.Currency
+	if req.Currency != "" {
+		cur = req.Currency
+	}
+	// 按修改后的金额、日期、类别做预算校验（排除原记录）
+	next := item
+	next.Currency = cur
+	if !t.IsZero() {
+		next.Date = t
+	}
+	if req.Amount != 0 {
+		next.Amount = req.Amount.RoundFor(cur)
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	warnings, msg := checkExpenseBudgets(tx, &next)
+	if msg != "" {
+		tx.Rollback()
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	// 币种变更时旧快照汇率失效，记账时按单据日期重新取汇率
+	if cur != item.Currency {
+		tx.Model(&item).UpdateColumn("rate_to_cny", 0)
+	}
+	tx.Model(&item).Updates(models.BaseExpense{
 		Date:       t,
 		CategoryID: req.CategoryID,
-		Amount:     req.Amount,
-		Currency: func() string {
-			if req.Currency != "" {
-				return req.Currency
-			}
-			return item.Currency
-		}(),
-		Detail:    req.Detail,
-		UpdatedAt: time.Now(),
+		Amount:     req.Amount.RoundFor(cur),
+		Currency:   cur,
+		Detail:     req.Detail,
+		UpdatedAt:  time.Now(),
+		PaidBy:     paidBy,
+		Status:     status,
 	})
-	db.DB.Preload("Base").Preload("Category").First(&item, eid)
-	json.NewEncoder(w).Encode(item)
+	if status == models.ExpenseStatusSubmitted {
+		tx.Model(&item).Updates(map[string]interface{}{"approved_by": nil, "approved_at": nil, "rejected_by": nil, "rejected_at": nil, "reject_reason": ""})
+	}
+	tx.Model(&item).UpdateColumn("section_id", sectionID)
+	tx.First(&item, eid)
+	if err := reallocateExpense(tx, &item); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := postExpenseJournal(tx, &item); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	refreshExpenseBudgetAlerts(db.DB, &item)
+	refreshMonthly(mvExpense, oldDate, item.Date)
+	db.DB.Preload("Base").Preload("Category").Preload("Allocations").First(&item, eid)
+	json.NewEncoder(w).Encode(expenseResp{BaseExpense: item, BudgetWarnings: warnings})
 }
 
 type ExpenseStat struct {
-	Base     string  `json:"base"`
-	Category string  `json:"category"`
-	Month    string  `json:"month"`
-	Currency string  `json:"currency"`
-	Total    float64 `json:"total"`
+	Base       string       `json:"base"`
+	Category   string       `json:"category"`
+	CategoryID uint         `json:"category_id"`
+	ParentID   *uint        `json:"parent_id,omitempty"`
+	Month      string       `json:"month"`
+	Currency   string       `json:"currency"`
+	Total      money.Amount `json:"total"` // 含全部下级类别
+	Own        money.Amount `json:"own"`   // 仅本类别
 }
 
 func StatExpense(w http.ResponseWriter, r *http.Request) {
@@ -643,18 +832,17 @@ func StatExpense(w http.ResponseWriter, r *http.Request) {
 	baseCode := r.URL.Query().Get("base_code")
 	var result []ExpenseStat
 
-	// 修复日期范围查询 - 使用正确的月份结束日期
-	// 解析输入月份并计算下个月第一天
-	t, _ := time.Parse("2006-01", month)
-	nextMonth := t.AddDate(0, 1, 0)
-	startDate := month + "-01"
-	endDate := nextMonth.Format("2006-01-02")
-
-	group := db.DB.Model(&models.BaseExpense{}).
-		Select("bases.name as base, expense_categories.name as category, DATE_FORMAT(base_expenses.date, '%Y-%m') as month, base_expenses.currency as currency, SUM(base_expenses.amount) as total").
-		Joins("LEFT JOIN bases ON bases.id = base_expenses.base_id").
-		Joins("LEFT JOIN expense_categories ON expense_categories.id = base_expenses.category_id").
-		Where("base_expenses.date >= ? AND base_expenses.date < ?", startDate, endDate)
+	if _, _, err := monthRange(month); err != nil {
+		http.Error(w, "month参数错误", http.StatusBadRequest)
+		return
+	}
+
+	// 读取月度汇总表（已按分摊计入各基地，仅含已计入费用的状态）
+	group := db.DB.Table("mv_base_expense_month m").
+		Select("bases.name as base, m.category_id as category_id, expense_categories.name as category, m.month as month, m.currency as currency, SUM(m.total_amount) as total").
+		Joins("LEFT JOIN bases ON bases.id = m.base_id").
+		Joins("LEFT JOIN expense_categories ON expense_categories.id = m.category_id").
+		Where("m.month = ?", month)
 	if role := claims["role"].(string); role == "base_agent" || role == "captain" {
 		var codes []string
 		if v, ok := claims["bases"]; ok && v != nil {
@@ -683,9 +871,52 @@ func StatExpense(w http.ResponseWriter, r *http.Request) {
 			group = group.Where("bases.name = ?", base)
 		}
 	}
-	group = group.Group("bases.name, expense_categories.name, month, base_expenses.currency").Order("bases.name, expense_categories.name")
+	group = group.Group("bases.name, m.category_id, expense_categories.name, m.month, m.currency").Order("bases.name, expense_categories.name")
 	group.Scan(&result)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(rollupExpenseStats(result))
+}
+
+// rollupExpenseStats 将各类别金额逐级累加到上级类别：Own 为本类别金额，Total 含全部下级；
+// 仅有下级开支的上级类别也会补充一行
+func rollupExpenseStats(rows []ExpenseStat) []ExpenseStat {
+	var cats []models.ExpenseCategory
+	db.DB.Select("id, name, parent_id").Find(&cats)
+	names := make(map[uint]string, len(cats))
+	parents := make(map[uint]*uint, len(cats))
+	for _, c := range cats {
+		names[c.ID] = c.Name
+		parents[c.ID] = c.ParentID
+	}
+	tree := loadCategoryTree()
+	type key struct {
+		base, month, currency string
+		cat                   uint
+	}
+	idx := map[key]int{}
+	out := make([]ExpenseStat, 0, len(rows))
+	at := func(k key) *ExpenseStat {
+		i, ok := idx[k]
+		if !ok {
+			i = len(out)
+			idx[k] = i
+			out = append(out, ExpenseStat{Base: k.base, Category: names[k.cat], CategoryID: k.cat, ParentID: parents[k.cat], Month: k.month, Currency: k.currency})
+		}
+		return &out[i]
+	}
+	for _, r0 := range rows {
+		self := at(key{r0.Base, r0.Month, r0.Currency, r0.CategoryID})
+		self.Own += r0.Total
+		for _, a := range tree.Ancestors(r0.CategoryID) {
+			at(key{r0.Base, r0.Month, r0.Currency, a}).Total += r0.Total
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Base != out[j].Base {
+			return out[i].Base < out[j].Base
+		}
+		return out[i].Category < out[j].Category
+	})
+	return out
 }
 
 // 删除单个费用记录
@@ -710,8 +941,40 @@ func DeleteExpense(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "无权删除", http.StatusForbidden)
 		return
 	}
+	if item.Status == models.ExpenseStatusReimbursed {
+		http.Error(w, "已报销的开支不能删除", http.StatusConflict)
+		return
+	}
+	if msg := periodLockMsg(optionalBaseID(item.BaseID), item.Date); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 
-	db.DB.Delete(&item)
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Delete(&item).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Where("expense_id = ?", item.ID).Delete(&models.ExpenseAllocation{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	if err := removeJournal(tx, models.JournalSourceExpense, item.ID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	refreshMonthly(mvExpense, item.Date)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -760,13 +1023,50 @@ func BatchDeleteExpense(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "没有找到可删除的记录", http.StatusNotFound)
 		return
 	}
+	for _, it := range items {
+		if msg := periodLockMsg(optionalBaseID(it.BaseID), it.Date); msg != "" {
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+		if it.Status == models.ExpenseStatusReimbursed {
+			http.Error(w, "已报销的开支不能删除", http.StatusConflict)
+			return
+		}
+	}
 
-	// 执行批量删除
-	result := db.DB.Delete(&items)
+	// 执行批量删除（连同自动凭证）
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	result := tx.Delete(&items)
 	if result.Error != nil {
+		tx.Rollback()
 		http.Error(w, "删除失败: "+result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
+	ids := make([]uint, 0, len(items))
+	dates := make([]time.Time, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.ID)
+		dates = append(dates, it.Date)
+	}
+	if err := tx.Where("expense_id IN ?", ids).Delete(&models.ExpenseAllocation{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	if err := removeJournal(tx, models.JournalSourceExpense, ids...); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	refreshMonthly(mvExpense, dates...)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
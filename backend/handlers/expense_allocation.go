@@ -0,0 +1,553 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// allocatedExpensesSQL 按分摊行展开的开支：有分摊行的开支每行一条（base_id、section_id、amount 取分摊值），
+// 否则为开支本身（含其所属分区）；id 仍为开支ID。统计分析以此替代 base_expenses 表，使共享费用按分摊计入各基地
+const allocatedExpensesSQL = "(SELECT x.id, COALESCE(ea.base_id, x.base_id) AS base_id, CASE WHEN ea.id IS NULL THEN x.section_id ELSE ea.section_id END AS section_id, " +
+	"x.category_id, x.date, x.currency, x.status, x.paid_by, x.created_by, COALESCE(ea.amount, x.amount) AS amount " +
+	"FROM base_expenses x LEFT JOIN expense_allocations ea ON ea.expense_id = x.id)"
+
+// allocatedExpenses 以 alias 为别名的分摊后开支（用于 Table）
+func allocatedExpenses(alias string) string {
+	return allocatedExpensesSQL + " " + alias
+}
+
+// splitByPercent 按百分比拆分金额：各行按币种取整，尾差计入最后一行，保证合计等于 total
+func splitByPercent(total money.Amount, currency string, percents []float64) []money.Amount {
+	out := make([]money.Amount, len(percents))
+	var used money.Amount
+	for i, p := range percents {
+		if i == len(percents)-1 {
+			out[i] = total - used
+			break
+		}
+		out[i] = total.Percent(p).RoundFor(currency)
+		used += out[i]
+	}
+	return out
+}
+
+// expenseShare 开支计入某基地的金额
+type expenseShare struct {
+	BaseID uint
+	Amount money.Amount
+}
+
+// expenseShares 开支按分摊计入各基地的金额；exp.Allocations 为 nil 时读取已保存的分摊行，
+// 并按比例重算到当前金额（用于修改金额后的预算校验）
+func expenseShares(q *gorm.DB, exp *models.BaseExpense) []expenseShare {
+	allocs := exp.Allocations
+	if allocs == nil && exp.ID != 0 {
+		q.Where("expense_id = ?", exp.ID).Order("id").Find(&allocs)
+	}
+	if len(allocs) == 0 {
+		if exp.BaseID == nil || *exp.BaseID == 0 {
+			return nil
+		}
+		return []expenseShare{{BaseID: *exp.BaseID, Amount: exp.Amount}}
+	}
+	percents := make([]float64, len(allocs))
+	for i, a := range allocs {
+		percents[i] = a.Percent
+	}
+	amounts := splitByPercent(exp.Amount, exp.Currency, percents)
+	out := make([]expenseShare, 0, len(allocs))
+	for i, a := range allocs {
+		// 同一基地的多个分区合并校验
+		merged := false
+		for j := range out {
+			if out[j].BaseID == a.BaseID {
+				out[j].Amount += amounts[i]
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			out = append(out, expenseShare{BaseID: a.BaseID, Amount: amounts[i]})
+		}
+	}
+	return out
+}
+
+// reallocateExpense 开支金额或币种变更后按已保存的比例重算分摊金额
+func reallocateExpense(tx *gorm.DB, exp *models.BaseExpense) error {
+	var allocs []models.ExpenseAllocation
+	if err := tx.Where("expense_id = ?", exp.ID).Order("id").Find(&allocs).Error; err != nil {
+		return err
+	}
+	if len(allocs) == 0 {
+		return nil
+	}
+	percents := make([]float64, len(allocs))
+	for i, a := range allocs {
+		percents[i] = a.Percent
+	}
+	for i, amt := range splitByPercent(exp.Amount, exp.Currency, percents) {
+		if allocs[i].Amount == amt {
+			continue
+		}
+		if err := tx.Model(&allocs[i]).UpdateColumn("amount", amt).Error; err != nil {
+			return fmt.Errorf("重算分摊失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// refreshExpenseBudgetAlerts 重新评估开支所属基地及各分摊基地的预算预警
+func refreshExpenseBudgetAlerts(q *gorm.DB, exp *models.BaseExpense, extraBaseIDs ...uint) {
+	seen := map[uint]bool{}
+	ids := append([]uint{optionalBaseID(exp.BaseID)}, extraBaseIDs...)
+	var allocBases []uint
+	q.Model(&models.ExpenseAllocation{}).Where("expense_id = ?", exp.ID).Pluck("base_id", &allocBases)
+	for _, id := range append(ids, allocBases...) {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		bid := id
+		refreshBudgetAlerts(q, &bid, exp.CategoryID, exp.Date)
+	}
+}
+
+type allocationLineReq struct {
+	BaseID    uint          `json:"base_id"`
+	SectionID *uint         `json:"section_id"`
+	Percent   *float64      `json:"percent"`
+	Amount    *money.Amount `json:"amount"`
+	Weight    float64       `json:"weight"` // 仅用于分摊规则
+}
+
+// validateAllocationTargets 校验分摊行的基地、分区（分区须属于该基地），同一基地+分区不得重复
+func validateAllocationTargets(lines []allocationLineReq) string {
+	seen := map[string]bool{}
+	for i := range lines {
+		l := &lines[i]
+		if l.SectionID != nil && *l.SectionID == 0 {
+			l.SectionID = nil
+		}
+		if l.BaseID == 0 {
+			return "分摊行必须指定基地"
+		}
+		var base models.Base
+		if err := db.DB.Select("id").First(&base, l.BaseID).Error; err != nil {
+			return fmt.Sprintf("基地 %d 不存在", l.BaseID)
+		}
+		key := strconv.FormatUint(uint64(l.BaseID), 10) + "-"
+		if l.SectionID != nil {
+			var sec models.BaseSection
+			if err := db.DB.Select("id, base_id").First(&sec, *l.SectionID).Error; err != nil {
+				return fmt.Sprintf("分区 %d 不存在", *l.SectionID)
+			}
+			if sec.BaseID != l.BaseID {
+				return fmt.Sprintf("分区 %d 不属于基地 %d", *l.SectionID, l.BaseID)
+			}
+			key += strconv.FormatUint(uint64(*l.SectionID), 10)
+		}
+		if seen[key] {
+			return "同一基地/分区不能重复分摊"
+		}
+		seen[key] = true
+	}
+	return ""
+}
+
+// buildAllocations 由分摊行（全部为比例或全部为金额）生成分摊记录，合计须等于开支金额
+func buildAllocations(exp *models.BaseExpense, lines []allocationLineReq) ([]models.ExpenseAllocation, string) {
+	if exp.Amount <= 0 {
+		return nil, "开支金额为0，无法分摊"
+	}
+	byPercent := lines[0].Percent != nil
+	for _, l := range lines {
+		if (l.Percent != nil) != byPercent || (l.Amount != nil) == byPercent {
+			return nil, "分摊行须全部按比例（percent）或全部按金额（amount）填写"
+		}
+	}
+	out := make([]models.ExpenseAllocation, len(lines))
+	if byPercent {
+		percents := make([]float64, len(lines))
+		sum := 0.0
+		for i, l := range lines {
+			if *l.Percent <= 0 {
+				return nil, "分摊比例必须大于0"
+			}
+			percents[i] = *l.Percent
+			sum += *l.Percent
+		}
+		if math.Abs(sum-100) > 0.0001 {
+			return nil, fmt.Sprintf("分摊比例合计应为100%%，当前为 %.4f%%", sum)
+		}
+		for i, amt := range splitByPercent(exp.Amount, exp.Currency, percents) {
+			out[i] = models.ExpenseAllocation{ExpenseID: exp.ID, BaseID: lines[i].BaseID, SectionID: lines[i].SectionID, Percent: percents[i], Amount: amt}
+		}
+		return out, ""
+	}
+	var sum money.Amount
+	for i, l := range lines {
+		amt := l.Amount.RoundFor(exp.Currency)
+		if amt <= 0 {
+			return nil, "分摊金额必须大于0"
+		}
+		sum += amt
+		p := math.Round(amt.Float64()/exp.Amount.Float64()*100*1e6) / 1e6
+		out[i] = models.ExpenseAllocation{ExpenseID: exp.ID, BaseID: l.BaseID, SectionID: l.SectionID, Percent: p, Amount: amt}
+	}
+	if sum != exp.Amount {
+		return nil, fmt.Sprintf("分摊金额合计 %s 与开支金额 %s 不一致", sum.StringFixed(money.Decimals(exp.Currency)), exp.Amount.StringFixed(money.Decimals(exp.Currency)))
+	}
+	return out, ""
+}
+
+// ruleLines 将分摊规则的权重换算为比例行
+func ruleLines(rule *models.AllocationRule) []allocationLineReq {
+	total := 0.0
+	for _, l := range rule.Lines {
+		total += l.Weight
+	}
+	out := make([]allocationLineReq, 0, len(rule.Lines))
+	for _, l := range rule.Lines {
+		p := l.Weight / total * 100
+		out = append(out, allocationLineReq{BaseID: l.BaseID, SectionID: l.SectionID, Percent: &p})
+	}
+	return out
+}
+
+// GetExpenseAllocation 查看开支的分摊行，参数 expense_id
+func GetExpenseAllocation(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	eid, _ := strconv.ParseUint(r.URL.Query().Get("expense_id"), 10, 64)
+	var exp models.BaseExpense
+	if err := db.DB.First(&exp, eid).Error; err != nil {
+		http.Error(w, "数据不存在", http.StatusNotFound)
+		return
+	}
+	if claimRole(claims) != "admin" && (exp.BaseID == nil || !containsUint(claimBaseIDs(claims), *exp.BaseID)) {
+		http.Error(w, "无权查看", http.StatusForbidden)
+		return
+	}
+	var rows []models.ExpenseAllocation
+	db.DB.Preload("Base").Preload("Section").Where("expense_id = ?", exp.ID).Order("id").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// SetExpenseAllocation 设置开支分摊（整体替换），参数 expense_id
+// 请求体：{"rule_id": 1} 按分摊规则；或 {"lines": [{"base_id":1,"section_id":2,"percent":40}, ...]}，
+// 行内使用 percent 或 amount（开支原币）；rule_id 与 lines 均为空表示取消分摊
+func SetExpenseAllocation(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	eid, _ := strconv.ParseUint(r.URL.Query().Get("expense_id"), 10, 64)
+	var exp models.BaseExpense
+	if err := db.DB.First(&exp, eid).Error; err != nil {
+		http.Error(w, "数据不存在", http.StatusNotFound)
+		return
+	}
+	role := claimRole(claims)
+	if !(role == "admin" || ((role == "base_agent" || role == "captain") && exp.CreatedBy == claimUserID(claims))) {
+		http.Error(w, "无权修改", http.StatusForbidden)
+		return
+	}
+	var body struct {
+		RuleID uint                `json:"rule_id"`
+		Lines  []allocationLineReq `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	lines := body.Lines
+	if body.RuleID != 0 {
+		var rule models.AllocationRule
+		if err := db.DB.Preload("Lines").First(&rule, body.RuleID).Error; err != nil {
+			http.Error(w, "分摊规则不存在", http.StatusBadRequest)
+			return
+		}
+		if rule.Status != "active" {
+			http.Error(w, "分摊规则已停用", http.StatusBadRequest)
+			return
+		}
+		lines = ruleLines(&rule)
+	}
+	if msg := validateAllocationTargets(lines); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	allocs := []models.ExpenseAllocation{}
+	if len(lines) > 0 {
+		var msg string
+		if allocs, msg = buildAllocations(&exp, lines); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 原分摊基地与新分摊基地所在期间均须未结账
+	var oldBases []uint
+	db.DB.Model(&models.ExpenseAllocation{}).Where("expense_id = ?", exp.ID).Pluck("base_id", &oldBases)
+	affected := append([]uint{optionalBaseID(exp.BaseID)}, oldBases...)
+	for _, a := range allocs {
+		affected = append(affected, a.BaseID)
+	}
+	for _, bid := range affected {
+		if msg := periodLockMsg(bid, exp.Date); msg != "" {
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	var warnings []budgetWarning
+	if exp.Counted() {
+		next := exp
+		next.Allocations = allocs
+		var msg string
+		if warnings, msg = checkExpenseBudgets(tx, &next); msg != "" {
+			tx.Rollback()
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+	}
+	if err := tx.Where("expense_id = ?", exp.ID).Delete(&models.ExpenseAllocation{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存分摊失败", http.StatusInternalServerError)
+		return
+	}
+	for i := range allocs {
+		if err := tx.Create(&allocs[i]).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "保存分摊失败", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	refreshExpenseBudgetAlerts(db.DB, &exp, oldBases...)
+	refreshMonthly(mvExpense, exp.Date)
+
+	var rows []models.ExpenseAllocation
+	db.DB.Preload("Base").Preload("Section").Where("expense_id = ?", exp.ID).Order("id").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"allocations":     rows,
+		"budget_warnings": warnings,
+	})
+}
+
+type allocationRuleReq struct {
+	Name   string              `json:"name"`
+	Basis  string              `json:"basis"`
+	Status string              `json:"status"`
+	Note   string              `json:"note"`
+	Lines  []allocationLineReq `json:"lines"`
+}
+
+// validateAllocationRule 校验分摊规则参数，写入 rule（不含行）；id 为修改时的规则ID（新增为 0）
+func validateAllocationRule(req *allocationRuleReq, id uint, rule *models.AllocationRule) string {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "规则名称不能为空"
+	}
+	var cnt int64
+	db.DB.Model(&models.AllocationRule{}).Where("name = ? AND id <> ?", name, id).Count(&cnt)
+	if cnt > 0 {
+		return "规则名称已存在"
+	}
+	basis := strings.ToLower(strings.TrimSpace(req.Basis))
+	switch basis {
+	case "":
+		basis = "custom"
+	case "headcount", "area", "custom":
+	default:
+		return "basis 仅支持 headcount / area / custom"
+	}
+	status := strings.TrimSpace(req.Status)
+	if status == "" {
+		status = "active"
+	}
+	if status != "active" && status != "inactive" {
+		return "status 仅支持 active / inactive"
+	}
+	if len(req.Lines) < 2 {
+		return "分摊规则至少需要两行"
+	}
+	for _, l := range req.Lines {
+		if l.Weight <= 0 {
+			return "分摊权重必须大于0"
+		}
+	}
+	if msg := validateAllocationTargets(req.Lines); msg != "" {
+		return msg
+	}
+	rule.Name = name
+	rule.Basis = basis
+	rule.Status = status
+	rule.Note = req.Note
+	return ""
+}
+
+// saveAllocationRuleLines 整体替换规则行
+func saveAllocationRuleLines(tx *gorm.DB, ruleID uint, lines []allocationLineReq) error {
+	if err := tx.Where("rule_id = ?", ruleID).Delete(&models.AllocationRuleLine{}).Error; err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if err := tx.Create(&models.AllocationRuleLine{RuleID: ruleID, BaseID: l.BaseID, SectionID: l.SectionID, Weight: l.Weight}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAllocationRules 分摊规则列表，参数 status
+func ListAllocationRules(w http.ResponseWriter, r *http.Request) {
+	q := db.DB.Preload("Lines.Base").Preload("Lines.Section").Order("name")
+	if st := r.URL.Query().Get("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	var rows []models.AllocationRule
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// CreateAllocationRule 新增分摊规则（按人数、面积等权重）
+func CreateAllocationRule(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var req allocationRuleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	rule := models.AllocationRule{CreatedBy: claimUserID(claims)}
+	if msg := validateAllocationRule(&req, 0, &rule); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Omit("Lines").Create(&rule).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存失败", http.StatusInternalServerError)
+		return
+	}
+	if err := saveAllocationRuleLines(tx, rule.ID, req.Lines); err != nil {
+		tx.Rollback()
+		http.Error(w, "保存失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.Preload("Lines.Base").Preload("Lines.Section").First(&rule, rule.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// UpdateAllocationRule 修改分摊规则（整体替换规则行），参数 id；已分摊的开支不受影响
+func UpdateAllocationRule(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var rule models.AllocationRule
+	if err := db.DB.First(&rule, id).Error; err != nil {
+		http.Error(w, "分摊规则不存在", http.StatusNotFound)
+		return
+	}
+	var req allocationRuleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if msg := validateAllocationRule(&req, rule.ID, &rule); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	rule.UpdatedAt = time.Now()
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Omit("Lines").Save(&rule).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存失败", http.StatusInternalServerError)
+		return
+	}
+	if err := saveAllocationRuleLines(tx, rule.ID, req.Lines); err != nil {
+		tx.Rollback()
+		http.Error(w, "保存失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.Preload("Lines.Base").Preload("Lines.Section").First(&rule, rule.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// DeleteAllocationRule 删除分摊规则，参数 id；已按规则分摊的开支保留其分摊行
+func DeleteAllocationRule(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Where("rule_id = ?", id).Delete(&models.AllocationRuleLine{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	res := tx.Delete(&models.AllocationRule{}, id)
+	if res.Error != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		http.Error(w, "分摊规则不存在", http.StatusNotFound)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "删除成功"})
+}
@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// normalizePaidBy 规范化付款方（空值为公司支付）
+func normalizePaidBy(s string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", models.ExpensePaidByCompany:
+		return models.ExpensePaidByCompany, true
+	case models.ExpensePaidByEmployee:
+		return models.ExpensePaidByEmployee, true
+	}
+	return "", false
+}
+
+// baseHasApprovers 基地是否配置了开支审批人
+func baseHasApprovers(baseID uint) bool {
+	var cnt int64
+	db.DB.Model(&models.ExpenseApprover{}).Where("base_id = ?", baseID).Count(&cnt)
+	return cnt > 0
+}
+
+// initialExpenseStatus 新录入开支的状态：管理员录入或基地未配置审批人时直接通过，否则待审批
+func initialExpenseStatus(role string, baseID *uint) string {
+	if role == "admin" || baseID == nil || !baseHasApprovers(*baseID) {
+		return models.ExpenseStatusApproved
+	}
+	return models.ExpenseStatusSubmitted
+}
+
+// canApproveExpense 管理员可审批任意基地；其他用户须为该基地的审批人
+func canApproveExpense(claims jwt.MapClaims, baseID *uint) bool {
+	if claimRole(claims) == "admin" {
+		return true
+	}
+	if baseID == nil {
+		return false
+	}
+	var cnt int64
+	db.DB.Model(&models.ExpenseApprover{}).Where("base_id = ? AND user_id = ?", *baseID, claimUserID(claims)).Count(&cnt)
+	return cnt > 0
+}
+
+// ListExpenseApprovers 开支审批人列表，参数 base_id
+func ListExpenseApprovers(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Preload("User").Order("base_id, id")
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	var rows []models.ExpenseApprover
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// SetExpenseApprovers 设置某基地的开支审批人（整体替换，user_ids 为空表示取消审批）
+func SetExpenseApprovers(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权限", http.StatusForbidden)
+		return
+	}
+	var body struct {
+		BaseID  uint   `json:"base_id"`
+		UserIDs []uint `json:"user_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.BaseID == 0 {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	var base models.Base
+	if err := db.DB.First(&base, body.BaseID).Error; err != nil {
+		http.Error(w, "指定的基地不存在", http.StatusBadRequest)
+		return
+	}
+	if len(body.UserIDs) > 0 {
+		var cnt int64
+		db.DB.Model(&models.User{}).Where("id IN ?", body.UserIDs).Count(&cnt)
+		if int(cnt) != len(body.UserIDs) {
+			http.Error(w, "存在无效的用户", http.StatusBadRequest)
+			return
+		}
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Where("base_id = ?", body.BaseID).Delete(&models.ExpenseApprover{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存审批人失败", http.StatusInternalServerError)
+		return
+	}
+	for _, uid := range body.UserIDs {
+		if err := tx.Create(&models.ExpenseApprover{BaseID: body.BaseID, UserID: uid}).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "保存审批人失败", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	var rows []models.ExpenseApprover
+	db.DB.Preload("User").Where("base_id = ?", body.BaseID).Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// ExpenseApprovalQueue 当前用户可审批的待审批开支
+func ExpenseApprovalQueue(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Preload("Base").Preload("Category").
+		Where("status = ?", models.ExpenseStatusSubmitted).Order("date asc, id asc")
+	if claimRole(claims) != "admin" {
+		var baseIDs []uint
+		db.DB.Model(&models.ExpenseApprover{}).Where("user_id = ?", claimUserID(claims)).Pluck("base_id", &baseIDs)
+		if len(baseIDs) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", baseIDs)
+		}
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	var rows []models.BaseExpense
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+type expenseDecisionReq struct {
+	IDs    []uint `json:"ids"`
+	Reason string `json:"reason"`
+}
+
+// loadSubmittedExpenses 在事务内读取并锁定待审批开支，校验审批权限（不能审批本人提交的开支，管理员除外）
+func loadSubmittedExpenses(tx *gorm.DB, claims jwt.MapClaims, ids []uint) ([]models.BaseExpense, string, int) {
+	if len(ids) == 0 {
+		return nil, "未选择开支记录", http.StatusBadRequest
+	}
+	var items []models.BaseExpense
+	tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Find(&items)
+	if len(items) != len(ids) {
+		return nil, "部分开支记录不存在", http.StatusNotFound
+	}
+	uid := claimUserID(claims)
+	for _, it := range items {
+		if it.Status != models.ExpenseStatusSubmitted {
+			return nil, fmt.Sprintf("开支 %d 不是待审批状态", it.ID), http.StatusConflict
+		}
+		if !canApproveExpense(claims, it.BaseID) {
+			return nil, "无权审批该基地的开支", http.StatusForbidden
+		}
+		if claimRole(claims) != "admin" && it.CreatedBy == uid {
+			return nil, "不能审批本人提交的开支", http.StatusForbidden
+		}
+	}
+	return items, "", 0
+}
+
+// ApproveExpenses 审批通过开支（批量，全部成功或全部失败）：通过后计入费用并生成凭证；超出硬预算时拒绝
+func ApproveExpenses(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var req expenseDecisionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	items, msg, code := loadSubmittedExpenses(tx, claims, req.IDs)
+	if msg != "" {
+		tx.Rollback()
+		http.Error(w, msg, code)
+		return
+	}
+	for _, it := range items {
+		if msg := periodLockMsg(optionalBaseID(it.BaseID), it.Date); msg != "" {
+			tx.Rollback()
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+	}
+	uid := claimUserID(claims)
+	now := time.Now()
+	var warnings []budgetWarning
+	for i := range items {
+		it := &items[i]
+		// 同批次先审批的开支已在事务内计入，预算校验一并考虑
+		warns, msg := checkExpenseBudgets(tx, it)
+		if msg != "" {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("开支 %d：%s", it.ID, msg), http.StatusConflict)
+			return
+		}
+		warnings = append(warnings, warns...)
+		it.Status = models.ExpenseStatusApproved
+		it.ApprovedBy = &uid
+		it.ApprovedAt = &now
+		res := tx.Model(&models.BaseExpense{}).Where("id = ? AND status = ?", it.ID, models.ExpenseStatusSubmitted).Updates(map[string]interface{}{
+			"status": it.Status, "approved_by": uid, "approved_at": now, "reject_reason": "",
+		})
+		if res.Error != nil {
+			tx.Rollback()
+			http.Error(w, "审批失败", http.StatusInternalServerError)
+			return
+		}
+		if res.RowsAffected == 0 {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("开支 %d 已被处理", it.ID), http.StatusConflict)
+			return
+		}
+		if err := postExpenseJournal(tx, it); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	dates := make([]time.Time, 0, len(items))
+	for i := range items {
+		refreshExpenseBudgetAlerts(db.DB, &items[i])
+		dates = append(dates, items[i].Date)
+	}
+	refreshMonthly(mvExpense, dates...)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"approved":        len(items),
+		"budget_warnings": warnings,
+	})
+}
+
+// RejectExpenses 驳回待审批开支（须填写原因）；驳回后提交人修改即重新提交
+func RejectExpenses(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var req expenseDecisionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "请填写驳回原因", http.StatusBadRequest)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	items, msg, code := loadSubmittedExpenses(tx, claims, req.IDs)
+	if msg != "" {
+		tx.Rollback()
+		http.Error(w, msg, code)
+		return
+	}
+	ids := make([]uint, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.ID)
+	}
+	res := tx.Model(&models.BaseExpense{}).Where("id IN ? AND status = ?", ids, models.ExpenseStatusSubmitted).Updates(map[string]interface{}{
+		"status": models.ExpenseStatusRejected, "rejected_by": claimUserID(claims), "rejected_at": time.Now(),
+		"reject_reason": strings.TrimSpace(req.Reason),
+	})
+	if res.Error != nil {
+		tx.Rollback()
+		http.Error(w, "驳回失败", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected != int64(len(ids)) {
+		tx.Rollback()
+		http.Error(w, "部分开支已被处理，请刷新后重试", http.StatusConflict)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"rejected": len(ids)})
+}
+
+type reimbursementReq struct {
+	ExpenseIDs      []uint `json:"expense_ids"`
+	PaymentDate     string `json:"payment_date"`
+	PaymentMethod   string `json:"payment_method"`
+	ReferenceNumber string `json:"reference_number"`
+	Notes           string `json:"notes"`
+}
+
+// CreateReimbursement 报销付款：支付一名员工在同一基地、同一币种下已审批的垫付开支，生成付款记录与凭证
+func CreateReimbursement(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var req reimbursementReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if len(req.ExpenseIDs) == 0 {
+		http.Error(w, "未选择开支记录", http.StatusBadRequest)
+		return
+	}
+	payDate := time.Now()
+	if req.PaymentDate != "" {
+		t, err := time.Parse("2006-01-02", req.PaymentDate)
+		if err != nil {
+			http.Error(w, "payment_date 格式应为 YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		payDate = t
+	}
+	method := req.PaymentMethod
+	if method == "" {
+		method = models.PaymentMethodBankTransfer
+	}
+	if method != models.PaymentMethodCash && method != models.PaymentMethodBankTransfer &&
+		method != models.PaymentMethodCheck && method != models.PaymentMethodOther {
+		http.Error(w, "不支持的付款方式", http.StatusBadRequest)
+		return
+	}
+
+	var items []models.BaseExpense
+	db.DB.Where("id IN ?", req.ExpenseIDs).Find(&items)
+	if len(items) != len(req.ExpenseIDs) {
+		http.Error(w, "部分开支记录不存在", http.StatusNotFound)
+		return
+	}
+	first := items[0]
+	if first.BaseID == nil {
+		http.Error(w, "平台级开支不能报销", http.StatusBadRequest)
+		return
+	}
+	var total money.Amount
+	for _, it := range items {
+		if it.Status != models.ExpenseStatusApproved || it.ReimbursementID != nil {
+			http.Error(w, fmt.Sprintf("开支 %d 不是已审批待报销状态", it.ID), http.StatusConflict)
+			return
+		}
+		if it.PaidBy != models.ExpensePaidByEmployee {
+			http.Error(w, fmt.Sprintf("开支 %d 不是员工垫付", it.ID), http.StatusBadRequest)
+			return
+		}
+		if optionalBaseID(it.BaseID) != *first.BaseID || it.CreatedBy != first.CreatedBy || it.Currency != first.Currency {
+			http.Error(w, "一次报销仅限同一员工、同一基地、同一币种的开支", http.StatusBadRequest)
+			return
+		}
+		total += it.Amount
+	}
+	if claimRole(claims) != "admin" && !containsUint(claimBaseIDs(claims), *first.BaseID) {
+		http.Error(w, "无权操作该基地", http.StatusForbidden)
+		return
+	}
+	if msg := periodLockMsg(*first.BaseID, payDate); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+
+	reim := models.ExpenseReimbursement{
+		BaseID:          *first.BaseID,
+		EmployeeID:      first.CreatedBy,
+		Currency:        first.Currency,
+		TotalAmount:     total.RoundFor(first.Currency),
+		PaymentDate:     payDate,
+		PaymentMethod:   method,
+		ReferenceNumber: req.ReferenceNumber,
+		Notes:           req.Notes,
+		CreatedBy:       claimUserID(claims),
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Create(&reim).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "创建报销记录失败", http.StatusInternalServerError)
+		return
+	}
+	// 条件更新防止并发重复报销
+	res := tx.Model(&models.BaseExpense{}).
+		Where("id IN ? AND status = ? AND reimbursement_id IS NULL", req.ExpenseIDs, models.ExpenseStatusApproved).
+		Updates(map[string]interface{}{"status": models.ExpenseStatusReimbursed, "reimbursement_id": reim.ID})
+	if res.Error != nil || int(res.RowsAffected) != len(req.ExpenseIDs) {
+		tx.Rollback()
+		http.Error(w, "开支状态已变化，请刷新后重试", http.StatusConflict)
+		return
+	}
+	if err := postReimbursementJournal(tx, &reim); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.Preload("Base").Preload("Employee").Preload("Expenses").First(&reim, reim.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reim)
+}
+
+// reimbursementScope 按角色限定报销数据：管理员全部；基地代理本人基地；队长仅本人
+func reimbursementScope(q *gorm.DB, claims jwt.MapClaims, baseCol, userCol string) *gorm.DB {
+	switch claimRole(claims) {
+	case "admin":
+		return q
+	case "captain":
+		return q.Where(userCol+" = ?", claimUserID(claims))
+	}
+	ids := claimBaseIDs(claims)
+	if len(ids) == 0 {
+		return q.Where("1 = 0")
+	}
+	return q.Where(baseCol+" IN ?", ids)
+}
+
+// ListReimbursements 报销付款列表，参数：base_id、employee_id、start_date、end_date
+func ListReimbursements(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	q := db.DB.Preload("Base").Preload("Employee").Preload("Expenses.Category").
+		Where("payment_date BETWEEN ? AND ?", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	q = reimbursementScope(q, claims, "base_id", "employee_id")
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	if eid := r.URL.Query().Get("employee_id"); eid != "" {
+		q = q.Where("employee_id = ?", eid)
+	}
+	var rows []models.ExpenseReimbursement
+	q.Order("payment_date desc, id desc").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// DeleteReimbursement 撤销报销付款（仅管理员）：开支恢复为已审批待报销，删除付款凭证
+func DeleteReimbursement(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权限", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var reim models.ExpenseReimbursement
+	if err := db.DB.First(&reim, id).Error; err != nil {
+		http.Error(w, "报销记录不存在", http.StatusNotFound)
+		return
+	}
+	if msg := periodLockMsg(reim.BaseID, reim.PaymentDate); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := removeJournal(tx, models.JournalSourceReimburse, reim.ID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err := tx.Model(&models.BaseExpense{}).Where("reimbursement_id = ?", reim.ID).
+		Updates(map[string]interface{}{"status": models.ExpenseStatusApproved, "reimbursement_id": nil}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "撤销失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Delete(&reim).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "撤销失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// ReimbursementBalance 员工待报销余额（按基地、币种）
+type ReimbursementBalance struct {
+	UserID      uint         `json:"user_id"`
+	UserName    string       `json:"user_name"`
+	BaseID      uint         `json:"base_id"`
+	BaseName    string       `json:"base_name"`
+	Currency    string       `json:"currency"`
+	Outstanding money.Amount `json:"outstanding"` // 已审批待报销
+	Pending     money.Amount `json:"pending"`     // 待审批
+	Count       int64        `json:"count"`       // 待报销笔数
+}
+
+// ReimbursementBalances 员工垫付开支的待报销余额，参数：base_id、user_id
+func ReimbursementBalances(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Table("base_expenses be").
+		Select("be.created_by as user_id, u.name as user_name, be.base_id as base_id, b.name as base_name, be.currency as currency, "+
+			"SUM(CASE WHEN be.status = ? THEN be.amount ELSE 0 END) as outstanding, "+
+			"SUM(CASE WHEN be.status = ? THEN be.amount ELSE 0 END) as pending, "+
+			"SUM(CASE WHEN be.status = ? THEN 1 ELSE 0 END) as count",
+			models.ExpenseStatusApproved, models.ExpenseStatusSubmitted, models.ExpenseStatusApproved).
+		Joins("LEFT JOIN users u ON u.id = be.created_by").
+		Joins("LEFT JOIN bases b ON b.id = be.base_id").
+		Where("be.paid_by = ? AND be.status IN ? AND be.base_id IS NOT NULL", models.ExpensePaidByEmployee,
+			[]string{models.ExpenseStatusApproved, models.ExpenseStatusSubmitted})
+	q = reimbursementScope(q, claims, "be.base_id", "be.created_by")
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("be.base_id = ?", bid)
+	}
+	if uid := r.URL.Query().Get("user_id"); uid != "" {
+		q = q.Where("be.created_by = ?", uid)
+	}
+	var rows []ReimbursementBalance
+	q.Group("be.created_by, u.name, be.base_id, b.name, be.currency").
+		Order("outstanding desc").Scan(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
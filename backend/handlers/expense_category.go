@@ -11,9 +11,63 @@ import (
 )
 
 type expenseCategoryReq struct {
-	Name   string  `json:"name"`
-	Code   *string `json:"code"`
-	Status string  `json:"status"`
+	Name        string  `json:"name"`
+	Code        *string `json:"code"`
+	Status      string  `json:"status"`
+	AccountCode *string `json:"account_code"` // 记账科目，需为已启用科目
+	ParentID    *uint   `json:"parent_id"`    // 上级类别（仅创建时有效，调整层级请用 move 接口）
+}
+
+// categoryTree 类别层级（id -> 上级、上级 -> 下级），类别数量有限，按需整表加载
+type categoryTree struct {
+	parent   map[uint]uint
+	children map[uint][]uint
+}
+
+func loadCategoryTree() *categoryTree {
+	var cats []models.ExpenseCategory
+	db.DB.Select("id, parent_id").Order("name").Find(&cats)
+	t := &categoryTree{parent: map[uint]uint{}, children: map[uint][]uint{}}
+	for _, c := range cats {
+		if c.ParentID != nil {
+			t.parent[c.ID] = *c.ParentID
+			t.children[*c.ParentID] = append(t.children[*c.ParentID], c.ID)
+		}
+	}
+	return t
+}
+
+// Descendants 类别自身及全部下级
+func (t *categoryTree) Descendants(id uint) []uint {
+	out := []uint{id}
+	for i := 0; i < len(out); i++ {
+		out = append(out, t.children[out[i]]...)
+	}
+	return out
+}
+
+// Ancestors 类别自身及全部上级（由近及远）
+func (t *categoryTree) Ancestors(id uint) []uint {
+	out := []uint{id}
+	for p, ok := t.parent[id]; ok && !containsUint(out, p); p, ok = t.parent[p] {
+		out = append(out, p)
+	}
+	return out
+}
+
+// categoryWithDescendants 类别筛选条件展开为自身及全部下级
+func categoryWithDescendants(id uint) []uint {
+	return loadCategoryTree().Descendants(id)
+}
+
+// validAccountCode 校验科目代码存在且已启用
+func validAccountCode(code *string) bool {
+	if code == nil {
+		return true
+	}
+	var cnt int64
+	db.DB.Model(&models.Account{}).Where("code = ? AND status = ?", *code, "active").Count(&cnt)
+	return cnt > 0
 }
 
 func normalizeCode(codePtr *string) *string {
@@ -75,6 +129,23 @@ func CreateExpenseCategory(w http.ResponseWriter, r *http.Request) {
 	if code := normalizeCode(payload.Code); code != nil {
 		category.Code = code
 	}
+	category.AccountCode = normalizeCode(payload.AccountCode)
+	if !validAccountCode(category.AccountCode) {
+		http.Error(w, "记账科目不存在或已停用", http.StatusBadRequest)
+		return
+	}
+	if payload.ParentID != nil && *payload.ParentID != 0 {
+		var parent models.ExpenseCategory
+		if err := db.DB.First(&parent, *payload.ParentID).Error; err != nil {
+			http.Error(w, "上级类别不存在", http.StatusBadRequest)
+			return
+		}
+		if parent.Status != "active" && status == "active" {
+			http.Error(w, "上级类别已停用", http.StatusBadRequest)
+			return
+		}
+		category.ParentID = &parent.ID
+	}
 
 	// 创建费用类别
 	if err := db.DB.Create(&category).Error; err != nil {
@@ -109,9 +180,50 @@ func ListExpenseCategory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("tree") == "1" {
+		json.NewEncoder(w).Encode(buildCategoryNodes(categories))
+		return
+	}
 	json.NewEncoder(w).Encode(categories)
 }
 
+// categoryNode 类别树节点（path 为自顶向下的名称路径）
+type categoryNode struct {
+	models.ExpenseCategory
+	Path     string          `json:"path"`
+	Children []*categoryNode `json:"children"`
+}
+
+// buildCategoryNodes 组装类别树；上级不在结果集中（如按状态筛选）的类别作为根节点
+func buildCategoryNodes(categories []models.ExpenseCategory) []*categoryNode {
+	nodes := make(map[uint]*categoryNode, len(categories))
+	for _, c := range categories {
+		nodes[c.ID] = &categoryNode{ExpenseCategory: c, Children: []*categoryNode{}}
+	}
+	roots := []*categoryNode{}
+	for _, c := range categories {
+		n := nodes[c.ID]
+		if c.ParentID != nil {
+			if p, ok := nodes[*c.ParentID]; ok {
+				p.Children = append(p.Children, n)
+				continue
+			}
+		}
+		roots = append(roots, n)
+	}
+	var setPath func(n *categoryNode, prefix string)
+	setPath = func(n *categoryNode, prefix string) {
+		n.Path = prefix + n.Name
+		for _, c := range n.Children {
+			setPath(c, n.Path+" > ")
+		}
+	}
+	for _, n := range roots {
+		setPath(n, "")
+	}
+	return roots
+}
+
 // 获取费用类别详情
 func GetExpenseCategory(w http.ResponseWriter, r *http.Request) {
 	// 验证用户权限（所有登录用户都可以查看）
@@ -186,14 +298,49 @@ func UpdateExpenseCategory(w http.ResponseWriter, r *http.Request) {
 	if payload.Code != nil {
 		category.Code = normalizeCode(payload.Code)
 	}
+	if payload.AccountCode != nil {
+		category.AccountCode = normalizeCode(payload.AccountCode)
+		if !validAccountCode(category.AccountCode) {
+			http.Error(w, "记账科目不存在或已停用", http.StatusBadRequest)
+			return
+		}
+	}
 	if strings.TrimSpace(payload.Status) != "" {
 		category.Status = strings.TrimSpace(payload.Status)
 	}
+	// 启用下级类别时上级须为启用状态
+	if category.Status == "active" && category.ParentID != nil {
+		var parent models.ExpenseCategory
+		if err := db.DB.First(&parent, *category.ParentID).Error; err == nil && parent.Status != "active" {
+			http.Error(w, "上级类别已停用，不能启用该类别", http.StatusBadRequest)
+			return
+		}
+	}
 
-	if err := db.DB.Save(&category).Error; err != nil {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Save(&category).Error; err != nil {
+		tx.Rollback()
 		http.Error(w, "更新费用类别失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// 停用上级类别时级联停用全部下级
+	if category.Status != "active" {
+		if sub := loadCategoryTree().Descendants(category.ID)[1:]; len(sub) > 0 {
+			if err := tx.Model(&models.ExpenseCategory{}).Where("id IN ?", sub).Update("status", category.Status).Error; err != nil {
+				tx.Rollback()
+				http.Error(w, "停用下级类别失败", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交失败", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(category)
@@ -226,6 +373,14 @@ func DeleteExpenseCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 有下级类别时不能删除
+	var children int64
+	db.DB.Model(&models.ExpenseCategory{}).Where("parent_id = ?", id).Count(&children)
+	if children > 0 {
+		http.Error(w, "该费用类别下还有子类别，无法删除", http.StatusBadRequest)
+		return
+	}
+
 	// 检查是否有关联的开支记录
 	var count int64
 	db.DB.Model(&models.BaseExpense{}).Where("category_id = ?", id).Count(&count)
@@ -246,3 +401,59 @@ func DeleteExpenseCategory(w http.ResponseWriter, r *http.Request) {
 		"message": "删除成功",
 	})
 }
+
+// MoveExpenseCategory 调整类别层级：body {"parent_id": 上级ID 或 null(移为顶级)}
+// 不能移动到自身或其下级之下；不能移动到已停用的类别下
+func MoveExpenseCategory(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权调整费用类别", http.StatusForbidden)
+		return
+	}
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id == 0 {
+		http.Error(w, "无效的费用类别ID", http.StatusBadRequest)
+		return
+	}
+	var category models.ExpenseCategory
+	if err := db.DB.First(&category, id).Error; err != nil {
+		http.Error(w, "费用类别不存在", http.StatusNotFound)
+		return
+	}
+	var body struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if body.ParentID != nil && *body.ParentID == 0 {
+		body.ParentID = nil
+	}
+	if body.ParentID != nil {
+		var parent models.ExpenseCategory
+		if err := db.DB.First(&parent, *body.ParentID).Error; err != nil {
+			http.Error(w, "上级类别不存在", http.StatusBadRequest)
+			return
+		}
+		if containsUint(loadCategoryTree().Descendants(category.ID), parent.ID) {
+			http.Error(w, "不能移动到自身或其下级类别之下", http.StatusBadRequest)
+			return
+		}
+		if parent.Status != "active" && category.Status == "active" {
+			http.Error(w, "不能移动到已停用的类别下", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := db.DB.Model(&category).Update("parent_id", body.ParentID).Error; err != nil {
+		http.Error(w, "调整类别层级失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.First(&category, id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
@@ -4,6 +4,7 @@ import (
     "backend/db"
     "backend/middleware"
     "backend/models"
+    "backend/money"
     "encoding/json"
     "net/http"
     "strconv"
@@ -17,13 +18,13 @@ import (
 
 // InventoryRecord 返回给前端的库存记录
 type InventoryRecord struct {
-    ProductName string  `json:"product_name"`
-    Spec        string  `json:"product_spec"`
-    Unit        string  `json:"product_unit"`
-    UnitPrice   float64 `json:"unit_price"`
-    Currency    string  `json:"currency"`
-    StockQty    float64 `json:"stock_quantity"`
-    Supplier    string  `json:"supplier"`
+    ProductName string       `json:"product_name"`
+    Spec        string       `json:"product_spec"`
+    Unit        string       `json:"product_unit"`
+    UnitPrice   money.Amount `json:"unit_price"`
+    Currency    string       `json:"currency"`
+    StockQty    float64      `json:"stock_quantity"`
+    Supplier    string       `json:"supplier"`
 }
 
 // InventoryList 库存汇总（按商品）
@@ -103,12 +104,13 @@ func InventoryList(w http.ResponseWriter, r *http.Request) {
 }
 
 type RequisitionCreateReq struct {
-    BaseID      uint     `json:"base_id"`
-    ProductID   uint     `json:"product_id"`
-    Quantity    float64  `json:"quantity"`
-    Unit        string   `json:"unit"`         // 可选，若为空则按基准单位
-    UnitPrice   *float64 `json:"unit_price"`   // 可选，不传则取商品默认单价
-    RequestDate string   `json:"request_date"` // yyyy-mm-dd，可选，默认今天
+    BaseID      uint          `json:"base_id"`
+    ProductID   uint          `json:"product_id"`
+    Quantity    float64       `json:"quantity"`
+    Unit        string        `json:"unit"`         // 可选，若为空则按基准单位
+    UnitPrice   *money.Amount `json:"unit_price"`   // 可选，不传则取商品默认单价
+    RequestDate string        `json:"request_date"` // yyyy-mm-dd，可选，默认今天
+    SectionID   *uint         `json:"section_id"`   // 可选，默认为申领人担任队长的分区；0 表示不指定
 }
 
 // CreateRequisition 创建物资申领记录（并校验库存充足）
@@ -190,6 +192,15 @@ func CreateRequisition(w http.ResponseWriter, r *http.Request) {
         }
         reqDate = d
     }
+    if msg := periodLockMsg(req.BaseID, reqDate); msg != "" {
+        http.Error(w, msg, http.StatusConflict)
+        return
+    }
+    sectionID, msg := resolveSectionID(req.BaseID, req.SectionID, uid)
+    if msg != "" {
+        http.Error(w, msg, http.StatusBadRequest)
+        return
+    }
 
     rec := models.MaterialRequisition{
         BaseID:       req.BaseID,
@@ -197,15 +208,31 @@ func CreateRequisition(w http.ResponseWriter, r *http.Request) {
         ProductName:  product.Name,
         UnitPrice:    unitPrice,
         QuantityBase: quantityBase,
-        TotalAmount:  unitPrice * quantityBase,
+        TotalAmount:  unitPrice.Mul(quantityBase).RoundFor(product.Currency),
         Currency:     product.Currency,
         RequestDate:  reqDate,
         RequestedBy:  uid,
+        SectionID:    sectionID,
+    }
+    tx := db.DB.Begin()
+    if tx.Error != nil {
+        http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+        return
     }
-    if err := db.DB.Create(&rec).Error; err != nil {
+    if err := tx.Create(&rec).Error; err != nil {
+        tx.Rollback()
         http.Error(w, "保存申领记录失败", http.StatusInternalServerError)
         return
     }
+    if err := postRequisitionJournal(tx, &rec); err != nil {
+        tx.Rollback()
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    if err := tx.Commit().Error; err != nil {
+        http.Error(w, "提交事务失败", http.StatusInternalServerError)
+        return
+    }
 
     db.DB.Preload("Base").Preload("Product").Preload("Requester").First(&rec, rec.ID)
     w.Header().Set("Content-Type", "application/json")
@@ -220,7 +247,7 @@ func ListRequisition(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    q := db.DB.Preload("Base").Preload("Product").Preload("Requester").Order("request_date desc, id desc")
+    q := db.DB.Preload("Base").Preload("Product").Preload("Requester").Preload("Section").Order("request_date desc, id desc")
 
     if v := strings.TrimSpace(r.URL.Query().Get("base_id")); v != "" {
         if id, err := strconv.Atoi(v); err == nil {
@@ -232,6 +259,9 @@ func ListRequisition(w http.ResponseWriter, r *http.Request) {
             q = q.Where("product_id = ?", id)
         }
     }
+    if v := strings.TrimSpace(r.URL.Query().Get("section_id")); v != "" {
+        q = q.Where("section_id = ?", v)
+    }
     if kw := strings.TrimSpace(r.URL.Query().Get("q")); kw != "" {
         like := "%" + kw + "%"
         q = q.Where("product_name LIKE ?", like)
@@ -359,16 +389,31 @@ func UpdateRequisition(w http.ResponseWriter, r *http.Request) {
         d, err := time.Parse("2006-01-02", req.RequestDate); if err != nil { http.Error(w, "request_date格式错误", http.StatusBadRequest); return }
         reqDate = d
     }
+    // 原记录与修改后的日期所在期间均须未结账
+    if msg := periodLockMsg(rec.BaseID, rec.RequestDate); msg != "" { http.Error(w, msg, http.StatusConflict); return }
+    if msg := periodLockMsg(req.BaseID, reqDate); msg != "" { http.Error(w, msg, http.StatusConflict); return }
+    // 分区：传入时按传入值；更换基地时重新取申领人的默认分区；否则保持不变
+    if req.SectionID != nil || req.BaseID != rec.BaseID {
+        sectionID, msg := resolveSectionID(req.BaseID, req.SectionID, rec.RequestedBy)
+        if msg != "" { http.Error(w, msg, http.StatusBadRequest); return }
+        rec.SectionID = sectionID
+    }
 
+    // 币种变更时旧快照汇率失效，记账时按单据日期重新取汇率
+    if rec.Currency != product.Currency { rec.RateToCNY = 0 }
     rec.BaseID = req.BaseID
     rec.ProductID = product.ID
     rec.ProductName = product.Name
     rec.UnitPrice = newUnitPrice
     rec.QuantityBase = newQtyBase
-    rec.TotalAmount = newUnitPrice * newQtyBase
+    rec.TotalAmount = newUnitPrice.Mul(newQtyBase).RoundFor(product.Currency)
     rec.Currency = product.Currency
     rec.RequestDate = reqDate
-    if err := db.DB.Save(&rec).Error; err != nil { http.Error(w, "更新失败", http.StatusInternalServerError); return }
+    tx := db.DB.Begin()
+    if tx.Error != nil { http.Error(w, "数据库事务启动失败", http.StatusInternalServerError); return }
+    if err := tx.Save(&rec).Error; err != nil { tx.Rollback(); http.Error(w, "更新失败", http.StatusInternalServerError); return }
+    if err := postRequisitionJournal(tx, &rec); err != nil { tx.Rollback(); http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    if err := tx.Commit().Error; err != nil { http.Error(w, "提交事务失败", http.StatusInternalServerError); return }
 
     db.DB.Preload("Base").Preload("Product").Preload("Requester").First(&rec, rec.ID)
     w.Header().Set("Content-Type", "application/json")
@@ -390,8 +435,13 @@ func DeleteRequisition(w http.ResponseWriter, r *http.Request) {
     var uid uint
     if v, ok := claims["uid"]; ok { if f, ok2 := v.(float64); ok2 { uid = uint(f) } }
     if !(role == "admin" || rec.RequestedBy == uid) { http.Error(w, "无权限", http.StatusForbidden); return }
+    if msg := periodLockMsg(rec.BaseID, rec.RequestDate); msg != "" { http.Error(w, msg, http.StatusConflict); return }
 
-    if err := db.DB.Delete(&rec).Error; err != nil { http.Error(w, "删除失败", http.StatusInternalServerError); return }
+    tx := db.DB.Begin()
+    if tx.Error != nil { http.Error(w, "数据库事务启动失败", http.StatusInternalServerError); return }
+    if err := tx.Delete(&rec).Error; err != nil { tx.Rollback(); http.Error(w, "删除失败", http.StatusInternalServerError); return }
+    if err := removeJournal(tx, models.JournalSourceRequisition, rec.ID); err != nil { tx.Rollback(); http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    if err := tx.Commit().Error; err != nil { http.Error(w, "提交事务失败", http.StatusInternalServerError); return }
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]any{"success": true})
 }
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/money"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 自动凭证：业务单据新增/修改/删除时，在同一事务内按 source_type+source_id 重建对应凭证。
+// 借贷金额按单据日期生效的汇率折算为本位币（CNY）；采购、开支、申领、还款在首次记账时把汇率与本位币金额
+// 快照到单据上（rate_to_cny / amount_cny），此后修改单据或重建凭证均沿用快照汇率，避免历史金额漂移。
+
+// toCNY 原币金额按汇率折算为本位币（保留 2 位小数）
+func toCNY(a money.Amount, rate float64) money.Amount {
+	return a.Mul(rate).Round(2)
+}
+
+// ledgerRate 取某币种在单据日期生效的汇率（1 外币 = rate CNY）
+func ledgerRate(q *gorm.DB, currency string, on time.Time) (float64, error) {
+	if currency == "" || currency == "CNY" {
+		return 1, nil
+	}
+	var h models.ExchangeRateHistory
+	if err := q.Where("currency = ? AND effective_date <= ?", currency, on.Format("2006-01-02")).Order("effective_date desc").First(&h).Error; err == nil {
+		return h.RateToCNY, nil
+	}
+	// 早于最早的历史汇率时取最早一条，无历史时取当前汇率
+	if err := q.Where("currency = ?", currency).Order("effective_date asc").First(&h).Error; err == nil {
+		return h.RateToCNY, nil
+	}
+	var er models.ExchangeRate
+	if err := q.Where("currency = ?", currency).First(&er).Error; err != nil || er.RateToCNY <= 0 {
+		return 0, fmt.Errorf("缺少币种 %s 的汇率，无法生成凭证", currency)
+	}
+	return er.RateToCNY, nil
+}
+
+// postingRate 重建凭证时使用的汇率：原凭证币种一致则沿用其汇率，否则取单据日期的汇率
+func postingRate(q *gorm.DB, sourceType string, sourceID uint, currency string, on time.Time) (float64, error) {
+	var old models.JournalEntry
+	if err := q.Where("source_type = ? AND source_id = ?", sourceType, sourceID).First(&old).Error; err == nil {
+		if old.Currency == currency && old.Rate > 0 {
+			return old.Rate, nil
+		}
+	}
+	return ledgerRate(q, currency, on)
+}
+
+// documentRate 单据折算汇率：已有快照时沿用，否则取单据日期生效的汇率
+func documentRate(q *gorm.DB, snapshot float64, currency string, on time.Time) (float64, error) {
+	if snapshot > 0 {
+		return snapshot, nil
+	}
+	return ledgerRate(q, currency, on)
+}
+
+// saveSnapshot 回写单据的折算快照（不触发 updated_at）
+func saveSnapshot(tx *gorm.DB, model interface{}, rate float64, cny money.Amount) error {
+	if err := tx.Model(model).UpdateColumns(map[string]interface{}{"rate_to_cny": rate, "amount_cny": cny}).Error; err != nil {
+		return errors.New("保存折算快照失败")
+	}
+	return nil
+}
+
+// removeJournal 删除某业务单据生成的凭证及分录
+func removeJournal(tx *gorm.DB, sourceType string, sourceIDs ...uint) error {
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+	var ids []uint
+	if err := tx.Model(&models.JournalEntry{}).Where("source_type = ? AND source_id IN ?", sourceType, sourceIDs).Pluck("id", &ids).Error; err != nil {
+		return errors.New("查询凭证失败")
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var exported int64
+	tx.Model(&models.JournalEntry{}).Where("id IN ? AND export_id IS NOT NULL", ids).Count(&exported)
+	if exported > 0 {
+		return errors.New("单据凭证已导出至外部账套，不能修改或删除；如需调整请先撤销导出批次")
+	}
+	if err := tx.Where("entry_id IN ?", ids).Delete(&models.JournalLine{}).Error; err != nil {
+		return errors.New("删除凭证分录失败")
+	}
+	if err := tx.Where("id IN ?", ids).Delete(&models.JournalEntry{}).Error; err != nil {
+		return errors.New("删除凭证失败")
+	}
+	return nil
+}
+
+// postJournal 写入凭证（先删除同来源旧凭证）；借贷不平时返回错误
+func postJournal(tx *gorm.DB, entry models.JournalEntry, lines []models.JournalLine) error {
+	if err := removeJournal(tx, entry.SourceType, entry.SourceID); err != nil {
+		return err
+	}
+	var debit, credit money.Amount
+	kept := lines[:0]
+	for _, l := range lines {
+		l.Debit = l.Debit.Round(2)
+		l.Credit = l.Credit.Round(2)
+		if l.Debit == 0 && l.Credit == 0 {
+			continue
+		}
+		debit += l.Debit
+		credit += l.Credit
+		kept = append(kept, l)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	if debit != credit {
+		return fmt.Errorf("凭证借贷不平衡（借 %s / 贷 %s）", debit.StringFixed(2), credit.StringFixed(2))
+	}
+	entry.Lines = kept
+	if err := tx.Create(&entry).Error; err != nil {
+		return errors.New("生成凭证失败")
+	}
+	return nil
+}
+
+// debitLine / creditLine 构造分录：cny 为本位币金额，orig 为原币金额
+func debitLine(account string, cny, orig money.Amount, currency, memo string) models.JournalLine {
+	return models.JournalLine{AccountCode: account, Debit: cny, OrigAmount: orig.Round(2), OrigCurrency: currency, Memo: memo}
+}
+
+func creditLine(account string, cny, orig money.Amount, currency, memo string) models.JournalLine {
+	return models.JournalLine{AccountCode: account, Credit: cny, OrigAmount: -orig.Round(2), OrigCurrency: currency, Memo: memo}
+}
+
+// cashAccount 付款方式对应的资金科目
+func cashAccount(method string) string {
+	switch method {
+	case "cash":
+		return models.AccountCash
+	case models.PaymentMethodCredit:
+		return models.AccountPrepayment
+	default:
+		return models.AccountBank
+	}
+}
+
+// postPurchaseJournal 采购入库：借 库存商品 / 贷 应付账款
+func postPurchaseJournal(tx *gorm.DB, p *models.PurchaseEntry) error {
+	rate, err := documentRate(tx, p.RateToCNY, p.Currency, p.PurchaseDate)
+	if err != nil {
+		return err
+	}
+	cny := toCNY(p.TotalAmount, rate)
+	if err := saveSnapshot(tx, p, rate, cny); err != nil {
+		return err
+	}
+	p.RateToCNY, p.AmountCNY = rate, cny
+	baseID := p.BaseID
+	entry := models.JournalEntry{
+		BaseID:      &baseID,
+		EntryDate:   p.PurchaseDate,
+		SourceType:  models.JournalSourcePurchase,
+		SourceID:    p.ID,
+		Description: "采购入库 " + p.OrderNumber,
+		Currency:    p.Currency,
+		Rate:        rate,
+		CreatedBy:   p.CreatedBy,
+	}
+	return postJournal(tx, entry, []models.JournalLine{
+		debitLine(models.AccountInventory, cny, p.TotalAmount, p.Currency, ""),
+		creditLine(models.AccountPayable, cny, p.TotalAmount, p.Currency, ""),
+	})
+}
+
+// postExpenseJournal 基地开支：借 费用类别对应科目（未配置时为管理费用） / 贷 库存现金（员工垫付时贷 其他应付款）；
+// 待审批或已驳回的开支不生成凭证（删除已有凭证）
+func postExpenseJournal(tx *gorm.DB, e *models.BaseExpense) error {
+	if !e.Counted() {
+		return removeJournal(tx, models.JournalSourceExpense, e.ID)
+	}
+	rate, err := documentRate(tx, e.RateToCNY, e.Currency, e.Date)
+	if err != nil {
+		return err
+	}
+	account := models.AccountAdminExpense
+	var cat models.ExpenseCategory
+	if err := tx.First(&cat, e.CategoryID).Error; err == nil && cat.AccountCode != nil && *cat.AccountCode != "" {
+		account = *cat.AccountCode
+	}
+	cny := toCNY(e.Amount, rate)
+	if err := saveSnapshot(tx, e, rate, cny); err != nil {
+		return err
+	}
+	e.RateToCNY, e.AmountCNY = rate, cny
+	entry := models.JournalEntry{
+		BaseID:      e.BaseID,
+		EntryDate:   e.Date,
+		SourceType:  models.JournalSourceExpense,
+		SourceID:    e.ID,
+		Description: "基地开支 " + cat.Name,
+		Currency:    e.Currency,
+		Rate:        rate,
+		CreatedBy:   e.CreatedBy,
+	}
+	credit, memo := models.AccountCash, ""
+	if e.PaidBy == models.ExpensePaidByEmployee {
+		credit, memo = models.AccountOtherPayable, "员工垫付 "+e.CreatorName
+	}
+	return postJournal(tx, entry, []models.JournalLine{
+		debitLine(account, cny, e.Amount, e.Currency, e.Detail),
+		creditLine(credit, cny, e.Amount, e.Currency, memo),
+	})
+}
+
+// postReimbursementJournal 报销付款：借 其他应付款（按各笔开支入账金额）/ 贷 资金科目（按付款汇率），差额计入汇兑损益
+func postReimbursementJournal(tx *gorm.DB, reim *models.ExpenseReimbursement) error {
+	rate, err := documentRate(tx, reim.RateToCNY, reim.Currency, reim.PaymentDate)
+	if err != nil {
+		return err
+	}
+	var booked money.Amount
+	tx.Model(&models.BaseExpense{}).Select("COALESCE(SUM(amount_cny), 0)").
+		Where("reimbursement_id = ?", reim.ID).Scan(&booked)
+	cashCny := toCNY(reim.TotalAmount, rate)
+	if err := saveSnapshot(tx, reim, rate, cashCny); err != nil {
+		return err
+	}
+	reim.RateToCNY, reim.AmountCNY = rate, cashCny
+	if booked == 0 {
+		booked = cashCny
+	}
+	baseID := reim.BaseID
+	entry := models.JournalEntry{
+		BaseID:      &baseID,
+		EntryDate:   reim.PaymentDate,
+		SourceType:  models.JournalSourceReimburse,
+		SourceID:    reim.ID,
+		Description: "员工报销 " + reim.ReferenceNumber,
+		Currency:    reim.Currency,
+		Rate:        rate,
+		CreatedBy:   reim.CreatedBy,
+	}
+	lines := []models.JournalLine{
+		debitLine(models.AccountOtherPayable, booked, reim.TotalAmount, reim.Currency, ""),
+		creditLine(cashAccount(reim.PaymentMethod), cashCny, reim.TotalAmount, reim.Currency, ""),
+	}
+	if diff := booked - cashCny; diff > 0 {
+		lines = append(lines, creditLine(models.AccountFXGainLoss, diff, 0, reim.Currency, "汇兑收益"))
+	} else if diff < 0 {
+		lines = append(lines, debitLine(models.AccountFXGainLoss, diff.Neg(), 0, reim.Currency, "汇兑损失"))
+	}
+	return postJournal(tx, entry, lines)
+}
+
+// postRequisitionJournal 物资申领出库：借 主营业务成本 / 贷 库存商品
+func postRequisitionJournal(tx *gorm.DB, rec *models.MaterialRequisition) error {
+	rate, err := documentRate(tx, rec.RateToCNY, rec.Currency, rec.RequestDate)
+	if err != nil {
+		return err
+	}
+	cny := toCNY(rec.TotalAmount, rate)
+	if err := saveSnapshot(tx, rec, rate, cny); err != nil {
+		return err
+	}
+	rec.RateToCNY, rec.AmountCNY = rate, cny
+	baseID := rec.BaseID
+	entry := models.JournalEntry{
+		BaseID:      &baseID,
+		EntryDate:   rec.RequestDate,
+		SourceType:  models.JournalSourceRequisition,
+		SourceID:    rec.ID,
+		Description: "物资申领 " + rec.ProductName,
+		Currency:    rec.Currency,
+		Rate:        rate,
+		CreatedBy:   rec.RequestedBy,
+	}
+	return postJournal(tx, entry, []models.JournalLine{
+		debitLine(models.AccountCost, cny, rec.TotalAmount, rec.Currency, ""),
+		creditLine(models.AccountInventory, cny, rec.TotalAmount, rec.Currency, ""),
+	})
+}
+
+// payableBookedRate 应付款入账汇率：按关联采购单的折算快照（本位币/原币）加权，缺失时取应付款创建日的汇率
+func payableBookedRate(tx *gorm.DB, payable *models.PayableRecord) (float64, error) {
+	var purchaseIDs []uint
+	tx.Model(&models.PayableLink{}).Where("payable_record_id = ?", payable.ID).Pluck("purchase_entry_id", &purchaseIDs)
+	if payable.PurchaseEntryID != nil {
+		purchaseIDs = append(purchaseIDs, *payable.PurchaseEntryID)
+	}
+	if len(purchaseIDs) > 0 {
+		var agg struct {
+			Cny  float64
+			Orig float64
+		}
+		tx.Model(&models.PurchaseEntry{}).
+			Select("COALESCE(SUM(amount_cny), 0) as cny, COALESCE(SUM(total_amount), 0) as orig").
+			Where("id IN ? AND rate_to_cny > 0", purchaseIDs).
+			Scan(&agg)
+		if agg.Orig > 0 {
+			return agg.Cny / agg.Orig, nil
+		}
+	}
+	return ledgerRate(tx, payable.Currency, payable.CreatedAt)
+}
+
+// creditCarriedRate 供应商余额（预付账款）的账面汇率：按 供应商+基地+币种 的余额流水移动加权，
+// 增加按其凭证汇率入账，抵扣按当时的账面汇率转出；只计入该笔抵扣还款之前的流水，无余额时取付款日汇率
+func creditCarriedRate(tx *gorm.DB, supplierID, baseID uint, payment *models.PaymentRecord) (float64, error) {
+	var entries []models.SupplierCreditEntry
+	tx.Where("supplier_id = ? AND base_id = ? AND currency = ? AND entry_date <= ?", supplierID, baseID, payment.Currency, payment.PaymentDate).
+		Order("entry_date, id").Find(&entries)
+	var bal, cny money.Amount
+	for _, e := range entries {
+		if e.PaymentRecordID != nil && *e.PaymentRecordID == payment.ID {
+			break
+		}
+		if e.Amount > 0 {
+			rate, err := postingRate(tx, models.JournalSourceCredit, e.ID, e.Currency, e.EntryDate)
+			if err != nil {
+				return 0, err
+			}
+			cny += toCNY(e.Amount, rate)
+		} else if bal > 0 {
+			cny -= cny.Mul(e.Amount.Neg().Float64() / bal.Float64()).Round(2)
+		}
+		bal += e.Amount
+	}
+	if bal <= 0 || cny <= 0 {
+		return ledgerRate(tx, payment.Currency, payment.PaymentDate)
+	}
+	return cny.Float64() / bal.Float64(), nil
+}
+
+// postPaymentJournal 还款：借 应付账款（按入账汇率）/ 贷 资金科目（按付款汇率；余额抵扣按预付账款的账面汇率），
+// 现金折扣贷记财务费用，入账与付款汇率差额计入汇兑损益，并同步重建该笔还款的已实现汇兑损益记录
+func postPaymentJournal(tx *gorm.DB, payable *models.PayableRecord, payment *models.PaymentRecord) error {
+	booked, err := payableBookedRate(tx, payable)
+	if err != nil {
+		return err
+	}
+	var rate float64
+	if payment.PaymentMethod == models.PaymentMethodCredit && payment.RateToCNY <= 0 && payable.SupplierID != nil {
+		rate, err = creditCarriedRate(tx, *payable.SupplierID, payable.BaseID, payment)
+	} else {
+		rate, err = documentRate(tx, payment.RateToCNY, payment.Currency, payment.PaymentDate)
+	}
+	if err != nil {
+		return err
+	}
+	settled := payment.PaymentAmount + payment.DiscountAmount
+	apCny := toCNY(settled, booked)
+	cashCny := toCNY(payment.PaymentAmount, rate)
+	discCny := toCNY(payment.DiscountAmount, rate)
+	if err := saveSnapshot(tx, payment, rate, cashCny); err != nil {
+		return err
+	}
+	payment.RateToCNY, payment.AmountCNY = rate, cashCny
+	if err := tx.Where("payment_record_id = ?", payment.ID).Delete(&models.RealizedFX{}).Error; err != nil {
+		return errors.New("更新汇兑损益记录失败")
+	}
+	diff := apCny - cashCny - discCny
+	if diff != 0 {
+		fx := models.RealizedFX{
+			PaymentRecordID: payment.ID,
+			PayableRecordID: payable.ID,
+			BaseID:          payable.BaseID,
+			SupplierID:      payable.SupplierID,
+			Currency:        payment.Currency,
+			SettledAmount:   settled,
+			BookedRate:      booked,
+			PaymentRate:     rate,
+			GainLossCNY:     diff,
+			PaymentDate:     payment.PaymentDate,
+		}
+		if err := tx.Create(&fx).Error; err != nil {
+			return errors.New("保存汇兑损益记录失败")
+		}
+	}
+	baseID := payable.BaseID
+	entry := models.JournalEntry{
+		BaseID:      &baseID,
+		EntryDate:   payment.PaymentDate,
+		SourceType:  models.JournalSourcePayment,
+		SourceID:    payment.ID,
+		Description: "支付应付款 " + payment.ReferenceNumber,
+		Currency:    payment.Currency,
+		Rate:        rate,
+		CreatedBy:   payment.CreatedBy,
+	}
+	lines := []models.JournalLine{
+		debitLine(models.AccountPayable, apCny, settled, payment.Currency, ""),
+		creditLine(cashAccount(payment.PaymentMethod), cashCny, payment.PaymentAmount, payment.Currency, ""),
+		creditLine(models.AccountFinanceExpense, discCny, payment.DiscountAmount, payment.Currency, "现金折扣"),
+	}
+	if diff > 0 {
+		lines = append(lines, creditLine(models.AccountFXGainLoss, diff, 0, payment.Currency, "汇兑收益"))
+	} else if diff < 0 {
+		lines = append(lines, debitLine(models.AccountFXGainLoss, diff.Neg(), 0, payment.Currency, "汇兑损失"))
+	}
+	return postJournal(tx, entry, lines)
+}
+
+// postCreditJournal 预付款 / 超付转余额：借 预付账款 / 贷 资金科目；抵扣流水由还款凭证反映，不单独记账
+func postCreditJournal(tx *gorm.DB, e *models.SupplierCreditEntry) error {
+	if e.Kind == models.SupplierCreditApplied || e.Amount <= 0 {
+		return nil
+	}
+	rate, err := postingRate(tx, models.JournalSourceCredit, e.ID, e.Currency, e.EntryDate)
+	if err != nil {
+		return err
+	}
+	method := e.PaymentMethod
+	desc := "供应商预付款"
+	if e.Kind == models.SupplierCreditOverpayment {
+		method = models.PaymentMethodBankTransfer
+		if e.PaymentRecordID != nil {
+			var p models.PaymentRecord
+			if err := tx.First(&p, *e.PaymentRecordID).Error; err == nil {
+				method = p.PaymentMethod
+			}
+		}
+		desc = "超付转供应商余额"
+	}
+	cny := toCNY(e.Amount, rate)
+	baseID := e.BaseID
+	entry := models.JournalEntry{
+		BaseID:      &baseID,
+		EntryDate:   e.EntryDate,
+		SourceType:  models.JournalSourceCredit,
+		SourceID:    e.ID,
+		Description: desc,
+		Currency:    e.Currency,
+		Rate:        rate,
+		CreatedBy:   e.CreatedBy,
+	}
+	return postJournal(tx, entry, []models.JournalLine{
+		debitLine(models.AccountPrepayment, cny, e.Amount, e.Currency, ""),
+		creditLine(cashAccount(method), cny, e.Amount, e.Currency, ""),
+	})
+}
@@ -0,0 +1,554 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// debitNormal 借方余额科目（资产、费用）；其余为贷方余额科目
+func debitNormal(accountType string) bool {
+	return accountType == models.AccountTypeAsset || accountType == models.AccountTypeExpense
+}
+
+// signedBalance 按科目方向计算余额（正数表示正常方向余额）
+func signedBalance(accountType string, debit, credit money.Amount) money.Amount {
+	if debitNormal(accountType) {
+		return debit - credit
+	}
+	return credit - debit
+}
+
+// scopeJournal 凭证查询的基地范围：非管理员仅限本人基地；base_id 参数进一步过滤
+func scopeJournal(q *gorm.DB, claims jwt.MapClaims, r *http.Request) *gorm.DB {
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			return q.Where("1 = 0")
+		}
+		q = q.Where("je.base_id IN ?", ids)
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("je.base_id = ?", bid)
+	}
+	return q
+}
+
+// parseLedgerRange 解析 start_date/end_date（YYYY-MM-DD），缺省为本年初至今天
+func parseLedgerRange(r *http.Request) (time.Time, time.Time, string) {
+	now := time.Now()
+	start := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.Local)
+	end := now
+	if s := r.URL.Query().Get("start_date"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return start, end, "start_date 格式应为 YYYY-MM-DD"
+		}
+		start = t
+	}
+	if s := r.URL.Query().Get("end_date"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return start, end, "end_date 格式应为 YYYY-MM-DD"
+		}
+		end = t
+	}
+	if end.Before(start) {
+		return start, end, "end_date 不能早于 start_date"
+	}
+	return start, end, ""
+}
+
+// ListAccounts 科目表
+func ListAccounts(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Order("code")
+	if st := r.URL.Query().Get("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	var rows []models.Account
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// UpsertAccount 新增或修改科目（仅管理员）；系统科目不可修改类型
+func UpsertAccount(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以维护科目", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		Code   string `json:"code"`
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Code == "" || req.Name == "" {
+		http.Error(w, "科目代码和名称不能为空", http.StatusBadRequest)
+		return
+	}
+	switch req.Type {
+	case models.AccountTypeAsset, models.AccountTypeLiability, models.AccountTypeEquity, models.AccountTypeIncome, models.AccountTypeExpense:
+	default:
+		http.Error(w, "科目类型应为 asset/liability/equity/income/expense", http.StatusBadRequest)
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+	var acc models.Account
+	if err := db.DB.Where("code = ?", req.Code).First(&acc).Error; err != nil {
+		acc = models.Account{Code: req.Code, Name: req.Name, Type: req.Type, Status: req.Status}
+		if err := db.DB.Create(&acc).Error; err != nil {
+			http.Error(w, "创建科目失败", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		if acc.System && (acc.Type != req.Type || req.Status != "active") {
+			http.Error(w, "系统科目不能修改类型或停用", http.StatusBadRequest)
+			return
+		}
+		if err := db.DB.Model(&acc).Updates(map[string]interface{}{"name": req.Name, "type": req.Type, "status": req.Status}).Error; err != nil {
+			http.Error(w, "更新科目失败", http.StatusInternalServerError)
+			return
+		}
+	}
+	db.DB.First(&acc, acc.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(acc)
+}
+
+// DeleteAccount 删除科目（仅管理员；系统科目、已有分录或被费用类别引用的科目不可删除）
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以维护科目", http.StatusForbidden)
+		return
+	}
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	var acc models.Account
+	if err := db.DB.Where("code = ?", code).First(&acc).Error; err != nil {
+		http.Error(w, "科目不存在", http.StatusNotFound)
+		return
+	}
+	if acc.System {
+		http.Error(w, "系统科目不可删除", http.StatusBadRequest)
+		return
+	}
+	var cnt int64
+	db.DB.Model(&models.JournalLine{}).Where("account_code = ?", code).Count(&cnt)
+	if cnt > 0 {
+		http.Error(w, "该科目已有分录，无法删除，可改为停用", http.StatusBadRequest)
+		return
+	}
+	db.DB.Model(&models.ExpenseCategory{}).Where("account_code = ?", code).Count(&cnt)
+	if cnt > 0 {
+		http.Error(w, "该科目已被费用类别引用，无法删除", http.StatusBadRequest)
+		return
+	}
+	db.DB.Delete(&acc)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
+
+// TrialBalanceRow 科目余额表行（金额为 CNY）
+type TrialBalanceRow struct {
+	AccountCode  string       `json:"account_code"`
+	AccountName  string       `json:"account_name"`
+	AccountType  string       `json:"account_type"`
+	OpeningDebit money.Amount `json:"opening_debit"`
+	OpeningCred  money.Amount `json:"opening_credit"`
+	PeriodDebit  money.Amount `json:"period_debit"`
+	PeriodCredit money.Amount `json:"period_credit"`
+	ClosingDebit money.Amount `json:"closing_debit"`
+	ClosingCred  money.Amount `json:"closing_credit"`
+}
+
+// GetTrialBalance 科目余额表（试算平衡）：期初、本期发生额、期末余额
+// 参数：start_date、end_date、base_id（可选）
+func GetTrialBalance(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	if role != "admin" && role != "base_agent" {
+		http.Error(w, "无权查看账簿", http.StatusForbidden)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	var agg []struct {
+		AccountCode  string
+		OpenDebit    money.Amount
+		OpenCredit   money.Amount
+		PeriodDebit  money.Amount
+		PeriodCredit money.Amount
+	}
+	startStr, endStr := start.Format("2006-01-02"), end.Format("2006-01-02")
+	q := db.DB.Table("journal_lines jl").
+		Select(`jl.account_code,
+			SUM(CASE WHEN je.entry_date < ? THEN jl.debit ELSE 0 END) as open_debit,
+			SUM(CASE WHEN je.entry_date < ? THEN jl.credit ELSE 0 END) as open_credit,
+			SUM(CASE WHEN je.entry_date >= ? THEN jl.debit ELSE 0 END) as period_debit,
+			SUM(CASE WHEN je.entry_date >= ? THEN jl.credit ELSE 0 END) as period_credit`,
+			startStr, startStr, startStr, startStr).
+		Joins("JOIN journal_entries je ON je.id = jl.entry_id").
+		Where("je.entry_date <= ?", endStr).
+		Group("jl.account_code")
+	scopeJournal(q, claims, r).Scan(&agg)
+
+	var accounts []models.Account
+	db.DB.Find(&accounts)
+	byCode := map[string]models.Account{}
+	for _, a := range accounts {
+		byCode[a.Code] = a
+	}
+
+	rows := make([]TrialBalanceRow, 0, len(agg))
+	var totals TrialBalanceRow
+	totals.AccountName = "合计"
+	for _, a := range agg {
+		acc := byCode[a.AccountCode]
+		row := TrialBalanceRow{
+			AccountCode:  a.AccountCode,
+			AccountName:  acc.Name,
+			AccountType:  acc.Type,
+			PeriodDebit:  a.PeriodDebit,
+			PeriodCredit: a.PeriodCredit,
+		}
+		if open := a.OpenDebit - a.OpenCredit; open >= 0 {
+			row.OpeningDebit = open
+		} else {
+			row.OpeningCred = -open
+		}
+		if closing := a.OpenDebit + a.PeriodDebit - a.OpenCredit - a.PeriodCredit; closing >= 0 {
+			row.ClosingDebit = closing
+		} else {
+			row.ClosingCred = -closing
+		}
+		totals.OpeningDebit += row.OpeningDebit
+		totals.OpeningCred += row.OpeningCred
+		totals.PeriodDebit += row.PeriodDebit
+		totals.PeriodCredit += row.PeriodCredit
+		totals.ClosingDebit += row.ClosingDebit
+		totals.ClosingCred += row.ClosingCred
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].AccountCode < rows[j].AccountCode })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"start_date": startStr,
+		"end_date":   endStr,
+		"rows":       rows,
+		"totals":     totals,
+		"balanced":   totals.PeriodDebit == totals.PeriodCredit && totals.ClosingDebit == totals.ClosingCred,
+	})
+}
+
+// LedgerLine 明细账行
+type LedgerLine struct {
+	EntryID     uint         `json:"entry_id"`
+	EntryDate   time.Time    `json:"entry_date"`
+	BaseID      *uint        `json:"base_id"`
+	SourceType  string       `json:"source_type"`
+	SourceID    uint         `json:"source_id"`
+	Description string       `json:"description"`
+	Memo        string       `json:"memo"`
+	Debit       money.Amount `json:"debit"`
+	Credit      money.Amount `json:"credit"`
+	OrigAmount  money.Amount `json:"orig_amount"`
+	OrigCur     string       `json:"orig_currency"`
+	Balance     money.Amount `json:"balance"`
+}
+
+// GetAccountLedger 科目明细账：期初余额 + 本期分录（带累计余额，按科目方向）
+// 参数：account_code（必填）、start_date、end_date、base_id
+func GetAccountLedger(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	if role != "admin" && role != "base_agent" {
+		http.Error(w, "无权查看账簿", http.StatusForbidden)
+		return
+	}
+	code := strings.TrimSpace(r.URL.Query().Get("account_code"))
+	var acc models.Account
+	if err := db.DB.Where("code = ?", code).First(&acc).Error; err != nil {
+		http.Error(w, "科目不存在", http.StatusNotFound)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	startStr, endStr := start.Format("2006-01-02"), end.Format("2006-01-02")
+
+	var open struct {
+		Debit  money.Amount
+		Credit money.Amount
+	}
+	oq := db.DB.Table("journal_lines jl").
+		Select("COALESCE(SUM(jl.debit), 0) as debit, COALESCE(SUM(jl.credit), 0) as credit").
+		Joins("JOIN journal_entries je ON je.id = jl.entry_id").
+		Where("jl.account_code = ? AND je.entry_date < ?", code, startStr)
+	scopeJournal(oq, claims, r).Scan(&open)
+	opening := signedBalance(acc.Type, open.Debit, open.Credit)
+
+	lines := []LedgerLine{}
+	lq := db.DB.Table("journal_lines jl").
+		Select(`je.id as entry_id, je.entry_date, je.base_id, je.source_type, je.source_id, je.description,
+			jl.memo, jl.debit, jl.credit, jl.orig_amount, jl.orig_currency as orig_cur`).
+		Joins("JOIN journal_entries je ON je.id = jl.entry_id").
+		Where("jl.account_code = ? AND je.entry_date >= ? AND je.entry_date <= ?", code, startStr, endStr).
+		Order("je.entry_date, je.id")
+	scopeJournal(lq, claims, r).Scan(&lines)
+	bal := opening
+	var debit, credit money.Amount
+	for i := range lines {
+		bal += signedBalance(acc.Type, lines[i].Debit, lines[i].Credit)
+		lines[i].Balance = bal
+		debit += lines[i].Debit
+		credit += lines[i].Credit
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"account":         acc,
+		"start_date":      startStr,
+		"end_date":        endStr,
+		"opening_balance": opening,
+		"period_debit":    debit,
+		"period_credit":   credit,
+		"closing_balance": bal,
+		"lines":           lines,
+	})
+}
+
+// ListJournalEntries 凭证列表（含分录）；参数：start_date、end_date、base_id、source_type、source_id
+func ListJournalEntries(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	if role != "admin" && role != "base_agent" {
+		http.Error(w, "无权查看账簿", http.StatusForbidden)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	q := db.DB.Table("journal_entries je").
+		Where("je.entry_date >= ? AND je.entry_date <= ?", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if st := r.URL.Query().Get("source_type"); st != "" {
+		q = q.Where("je.source_type = ?", st)
+	}
+	if sid := r.URL.Query().Get("source_id"); sid != "" {
+		q = q.Where("je.source_id = ?", sid)
+	}
+	q = scopeJournal(q, claims, r)
+	var total int64
+	q.Count(&total)
+	var ids []uint
+	q.Order("je.entry_date desc, je.id desc").Offset((page-1)*limit).Limit(limit).Pluck("je.id", &ids)
+	entries := []models.JournalEntry{}
+	if len(ids) > 0 {
+		db.DB.Preload("Lines").Preload("Base").Where("id IN ?", ids).Order("entry_date desc, id desc").Find(&entries)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"data":  entries,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// RebuildLedger 按现有业务单据重建全部自动凭证（仅管理员），用于启用总账前的历史数据补录；
+// 已有凭证沿用原记账汇率，新补凭证按当前汇率折算，已导出的凭证及已结账期间内的单据不重建
+func RebuildLedger(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以重建凭证", http.StatusForbidden)
+		return
+	}
+	counts := map[string]int{}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	fail := func(err error) {
+		tx.Rollback()
+		http.Error(w, "重建凭证失败: "+err.Error(), http.StatusInternalServerError)
+	}
+	// 已导出至外部账套的凭证保持不变
+	exported := map[string]bool{}
+	var done []models.JournalEntry
+	tx.Select("source_type, source_id").Where("export_id IS NOT NULL").Find(&done)
+	for _, e := range done {
+		exported[e.SourceType+":"+strconv.FormatUint(uint64(e.SourceID), 10)] = true
+	}
+	// 已结账的会计期间（基地+月份）内的凭证保持不变
+	closed := map[string]bool{}
+	var periods []models.AccountingPeriod
+	tx.Where("status = ?", models.PeriodStatusClosed).Find(&periods)
+	for _, p := range periods {
+		closed[strconv.FormatUint(uint64(p.BaseID), 10)+":"+p.Period] = true
+	}
+	skip := func(sourceType string, id, baseID uint, on time.Time) bool {
+		if baseID != 0 && closed[strconv.FormatUint(uint64(baseID), 10)+":"+on.Format("2006-01")] {
+			return true
+		}
+		return exported[sourceType+":"+strconv.FormatUint(uint64(id), 10)]
+	}
+
+	// 采购须先于还款，还款凭证按采购入账汇率冲减应付
+	var purchases []models.PurchaseEntry
+	tx.Order("purchase_date, id").Find(&purchases)
+	for i := range purchases {
+		if skip(models.JournalSourcePurchase, purchases[i].ID, purchases[i].BaseID, purchases[i].PurchaseDate) {
+			continue
+		}
+		if err := postPurchaseJournal(tx, &purchases[i]); err != nil {
+			fail(err)
+			return
+		}
+	}
+	counts[models.JournalSourcePurchase] = len(purchases)
+
+	var expenses []models.BaseExpense
+	tx.Order("date, id").Find(&expenses)
+	for i := range expenses {
+		if skip(models.JournalSourceExpense, expenses[i].ID, optionalBaseID(expenses[i].BaseID), expenses[i].Date) {
+			continue
+		}
+		if err := postExpenseJournal(tx, &expenses[i]); err != nil {
+			fail(err)
+			return
+		}
+	}
+	counts[models.JournalSourceExpense] = len(expenses)
+
+	var reqs []models.MaterialRequisition
+	tx.Order("request_date, id").Find(&reqs)
+	for i := range reqs {
+		if skip(models.JournalSourceRequisition, reqs[i].ID, reqs[i].BaseID, reqs[i].RequestDate) {
+			continue
+		}
+		if err := postRequisitionJournal(tx, &reqs[i]); err != nil {
+			fail(err)
+			return
+		}
+	}
+	counts[models.JournalSourceRequisition] = len(reqs)
+
+	var payments []models.PaymentRecord
+	tx.Order("payment_date, id").Find(&payments)
+	payables := map[uint]*models.PayableRecord{}
+	for i := range payments {
+		p := &payments[i]
+		pr, ok := payables[p.PayableRecordID]
+		if !ok {
+			pr = &models.PayableRecord{}
+			if err := tx.First(pr, p.PayableRecordID).Error; err != nil {
+				continue
+			}
+			payables[p.PayableRecordID] = pr
+		}
+		if skip(models.JournalSourcePayment, p.ID, pr.BaseID, p.PaymentDate) {
+			continue
+		}
+		if err := postPaymentJournal(tx, pr, p); err != nil {
+			fail(err)
+			return
+		}
+		counts[models.JournalSourcePayment]++
+	}
+
+	var reimbursements []models.ExpenseReimbursement
+	tx.Order("payment_date, id").Find(&reimbursements)
+	for i := range reimbursements {
+		if skip(models.JournalSourceReimburse, reimbursements[i].ID, reimbursements[i].BaseID, reimbursements[i].PaymentDate) {
+			continue
+		}
+		if err := postReimbursementJournal(tx, &reimbursements[i]); err != nil {
+			fail(err)
+			return
+		}
+	}
+	counts[models.JournalSourceReimburse] = len(reimbursements)
+
+	var credits []models.SupplierCreditEntry
+	tx.Where("amount > 0").Order("entry_date, id").Find(&credits)
+	for i := range credits {
+		if skip(models.JournalSourceCredit, credits[i].ID, credits[i].BaseID, credits[i].EntryDate) {
+			continue
+		}
+		if err := postCreditJournal(tx, &credits[i]); err != nil {
+			fail(err)
+			return
+		}
+	}
+	counts[models.JournalSourceCredit] = len(credits)
+
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "posted": counts})
+}
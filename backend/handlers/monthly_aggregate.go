@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 月度物化汇总的类别
+const (
+	mvExpense  = "expense"  // mv_base_expense_month：开支
+	mvSupplier = "supplier" // mv_supplier_monthly_spend：采购与付款
+)
+
+// mvMu 串行化重算，避免同一月份的删除/写入交错
+var mvMu sync.Mutex
+
+// monthRange 月份 YYYY-MM 的 [start, end)
+func monthRange(month string) (time.Time, time.Time, error) {
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return t, t.AddDate(0, 1, 0), nil
+}
+
+// monthsBetween 闭区间内的全部月份 YYYY-MM
+func monthsBetween(start, end string) ([]string, error) {
+	s, err := time.Parse("2006-01", start)
+	if err != nil {
+		return nil, err
+	}
+	e, err := time.Parse("2006-01", end)
+	if err != nil {
+		return nil, err
+	}
+	if s.After(e) {
+		s, e = e, s
+	}
+	var out []string
+	for cur := s; !cur.After(e); cur = cur.AddDate(0, 1, 0) {
+		out = append(out, cur.Format("2006-01"))
+	}
+	return out, nil
+}
+
+// mvAmountColumn 目标币种对应的折算金额列（target 须已通过 parseTargetCurrency 校验）
+func mvAmountColumn(kind, target string) string {
+	if kind == mvSupplier {
+		return "purchase_" + strings.ToLower(target)
+	}
+	return "amount_" + strings.ToLower(target)
+}
+
+// mvConvert 按当日生效汇率折算为各报表币种
+func mvConvert(rb *rateBook, amount money.Amount, curr string, d time.Time) (cny, lak, thb money.Amount) {
+	return rb.convertRaw(amount, curr, "CNY", d), rb.convertRaw(amount, curr, "LAK", d), rb.convertRaw(amount, curr, "THB", d)
+}
+
+// buildExpenseMonth 由原始开支（按分摊计入各基地）计算某月的汇总行
+func buildExpenseMonth(rb *rateBook, month string) ([]models.MVBaseExpenseMonth, error) {
+	start, end, err := monthRange(month)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		BaseID     uint
+		CategoryID uint
+		Curr       string
+		Day        string
+		Total      money.Amount
+	}
+	if err := db.DB.Table(allocatedExpenses("be")).
+		Select("COALESCE(be.base_id,0) as base_id, COALESCE(be.category_id,0) as category_id, "+recordCurrencySQL("be")+" as curr, DATE_FORMAT(be.date,'%Y-%m-%d') as day, COALESCE(SUM(be.amount),0) as total").
+		Where("be.date >= ? AND be.date < ?", start, end).
+		Where("be.status IN ?", models.ExpenseCountedStatuses).
+		Group("be.base_id, be.category_id, curr, day").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	type key struct {
+		base, cat uint
+		curr      string
+	}
+	idx := map[key]int{}
+	out := make([]models.MVBaseExpenseMonth, 0)
+	now := time.Now()
+	for _, x := range rows {
+		k := key{x.BaseID, x.CategoryID, x.Curr}
+		i, ok := idx[k]
+		if !ok {
+			i = len(out)
+			idx[k] = i
+			out = append(out, models.MVBaseExpenseMonth{BaseID: x.BaseID, CategoryID: x.CategoryID, Month: month, Currency: x.Curr, GeneratedAt: now})
+		}
+		cny, lak, thb := mvConvert(rb, x.Total, x.Curr, parseRateDay(x.Day))
+		out[i].TotalAmount += x.Total
+		out[i].AmountCNY += cny
+		out[i].AmountLAK += lak
+		out[i].AmountTHB += thb
+	}
+	return out, nil
+}
+
+// buildSupplierMonth 由原始采购与付款计算某月的汇总行；付款按应付款的供应商与基地归集，
+// 不含以供应商余额抵扣（credit）的部分
+func buildSupplierMonth(rb *rateBook, month string) ([]models.MVSupplierMonthlySpend, error) {
+	start, end, err := monthRange(month)
+	if err != nil {
+		return nil, err
+	}
+	var purRows []struct {
+		SupplierID uint
+		BaseID     uint
+		Curr       string
+		Day        string
+		Total      money.Amount
+		Cnt        int64
+	}
+	if err := db.DB.Table("purchase_entries pe").
+		Select("COALESCE(pe.supplier_id,0) as supplier_id, pe.base_id as base_id, "+recordCurrencySQL("pe")+" as curr, DATE_FORMAT(pe.purchase_date,'%Y-%m-%d') as day, COALESCE(SUM(pe.total_amount),0) as total, COUNT(pe.id) as cnt").
+		Where("pe.purchase_date >= ? AND pe.purchase_date < ?", start, end).
+		Group("pe.supplier_id, pe.base_id, curr, day").Scan(&purRows).Error; err != nil {
+		return nil, err
+	}
+	var payRows []struct {
+		SupplierID uint
+		BaseID     uint
+		Curr       string
+		Total      money.Amount
+	}
+	if err := db.DB.Table("payment_records pm").
+		Joins("JOIN payable_records pr ON pr.id = pm.payable_record_id").
+		Select("COALESCE(pr.supplier_id,0) as supplier_id, pr.base_id as base_id, "+recordCurrencySQL("pm")+" as curr, COALESCE(SUM(pm.payment_amount),0) as total").
+		Where("pm.payment_date >= ? AND pm.payment_date < ?", start, end).
+		Where("pm.payment_method <> ?", "credit").
+		Group("pr.supplier_id, pr.base_id, curr").Scan(&payRows).Error; err != nil {
+		return nil, err
+	}
+	type key struct {
+		supplier, base uint
+		curr           string
+	}
+	idx := map[key]int{}
+	out := make([]models.MVSupplierMonthlySpend, 0)
+	now := time.Now()
+	at := func(k key) *models.MVSupplierMonthlySpend {
+		i, ok := idx[k]
+		if !ok {
+			i = len(out)
+			idx[k] = i
+			out = append(out, models.MVSupplierMonthlySpend{SupplierID: k.supplier, BaseID: k.base, Month: month, Currency: k.curr, GeneratedAt: now})
+		}
+		return &out[i]
+	}
+	for _, x := range purRows {
+		m := at(key{x.SupplierID, x.BaseID, x.Curr})
+		cny, lak, thb := mvConvert(rb, x.Total, x.Curr, parseRateDay(x.Day))
+		m.TotalPurchase += x.Total
+		m.PurchaseCount += x.Cnt
+		m.PurchaseCNY += cny
+		m.PurchaseLAK += lak
+		m.PurchaseTHB += thb
+	}
+	for _, x := range payRows {
+		at(key{x.SupplierID, x.BaseID, x.Curr}).TotalPaid += x.Total
+	}
+	return out, nil
+}
+
+// recomputeMonth 重算某月某类汇总：整月删除后重新写入
+func recomputeMonth(rb *rateBook, kind, month string) error {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	var err error
+	switch kind {
+	case mvExpense:
+		var rows []models.MVBaseExpenseMonth
+		if rows, err = buildExpenseMonth(rb, month); err == nil {
+			if err = tx.Where("month = ?", month).Delete(&models.MVBaseExpenseMonth{}).Error; err == nil && len(rows) > 0 {
+				err = tx.Create(&rows).Error
+			}
+		}
+	case mvSupplier:
+		var rows []models.MVSupplierMonthlySpend
+		if rows, err = buildSupplierMonth(rb, month); err == nil {
+			if err = tx.Where("month = ?", month).Delete(&models.MVSupplierMonthlySpend{}).Error; err == nil && len(rows) > 0 {
+				err = tx.Create(&rows).Error
+			}
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// RecomputeMonthly 重算某月（YYYY-MM）的全部月度汇总
+func RecomputeMonthly(month string) error {
+	if _, _, err := monthRange(month); err != nil {
+		return err
+	}
+	mvMu.Lock()
+	defer mvMu.Unlock()
+	rb := loadRateBook(db.DB)
+	for _, kind := range []string{mvExpense, mvSupplier} {
+		if err := recomputeMonth(rb, kind, month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshMonthly 单据变更（提交事务后）时增量刷新所涉月份的汇总；失败仅记录日志，可通过一致性检查修复
+func refreshMonthly(kind string, dates ...time.Time) {
+	months := map[string]bool{}
+	for _, d := range dates {
+		if !d.IsZero() {
+			months[d.Format("2006-01")] = true
+		}
+	}
+	if len(months) == 0 {
+		return
+	}
+	mvMu.Lock()
+	defer mvMu.Unlock()
+	rb := loadRateBook(db.DB)
+	for m := range months {
+		if err := recomputeMonth(rb, kind, m); err != nil {
+			log.Printf("warn: refresh %s monthly aggregate for %s failed: %v", kind, m, err)
+		}
+	}
+}
+
+// earliestRecordMonth 最早一笔开支、采购或付款所在月份；无数据时返回空
+func earliestRecordMonth() string {
+	var days []string
+	for _, q := range []string{
+		"SELECT DATE_FORMAT(MIN(date),'%Y-%m') FROM base_expenses",
+		"SELECT DATE_FORMAT(MIN(purchase_date),'%Y-%m') FROM purchase_entries",
+		"SELECT DATE_FORMAT(MIN(payment_date),'%Y-%m') FROM payment_records",
+	} {
+		var m *string
+		db.DB.Raw(q).Scan(&m)
+		if m != nil && *m != "" {
+			days = append(days, *m)
+		}
+	}
+	first := ""
+	for _, m := range days {
+		if first == "" || m < first {
+			first = m
+		}
+	}
+	return first
+}
+
+// refreshMonthlySince 汇率变更后，重算自生效日期所在月份（不早于最早单据）至本月的全部汇总
+func refreshMonthlySince(d time.Time) {
+	from := d.Format("2006-01")
+	if first := earliestRecordMonth(); first == "" {
+		return
+	} else if first > from {
+		from = first
+	}
+	months, err := monthsBetween(from, time.Now().Format("2006-01"))
+	if err != nil {
+		return
+	}
+	for _, m := range months {
+		if err := RecomputeMonthly(m); err != nil {
+			log.Printf("warn: recompute monthly aggregates for %s failed: %v", m, err)
+		}
+	}
+}
+
+// EnsureMonthlyAggregates 启动时补建：汇总表为空而已有单据时，重算最早单据月份至本月
+func EnsureMonthlyAggregates() int {
+	var n1, n2 int64
+	db.DB.Model(&models.MVBaseExpenseMonth{}).Count(&n1)
+	db.DB.Model(&models.MVSupplierMonthlySpend{}).Count(&n2)
+	if n1 > 0 || n2 > 0 {
+		return 0
+	}
+	first := earliestRecordMonth()
+	if first == "" {
+		return 0
+	}
+	months, err := monthsBetween(first, time.Now().Format("2006-01"))
+	if err != nil {
+		return 0
+	}
+	for _, m := range months {
+		if err := RecomputeMonthly(m); err != nil {
+			log.Printf("warn: build monthly aggregates for %s failed: %v", m, err)
+		}
+	}
+	return len(months)
+}
+
+// parseMonthSpan 读取 start、end（YYYY-MM，默认本月；end 默认同 start）
+func parseMonthSpan(r *http.Request) ([]string, string) {
+	start := r.URL.Query().Get("start")
+	end := r.URL.Query().Get("end")
+	if start == "" {
+		start = time.Now().Format("2006-01")
+	}
+	if end == "" {
+		end = start
+	}
+	months, err := monthsBetween(start, end)
+	if err != nil {
+		return nil, "start/end 格式应为 YYYY-MM"
+	}
+	if len(months) > 240 {
+		return nil, "月份区间过长"
+	}
+	return months, ""
+}
+
+// RefreshMonthlyAggregates 手动重算月度汇总（仅管理员）
+// GET/POST 参数：start、end（YYYY-MM，闭区间，默认本月）
+func RefreshMonthlyAggregates(w http.ResponseWriter, r *http.Request) {
+	months, msg := parseMonthSpan(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	for _, m := range months {
+		if err := RecomputeMonthly(m); err != nil {
+			http.Error(w, "重算月度汇总失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "refreshed", "months": months})
+}
+
+// MonthlyAggregateDiff 汇总表与原始单据重算结果不一致的一行
+type MonthlyAggregateDiff struct {
+	Table    string       `json:"table"`
+	Month    string       `json:"month"`
+	Key      string       `json:"key"`
+	Field    string       `json:"field"`
+	Stored   money.Amount `json:"stored"`
+	Expected money.Amount `json:"expected"`
+}
+
+// mvCompare 按键比较两组金额，缺失的一侧记为 0
+func mvCompare(table, month string, stored, expected map[string]map[string]money.Amount) []MonthlyAggregateDiff {
+	var out []MonthlyAggregateDiff
+	keys := map[string]bool{}
+	for k := range stored {
+		keys[k] = true
+	}
+	for k := range expected {
+		keys[k] = true
+	}
+	for k := range keys {
+		fields := map[string]bool{}
+		for f := range stored[k] {
+			fields[f] = true
+		}
+		for f := range expected[k] {
+			fields[f] = true
+		}
+		for f := range fields {
+			if s, e := stored[k][f], expected[k][f]; s != e {
+				out = append(out, MonthlyAggregateDiff{Table: table, Month: month, Key: k, Field: f, Stored: s, Expected: e})
+			}
+		}
+	}
+	return out
+}
+
+func expenseMonthValues(rows []models.MVBaseExpenseMonth) map[string]map[string]money.Amount {
+	out := map[string]map[string]money.Amount{}
+	for _, x := range rows {
+		out[fmt.Sprintf("base=%d category=%d currency=%s", x.BaseID, x.CategoryID, x.Currency)] = map[string]money.Amount{
+			"total_amount": x.TotalAmount, "amount_cny": x.AmountCNY, "amount_lak": x.AmountLAK, "amount_thb": x.AmountTHB,
+		}
+	}
+	return out
+}
+
+func supplierMonthValues(rows []models.MVSupplierMonthlySpend) map[string]map[string]money.Amount {
+	out := map[string]map[string]money.Amount{}
+	for _, x := range rows {
+		out[fmt.Sprintf("supplier=%d base=%d currency=%s", x.SupplierID, x.BaseID, x.Currency)] = map[string]money.Amount{
+			"total_purchase": x.TotalPurchase, "purchase_count": money.FromInt(x.PurchaseCount), "total_paid": x.TotalPaid,
+			"purchase_cny": x.PurchaseCNY, "purchase_lak": x.PurchaseLAK, "purchase_thb": x.PurchaseTHB,
+		}
+	}
+	return out
+}
+
+// CheckMonthlyAggregates 一致性检查：按原始单据重算各月汇总并与汇总表比较（仅管理员）
+// GET 参数：start、end（YYYY-MM，闭区间，默认本月）；fix=1 时重算不一致的月份
+func CheckMonthlyAggregates(w http.ResponseWriter, r *http.Request) {
+	months, msg := parseMonthSpan(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	fix := r.URL.Query().Get("fix") == "1"
+	rb := loadRateBook(db.DB)
+	diffs := make([]MonthlyAggregateDiff, 0)
+	var bad []string
+	for _, m := range months {
+		expExpected, err := buildExpenseMonth(rb, m)
+		if err != nil {
+			http.Error(w, "重算开支汇总失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		supExpected, err := buildSupplierMonth(rb, m)
+		if err != nil {
+			http.Error(w, "重算采购汇总失败: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var expStored []models.MVBaseExpenseMonth
+		db.DB.Where("month = ?", m).Find(&expStored)
+		var supStored []models.MVSupplierMonthlySpend
+		db.DB.Where("month = ?", m).Find(&supStored)
+		d := mvCompare("mv_base_expense_month", m, expenseMonthValues(expStored), expenseMonthValues(expExpected))
+		d = append(d, mvCompare("mv_supplier_monthly_spend", m, supplierMonthValues(supStored), supplierMonthValues(supExpected))...)
+		if len(d) > 0 {
+			bad = append(bad, m)
+			diffs = append(diffs, d...)
+		}
+	}
+	fixed := []string{}
+	if fix {
+		for _, m := range bad {
+			if err := RecomputeMonthly(m); err != nil {
+				http.Error(w, "重算月度汇总失败: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fixed = append(fixed, m)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"months":            months,
+		"consistent":        len(bad) == 0,
+		"mismatched_months": bad,
+		"diffs":             diffs,
+		"fixed":             fixed,
+	})
+}
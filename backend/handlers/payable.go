@@ -4,10 +4,16 @@ import (
 	"backend/db"
 	"backend/middleware"
 	"backend/models"
+	"backend/money"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // PayableListResponse 应付款列表响应
@@ -18,21 +24,22 @@ type PayableListResponse struct {
 
 // PayableSummaryResponse 应付款汇总响应
 type PayableSummaryResponse struct {
-	TotalPayable   float64 `json:"total_payable"`   // 总应付款
-	TotalPaid      float64 `json:"total_paid"`      // 总已付款
-	TotalRemaining float64 `json:"total_remaining"` // 总剩余款
+	TotalPayable   money.Amount `json:"total_payable"`   // 总应付款
+	TotalPaid      money.Amount `json:"total_paid"`      // 总已付款
+	TotalRemaining money.Amount `json:"total_remaining"` // 总剩余款
 	PendingCount   int64   `json:"pending_count"`   // 待付款数量
 	PartialCount   int64   `json:"partial_count"`   // 部分付款数量
 	PaidCount      int64   `json:"paid_count"`      // 已付清数量
 	OverdueCount   int64   `json:"overdue_count"`   // 超期数量
+	OverdueAmount  money.Amount `json:"overdue_amount"`  // 超期未付金额（分期按已到期各期剩余计）
 }
 
 // SupplierPayableStats 供应商应付款统计
 type SupplierPayableStats struct {
 	Supplier        string  `json:"supplier"`
-	TotalAmount     float64 `json:"total_amount"`
-	PaidAmount      float64 `json:"paid_amount"`
-	RemainingAmount float64 `json:"remaining_amount"`
+	TotalAmount     money.Amount `json:"total_amount"`
+	PaidAmount      money.Amount `json:"paid_amount"`
+	RemainingAmount money.Amount `json:"remaining_amount"`
 	RecordCount     int64   `json:"record_count"`
 }
 
@@ -55,15 +62,13 @@ func ListPayable(w http.ResponseWriter, r *http.Request) {
         Preload("PurchaseEntry").
         Preload("Links").Preload("Links.PurchaseEntry").
         Preload("Base").Preload("Creator").Preload("Supplier").
+        Preload("Installments", orderedInstallments).
         Order("created_at desc")
 
 	// 权限过滤
 	if role == "base_agent" {
-		baseName := claims["base"].(string)
-		var base models.Base
-		if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-			query = query.Where("base_id = ?", base.ID)
-		}
+		ids := claimBaseIDs(claims)
+		query = query.Where("base_id IN ?", ids)
 	}
 	// 管理员可以查看所有记录，无需额外过滤
 
@@ -138,11 +143,8 @@ func GetPayableSummary(w http.ResponseWriter, r *http.Request) {
 
 	// 权限过滤
 	if role == "base_agent" {
-		baseName := claims["base"].(string)
-		var base models.Base
-		if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-			query = query.Where("base_id = ?", base.ID)
-		}
+		ids := claimBaseIDs(claims)
+		query = query.Where("base_id IN ?", ids)
 	}
 	// 管理员可以查看所有记录，无需额外过滤
 
@@ -151,11 +153,8 @@ func GetPayableSummary(w http.ResponseWriter, r *http.Request) {
     // 总计统计（单独查询，避免where叠加污染）
     totalQ := db.DB.Model(&models.PayableRecord{})
     if role == "base_agent" {
-        baseName := claims["base"].(string)
-        var base models.Base
-        if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-            totalQ = totalQ.Where("base_id = ?", base.ID)
-        }
+        ids := claimBaseIDs(claims)
+        totalQ = totalQ.Where("base_id IN ?", ids)
     }
     totalQ.Select("SUM(total_amount) as total_payable, SUM(paid_amount) as total_paid, SUM(remaining_amount) as total_remaining").Scan(&summary)
 
@@ -165,21 +164,35 @@ func GetPayableSummary(w http.ResponseWriter, r *http.Request) {
     paidQ := db.DB.Model(&models.PayableRecord{})
     overdueQ := db.DB.Model(&models.PayableRecord{})
     if role == "base_agent" {
-        baseName := claims["base"].(string)
-        var base models.Base
-        if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-            pendingQ = pendingQ.Where("base_id = ?", base.ID)
-            partialQ = partialQ.Where("base_id = ?", base.ID)
-            paidQ = paidQ.Where("base_id = ?", base.ID)
-            overdueQ = overdueQ.Where("base_id = ?", base.ID)
-        }
+        ids := claimBaseIDs(claims)
+        pendingQ = pendingQ.Where("base_id IN ?", ids)
+        partialQ = partialQ.Where("base_id IN ?", ids)
+        paidQ = paidQ.Where("base_id IN ?", ids)
+        overdueQ = overdueQ.Where("base_id IN ?", ids)
     }
     pendingQ.Where("status = ?", models.PayableStatusPending).Count(&summary.PendingCount)
     partialQ.Where("status = ?", models.PayableStatusPartial).Count(&summary.PartialCount)
     paidQ.Where("status = ?", models.PayableStatusPaid).Count(&summary.PaidCount)
 
     now := time.Now()
-    overdueQ.Where("due_date < ? AND status != ?", now, models.PayableStatusPaid).Count(&summary.OverdueCount)
+    whereOverdue(overdueQ, now).Count(&summary.OverdueCount)
+
+    // 超期金额：分期应付款取已到期各期剩余，其余取整笔剩余
+    instQ := db.DB.Table("payable_installments pi").
+        Joins("JOIN payable_records ON payable_records.id = pi.payable_record_id").
+        Where("pi.due_date < ? AND pi.status <> ?", now, models.PayableStatusPaid)
+    plainQ := db.DB.Model(&models.PayableRecord{}).
+        Where("payable_records.status <> ? AND payable_records.due_date < ?", models.PayableStatusPaid, now).
+        Where("NOT EXISTS (SELECT 1 FROM payable_installments pi WHERE pi.payable_record_id = payable_records.id)")
+    if role == "base_agent" {
+        ids := claimBaseIDs(claims)
+        instQ = instQ.Where("payable_records.base_id IN ?", ids)
+        plainQ = plainQ.Where("payable_records.base_id IN ?", ids)
+    }
+    var instOverdue, plainOverdue money.Amount
+    instQ.Select("COALESCE(SUM(pi.amount - pi.paid_amount), 0)").Scan(&instOverdue)
+    plainQ.Select("COALESCE(SUM(payable_records.remaining_amount), 0)").Scan(&plainOverdue)
+    summary.OverdueAmount = instOverdue + plainOverdue
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(summary)
@@ -224,11 +237,8 @@ func GetPayableBySupplier(w http.ResponseWriter, r *http.Request) {
 
 	// 权限过滤
     if role == "base_agent" {
-        baseName := claims["base"].(string)
-        var base models.Base
-        if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-            query = query.Where("base_id = ?", base.ID)
-        }
+        ids := claimBaseIDs(claims)
+        query = query.Where("base_id IN ?", ids)
 	}
 	// 管理员可以查看所有记录，无需额外过滤
 
@@ -254,21 +264,25 @@ func GetOverduePayables(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var payables []models.PayableRecord
-	query := db.DB.Preload("PurchaseEntry").Preload("Base").Preload("Creator").Preload("Supplier").
-		Where("due_date < ? AND status != ?", time.Now(), models.PayableStatusPaid).
-		Order("due_date asc")
+	query := whereOverdue(db.DB.Preload("PurchaseEntry").Preload("Base").Preload("Creator").Preload("Supplier").
+		Preload("Installments", orderedInstallments), time.Now())
 
 	// 权限过滤
 	if role == "base_agent" {
-		baseName := claims["base"].(string)
-		var base models.Base
-		if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-			query = query.Where("base_id = ?", base.ID)
-		}
+		ids := claimBaseIDs(claims)
+		query = query.Where("base_id IN ?", ids)
 	}
 	// 管理员可以查看所有记录，无需额外过滤
 
 	query.Find(&payables)
+	// 按最早未付清的到期日排序（分期应付款取最早未付清一期）
+	sort.SliceStable(payables, func(i, j int) bool {
+		di, dj := payables[i].NextDueDate(), payables[j].NextDueDate()
+		if di == nil || dj == nil {
+			return dj == nil && di != nil
+		}
+		return di.Before(*dj)
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(payables)
@@ -299,15 +313,13 @@ func GetPayableDetail(w http.ResponseWriter, r *http.Request) {
         Preload("PurchaseEntry").Preload("PurchaseEntry.Items").
         Preload("Links").Preload("Links.PurchaseEntry").
         Preload("Base").Preload("Creator").Preload("Supplier").
-        Preload("PaymentRecords").Preload("PaymentRecords.Creator")
+        Preload("PaymentRecords").Preload("PaymentRecords.Creator").
+        Preload("Installments", orderedInstallments)
 
 	// 权限过滤
 	if role == "base_agent" {
-		baseName := claims["base"].(string)
-		var base models.Base
-		if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-			query = query.Where("base_id = ?", base.ID)
-		}
+		ids := claimBaseIDs(claims)
+		query = query.Where("base_id IN ?", ids)
 	}
 	// 管理员可以查看所有记录，无需额外过滤
 
@@ -323,7 +335,7 @@ func GetPayableDetail(w http.ResponseWriter, r *http.Request) {
 // CreatePaymentRequest 创建还款记录请求
 type CreatePaymentRequest struct {
 	PayableID     uint    `json:"payable_id"`
-	Amount        float64 `json:"amount"`
+	Amount        money.Amount `json:"amount"`
 	PaymentDate   string  `json:"payment_date"`
 	PaymentMethod string  `json:"payment_method"`
 	Reference     string  `json:"reference"`
@@ -375,17 +387,9 @@ func CreatePayment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 权限检查：基地代理只能处理自己基地的记录
-	if role == "base_agent" {
-		baseName := claims["base"].(string)
-		var base models.Base
-		if err := db.DB.Where("name = ?", baseName).First(&base).Error; err != nil {
-			http.Error(w, "基地信息错误", http.StatusBadRequest)
-			return
-		}
-		if payable.BaseID != base.ID {
-			http.Error(w, "无权处理此应付款记录", http.StatusForbidden)
-			return
-		}
+	if role == "base_agent" && !containsUint(claimBaseIDs(claims), payable.BaseID) {
+		http.Error(w, "无权处理此应付款记录", http.StatusForbidden)
+		return
 	}
 
 	// 检查应付款状态
@@ -394,12 +398,30 @@ func CreatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 检查还款金额是否超过剩余金额
-	if req.Amount > payable.RemainingAmount {
-		http.Error(w, "还款金额不能超过剩余应付金额", http.StatusBadRequest)
+	if req.PaymentMethod == models.PaymentMethodCredit {
+		http.Error(w, "余额抵扣请使用预付款抵扣功能", http.StatusBadRequest)
 		return
 	}
 
+	// 金额按币种取整（LAK 无小数）
+	req.Amount = req.Amount.RoundFor(payable.Currency)
+	if req.Amount <= 0 {
+		http.Error(w, "还款金额必须大于0", http.StatusBadRequest)
+		return
+	}
+
+	// 超出剩余金额的部分转为供应商余额（需关联供应商）
+	applyAmount := req.Amount
+	excess := money.Amount(0)
+	if req.Amount > payable.RemainingAmount {
+		if payable.SupplierID == nil {
+			http.Error(w, "还款金额不能超过剩余应付金额", http.StatusBadRequest)
+			return
+		}
+		applyAmount = payable.RemainingAmount
+		excess = req.Amount - payable.RemainingAmount
+	}
+
 	// 解析还款日期
 	var paymentDate time.Time
 	if req.PaymentDate != "" {
@@ -413,17 +435,56 @@ func CreatePayment(w http.ResponseWriter, r *http.Request) {
 		paymentDate = time.Now()
 	}
 
+	if msg := periodLockMsg(payable.BaseID, paymentDate); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+
+	// 超过审批阈值：非管理员的付款转为付款申请，待管理员审批后才生成还款记录
+	if role != "admin" && paymentNeedsApproval(payable.Currency, req.Amount) {
+		pr, err := createPaymentRequest(&payable, req, paymentDate, userID)
+		if err != nil {
+			http.Error(w, "创建付款申请失败", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"approval_required": true, "request": pr})
+		return
+	}
+
 	// 开始事务
 	tx := db.DB.Begin()
 	if tx.Error != nil {
 		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
 		return
 	}
+	// 加锁重新读取应付款，按最新的剩余金额拆分超付部分
+	if err := lockPayable(tx, &payable, req.PayableID); err != nil {
+		tx.Rollback()
+		http.Error(w, "应付款记录不存在", http.StatusNotFound)
+		return
+	}
+	if payable.Status == models.PayableStatusPaid {
+		tx.Rollback()
+		http.Error(w, "此应付款已付清，无法继续还款", http.StatusConflict)
+		return
+	}
+	applyAmount, excess = req.Amount, 0
+	if req.Amount > payable.RemainingAmount {
+		if payable.SupplierID == nil {
+			tx.Rollback()
+			http.Error(w, "还款金额不能超过剩余应付金额", http.StatusBadRequest)
+			return
+		}
+		applyAmount = payable.RemainingAmount
+		excess = req.Amount - payable.RemainingAmount
+	}
 
 	// 创建还款记录
     payment := models.PaymentRecord{
         PayableRecordID: req.PayableID,
-        PaymentAmount:   req.Amount,
+        PaymentAmount:   applyAmount,
         Currency:        payable.Currency,
         PaymentDate:     paymentDate,
         PaymentMethod:   req.PaymentMethod,
@@ -432,32 +493,17 @@ func CreatePayment(w http.ResponseWriter, r *http.Request) {
         CreatedBy:       userID,
     }
 
-	if err := tx.Create(&payment).Error; err != nil {
+	if err := applyPayment(tx, &payable, &payment); err != nil {
 		tx.Rollback()
-		http.Error(w, "创建还款记录失败", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// 更新应付款记录
-	newPaidAmount := payable.PaidAmount + req.Amount
-	newRemainingAmount := payable.TotalAmount - newPaidAmount
-    newStatus := models.PayableStatusPartial
-    if newRemainingAmount <= 0.000001 { // 考虑浮点数精度问题
-        newStatus = models.PayableStatusPaid
-        newRemainingAmount = 0
-    }
-
-	updates := map[string]interface{}{
-		"paid_amount":      newPaidAmount,
-		"remaining_amount": newRemainingAmount,
-		"status":           newStatus,
-		"updated_at":       time.Now(),
-	}
-
-	if err := tx.Model(&payable).Updates(updates).Error; err != nil {
-		tx.Rollback()
-		http.Error(w, "更新应付款状态失败", http.StatusInternalServerError)
-		return
+	if excess > 0 {
+		if err := recordOverpayment(tx, &payable, &payment, excess); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// 提交事务
@@ -465,6 +511,7 @@ func CreatePayment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "提交事务失败", http.StatusInternalServerError)
 		return
 	}
+	refreshMonthly(mvSupplier, payment.PaymentDate)
 
 	// 返回创建的还款记录
 	db.DB.Preload("Creator").Preload("Payable").First(&payment, payment.ID)
@@ -473,6 +520,64 @@ func CreatePayment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(payment)
 }
 
+// lockPayable 在事务内加行锁读取应付款：并发还款须依次基于最新的已付、剩余金额计算
+func lockPayable(tx *gorm.DB, payable *models.PayableRecord, id uint) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(payable, id).Error
+}
+
+// applyPayment 在事务内写入还款记录，并回写应付款的已付、剩余金额与状态。
+// 符合付款条件的现金折扣会自动计入（记录在还款记录与应付款上）。
+// 调用方须先用 lockPayable 加锁读取应付款，并负责权限、金额上限校验以及事务的提交/回滚。
+func applyPayment(tx *gorm.DB, payable *models.PayableRecord, payment *models.PaymentRecord) error {
+	if payment.PaymentMethod == "" {
+		payment.PaymentMethod = models.PaymentMethodBankTransfer
+	}
+	if payment.PaymentAmount > payable.RemainingAmount {
+		return errors.New("还款金额不能超过剩余应付金额")
+	}
+	if err := periodLockErr(payable.BaseID, payment.PaymentDate); err != nil {
+		return err
+	}
+	if payment.PaymentMethod != models.PaymentMethodCredit {
+		payment.DiscountAmount = payable.EligibleDiscount(payment.PaymentAmount, payment.PaymentDate)
+	}
+	if err := tx.Create(payment).Error; err != nil {
+		return errors.New("创建还款记录失败")
+	}
+	if err := postPaymentJournal(tx, payable, payment); err != nil {
+		return err
+	}
+
+	newPaidAmount := payable.PaidAmount + payment.PaymentAmount
+	newDiscount := payable.DiscountTaken + payment.DiscountAmount
+	newRemainingAmount := payable.TotalAmount - newPaidAmount - newDiscount
+	newStatus := models.PayableStatusPartial
+	if newRemainingAmount <= 0 {
+		newStatus = models.PayableStatusPaid
+		newRemainingAmount = 0
+	}
+
+	updates := map[string]interface{}{
+		"paid_amount":      newPaidAmount,
+		"discount_taken":   newDiscount,
+		"remaining_amount": newRemainingAmount,
+		"status":           newStatus,
+		"updated_at":       time.Now(),
+	}
+	if err := tx.Model(payable).Updates(updates).Error; err != nil {
+		return errors.New("更新应付款状态失败")
+	}
+	// 分期计划：按期次顺序分摊已结清金额（含折扣）
+	if err := syncInstallments(tx, payable.ID, newPaidAmount+newDiscount); err != nil {
+		return err
+	}
+	payable.PaidAmount = newPaidAmount
+	payable.DiscountTaken = newDiscount
+	payable.RemainingAmount = newRemainingAmount
+	payable.Status = newStatus
+	return nil
+}
+
 // ListPayments 获取还款记录列表
 func ListPayments(w http.ResponseWriter, r *http.Request) {
 	claims, err := middleware.ParseJWT(r)
@@ -493,12 +598,9 @@ func ListPayments(w http.ResponseWriter, r *http.Request) {
 
 	// 权限过滤
 	if role == "base_agent" {
-		baseName := claims["base"].(string)
-		var base models.Base
-		if err := db.DB.Where("name = ?", baseName).First(&base).Error; err == nil {
-			query = query.Joins("JOIN payable_records ON payment_records.payable_record_id = payable_records.id").
-				Where("payable_records.base_id = ?", base.ID)
-		}
+		ids := claimBaseIDs(claims)
+		query = query.Joins("JOIN payable_records ON payment_records.payable_record_id = payable_records.id").
+			Where("payable_records.base_id IN ?", ids)
 	}
 	// 管理员可以查看所有记录，无需额外过滤
 
@@ -581,6 +683,10 @@ func DeletePayment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "关联的应付款记录不存在", http.StatusNotFound)
 		return
 	}
+	if msg := periodLockMsg(payable.BaseID, payment.PaymentDate); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 
 	// 开始事务
 	tx := db.DB.Begin()
@@ -589,28 +695,47 @@ func DeletePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 回滚关联的余额流水（抵扣恢复余额、超付扣回余额）
+	if err := revertPaymentCredit(tx, &payment); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 删除还款记录
 	if err := tx.Delete(&payment).Error; err != nil {
 		tx.Rollback()
 		http.Error(w, "删除还款记录失败", http.StatusInternalServerError)
 		return
 	}
+	if err := removeJournal(tx, models.JournalSourcePayment, payment.ID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Where("payment_record_id = ?", payment.ID).Delete(&models.RealizedFX{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除汇兑损益记录失败", http.StatusInternalServerError)
+		return
+	}
 
 	// 重新计算应付款状态
-	var totalPaid float64
+	var totalPaid, totalDiscount money.Amount
 	tx.Model(&models.PaymentRecord{}).Where("payable_record_id = ?", payable.ID).Select("COALESCE(SUM(payment_amount), 0)").Scan(&totalPaid)
+	tx.Model(&models.PaymentRecord{}).Where("payable_record_id = ?", payable.ID).Select("COALESCE(SUM(discount_amount), 0)").Scan(&totalDiscount)
 
-	newRemainingAmount := payable.TotalAmount - totalPaid
+	newRemainingAmount := payable.TotalAmount - totalPaid - totalDiscount
 	newStatus := models.PayableStatusPending
-    if totalPaid > 0 && newRemainingAmount > 0.000001 {
+    if totalPaid > 0 && newRemainingAmount > 0 {
         newStatus = models.PayableStatusPartial
-    } else if newRemainingAmount <= 0.000001 {
+    } else if newRemainingAmount <= 0 {
         newStatus = models.PayableStatusPaid
         newRemainingAmount = 0
     }
 
 	updates := map[string]interface{}{
 		"paid_amount":      totalPaid,
+		"discount_taken":   totalDiscount,
 		"remaining_amount": newRemainingAmount,
 		"status":           newStatus,
 		"updated_at":       time.Now(),
@@ -621,12 +746,18 @@ func DeletePayment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "更新应付款状态失败", http.StatusInternalServerError)
 		return
 	}
+	if err := syncInstallments(tx, payable.ID, totalPaid+totalDiscount); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		http.Error(w, "提交事务失败", http.StatusInternalServerError)
 		return
 	}
+	refreshMonthly(mvSupplier, payment.PaymentDate)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "还款记录删除成功"})
@@ -680,6 +811,10 @@ func UpdatePayableStatus(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "应付款记录不存在", http.StatusNotFound)
 		return
 	}
+	if msg := periodLockMsg(payable.BaseID, payable.CreatedAt, time.Now()); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 
 	// 更新状态
 	updates := map[string]interface{}{
@@ -689,10 +824,11 @@ func UpdatePayableStatus(w http.ResponseWriter, r *http.Request) {
 
 	// 如果设置为已付清，更新相关金额
 	if req.Status == models.PayableStatusPaid {
-		updates["paid_amount"] = payable.TotalAmount
-		updates["remaining_amount"] = 0.0
+		updates["paid_amount"] = payable.TotalAmount - payable.DiscountTaken
+		updates["remaining_amount"] = money.Amount(0)
 	} else if req.Status == models.PayableStatusPending {
-		updates["paid_amount"] = 0.0
+		updates["paid_amount"] = money.Amount(0)
+		updates["discount_taken"] = money.Amount(0)
 		updates["remaining_amount"] = payable.TotalAmount
 	}
 
@@ -700,6 +836,17 @@ func UpdatePayableStatus(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "更新应付款状态失败", http.StatusInternalServerError)
 		return
 	}
+	if paid, ok := updates["paid_amount"].(money.Amount); ok {
+		if d, ok := updates["discount_taken"].(money.Amount); ok {
+			paid += d
+		} else {
+			paid += payable.DiscountTaken
+		}
+		if err := syncInstallments(db.DB, payable.ID, paid); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "应付款状态更新成功"})
@@ -731,6 +878,11 @@ func DeletePayable(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if msg := periodLockMsg(pr.BaseID, pr.CreatedAt); msg != "" {
+        http.Error(w, msg, http.StatusConflict)
+        return
+    }
+
     // 若存在还款记录，禁止删除
     var payCnt int64
     if err := db.DB.Model(&models.PaymentRecord{}).Where("payable_record_id = ?", pr.ID).Count(&payCnt).Error; err == nil && payCnt > 0 {
@@ -748,6 +900,11 @@ func DeletePayable(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "删除关联链接失败", http.StatusInternalServerError)
         return
     }
+    if err := tx.Where("payable_record_id = ?", pr.ID).Delete(&models.PayableInstallment{}).Error; err != nil {
+        tx.Rollback()
+        http.Error(w, "删除分期计划失败", http.StatusInternalServerError)
+        return
+    }
     if err := tx.Delete(&models.PayableRecord{}, pr.ID).Error; err != nil {
         tx.Rollback()
         http.Error(w, "删除失败", http.StatusInternalServerError)
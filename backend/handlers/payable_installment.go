@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 超期条件：有分期计划的应付款按各期到期日判断，否则按应付款自身的 due_date
+const payableOverdueSQL = `payable_records.status <> ? AND (
+	EXISTS (SELECT 1 FROM payable_installments pi WHERE pi.payable_record_id = payable_records.id AND pi.due_date < ? AND pi.status <> ?)
+	OR (payable_records.due_date < ? AND NOT EXISTS (SELECT 1 FROM payable_installments pi2 WHERE pi2.payable_record_id = payable_records.id))
+)`
+
+// whereOverdue 为应付款查询追加超期条件
+func whereOverdue(q *gorm.DB, now time.Time) *gorm.DB {
+	return q.Where(payableOverdueSQL, models.PayableStatusPaid, now, models.PayableStatusPaid, now)
+}
+
+// orderedInstallments 分期计划按期次排序的预加载
+func orderedInstallments(q *gorm.DB) *gorm.DB {
+	return q.Order("seq asc")
+}
+
+// syncInstallments 按应付款累计已付金额重新分摊各期已付与状态（无分期计划时不做处理）
+func syncInstallments(tx *gorm.DB, payableID uint, paid money.Amount) error {
+	var items []models.PayableInstallment
+	if err := tx.Where("payable_record_id = ?", payableID).Order("seq asc").Find(&items).Error; err != nil {
+		return errors.New("读取分期计划失败")
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	models.AllocateInstallmentPayments(items, paid)
+	for i := range items {
+		if err := tx.Model(&items[i]).Updates(map[string]interface{}{
+			"paid_amount": items[i].PaidAmount,
+			"status":      items[i].Status,
+			"updated_at":  time.Now(),
+		}).Error; err != nil {
+			return errors.New("更新分期状态失败")
+		}
+	}
+	return nil
+}
+
+// rebalanceInstallments 应付总额因采购增减而变化时，差额计入最后一期（减少时自后向前扣减，扣空的期次删除），
+// 再按已付金额重新分摊
+func rebalanceInstallments(tx *gorm.DB, payableID uint, total, paid money.Amount) error {
+	var items []models.PayableInstallment
+	if err := tx.Where("payable_record_id = ?", payableID).Order("seq asc").Find(&items).Error; err != nil {
+		return errors.New("读取分期计划失败")
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	var sum money.Amount
+	for _, it := range items {
+		sum += it.Amount
+	}
+	diff := total - sum
+	if diff > 0 {
+		items[len(items)-1].Amount += diff
+	}
+	for i := len(items) - 1; i >= 0 && diff < 0; i-- {
+		cut := money.Min(items[i].Amount, -diff)
+		items[i].Amount -= cut
+		diff += cut
+	}
+	kept := items[:0]
+	for _, it := range items {
+		if it.Amount <= 0 {
+			if err := tx.Delete(&models.PayableInstallment{}, it.ID).Error; err != nil {
+				return errors.New("删除分期失败")
+			}
+			continue
+		}
+		kept = append(kept, it)
+	}
+	models.AllocateInstallmentPayments(kept, paid)
+	for i := range kept {
+		if err := tx.Model(&kept[i]).Updates(map[string]interface{}{
+			"amount":      kept[i].Amount,
+			"paid_amount": kept[i].PaidAmount,
+			"status":      kept[i].Status,
+			"updated_at":  time.Now(),
+		}).Error; err != nil {
+			return errors.New("更新分期计划失败")
+		}
+	}
+	return nil
+}
+
+type installmentInput struct {
+	DueDate string       `json:"due_date"`
+	Amount  money.Amount `json:"amount"`
+}
+
+// SetPayableInstallments 设置（替换）应付款的分期计划
+// 参数：id；请求体 {installments:[{due_date:"YYYY-MM-DD", amount}]}，空数组表示取消分期
+// 各期合计须等于应付总额；已付金额按期次顺序重新分摊
+func SetPayableInstallments(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	if role != "admin" && role != "base_agent" {
+		http.Error(w, "无权设置分期计划", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if id == 0 {
+		http.Error(w, "无效的应付款ID", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Installments []installmentInput `json:"installments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "请求数据格式错误", http.StatusBadRequest)
+		return
+	}
+
+	// 在事务内加锁读取应付款，避免分期按过期的已付金额分摊
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	fail := func(msg string, code int) {
+		tx.Rollback()
+		http.Error(w, msg, code)
+	}
+	var payable models.PayableRecord
+	if err := lockPayable(tx, &payable, uint(id)); err != nil {
+		fail("应付款记录不存在", http.StatusNotFound)
+		return
+	}
+	if role == "base_agent" && !containsUint(claimBaseIDs(claims), payable.BaseID) {
+		fail("无权处理此应付款记录", http.StatusForbidden)
+		return
+	}
+	if msg := periodLockMsg(payable.BaseID, payable.CreatedAt, time.Now()); msg != "" {
+		fail(msg, http.StatusConflict)
+		return
+	}
+	if payable.Status == models.PayableStatusPaid && len(body.Installments) > 0 {
+		fail("此应付款已付清，无需设置分期", http.StatusBadRequest)
+		return
+	}
+
+	items := make([]models.PayableInstallment, 0, len(body.Installments))
+	var sum money.Amount
+	for i, in := range body.Installments {
+		d, err := time.Parse("2006-01-02", in.DueDate)
+		if err != nil {
+			fail("第"+strconv.Itoa(i+1)+"期到期日格式错误", http.StatusBadRequest)
+			return
+		}
+		in.Amount = in.Amount.RoundFor(payable.Currency)
+		if in.Amount <= 0 {
+			fail("第"+strconv.Itoa(i+1)+"期金额必须大于0", http.StatusBadRequest)
+			return
+		}
+		sum += in.Amount
+		items = append(items, models.PayableInstallment{
+			PayableRecordID: payable.ID,
+			DueDate:         d,
+			Amount:          in.Amount,
+			Status:          models.PayableStatusPending,
+		})
+	}
+	if len(items) > 0 && sum != payable.TotalAmount {
+		fail("分期金额合计须等于应付总额", http.StatusBadRequest)
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DueDate.Before(items[j].DueDate) })
+	for i := range items {
+		items[i].Seq = i + 1
+	}
+	models.AllocateInstallmentPayments(items, payable.PaidAmount+payable.DiscountTaken)
+
+	if err := tx.Where("payable_record_id = ?", payable.ID).Delete(&models.PayableInstallment{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "清除原分期计划失败", http.StatusInternalServerError)
+		return
+	}
+	if len(items) > 0 {
+		if err := tx.Create(&items).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "保存分期计划失败", http.StatusInternalServerError)
+			return
+		}
+		// 应付款到期日同步为最后一期，便于未识别分期的旧报表使用
+		last := items[len(items)-1].DueDate
+		if err := tx.Model(&payable).Updates(map[string]interface{}{"due_date": last, "updated_at": time.Now()}).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "更新应付款到期日失败", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+
+	db.DB.Preload("Installments", orderedInstallments).First(&payable, payable.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payable)
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// paymentNeedsApproval 判断某币种的单笔付款是否超过审批阈值（未配置阈值的币种不需审批）
+func paymentNeedsApproval(currency string, amount money.Amount) bool {
+	var th models.PaymentApprovalThreshold
+	if err := db.DB.Where("currency = ?", strings.ToUpper(currency)).First(&th).Error; err != nil {
+		return false
+	}
+	return amount > th.Amount
+}
+
+// createPaymentRequest 为应付款生成一条待审批的付款申请
+func createPaymentRequest(payable *models.PayableRecord, req CreatePaymentRequest, paymentDate time.Time, uid uint) (models.PaymentRequest, error) {
+	method := req.PaymentMethod
+	if method == "" {
+		method = models.PaymentMethodBankTransfer
+	}
+	pr := models.PaymentRequest{
+		PayableRecordID: payable.ID,
+		BaseID:          payable.BaseID,
+		Amount:          req.Amount,
+		Currency:        payable.Currency,
+		PaymentDate:     paymentDate,
+		PaymentMethod:   method,
+		ReferenceNumber: req.Reference,
+		Notes:           req.Note,
+		Status:          models.PaymentRequestPending,
+		RequestedBy:     uid,
+	}
+	if err := db.DB.Create(&pr).Error; err != nil {
+		return pr, err
+	}
+	return pr, nil
+}
+
+// ListPaymentThresholds 付款审批阈值列表
+func ListPaymentThresholds(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var rows []models.PaymentApprovalThreshold
+	db.DB.Order("currency asc").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// UpsertPaymentThreshold 新增/更新某币种的审批阈值（仅管理员）
+func UpsertPaymentThreshold(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权限", http.StatusForbidden)
+		return
+	}
+	var body struct {
+		Currency string       `json:"currency"`
+		Amount   money.Amount `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	c := strings.ToUpper(strings.TrimSpace(body.Currency))
+	if c == "" {
+		http.Error(w, "currency 必填", http.StatusBadRequest)
+		return
+	}
+	if body.Amount < 0 {
+		http.Error(w, "阈值不能为负数", http.StatusBadRequest)
+		return
+	}
+	var th models.PaymentApprovalThreshold
+	if err := db.DB.Where("currency = ?", c).First(&th).Error; err == nil {
+		th.Amount = body.Amount
+		th.UpdatedBy = claimUserID(claims)
+		db.DB.Save(&th)
+	} else {
+		th = models.PaymentApprovalThreshold{Currency: c, Amount: body.Amount, UpdatedBy: claimUserID(claims)}
+		if err := db.DB.Create(&th).Error; err != nil {
+			http.Error(w, "保存阈值失败", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(th)
+}
+
+// DeletePaymentThreshold 删除某币种的审批阈值（该币种付款不再需要审批）
+func DeletePaymentThreshold(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "无权限", http.StatusForbidden)
+		return
+	}
+	c := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency")))
+	if c == "" {
+		http.Error(w, "currency 必填", http.StatusBadRequest)
+		return
+	}
+	db.DB.Where("currency = ?", c).Delete(&models.PaymentApprovalThreshold{})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
+
+// SubmitPaymentRequest 主动提交付款申请（不论是否超过阈值）
+func SubmitPaymentRequest(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	if role != "admin" && role != "base_agent" {
+		http.Error(w, "无权提交付款申请", http.StatusForbidden)
+		return
+	}
+	uid := claimUserID(claims)
+	if uid == 0 {
+		http.Error(w, "token缺少用户信息", http.StatusUnauthorized)
+		return
+	}
+	var req CreatePaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "请求数据格式错误", http.StatusBadRequest)
+		return
+	}
+	if req.PayableID == 0 || req.Amount <= 0 {
+		http.Error(w, "应付款ID和还款金额不能为空", http.StatusBadRequest)
+		return
+	}
+	var payable models.PayableRecord
+	if err := db.DB.First(&payable, req.PayableID).Error; err != nil {
+		http.Error(w, "应付款记录不存在", http.StatusNotFound)
+		return
+	}
+	if role == "base_agent" && !containsUint(claimBaseIDs(claims), payable.BaseID) {
+		http.Error(w, "无权处理此应付款记录", http.StatusForbidden)
+		return
+	}
+	if payable.Status == models.PayableStatusPaid {
+		http.Error(w, "此应付款已付清，无法继续还款", http.StatusBadRequest)
+		return
+	}
+	req.Amount = req.Amount.RoundFor(payable.Currency)
+	if req.Amount <= 0 {
+		http.Error(w, "还款金额必须大于0", http.StatusBadRequest)
+		return
+	}
+	if req.Amount > payable.RemainingAmount && payable.SupplierID == nil {
+		http.Error(w, "还款金额不能超过剩余应付金额", http.StatusBadRequest)
+		return
+	}
+	paymentDate := time.Now()
+	if req.PaymentDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.PaymentDate)
+		if err != nil {
+			http.Error(w, "还款日期格式错误", http.StatusBadRequest)
+			return
+		}
+		paymentDate = parsed
+	}
+	pr, err := createPaymentRequest(&payable, req, paymentDate, uid)
+	if err != nil {
+		http.Error(w, "创建付款申请失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pr)
+}
+
+// ListPaymentRequests 付款申请列表；status=pending 即为待审批队列
+// 支持过滤：status、payable_id、base_id（仅管理员）
+func ListPaymentRequests(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	q := db.DB.Preload("PayableRecord").Preload("PayableRecord.Supplier").Preload("PayableRecord.Base").
+		Preload("Requester").Preload("Approver")
+	if role == "base_agent" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	} else if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if pid := r.URL.Query().Get("payable_id"); pid != "" {
+		q = q.Where("payable_record_id = ?", pid)
+	}
+	// 待审批按提交先后排队，其余按最近处理排序
+	if status == models.PaymentRequestPending {
+		q = q.Order("created_at asc")
+	} else {
+		q = q.Order("created_at desc")
+	}
+	var rows []models.PaymentRequest
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// PaymentRequestQueue 待审批队列
+func PaymentRequestQueue(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	q.Set("status", models.PaymentRequestPending)
+	r.URL.RawQuery = q.Encode()
+	ListPaymentRequests(w, r)
+}
+
+type reviewPaymentRequestReq struct {
+	Comment string `json:"comment"`
+}
+
+// ApprovePaymentRequest 管理员批准付款申请：生成还款记录并更新应付款
+// 双人控制：申请人不能审批自己的申请
+func ApprovePaymentRequest(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以审批付款申请", http.StatusForbidden)
+		return
+	}
+	uid := claimUserID(claims)
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if id == 0 {
+		http.Error(w, "无效的申请ID", http.StatusBadRequest)
+		return
+	}
+	var body reviewPaymentRequestReq
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	// 锁定申请行：并发审批同一申请时后到者等待，再读到已处理状态
+	var pr models.PaymentRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pr, id).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "付款申请不存在", http.StatusNotFound)
+		return
+	}
+	if pr.Status != models.PaymentRequestPending {
+		tx.Rollback()
+		http.Error(w, "该申请已处理", http.StatusBadRequest)
+		return
+	}
+	if pr.RequestedBy == uid {
+		tx.Rollback()
+		http.Error(w, "不能审批自己提交的付款申请", http.StatusForbidden)
+		return
+	}
+	// 锁定应付款：与直接还款、银行流水确认并发时按最新剩余金额计算
+	var payable models.PayableRecord
+	if err := lockPayable(tx, &payable, pr.PayableRecordID); err != nil {
+		tx.Rollback()
+		http.Error(w, "应付款记录不存在", http.StatusNotFound)
+		return
+	}
+	if payable.Status == models.PayableStatusPaid {
+		tx.Rollback()
+		http.Error(w, "此应付款已付清，无法继续还款", http.StatusBadRequest)
+		return
+	}
+	// 超出剩余应付的部分转为供应商余额
+	applyAmount, excess := pr.Amount, money.Amount(0)
+	if pr.Amount > payable.RemainingAmount {
+		if payable.SupplierID == nil {
+			tx.Rollback()
+			http.Error(w, "还款金额已超过当前剩余应付金额", http.StatusBadRequest)
+			return
+		}
+		applyAmount, excess = payable.RemainingAmount, pr.Amount-payable.RemainingAmount
+	}
+	payment := models.PaymentRecord{
+		PayableRecordID: payable.ID,
+		PaymentAmount:   applyAmount,
+		Currency:        payable.Currency,
+		PaymentDate:     pr.PaymentDate,
+		PaymentMethod:   pr.PaymentMethod,
+		ReferenceNumber: pr.ReferenceNumber,
+		Notes:           pr.Notes,
+		CreatedBy:       pr.RequestedBy,
+	}
+	if err := applyPayment(tx, &payable, &payment); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if excess > 0 {
+		if err := recordOverpayment(tx, &payable, &payment, excess); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	now := time.Now()
+	res := tx.Model(&models.PaymentRequest{}).Where("id = ? AND status = ?", pr.ID, models.PaymentRequestPending).Updates(map[string]interface{}{
+		"status":            models.PaymentRequestApproved,
+		"approver_id":       uid,
+		"reviewed_at":       now,
+		"comment":           body.Comment,
+		"payment_record_id": payment.ID,
+	})
+	if res.Error != nil {
+		tx.Rollback()
+		http.Error(w, "更新付款申请失败", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		http.Error(w, "该申请已处理", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	refreshMonthly(mvSupplier, payment.PaymentDate)
+	db.DB.Preload("Requester").Preload("Approver").First(&pr, pr.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"request": pr, "payment": payment})
+}
+
+// RejectPaymentRequest 管理员驳回付款申请，驳回意见必填并保留
+func RejectPaymentRequest(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以审批付款申请", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if id == 0 {
+		http.Error(w, "无效的申请ID", http.StatusBadRequest)
+		return
+	}
+	var body reviewPaymentRequestReq
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Comment) == "" {
+		http.Error(w, "驳回意见不能为空", http.StatusBadRequest)
+		return
+	}
+	var pr models.PaymentRequest
+	if err := db.DB.First(&pr, id).Error; err != nil {
+		http.Error(w, "付款申请不存在", http.StatusNotFound)
+		return
+	}
+	if pr.Status != models.PaymentRequestPending {
+		http.Error(w, "该申请已处理", http.StatusBadRequest)
+		return
+	}
+	uid := claimUserID(claims)
+	now := time.Now()
+	// 仅待审批的申请可驳回，避免与并发的审批互相覆盖
+	res := db.DB.Model(&models.PaymentRequest{}).Where("id = ? AND status = ?", pr.ID, models.PaymentRequestPending).Updates(map[string]interface{}{
+		"status":      models.PaymentRequestRejected,
+		"approver_id": uid,
+		"reviewed_at": now,
+		"comment":     strings.TrimSpace(body.Comment),
+	})
+	if res.Error != nil {
+		http.Error(w, "更新付款申请失败", http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		http.Error(w, "该申请已处理", http.StatusBadRequest)
+		return
+	}
+	db.DB.Preload("Requester").Preload("Approver").First(&pr, pr.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pr)
+}
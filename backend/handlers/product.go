@@ -4,6 +4,7 @@ import (
 	"backend/db"
 	"backend/middleware"
 	"backend/models"
+	"backend/money"
 	"encoding/csv"
 	"encoding/json"
 	"io"
@@ -15,23 +16,23 @@ import (
 )
 
 type productCreateReq struct {
-	Name       string  `json:"name"`
-	BaseUnit   string  `json:"base_unit"`
-	Spec       string  `json:"spec"`
-	UnitPrice  float64 `json:"unit_price"`
-	Currency   string  `json:"currency"`
-	SupplierID *uint   `json:"supplier_id,omitempty"`
-	Status     string  `json:"status"`
+	Name       string       `json:"name"`
+	BaseUnit   string       `json:"base_unit"`
+	Spec       string       `json:"spec"`
+	UnitPrice  money.Amount `json:"unit_price"`
+	Currency   string       `json:"currency"`
+	SupplierID *uint        `json:"supplier_id,omitempty"`
+	Status     string       `json:"status"`
 }
 
 type productUpdateReq struct {
-	Name       *string  `json:"name,omitempty"`
-	BaseUnit   *string  `json:"base_unit,omitempty"`
-	Spec       *string  `json:"spec,omitempty"`
-	UnitPrice  *float64 `json:"unit_price,omitempty"`
-	Currency   *string  `json:"currency,omitempty"`
-	SupplierID *uint    `json:"supplier_id,omitempty"`
-	Status     *string  `json:"status,omitempty"`
+	Name       *string       `json:"name,omitempty"`
+	BaseUnit   *string       `json:"base_unit,omitempty"`
+	Spec       *string       `json:"spec,omitempty"`
+	UnitPrice  *money.Amount `json:"unit_price,omitempty"`
+	Currency   *string       `json:"currency,omitempty"`
+	SupplierID *uint         `json:"supplier_id,omitempty"`
+	Status     *string       `json:"status,omitempty"`
 }
 
 // ListProduct 商品列表，支持按名称和供应商筛选，返回分页和总数
@@ -274,14 +275,14 @@ func ExportProductCSV(w http.ResponseWriter, r *http.Request) {
 		if pp, ok := ppMap[p.ID]; ok {
 			purchaseUnit = pp.Unit
 			purchaseFactor = strconv.FormatFloat(pp.FactorToBase, 'f', 4, 64)
-			purchasePrice = strconv.FormatFloat(pp.PurchasePrice, 'f', 2, 64)
+			purchasePrice = pp.PurchasePrice.StringFixed(2)
 		}
 		_ = cw.Write([]string{
 			strconv.FormatUint(uint64(p.ID), 10),
 			p.Name,
 			p.Spec,
 			p.BaseUnit,
-			strconv.FormatFloat(p.UnitPrice, 'f', 2, 64),
+			p.UnitPrice.StringFixed(2),
 			p.Currency,
 			supID,
 			supName,
@@ -366,9 +367,9 @@ func ImportProductCSV(w http.ResponseWriter, r *http.Request) {
 		baseUnit := get("base_unit")
 		unitPriceStr := get("unit_price")
 		currency := strings.ToUpper(strings.TrimSpace(get("currency")))
-		var unitPrice float64
+		var unitPrice money.Amount
 		if unitPriceStr != "" {
-			if v, e := strconv.ParseFloat(unitPriceStr, 64); e == nil {
+			if v, e := money.Parse(unitPriceStr); e == nil {
 				unitPrice = v
 			}
 		}
@@ -381,9 +382,9 @@ func ImportProductCSV(w http.ResponseWriter, r *http.Request) {
 				purchaseFactor = v
 			}
 		}
-		var purchasePrice float64
+		var purchasePrice money.Amount
 		if purchasePriceStr != "" {
-			if v, e := strconv.ParseFloat(purchasePriceStr, 64); e == nil {
+			if v, e := money.Parse(purchasePriceStr); e == nil {
 				purchasePrice = v
 			}
 		}
@@ -398,7 +399,7 @@ func ImportProductCSV(w http.ResponseWriter, r *http.Request) {
 			var sup models.Supplier
 			if err := db.DB.Where("name = ?", sname).First(&sup).Error; err != nil {
 				// 若不存在则创建
-				sup = models.Supplier{Name: sname, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+				sup = models.Supplier{Name: sname, AutoApplyCredit: true, CreatedAt: time.Now(), UpdatedAt: time.Now()}
 				_ = db.DB.Create(&sup).Error
 			}
 			supplierID = &sup.ID
@@ -456,7 +457,7 @@ func ImportProductCSV(w http.ResponseWriter, r *http.Request) {
 func readFileFromMultipart(fh *multipart.FileHeader) ([]byte, error) { return nil, nil }
 
 // upsertPurchaseParamForProduct 在导入过程中同步采购参数与单位规格
-func upsertPurchaseParamForProduct(productID uint, unit string, factor float64, price float64) error {
+func upsertPurchaseParamForProduct(productID uint, unit string, factor float64, price money.Amount) error {
 	unit = strings.TrimSpace(unit)
 	if productID == 0 || unit == "" || factor <= 0 || price <= 0 {
 		return nil
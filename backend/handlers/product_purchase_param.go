@@ -4,6 +4,7 @@ import (
 	"backend/db"
 	"backend/middleware"
 	"backend/models"
+	"backend/money"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -33,10 +34,10 @@ func GetProductPurchaseParam(w http.ResponseWriter, r *http.Request) {
 }
 
 type purchaseParamReq struct {
-	ProductID     uint    `json:"product_id"`
-	Unit          string  `json:"unit"`
-	FactorToBase  float64 `json:"factor_to_base"`
-	PurchasePrice float64 `json:"purchase_price"`
+	ProductID     uint         `json:"product_id"`
+	Unit          string       `json:"unit"`
+	FactorToBase  float64      `json:"factor_to_base"`
+	PurchasePrice money.Amount `json:"purchase_price"`
 }
 
 // UpsertProductPurchaseParam 新增或更新商品采购参数（管理员）
@@ -4,6 +4,7 @@ import (
 	"backend/db"
 	"backend/middleware"
 	"backend/models"
+	"backend/money"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,21 +18,23 @@ import (
 )
 
 type PurchaseItemReq struct {
-	ProductName string  `json:"product_name"`
-	Unit        string  `json:"unit"`
-	Quantity    float64 `json:"quantity"`
-	UnitPrice   float64 `json:"unit_price"`
-	Amount      float64 `json:"amount"`
+	ProductName string       `json:"product_name"`
+	Unit        string       `json:"unit"`
+	Quantity    float64      `json:"quantity"`
+	UnitPrice   money.Amount `json:"unit_price"`
+	Amount      money.Amount `json:"amount"`
 }
 type PurchaseReq struct {
 	SupplierID   *uint             `json:"supplier_id,omitempty"` // 供应商ID
 	OrderNumber  string            `json:"order_number"`
 	PurchaseDate string            `json:"purchase_date"` // yyyy-mm-dd
-	TotalAmount  float64           `json:"total_amount"`
+	TotalAmount  money.Amount      `json:"total_amount"`
 	Currency     string            `json:"currency"`
 	Receiver     string            `json:"receiver"`
 	BaseID       uint              `json:"base_id"` // 所属基地ID
 	Items        []PurchaseItemReq `json:"items"`
+	// 是否用供应商预付款/余额抵扣新应付款；省略时按供应商的 auto_apply_credit 配置
+	ApplyCredit *bool `json:"apply_credit,omitempty"`
 }
 
 func CreatePurchase(w http.ResponseWriter, r *http.Request) {
@@ -162,11 +165,15 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pd, _ := time.Parse("2006-01-02", req.PurchaseDate)
+	if msg := periodLockMsg(baseID, pd); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 	// 若未提供总额，按明细求和
 	if req.TotalAmount <= 0 {
-		var sum float64
+		var sum money.Amount
 		for _, it := range req.Items {
-			sum += it.Quantity * it.UnitPrice
+			sum += it.UnitPrice.Mul(it.Quantity)
 		}
 		req.TotalAmount = sum
 	}
@@ -207,6 +214,7 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 	if purchaseCurrency == "" {
 		purchaseCurrency = "CNY"
 	}
+	req.TotalAmount = req.TotalAmount.RoundFor(purchaseCurrency)
 
 	p := models.PurchaseEntry{
 		SupplierID:   req.SupplierID, // 使用SupplierID而不是Supplier
@@ -295,7 +303,7 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 		// 金额回填
 		amount := item.Amount
 		if amount <= 0 {
-			amount = item.Quantity * unitPrice
+			amount = unitPrice.Mul(item.Quantity)
 		}
 		items[i] = models.PurchaseEntryItem{
 			PurchaseEntryID: p.ID,
@@ -303,7 +311,7 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 			Unit:            useUnit,
 			Quantity:        item.Quantity,
 			UnitPrice:       unitPrice,
-			Amount:          amount,
+			Amount:          amount.RoundFor(purchaseCurrency),
 			QuantityBase:    qBase,
 		}
 	}
@@ -319,12 +327,14 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 	// - 若供应商结算方式为 immediate（即付），则按采购单生成独立的应付款
 	// - 若为 monthly（按月）或 flexible（不定期），则聚合到该供应商+基地的未结清应付款；
 	//   monthly 会按采购月聚合到 period_month 相同的记录
+	// - 供应商配置了付款条件（net/eom）时，新应付款的到期日与现金折扣按付款条件计算
+	//   （聚合应付款以期间结算日为开票日，避免后续采购沿用首笔采购的折扣期限）
 
 	// 读取供应商结算方式（可为空）
 	settlementType := "flexible"
 	settlementDay := 0
+	var sup models.Supplier
 	if req.SupplierID != nil && *req.SupplierID != 0 {
-		var sup models.Supplier
 		if err := tx.First(&sup, *req.SupplierID).Error; err == nil {
 			if sup.SettlementType != "" {
 				settlementType = sup.SettlementType
@@ -350,8 +360,11 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 
 	var payable models.PayableRecord
 	if settlementType == "immediate" {
-		// 独立创建
+		// 独立创建：默认30天到期，配置了付款条件则按条件计算
 		dueDate := pd.AddDate(0, 0, 30)
+		if d := sup.TermsDueDate(pd); d != nil {
+			dueDate = *d
+		}
 		// 提取用户ID
 		var uid uint
 		if v, ok := claims["uid"]; ok && v != nil {
@@ -369,18 +382,20 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 		}
 
 		payable = models.PayableRecord{
-			PurchaseEntryID: &p.ID,
-			SupplierID:      req.SupplierID,
-			TotalAmount:     req.TotalAmount,
-			PaidAmount:      0,
-			RemainingAmount: req.TotalAmount,
-			Currency:        purchaseCurrency,
-			Status:          models.PayableStatusPending,
-			DueDate:         &dueDate,
-			BaseID:          baseID,
-			CreatedBy:       uid,
-			PeriodMonth:     periodMonth,
-			PeriodHalf:      periodHalf,
+			PurchaseEntryID:  &p.ID,
+			SupplierID:       req.SupplierID,
+			TotalAmount:      req.TotalAmount,
+			PaidAmount:       0,
+			RemainingAmount:  req.TotalAmount,
+			Currency:         purchaseCurrency,
+			Status:           models.PayableStatusPending,
+			DueDate:          &dueDate,
+			DiscountPercent:  sup.DiscountPercent,
+			DiscountDeadline: sup.TermsDiscountDeadline(pd),
+			BaseID:           baseID,
+			CreatedBy:        uid,
+			PeriodMonth:      periodMonth,
+			PeriodHalf:       periodHalf,
 		}
 		if err := tx.Create(&payable).Error; err != nil {
 			tx.Rollback()
@@ -410,20 +425,28 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 		err := q.First(&payable).Error
 		if err != nil {
 			// 未找到则创建新的聚合应付款
+			// 聚合应付款按期间结算日（按月为当月结算日，未设置则月末；不定期为半年末）计算付款条件，
+			// 同期所有采购共用同一到期日与折扣期限，不随首笔采购日期变化
+			y, m, _ := pd.Date()
+			var settleDate time.Time
 			var due *time.Time
 			if settlementType == "monthly" {
-				// 按月：到期日为当月结算日（若未设置，默认月末）
-				y, m, _ := pd.Date()
 				day := settlementDay
 				if day <= 0 || day > 28 { // 简化处理：>28按月末
-					// 月末
-					firstNext := time.Date(y, m, 1, 0, 0, 0, 0, pd.Location()).AddDate(0, 1, 0)
-					lastOfMonth := firstNext.AddDate(0, 0, -1)
-					due = &lastOfMonth
+					settleDate = time.Date(y, m, 1, 0, 0, 0, 0, pd.Location()).AddDate(0, 1, -1)
 				} else {
-					d := time.Date(y, m, day, 0, 0, 0, 0, pd.Location())
-					due = &d
+					settleDate = time.Date(y, m, day, 0, 0, 0, 0, pd.Location())
 				}
+				// 按月：到期日为当月结算日
+				d := settleDate
+				due = &d
+			} else if m <= 6 {
+				settleDate = time.Date(y, 6, 30, 0, 0, 0, 0, pd.Location())
+			} else {
+				settleDate = time.Date(y, 12, 31, 0, 0, 0, 0, pd.Location())
+			}
+			if d := sup.TermsDueDate(settleDate); d != nil {
+				due = d
 			}
 			// 提取用户ID
 			var uid2 uint
@@ -438,17 +461,19 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 			}
 
 			payable = models.PayableRecord{
-				SupplierID:      req.SupplierID,
-				TotalAmount:     0,
-				PaidAmount:      0,
-				RemainingAmount: 0,
-				Currency:        purchaseCurrency,
-				Status:          models.PayableStatusPending,
-				DueDate:         due,
-				BaseID:          baseID,
-				CreatedBy:       uid2,
-				PeriodMonth:     periodMonth,
-				PeriodHalf:      periodHalf,
+				SupplierID:       req.SupplierID,
+				TotalAmount:      0,
+				PaidAmount:       0,
+				RemainingAmount:  0,
+				Currency:         purchaseCurrency,
+				Status:           models.PayableStatusPending,
+				DueDate:          due,
+				DiscountPercent:  sup.DiscountPercent,
+				DiscountDeadline: sup.TermsDiscountDeadline(settleDate),
+				BaseID:           baseID,
+				CreatedBy:        uid2,
+				PeriodMonth:      periodMonth,
+				PeriodHalf:       periodHalf,
 			}
 			if err := tx.Create(&payable).Error; err != nil {
 				tx.Rollback()
@@ -475,7 +500,7 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 		newTotal := payable.TotalAmount + req.TotalAmount
 		updates := map[string]interface{}{
 			"total_amount":     newTotal,
-			"remaining_amount": newTotal - payable.PaidAmount,
+			"remaining_amount": newTotal - payable.PaidAmount - payable.DiscountTaken,
 			"updated_at":       time.Now(),
 		}
 		if err := tx.Model(&payable).Updates(updates).Error; err != nil {
@@ -484,6 +509,36 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "更新应付款金额失败", http.StatusInternalServerError)
 			return
 		}
+		if err := rebalanceInstallments(tx, payable.ID, newTotal, payable.PaidAmount+payable.DiscountTaken); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// 生成采购凭证（须在余额抵扣前，抵扣还款按采购入账汇率冲减应付）
+	if err := postPurchaseJournal(tx, &p); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 预付款/余额抵扣：按请求或供应商配置，自动用余额冲抵刚生成/累计的应付款
+	applyCredit := false
+	if req.ApplyCredit != nil {
+		applyCredit = *req.ApplyCredit
+	} else if sup.ID != 0 {
+		applyCredit = sup.AutoApplyCredit
+	}
+	if applyCredit && payable.ID != 0 {
+		if err := tx.First(&payable, payable.ID).Error; err == nil {
+			if _, err := applySupplierCredit(tx, &payable, 0, creatorID); err != nil {
+				tx.Rollback()
+				log.Printf("[CreatePurchase] apply supplier credit error: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
 	}
 
 	// 提交事务
@@ -491,6 +546,7 @@ func CreatePurchase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "提交事务失败", http.StatusInternalServerError)
 		return
 	}
+	refreshMonthly(mvSupplier, p.PurchaseDate)
 
 	// 预加载关联数据用于返回
 	db.DB.Preload("Items").Preload("Base").Preload("Supplier").First(&p, p.ID)
@@ -808,11 +864,11 @@ func ProductSuggestions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type Row struct {
-		ProductID   *uint   `json:"product_id,omitempty"`
-		ProductName string  `json:"product_name"`
-		AvgPrice    float64 `json:"avg_price"`
-		Times       int64   `json:"times"`
-		LastDate    string  `json:"last_date"`
+		ProductID   *uint        `json:"product_id,omitempty"`
+		ProductName string       `json:"product_name"`
+		AvgPrice    money.Amount `json:"avg_price"`
+		Times       int64        `json:"times"`
+		LastDate    string       `json:"last_date"`
 	}
 	var rows []Row
 	db.DB.
@@ -858,6 +914,10 @@ func DeletePurchase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "无权删除该记录", http.StatusForbidden)
 		return
 	}
+	if msg := periodLockMsg(purchase.BaseID, purchase.PurchaseDate); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 
 	// 事务内处理应付款关系后删除
 	tx := db.DB.Begin()
@@ -886,6 +946,11 @@ func DeletePurchase(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, "更新应付款失败", http.StatusInternalServerError)
 				return
 			}
+			if err := rebalanceInstallments(tx, pr.ID, pr.TotalAmount, pr.PaidAmount+pr.DiscountTaken); err != nil {
+				tx.Rollback()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 	}
 	if err := tx.Where("purchase_entry_id = ?", purchase.ID).Delete(&models.PayableLink{}).Error; err != nil {
@@ -908,6 +973,11 @@ func DeletePurchase(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "存在已还款的应付款记录，禁止删除对应采购，请先撤销还款或手动处理", http.StatusBadRequest)
 			return
 		}
+		if err := tx.Where("payable_record_id = ?", pr.ID).Delete(&models.PayableInstallment{}).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "删除分期计划失败", http.StatusInternalServerError)
+			return
+		}
 		if err := tx.Delete(&models.PayableRecord{}, pr.ID).Error; err != nil {
 			tx.Rollback()
 			http.Error(w, "删除关联应付款失败", http.StatusInternalServerError)
@@ -926,10 +996,16 @@ func DeletePurchase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "删除采购失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := removeJournal(tx, models.JournalSourcePurchase, purchase.ID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	if err := tx.Commit().Error; err != nil {
 		http.Error(w, "提交失败", http.StatusInternalServerError)
 		return
 	}
+	refreshMonthly(mvSupplier, purchase.PurchaseDate)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -992,6 +1068,15 @@ func UpdatePurchase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "日期格式错误", http.StatusBadRequest)
 		return
 	}
+	// 原记录与修改后的日期所在期间均须未结账
+	if msg := periodLockMsg(purchase.BaseID, purchase.PurchaseDate); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	if msg := periodLockMsg(req.BaseID, pd); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
 
 	// 获取基地信息
 	var base models.Base
@@ -1009,10 +1094,11 @@ func UpdatePurchase(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// 更新采购记录主表
+	oldDate := purchase.PurchaseDate
 	purchase.SupplierID = req.SupplierID
 	purchase.OrderNumber = req.OrderNumber
 	purchase.PurchaseDate = pd
-	purchase.TotalAmount = req.TotalAmount
+	purchase.TotalAmount = req.TotalAmount.RoundFor(purchase.Currency)
 	purchase.Receiver = req.Receiver
 	purchase.BaseID = req.BaseID
 	purchase.Base = base
@@ -1049,7 +1135,7 @@ func UpdatePurchase(w http.ResponseWriter, r *http.Request) {
 			Unit:            item.Unit,
 			Quantity:        item.Quantity,
 			UnitPrice:       item.UnitPrice,
-			Amount:          item.Amount,
+			Amount:          item.Amount.RoundFor(purchase.Currency),
 			QuantityBase:    qBase,
 		}
 	}
@@ -1062,11 +1148,18 @@ func UpdatePurchase(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := postPurchaseJournal(tx, &purchase); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		http.Error(w, "提交事务失败", http.StatusInternalServerError)
 		return
 	}
+	refreshMonthly(mvSupplier, oldDate, purchase.PurchaseDate)
 
 	// 预加载关联数据用于返回
 	db.DB.Preload("Items").Preload("Base").Preload("Supplier").First(&purchase, purchase.ID)
@@ -1119,6 +1212,12 @@ func BatchDeletePurchase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "没有找到可删除的记录", http.StatusNotFound)
 		return
 	}
+	for _, pe := range purchases {
+		if msg := periodLockMsg(pe.BaseID, pe.PurchaseDate); msg != "" {
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+	}
 
 	// 事务删除，先处理与应付款的关联，避免外键失败
 	tx := db.DB.Begin()
@@ -1154,6 +1253,11 @@ func BatchDeletePurchase(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, "更新应付款失败", http.StatusInternalServerError)
 				return
 			}
+			if err := rebalanceInstallments(tx, pr.ID, pr.TotalAmount, pr.PaidAmount+pr.DiscountTaken); err != nil {
+				tx.Rollback()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 	}
 	// 删除链接
@@ -1184,6 +1288,11 @@ func BatchDeletePurchase(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		// 无还款则可安全删除应付款记录
+		if err := tx.Where("payable_record_id = ?", pr.ID).Delete(&models.PayableInstallment{}).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "删除分期计划失败", http.StatusInternalServerError)
+			return
+		}
 		if err := tx.Delete(&models.PayableRecord{}, pr.ID).Error; err != nil {
 			tx.Rollback()
 			http.Error(w, "删除关联应付款失败", http.StatusInternalServerError)
@@ -1203,10 +1312,20 @@ func BatchDeletePurchase(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "删除采购记录失败: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := removeJournal(tx, models.JournalSourcePurchase, purchaseIDs...); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	if err := tx.Commit().Error; err != nil {
 		http.Error(w, "提交失败", http.StatusInternalServerError)
 		return
 	}
+	dates := make([]time.Time, 0, len(purchases))
+	for _, pe := range purchases {
+		dates = append(dates, pe.PurchaseDate)
+	}
+	refreshMonthly(mvSupplier, dates...)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
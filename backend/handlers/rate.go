@@ -4,16 +4,106 @@ import (
     "backend/db"
     "backend/middleware"
     "backend/models"
+    "backend/money"
     "encoding/json"
     "net/http"
+    "sort"
+    "strconv"
     "strings"
+    "time"
+
+    "gorm.io/gorm"
 )
 
+// ratePoint 某币种自 From 起生效的汇率
+type ratePoint struct {
+    From time.Time
+    Rate float64
+}
+
+// rateBook 按生效日期解析汇率：取生效日期 <= 交易日期的最近一条；
+// 交易日期早于最早记录时取最早一条；无历史记录时退回当前汇率；CNY 恒为 1
+type rateBook struct {
+    history map[string][]ratePoint
+    current map[string]float64
+}
+
+// loadRateBook 读取汇率历史与当前汇率
+func loadRateBook(q *gorm.DB) *rateBook {
+    rb := &rateBook{history: map[string][]ratePoint{}, current: map[string]float64{"CNY": 1}}
+    var cur []models.ExchangeRate
+    q.Find(&cur)
+    for _, r := range cur {
+        if r.Currency != "" { rb.current[r.Currency] = r.RateToCNY }
+    }
+    var hist []models.ExchangeRateHistory
+    q.Order("currency, effective_date").Find(&hist)
+    for _, h := range hist {
+        rb.history[h.Currency] = append(rb.history[h.Currency], ratePoint{From: h.EffectiveDate, Rate: h.RateToCNY})
+    }
+    return rb
+}
+
+// RateOn 某币种在日期 d 的汇率（1 外币 = rate CNY），未知币种返回 0
+func (rb *rateBook) RateOn(currency string, d time.Time) float64 {
+    if currency == "" || currency == "CNY" { return 1 }
+    pts := rb.history[currency]
+    if len(pts) == 0 { return rb.current[currency] }
+    day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+    i := sort.Search(len(pts), func(i int) bool {
+        f := pts[i].From
+        return time.Date(f.Year(), f.Month(), f.Day(), 0, 0, 0, 0, time.UTC).After(day)
+    })
+    if i == 0 { return pts[0].Rate }
+    return pts[i-1].Rate
+}
+
+// ToCNY 按日期折算为 CNY；未知币种按 1 处理（与历史行为一致）
+func (rb *rateBook) ToCNY(amount float64, currency string, d time.Time) float64 {
+    rate := rb.RateOn(currency, d)
+    if rate == 0 { rate = 1 }
+    return amount * rate
+}
+
+// Convert 按日期把 from 币种金额折算为 to 币种（经 CNY 交叉换算），结果按 to 币种规则取整；
+// 未知币种按 1 处理（与 ToCNY 一致）
+func (rb *rateBook) Convert(amount money.Amount, from, to string, d time.Time) money.Amount {
+    return rb.convertRaw(amount, from, to, d).RoundFor(to)
+}
+
+// convertRaw 同 Convert，但保留 4 位小数，供逐笔累加后再统一取整
+func (rb *rateBook) convertRaw(amount money.Amount, from, to string, d time.Time) money.Amount {
+    if from == to { return amount }
+    factor := rb.ToCNY(1, from, d)
+    if to != "" && to != "CNY" {
+        rate := rb.RateOn(to, d)
+        if rate == 0 { rate = 1 }
+        factor /= rate
+    }
+    return amount.Mul(factor)
+}
+
+// parseRateDay 解析聚合查询返回的日期字符串（YYYY-MM-DD）
+func parseRateDay(s string) time.Time {
+    if len(s) > 10 { s = s[:10] }
+    t, _ := time.Parse("2006-01-02", s)
+    return t
+}
+
 // ListExchangeRates 获取所有汇率（含CNY=1）
+// 可选参数 date=YYYY-MM-DD：返回该日生效的汇率，默认今天
 func ListExchangeRates(w http.ResponseWriter, r *http.Request) {
     if _, err := middleware.ParseJWT(r); err != nil { http.Error(w, "未授权", http.StatusUnauthorized); return }
+    on := time.Now()
+    if ds := r.URL.Query().Get("date"); ds != "" {
+        d, err := time.Parse("2006-01-02", ds)
+        if err != nil { http.Error(w, "date 格式应为 YYYY-MM-DD", http.StatusBadRequest); return }
+        on = d
+    }
     var rows []models.ExchangeRate
     db.DB.Order("currency asc").Find(&rows)
+    rates := getRatesMap(on)
+    for i := range rows { if v := rates[rows[i].Currency]; v > 0 { rows[i].RateToCNY = v } }
     // 补上CNY
     foundCNY := false
     for _, it := range rows { if strings.ToUpper(it.Currency) == "CNY" { foundCNY = true; break } }
@@ -22,23 +112,90 @@ func ListExchangeRates(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(rows)
 }
 
+// ListExchangeRateHistory 汇率历史（按生效日期倒序），可选参数 currency
+func ListExchangeRateHistory(w http.ResponseWriter, r *http.Request) {
+    if _, err := middleware.ParseJWT(r); err != nil { http.Error(w, "未授权", http.StatusUnauthorized); return }
+    q := db.DB.Order("currency asc, effective_date desc")
+    if c := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency"))); c != "" { q = q.Where("currency = ?", c) }
+    var rows []models.ExchangeRateHistory
+    q.Find(&rows)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(rows)
+}
+
+// syncCurrentRate 将当前汇率同步为今天已生效的最近一条历史记录
+func syncCurrentRate(tx *gorm.DB, currency string) error {
+    var h models.ExchangeRateHistory
+    if err := tx.Where("currency = ? AND effective_date <= ?", currency, time.Now().Format("2006-01-02")).
+        Order("effective_date desc").First(&h).Error; err != nil {
+        return nil
+    }
+    var cur models.ExchangeRate
+    if err := tx.Where("currency = ?", currency).First(&cur).Error; err == nil {
+        return tx.Model(&cur).Update("rate_to_cny", h.RateToCNY).Error
+    }
+    return tx.Create(&models.ExchangeRate{Currency: currency, RateToCNY: h.RateToCNY}).Error
+}
+
 // UpsertExchangeRate 新增/更新汇率（仅管理员）
+// effective_date 可选（默认今天）：同一币种同一生效日期的记录会被覆盖，不影响其他日期的历史汇率
 func UpsertExchangeRate(w http.ResponseWriter, r *http.Request) {
     claims, err := middleware.ParseJWT(r); if err != nil { http.Error(w, "未授权", http.StatusUnauthorized); return }
     if role, _ := claims["role"].(string); role != "admin" { http.Error(w, "无权限", http.StatusForbidden); return }
-    var body struct{ Currency string `json:"currency"`; RateToCNY float64 `json:"rate_to_cny"` }
+    var body struct {
+        Currency      string  `json:"currency"`
+        RateToCNY     float64 `json:"rate_to_cny"`
+        EffectiveDate string  `json:"effective_date"`
+    }
     if err := json.NewDecoder(r.Body).Decode(&body); err != nil { http.Error(w, "参数错误", http.StatusBadRequest); return }
     c := strings.ToUpper(strings.TrimSpace(body.Currency))
     if c == "" { http.Error(w, "currency 必填", http.StatusBadRequest); return }
     if c == "CNY" { http.Error(w, "无需设置CNY汇率", http.StatusBadRequest); return }
-    var cur models.ExchangeRate
-    if err := db.DB.Where("currency = ?", c).First(&cur).Error; err == nil {
-        cur.RateToCNY = body.RateToCNY
-        db.DB.Save(&cur)
-        w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(cur); return
+    if body.RateToCNY <= 0 { http.Error(w, "rate_to_cny 必须大于0", http.StatusBadRequest); return }
+    eff := time.Now()
+    if body.EffectiveDate != "" {
+        d, err := time.Parse("2006-01-02", body.EffectiveDate)
+        if err != nil { http.Error(w, "effective_date 格式应为 YYYY-MM-DD", http.StatusBadRequest); return }
+        eff = d
+    }
+    effDay := eff.Format("2006-01-02")
+
+    tx := db.DB.Begin()
+    if tx.Error != nil { http.Error(w, "数据库事务启动失败", http.StatusInternalServerError); return }
+    var h models.ExchangeRateHistory
+    if err := tx.Where("currency = ? AND effective_date = ?", c, effDay).First(&h).Error; err == nil {
+        if err := tx.Model(&h).Update("rate_to_cny", body.RateToCNY).Error; err != nil { tx.Rollback(); http.Error(w, "保存汇率失败", http.StatusInternalServerError); return }
+    } else {
+        h = models.ExchangeRateHistory{Currency: c, RateToCNY: body.RateToCNY, EffectiveDate: eff, CreatedBy: claimUserID(claims)}
+        if err := tx.Create(&h).Error; err != nil { tx.Rollback(); http.Error(w, "保存汇率失败", http.StatusInternalServerError); return }
     }
-    cur = models.ExchangeRate{Currency: c, RateToCNY: body.RateToCNY}
-    db.DB.Create(&cur)
-    w.Header().Set("Content-Type", "application/json"); json.NewEncoder(w).Encode(cur)
+    if err := syncCurrentRate(tx, c); err != nil { tx.Rollback(); http.Error(w, "更新当前汇率失败", http.StatusInternalServerError); return }
+    if err := tx.Commit().Error; err != nil { http.Error(w, "提交事务失败", http.StatusInternalServerError); return }
+    // 折算金额随汇率变化，重算生效日期以来的月度汇总
+    refreshMonthlySince(eff)
+
+    var cur models.ExchangeRate
+    db.DB.Where("currency = ?", c).First(&cur)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(cur)
 }
 
+// DeleteExchangeRateHistory 删除一条历史汇率（仅管理员；每个币种至少保留一条）
+func DeleteExchangeRateHistory(w http.ResponseWriter, r *http.Request) {
+    claims, err := middleware.ParseJWT(r); if err != nil { http.Error(w, "未授权", http.StatusUnauthorized); return }
+    if role, _ := claims["role"].(string); role != "admin" { http.Error(w, "无权限", http.StatusForbidden); return }
+    id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+    var h models.ExchangeRateHistory
+    if err := db.DB.First(&h, id).Error; err != nil { http.Error(w, "记录不存在", http.StatusNotFound); return }
+    var cnt int64
+    db.DB.Model(&models.ExchangeRateHistory{}).Where("currency = ?", h.Currency).Count(&cnt)
+    if cnt <= 1 { http.Error(w, "每个币种至少保留一条汇率记录", http.StatusBadRequest); return }
+    tx := db.DB.Begin()
+    if tx.Error != nil { http.Error(w, "数据库事务启动失败", http.StatusInternalServerError); return }
+    if err := tx.Delete(&h).Error; err != nil { tx.Rollback(); http.Error(w, "删除失败", http.StatusInternalServerError); return }
+    if err := syncCurrentRate(tx, h.Currency); err != nil { tx.Rollback(); http.Error(w, "更新当前汇率失败", http.StatusInternalServerError); return }
+    if err := tx.Commit().Error; err != nil { http.Error(w, "提交事务失败", http.StatusInternalServerError); return }
+    refreshMonthlySince(h.EffectiveDate)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
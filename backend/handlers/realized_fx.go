@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ListRealizedFX 已实现汇兑损益明细（按付款日期筛选），附按币种汇总
+// 参数：start_date、end_date（默认本年初至今天）、base_id、supplier_id、currency
+func ListRealizedFX(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	q := db.DB.Model(&models.RealizedFX{}).Where("payment_date BETWEEN ? AND ?", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	if sid := r.URL.Query().Get("supplier_id"); sid != "" {
+		q = q.Where("supplier_id = ?", sid)
+	}
+	if c := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency"))); c != "" {
+		q = q.Where("currency = ?", c)
+	}
+
+	type currencyTotal struct {
+		Currency      string       `json:"currency"`
+		SettledAmount money.Amount `json:"settled_amount"`
+		GainCNY       money.Amount `json:"gain_cny"`
+		LossCNY       money.Amount `json:"loss_cny"`
+		NetCNY        money.Amount `json:"net_cny"`
+	}
+	var totals []currencyTotal
+	q.Session(&gorm.Session{}).
+		Select("currency, SUM(settled_amount) as settled_amount, " +
+			"SUM(CASE WHEN gain_loss_cny > 0 THEN gain_loss_cny ELSE 0 END) as gain_cny, " +
+			"SUM(CASE WHEN gain_loss_cny < 0 THEN -gain_loss_cny ELSE 0 END) as loss_cny, " +
+			"SUM(gain_loss_cny) as net_cny").
+		Group("currency").Order("currency").Scan(&totals)
+	var net money.Amount
+	for _, t := range totals {
+		net += t.NetCNY
+	}
+
+	var rows []models.RealizedFX
+	q.Preload("Base").Preload("Supplier").Order("payment_date desc, id desc").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"records": rows,
+		"totals":  totals,
+		"net_cny": net,
+	})
+}
+
+// BackfillRateSnapshots 为尚未记录折算快照的历史单据补齐 rate_to_cny / amount_cny（按单据日期生效的汇率），
+// 返回补齐的记录数。已实现汇兑损益依赖还款凭证，历史还款可通过重建凭证生成。
+func BackfillRateSnapshots(q *gorm.DB) int {
+	rb := loadRateBook(q)
+	n := 0
+	var purchases []models.PurchaseEntry
+	q.Select("id, currency, total_amount, purchase_date").Where("rate_to_cny = 0").Find(&purchases)
+	for _, p := range purchases {
+		rate := rb.RateOn(p.Currency, p.PurchaseDate)
+		if rate > 0 && saveSnapshot(q, &p, rate, toCNY(p.TotalAmount, rate)) == nil {
+			n++
+		}
+	}
+	var expenses []models.BaseExpense
+	q.Select("id, currency, amount, date").Where("rate_to_cny = 0").Find(&expenses)
+	for _, e := range expenses {
+		rate := rb.RateOn(e.Currency, e.Date)
+		if rate > 0 && saveSnapshot(q, &e, rate, toCNY(e.Amount, rate)) == nil {
+			n++
+		}
+	}
+	var reqs []models.MaterialRequisition
+	q.Select("id, currency, total_amount, request_date").Where("rate_to_cny = 0").Find(&reqs)
+	for _, rec := range reqs {
+		rate := rb.RateOn(rec.Currency, rec.RequestDate)
+		if rate > 0 && saveSnapshot(q, &rec, rate, toCNY(rec.TotalAmount, rate)) == nil {
+			n++
+		}
+	}
+	var payments []models.PaymentRecord
+	q.Select("id, currency, payment_amount, payment_date").Where("rate_to_cny = 0").Find(&payments)
+	for _, p := range payments {
+		rate := rb.RateOn(p.Currency, p.PaymentDate)
+		if rate > 0 && saveSnapshot(q, &p, rate, toCNY(p.PaymentAmount, rate)) == nil {
+			n++
+		}
+	}
+	return n
+}
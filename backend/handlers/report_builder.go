@@ -0,0 +1,793 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 自定义报表：在白名单内的事实表（开支、采购、采购明细、物资申领、付款）上按维度分组汇总，
+// 支持筛选、度量与排序，输出 JSON 表格或 CSV/XLSX。报表定义可按名称保存复用；
+// 基地范围按执行者角色限定（非管理员仅本人基地），与定义的保存者无关。
+
+// reportMaxRows 单次返回的最大行数
+const reportMaxRows = 5000
+
+// reportDim 维度：分组键、显示名称及所需关联；filter 为按ID筛选时比较的表达式（为空时同 key）
+type reportDim struct {
+	key    string
+	label  string
+	joins  []string
+	filter string
+}
+
+// reportFact 事实表：日期、金额、币种、基地列、计数列，及支持的维度与额外筛选字段
+type reportFact struct {
+	title    string
+	table    string
+	joins    []string
+	date     string
+	amount   string
+	curr     string
+	baseCol  string
+	idCol    string
+	quantity string // 为空表示不支持 quantity 度量
+	dims     map[string]reportDim
+	fields   map[string]string // 按值筛选的额外字段
+	// 默认条件：未筛选 defaultField 时生效（开支仅计已审批/已报销，付款不含余额抵扣）
+	defaultField string
+	defaultWhere string
+	defaultArgs  []interface{}
+}
+
+var reportDimLabels = map[string]string{
+	"base":     "基地",
+	"section":  "分区",
+	"supplier": "供应商",
+	"category": "开支类别",
+	"product":  "商品",
+	"month":    "月份",
+	"creator":  "录入人",
+}
+
+var reportMeasureLabels = map[string]string{
+	"amount":     "金额",
+	"count":      "笔数",
+	"quantity":   "数量（基准单位）",
+	"avg_amount": "平均金额",
+}
+
+// reportPeriods 可用的相对期间
+var reportPeriods = []string{"yesterday", "this_week", "last_week", "this_month", "last_month", "this_year", "last_year", "last_7_days", "last_30_days"}
+
+func reportFacts() map[string]*reportFact {
+	baseDim := func(col string) reportDim {
+		return reportDim{key: col, label: "b.name", joins: []string{"LEFT JOIN bases b ON b.id = " + col}}
+	}
+	sectionDim := func(col string) reportDim {
+		return reportDim{key: col, label: "sec.name", joins: []string{"LEFT JOIN base_sections sec ON sec.id = " + col}}
+	}
+	supplierDim := func(col string) reportDim {
+		return reportDim{key: col, label: "s.name", joins: []string{"LEFT JOIN suppliers s ON s.id = " + col}}
+	}
+	creatorDim := func(col string) reportDim {
+		return reportDim{key: col, label: "u.name", joins: []string{"LEFT JOIN users u ON u.id = " + col}}
+	}
+	monthDim := func(col string) reportDim {
+		m := "DATE_FORMAT(" + col + ",'%Y-%m')"
+		return reportDim{key: m, label: m}
+	}
+	return map[string]*reportFact{
+		"expenses": {
+			title: "开支", table: allocatedExpenses("be"), date: "be.date", amount: "be.amount", curr: recordCurrencySQL("be"),
+			baseCol: "be.base_id", idCol: "be.id",
+			dims: map[string]reportDim{
+				"base":     baseDim("be.base_id"),
+				"section":  sectionDim("be.section_id"),
+				"category": {key: "be.category_id", label: "c.name", joins: []string{"LEFT JOIN expense_categories c ON c.id = be.category_id"}},
+				"month":    monthDim("be.date"),
+				"creator":  creatorDim("be.created_by"),
+			},
+			fields:       map[string]string{"currency": recordCurrencySQL("be"), "status": "be.status", "paid_by": "be.paid_by"},
+			defaultField: "status", defaultWhere: "be.status IN ?", defaultArgs: []interface{}{models.ExpenseCountedStatuses},
+		},
+		"purchases": {
+			title: "采购", table: "purchase_entries pe", date: "pe.purchase_date", amount: "pe.total_amount", curr: recordCurrencySQL("pe"),
+			baseCol: "pe.base_id", idCol: "pe.id",
+			dims: map[string]reportDim{
+				"base":     baseDim("pe.base_id"),
+				"supplier": supplierDim("pe.supplier_id"),
+				"month":    monthDim("pe.purchase_date"),
+				"creator":  creatorDim("pe.created_by"),
+			},
+			fields: map[string]string{"currency": recordCurrencySQL("pe")},
+		},
+		// 采购明细无商品ID，按商品名称分组；按商品筛选时以名称对应到商品ID
+		"purchase_items": {
+			title: "采购明细", table: "purchase_entry_items pei", joins: []string{"JOIN purchase_entries pe ON pe.id = pei.purchase_entry_id"},
+			date: "pe.purchase_date", amount: "pei.amount", curr: recordCurrencySQL("pe"), baseCol: "pe.base_id", idCol: "pei.id", quantity: "pei.quantity_base",
+			dims: map[string]reportDim{
+				"base":     baseDim("pe.base_id"),
+				"supplier": supplierDim("pe.supplier_id"),
+				"product":  {key: "pei.product_name", label: "pei.product_name", filter: "(SELECT p.id FROM products p WHERE p.name = pei.product_name)"},
+				"month":    monthDim("pe.purchase_date"),
+				"creator":  creatorDim("pe.created_by"),
+			},
+			fields: map[string]string{"currency": recordCurrencySQL("pe")},
+		},
+		"requisitions": {
+			title: "物资申领", table: "material_requisitions mr", date: "mr.request_date", amount: "mr.total_amount", curr: recordCurrencySQL("mr"),
+			baseCol: "mr.base_id", idCol: "mr.id", quantity: "mr.quantity_base",
+			dims: map[string]reportDim{
+				"base":    baseDim("mr.base_id"),
+				"section": sectionDim("mr.section_id"),
+				"product": {key: "mr.product_id", label: "mr.product_name"},
+				"month":   monthDim("mr.request_date"),
+				"creator": creatorDim("mr.requested_by"),
+			},
+			fields: map[string]string{"currency": recordCurrencySQL("mr")},
+		},
+		"payments": {
+			title: "付款", table: "payment_records pm", joins: []string{"JOIN payable_records pr ON pr.id = pm.payable_record_id"},
+			date: "pm.payment_date", amount: "pm.payment_amount", curr: recordCurrencySQL("pm"), baseCol: "pr.base_id", idCol: "pm.id",
+			dims: map[string]reportDim{
+				"base":     baseDim("pr.base_id"),
+				"supplier": supplierDim("pr.supplier_id"),
+				"month":    monthDim("pm.payment_date"),
+				"creator":  creatorDim("pm.created_by"),
+			},
+			fields:       map[string]string{"currency": recordCurrencySQL("pm"), "payment_method": "pm.payment_method"},
+			defaultField: "payment_method", defaultWhere: "pm.payment_method <> ?", defaultArgs: []interface{}{models.PaymentMethodCredit},
+		},
+	}
+}
+
+// reportFilter 筛选条件：维度字段按ID筛选，其余字段按值筛选
+type reportFilter struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op"` // in（默认）/ not_in
+	Values []string `json:"values"`
+}
+
+// reportDef 报表定义
+type reportDef struct {
+	Fact       string         `json:"fact"`
+	Dimensions []string       `json:"dimensions"`
+	Measures   []string       `json:"measures"` // 默认 amount, count
+	Filters    []reportFilter `json:"filters,omitempty"`
+	// 期间：start_date / end_date 优先，其次 period，均未指定时为本年初至今天
+	Period         string `json:"period,omitempty"`
+	StartDate      string `json:"start_date,omitempty"`
+	EndDate        string `json:"end_date,omitempty"`
+	TargetCurrency string `json:"target_currency,omitempty"`
+	Sort           string `json:"sort,omitempty"` // 维度或度量名，默认按维度升序
+	Desc           bool   `json:"desc,omitempty"`
+	Limit          int    `json:"limit,omitempty"`
+}
+
+// validate 校验定义并补全默认值
+func (d *reportDef) validate() (*reportFact, error) {
+	f, ok := reportFacts()[d.Fact]
+	if !ok {
+		return nil, fmt.Errorf("不支持的事实表：%s", d.Fact)
+	}
+	seen := map[string]bool{}
+	for _, x := range d.Dimensions {
+		if _, ok := f.dims[x]; !ok {
+			return nil, fmt.Errorf("%s不支持维度：%s", f.title, x)
+		}
+		if seen[x] {
+			return nil, fmt.Errorf("维度重复：%s", x)
+		}
+		seen[x] = true
+	}
+	if len(d.Measures) == 0 {
+		d.Measures = []string{"amount", "count"}
+	}
+	for _, x := range d.Measures {
+		if _, ok := reportMeasureLabels[x]; !ok {
+			return nil, fmt.Errorf("不支持的度量：%s", x)
+		}
+		if x == "quantity" && f.quantity == "" {
+			return nil, fmt.Errorf("%s不支持数量度量", f.title)
+		}
+		if seen[x] {
+			return nil, fmt.Errorf("度量重复：%s", x)
+		}
+		seen[x] = true
+	}
+	for _, x := range d.Filters {
+		if x.Op != "" && x.Op != "in" && x.Op != "not_in" {
+			return nil, fmt.Errorf("筛选条件 op 应为 in 或 not_in")
+		}
+		if len(x.Values) == 0 {
+			return nil, fmt.Errorf("筛选条件 %s 缺少取值", x.Field)
+		}
+		if _, ok := f.fields[x.Field]; ok {
+			continue
+		}
+		if _, ok := f.dims[x.Field]; !ok || x.Field == "month" {
+			return nil, fmt.Errorf("%s不支持按 %s 筛选", f.title, x.Field)
+		}
+		for _, v := range x.Values {
+			if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("筛选条件 %s 的取值应为ID", x.Field)
+			}
+		}
+	}
+	if d.Period != "" && !containsString(reportPeriods, d.Period) {
+		return nil, fmt.Errorf("period 仅支持 %s", strings.Join(reportPeriods, "/"))
+	}
+	for _, s := range []string{d.StartDate, d.EndDate} {
+		if s == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, fmt.Errorf("日期格式应为 YYYY-MM-DD")
+		}
+	}
+	d.TargetCurrency = strings.ToUpper(strings.TrimSpace(d.TargetCurrency))
+	if d.TargetCurrency == "" {
+		d.TargetCurrency = "CNY"
+	}
+	if !containsString(reportCurrencies, d.TargetCurrency) {
+		return nil, fmt.Errorf("target_currency 仅支持 %s", strings.Join(reportCurrencies, "/"))
+	}
+	if d.Sort != "" && !seen[d.Sort] {
+		return nil, fmt.Errorf("排序字段须为所选维度或度量：%s", d.Sort)
+	}
+	if d.Limit < 0 {
+		return nil, fmt.Errorf("limit 不能为负数")
+	}
+	return f, nil
+}
+
+// reportPeriodRange 相对期间对应的起止日期（含 end）
+func reportPeriodRange(period string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
+	year := time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.Local)
+	switch period {
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today.AddDate(0, 0, -1)
+	case "this_week":
+		return monday, today
+	case "last_week":
+		return monday.AddDate(0, 0, -7), monday.AddDate(0, 0, -1)
+	case "this_month":
+		return month, today
+	case "last_month":
+		return month.AddDate(0, -1, 0), month.AddDate(0, 0, -1)
+	case "last_year":
+		return year.AddDate(-1, 0, 0), year.AddDate(0, 0, -1)
+	case "last_7_days":
+		return today.AddDate(0, 0, -6), today
+	case "last_30_days":
+		return today.AddDate(0, 0, -29), today
+	}
+	return year, today
+}
+
+// dateRange 报表期间（含 end）
+func (d *reportDef) dateRange(now time.Time) (time.Time, time.Time, error) {
+	start, end := reportPeriodRange(d.Period, now)
+	if d.StartDate != "" {
+		start, _ = time.ParseInLocation("2006-01-02", d.StartDate, time.Local)
+	}
+	if d.EndDate != "" {
+		end, _ = time.ParseInLocation("2006-01-02", d.EndDate, time.Local)
+	}
+	if end.Before(start) {
+		return start, end, fmt.Errorf("end_date 不能早于 start_date")
+	}
+	return start, end, nil
+}
+
+// reportColumn 结果列
+type reportColumn struct {
+	Field  string `json:"field"`
+	Header string `json:"header"`
+}
+
+// ReportResult 报表结果：rows 与 columns 一一对应，维度列为名称，金额为 currency 折算值
+type ReportResult struct {
+	Name      string         `json:"name,omitempty"`
+	Fact      string         `json:"fact"`
+	Title     string         `json:"title"`
+	StartDate string         `json:"start_date"`
+	EndDate   string         `json:"end_date"`
+	Currency  string         `json:"currency"`
+	Columns   []reportColumn `json:"columns"`
+	Rows      [][]any        `json:"rows"`
+	Keys      [][]string     `json:"-"` // 与 Rows 对应的维度键值（如基地 ID），供合并多个报表结果使用
+	Totals    map[string]any `json:"totals"`
+	RowCount  int            `json:"row_count"` // 截断前的行数
+	Truncated bool           `json:"truncated"`
+}
+
+// reportAgg 某维度组合的累计值
+type reportAgg struct {
+	keys     []string
+	labels   []string
+	amount   money.Amount
+	count    int64
+	quantity float64
+}
+
+// measureValues 度量值；金额按目标币种取整
+func (a *reportAgg) measureValues(measures []string, target string) []any {
+	out := make([]any, 0, len(measures))
+	for _, m := range measures {
+		switch m {
+		case "amount":
+			out = append(out, a.amount.RoundFor(target))
+		case "count":
+			out = append(out, a.count)
+		case "quantity":
+			out = append(out, round3(a.quantity))
+		case "avg_amount":
+			var avg money.Amount
+			if a.count > 0 {
+				avg = money.FromFloat(a.amount.Float64() / float64(a.count)).RoundFor(target)
+			}
+			out = append(out, avg)
+		}
+	}
+	return out
+}
+
+// runReport 按定义查询：数据库按 维度+币种+日期 汇总，逐日折算为目标币种后合并
+func runReport(claims jwt.MapClaims, d *reportDef) (*ReportResult, error) {
+	f, err := d.validate()
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := d.dateRange(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	target := d.TargetCurrency
+
+	q := db.DB.Table(f.table)
+	joins := append([]string{}, f.joins...)
+	sel := make([]string, 0, len(d.Dimensions)+5)
+	group := make([]string, 0, len(d.Dimensions)*2+2)
+	for i, name := range d.Dimensions {
+		dim := f.dims[name]
+		joins = append(joins, dim.joins...)
+		sel = append(sel, fmt.Sprintf("CAST(%s AS CHAR) AS k%d, %s AS l%d", dim.key, i, dim.label, i))
+		group = append(group, fmt.Sprintf("k%d, l%d", i, i))
+	}
+	for _, j := range joins {
+		q = q.Joins(j)
+	}
+	quantity := "0"
+	if f.quantity != "" {
+		quantity = "COALESCE(SUM(" + f.quantity + "),0)"
+	}
+	sel = append(sel, f.curr+" AS curr", "DATE_FORMAT("+f.date+",'%Y-%m-%d') AS day",
+		"COALESCE(SUM("+f.amount+"),0) AS amount", "COUNT(DISTINCT "+f.idCol+") AS cnt", quantity+" AS qty")
+	group = append(group, "curr", "day")
+	q = q.Select(strings.Join(sel, ", ")).
+		Where(f.date+" >= ? AND "+f.date+" < ?", start, end.AddDate(0, 0, 1))
+
+	filtered := map[string]bool{}
+	for _, x := range d.Filters {
+		filtered[x.Field] = true
+		col, ok := f.fields[x.Field]
+		if !ok {
+			dim := f.dims[x.Field]
+			col = dim.key
+			if dim.filter != "" {
+				col = dim.filter
+			}
+		}
+		if x.Op == "not_in" {
+			q = q.Where("("+col+" IS NULL OR "+col+" NOT IN ?)", x.Values)
+		} else {
+			q = q.Where(col+" IN ?", x.Values)
+		}
+	}
+	if f.defaultWhere != "" && !filtered[f.defaultField] {
+		q = q.Where(f.defaultWhere, f.defaultArgs...)
+	}
+	q = timeseriesScope(q, claims, f.baseCol, "")
+
+	rows, err := q.Group(strings.Join(group, ", ")).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("查询失败")
+	}
+	defer rows.Close()
+
+	rb := loadRateBook(db.DB)
+	n := len(d.Dimensions)
+	keys := make([]sql.NullString, n)
+	labels := make([]sql.NullString, n)
+	var curr, day string
+	var amount money.Amount
+	var cnt int64
+	var qty float64
+	dest := make([]any, 0, n*2+5)
+	for i := 0; i < n; i++ {
+		dest = append(dest, &keys[i], &labels[i])
+	}
+	dest = append(dest, &curr, &day, &amount, &cnt, &qty)
+
+	byKey := map[string]*reportAgg{}
+	var order []string
+	total := &reportAgg{}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("读取结果失败")
+		}
+		parts := make([]string, n)
+		for i := range keys {
+			parts[i] = keys[i].String
+		}
+		k := strings.Join(parts, "\x00")
+		a, ok := byKey[k]
+		if !ok {
+			a = &reportAgg{keys: parts, labels: make([]string, n)}
+			for i := range labels {
+				a.labels[i] = labels[i].String
+				if a.labels[i] == "" {
+					a.labels[i] = "未指定"
+				}
+			}
+			byKey[k] = a
+			order = append(order, k)
+		}
+		v := rb.convertRaw(amount, curr, target, parseRateDay(day))
+		a.amount += v
+		a.count += cnt
+		a.quantity += qty
+		total.amount += v
+		total.count += cnt
+		total.quantity += qty
+	}
+
+	res := &ReportResult{
+		Fact:      d.Fact,
+		Title:     f.title,
+		StartDate: start.Format("2006-01-02"),
+		EndDate:   end.Format("2006-01-02"),
+		Currency:  target,
+		Rows:      [][]any{},
+		Totals:    map[string]any{},
+		RowCount:  len(order),
+	}
+	for _, name := range d.Dimensions {
+		res.Columns = append(res.Columns, reportColumn{name, reportDimLabels[name]})
+	}
+	for _, m := range d.Measures {
+		h := reportMeasureLabels[m]
+		if m == "amount" || m == "avg_amount" {
+			h += "（" + target + "）"
+		}
+		res.Columns = append(res.Columns, reportColumn{m, h})
+	}
+	for i, v := range total.measureValues(d.Measures, target) {
+		res.Totals[d.Measures[i]] = v
+	}
+
+	aggs := make([]*reportAgg, len(order))
+	for i, k := range order {
+		a := byKey[k]
+		row := make([]any, 0, len(res.Columns))
+		for _, l := range a.labels {
+			row = append(row, l)
+		}
+		aggs[i] = a
+		res.Rows = append(res.Rows, append(row, a.measureValues(d.Measures, target)...))
+	}
+	sortCol, desc := -1, d.Desc
+	for i, c := range res.Columns {
+		if c.Field == d.Sort {
+			sortCol = i
+		}
+	}
+	// 行与维度键值一起排序
+	idx := make([]int, len(res.Rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		ri, rj := res.Rows[idx[i]], res.Rows[idx[j]]
+		if sortCol >= 0 {
+			c := compareReportValues(ri[sortCol], rj[sortCol])
+			if c != 0 {
+				return (c < 0) != desc
+			}
+		}
+		for x := 0; x < n; x++ {
+			if c := compareReportValues(ri[x], rj[x]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	limit := d.Limit
+	if limit == 0 || limit > reportMaxRows {
+		limit = reportMaxRows
+	}
+	if len(idx) > limit {
+		idx = idx[:limit]
+		res.Truncated = true
+	}
+	sorted := make([][]any, 0, len(idx))
+	for _, i := range idx {
+		sorted = append(sorted, res.Rows[i])
+		res.Keys = append(res.Keys, aggs[i].keys)
+	}
+	res.Rows = sorted
+	return res, nil
+}
+
+// compareReportValues 比较同一列的两个值
+func compareReportValues(a, b any) int {
+	switch x := a.(type) {
+	case money.Amount:
+		y := b.(money.Amount)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case int64:
+		y := b.(int64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case float64:
+		y := b.(float64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// table 表格文件内容：表头、数据行与合计行
+func (res *ReportResult) table() [][]any {
+	out := make([][]any, 0, len(res.Rows)+2)
+	header := make([]any, len(res.Columns))
+	for i, c := range res.Columns {
+		header[i] = c.Header
+	}
+	out = append(out, header)
+	out = append(out, res.Rows...)
+	totals := make([]any, len(res.Columns))
+	for i, c := range res.Columns {
+		if v, ok := res.Totals[c.Field]; ok {
+			totals[i] = v
+		}
+	}
+	// 无维度时唯一的数据行即为合计
+	if _, ok := reportDimLabels[res.Columns[0].Field]; !ok {
+		return out
+	}
+	totals[0] = "合计"
+	return append(out, totals)
+}
+
+// loadReportDefinition 按名称读取已保存的报表定义
+func loadReportDefinition(name string) (*models.ReportDefinition, *reportDef, error) {
+	var saved models.ReportDefinition
+	if err := db.DB.Where("name = ?", name).First(&saved).Error; err != nil {
+		return nil, nil, fmt.Errorf("报表不存在：%s", name)
+	}
+	var d reportDef
+	if err := json.Unmarshal([]byte(saved.Definition), &d); err != nil {
+		return nil, nil, fmt.Errorf("报表定义格式错误")
+	}
+	return &saved, &d, nil
+}
+
+// RunReport 执行自定义报表
+// POST：请求体为报表定义（见 reportDef）；GET：name 指定已保存的报表
+// 两种方式均可用 period、start_date、end_date、target_currency 参数覆盖定义中的值；
+// format=json（默认）/ csv / xlsx
+func RunReport(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	qv := r.URL.Query()
+	format := qv.Get("format")
+	if format != "" && format != "json" && format != "csv" && format != "xlsx" {
+		http.Error(w, "format 应为 json、csv 或 xlsx", http.StatusBadRequest)
+		return
+	}
+	var d *reportDef
+	name := ""
+	if r.Method == http.MethodPost {
+		d = &reportDef{}
+		if err := json.NewDecoder(r.Body).Decode(d); err != nil {
+			http.Error(w, "参数错误", http.StatusBadRequest)
+			return
+		}
+	} else {
+		name = strings.TrimSpace(qv.Get("name"))
+		if name == "" {
+			http.Error(w, "请指定报表名称", http.StatusBadRequest)
+			return
+		}
+		if _, d, err = loadReportDefinition(name); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+	if p := qv.Get("period"); p != "" {
+		d.Period, d.StartDate, d.EndDate = p, "", ""
+	}
+	if s := qv.Get("start_date"); s != "" {
+		d.StartDate = s
+	}
+	if s := qv.Get("end_date"); s != "" {
+		d.EndDate = s
+	}
+	if s := qv.Get("target_currency"); s != "" {
+		d.TargetCurrency = s
+	}
+	res, err := runReport(claims, d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.Name = name
+	if format == "csv" || format == "xlsx" {
+		writeTableFile(w, format, "report_"+d.Fact+"_"+time.Now().Format("20060102"), res.Title, res.table())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// reportFactInfo 事实表可用的维度、度量与筛选字段
+type reportFactInfo struct {
+	Fact       string   `json:"fact"`
+	Title      string   `json:"title"`
+	Dimensions []string `json:"dimensions"`
+	Measures   []string `json:"measures"`
+	Filters    []string `json:"filters"`
+}
+
+func reportCatalog() []reportFactInfo {
+	facts := reportFacts()
+	out := make([]reportFactInfo, 0, len(facts))
+	for name, f := range facts {
+		info := reportFactInfo{Fact: name, Title: f.title, Measures: []string{"amount", "count", "avg_amount"}}
+		if f.quantity != "" {
+			info.Measures = append(info.Measures, "quantity")
+		}
+		for d := range f.dims {
+			info.Dimensions = append(info.Dimensions, d)
+			if d != "month" {
+				info.Filters = append(info.Filters, d)
+			}
+		}
+		for x := range f.fields {
+			info.Filters = append(info.Filters, x)
+		}
+		sort.Strings(info.Dimensions)
+		sort.Strings(info.Filters)
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Fact < out[j].Fact })
+	return out
+}
+
+// ListReportDefinitions 已保存的报表定义，附带可用的事实表、维度、度量与期间说明
+func ListReportDefinitions(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var rows []models.ReportDefinition
+	db.DB.Preload("Creator").Order("name").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"reports":    rows,
+		"facts":      reportCatalog(),
+		"dimensions": reportDimLabels,
+		"measures":   reportMeasureLabels,
+		"periods":    reportPeriods,
+	})
+}
+
+// SaveReportDefinition 新增/修改报表定义；带 id 为修改，仅创建人或管理员可修改
+func SaveReportDefinition(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		ID          uint      `json:"id"`
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		Definition  reportDef `json:"definition"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "报表名称不能为空", http.StatusBadRequest)
+		return
+	}
+	if _, err := req.Definition.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	uid := claimUserID(claims)
+	var saved models.ReportDefinition
+	if req.ID != 0 {
+		if err := db.DB.First(&saved, req.ID).Error; err != nil {
+			http.Error(w, "报表不存在", http.StatusNotFound)
+			return
+		}
+		if claimRole(claims) != "admin" && saved.CreatedBy != uid {
+			http.Error(w, "只能修改自己创建的报表", http.StatusForbidden)
+			return
+		}
+	} else {
+		saved.CreatedBy = uid
+	}
+	raw, _ := json.Marshal(req.Definition)
+	saved.Name = req.Name
+	saved.Description = req.Description
+	saved.Definition = string(raw)
+	if err := db.DB.Save(&saved).Error; err != nil {
+		http.Error(w, "保存报表失败（名称可能重复）", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// DeleteReportDefinition 删除报表定义（创建人或管理员）
+func DeleteReportDefinition(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var saved models.ReportDefinition
+	if err := db.DB.First(&saved, id).Error; err != nil {
+		http.Error(w, "报表不存在", http.StatusNotFound)
+		return
+	}
+	if claimRole(claims) != "admin" && saved.CreatedBy != claimUserID(claims) {
+		http.Error(w, "只能删除自己创建的报表", http.StatusForbidden)
+		return
+	}
+	if err := db.DB.Delete(&saved).Error; err != nil {
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
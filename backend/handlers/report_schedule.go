@@ -0,0 +1,778 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/mailer"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"backend/pdf"
+	"backend/xlsx"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 定时邮件报表：按计划生成各基地支出汇总（复用自定义报表查询）与超期应付款账龄，
+// 渲染为 PDF/XLSX 后通过 SMTP 中继（见 mailer 包）发送。收件人按基地与角色匹配，
+// 每位收件人只收到其可见基地的数据；每次发送逐个收件人记入 report_deliveries。
+
+// reportOverdueMaxRows 超期应付款明细的最大行数
+const reportOverdueMaxRows = 200
+
+// reportAdminClaims 定时任务以管理员身份查询，基地范围由筛选条件限定
+var reportAdminClaims = jwt.MapClaims{"role": "admin"}
+
+// defaultSchedulePeriod 未指定期间时按频率取上一周期
+func defaultSchedulePeriod(s *models.ReportSchedule) string {
+	if s.Period != "" {
+		return s.Period
+	}
+	switch s.Frequency {
+	case models.ReportFrequencyDaily:
+		return "yesterday"
+	case models.ReportFrequencyMonthly:
+		return "last_month"
+	}
+	return "last_week"
+}
+
+// nextReportRun after 之后的下一次发送时间
+func nextReportRun(s *models.ReportSchedule, after time.Time) time.Time {
+	t := time.Date(after.Year(), after.Month(), after.Day(), s.Hour, 0, 0, 0, time.Local)
+	switch s.Frequency {
+	case models.ReportFrequencyMonthly:
+		t = time.Date(after.Year(), after.Month(), s.DayOfMonth, s.Hour, 0, 0, 0, time.Local)
+		if !t.After(after) {
+			t = t.AddDate(0, 1, 0)
+		}
+	case models.ReportFrequencyWeekly:
+		t = t.AddDate(0, 0, (s.Weekday-int(t.Weekday())+7)%7)
+		if !t.After(after) {
+			t = t.AddDate(0, 0, 7)
+		}
+	default:
+		if !t.After(after) {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return t
+}
+
+// baseIDsKey 基地集合的规范表示（升序、逗号分隔）；nil 表示全部基地，返回空串
+func baseIDsKey(ids []uint) string {
+	if ids == nil {
+		return ""
+	}
+	sorted := append([]uint{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	parts := make([]string, len(sorted))
+	for i, id := range sorted {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// reportTarget 一位收件人及其报表基地范围（nil 表示全部基地）
+type reportTarget struct {
+	email  string
+	userID *uint
+	bases  []uint
+}
+
+// resolveReportRecipients 按收件人规则展开为邮箱地址；同一邮箱合并基地范围。
+// 无邮箱或未绑定基地的用户返回为 skipped 发送记录
+func resolveReportRecipients(s *models.ReportSchedule) ([]reportTarget, []models.ReportDelivery) {
+	var targets []reportTarget
+	var skipped []models.ReportDelivery
+	index := map[string]int{}
+	add := func(t reportTarget) {
+		key := strings.ToLower(t.email)
+		if i, ok := index[key]; ok {
+			if targets[i].bases == nil || t.bases == nil {
+				targets[i].bases = nil
+			} else {
+				for _, id := range t.bases {
+					if !containsUint(targets[i].bases, id) {
+						targets[i].bases = append(targets[i].bases, id)
+					}
+				}
+			}
+			return
+		}
+		index[key] = len(targets)
+		targets = append(targets, t)
+	}
+	only := func(id *uint) []uint {
+		if id == nil {
+			return nil
+		}
+		return []uint{*id}
+	}
+	for _, rule := range s.Recipients {
+		if rule.Email != "" {
+			add(reportTarget{email: rule.Email, bases: only(rule.BaseID)})
+			continue
+		}
+		q := db.DB.Model(&models.User{})
+		if rule.UserID != nil {
+			q = q.Where("id = ?", *rule.UserID)
+		}
+		if rule.Role != "" {
+			q = q.Where("role = ?", rule.Role)
+		}
+		var users []models.User
+		q.Find(&users)
+		for _, u := range users {
+			uid := u.ID
+			bases := only(rule.BaseID)
+			if u.Role != "admin" {
+				var own []uint
+				db.DB.Model(&models.UserBase{}).Where("user_id = ?", u.ID).Pluck("base_id", &own)
+				if rule.BaseID != nil {
+					if !containsUint(own, *rule.BaseID) {
+						continue
+					}
+				} else {
+					bases = own
+				}
+				if len(bases) == 0 {
+					skipped = append(skipped, models.ReportDelivery{Recipient: u.Name, UserID: &uid, Status: models.ReportDeliverySkipped, Error: "用户未绑定基地"})
+					continue
+				}
+			}
+			if strings.TrimSpace(u.Email) == "" {
+				skipped = append(skipped, models.ReportDelivery{Recipient: u.Name, UserID: &uid, Status: models.ReportDeliverySkipped, Error: "用户未填写邮箱"})
+				continue
+			}
+			add(reportTarget{email: strings.TrimSpace(u.Email), userID: &uid, bases: bases})
+		}
+	}
+	return targets, skipped
+}
+
+// baseFilters 限定基地的筛选条件；nil 表示不限
+func baseFilters(bases []uint) []reportFilter {
+	if bases == nil {
+		return nil
+	}
+	vals := make([]string, len(bases))
+	for i, id := range bases {
+		vals[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return []reportFilter{{Field: "base", Values: vals}}
+}
+
+// scheduledReport 渲染前的报表内容及邮件正文摘要
+type scheduledReport struct {
+	doc     pdf.Document
+	summary []string
+}
+
+// buildScheduledReport 生成报表内容：各基地支出汇总、附加的已保存报表、超期应付款账龄与明细
+func buildScheduledReport(s *models.ReportSchedule, bases []uint, start, end, now time.Time) (*scheduledReport, error) {
+	target := s.TargetCurrency
+	if target == "" {
+		target = "CNY"
+	}
+	period := start.Format("2006-01-02") + " 至 " + end.Format("2006-01-02")
+	scope := "全部基地"
+	if bases != nil {
+		var names []string
+		db.DB.Model(&models.Base{}).Where("id IN ?", bases).Order("name").Pluck("name", &names)
+		scope = strings.Join(names, "、")
+	}
+	rep := &scheduledReport{doc: pdf.Document{
+		Title: s.Name,
+		Notes: []string{
+			"期间：" + period,
+			"基地：" + scope,
+			"金额币种：" + target + "（支出按单据日期汇率折算，超期应付款按今日汇率折算）",
+			"生成时间：" + now.Format("2006-01-02 15:04"),
+		},
+	}}
+	rep.summary = append(rep.summary, "期间："+period, "基地："+scope)
+
+	// 各基地支出：开支、采购、物资申领分别按基地汇总后按基地 ID 合并（基地重名时不会混在一起）
+	facts := []string{"expenses", "purchases", "requisitions"}
+	type baseSpend struct {
+		name    string
+		amounts []money.Amount
+	}
+	byBase := map[string]*baseSpend{}
+	var order []string
+	header := []any{"基地"}
+	totals := []any{"合计"}
+	for i, fact := range facts {
+		res, err := runReport(reportAdminClaims, &reportDef{
+			Fact: fact, Dimensions: []string{"base"}, Measures: []string{"amount"},
+			Filters: baseFilters(bases), StartDate: start.Format("2006-01-02"), EndDate: end.Format("2006-01-02"), TargetCurrency: target,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("生成%s汇总失败：%v", fact, err)
+		}
+		header = append(header, res.Title+"（"+target+"）")
+		totals = append(totals, res.Totals["amount"])
+		rep.summary = append(rep.summary, fmt.Sprintf("%s合计：%v %s", res.Title, res.Totals["amount"], target))
+		for j, row := range res.Rows {
+			id := res.Keys[j][0]
+			b, ok := byBase[id]
+			if !ok {
+				b = &baseSpend{name: row[0].(string), amounts: make([]money.Amount, len(facts))}
+				byBase[id] = b
+				order = append(order, id)
+			}
+			b.amounts[i] = row[1].(money.Amount)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if byBase[order[i]].name != byBase[order[j]].name {
+			return byBase[order[i]].name < byBase[order[j]].name
+		}
+		return order[i] < order[j]
+	})
+	spend := pdf.Section{Title: "各基地支出", Rows: [][]any{header}}
+	for _, id := range order {
+		row := []any{byBase[id].name}
+		for _, v := range byBase[id].amounts {
+			row = append(row, v)
+		}
+		spend.Rows = append(spend.Rows, row)
+	}
+	spend.Rows = append(spend.Rows, totals)
+	rep.doc.Sections = append(rep.doc.Sections, spend)
+
+	// 附加的已保存报表：期间与基地范围以本次发送为准
+	for _, name := range strings.Split(s.ReportNames, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		_, d, err := loadReportDefinition(name)
+		if err == nil {
+			d.Period, d.StartDate, d.EndDate = "", start.Format("2006-01-02"), end.Format("2006-01-02")
+			d.Filters = append(d.Filters, baseFilters(bases)...)
+			if d.TargetCurrency == "" {
+				d.TargetCurrency = target
+			}
+			var res *ReportResult
+			if res, err = runReport(reportAdminClaims, d); err == nil {
+				rep.doc.Sections = append(rep.doc.Sections, pdf.Section{Title: name, Rows: res.table()})
+				continue
+			}
+		}
+		rep.doc.Notes = append(rep.doc.Notes, "报表“"+name+"”未能生成："+err.Error())
+	}
+
+	aging, detail, line := overdueSections(bases, target, now)
+	rep.doc.Sections = append(rep.doc.Sections, aging, detail)
+	rep.summary = append(rep.summary, line)
+	return rep, nil
+}
+
+// overdueSections 超期应付款：按超期天数分段的账龄汇总，以及按超期天数降序的明细
+func overdueSections(bases []uint, target string, now time.Time) (pdf.Section, pdf.Section, string) {
+	q := whereOverdue(db.DB.Preload("Supplier").Preload("Base").Preload("PurchaseEntry").
+		Preload("Installments", orderedInstallments), now)
+	if bases != nil {
+		q = q.Where("base_id IN ?", bases)
+	}
+	var list []models.PayableRecord
+	q.Find(&list)
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	rb := loadRateBook(db.DB)
+	type item struct {
+		pr        *models.PayableRecord
+		due       time.Time
+		days      int
+		overdue   money.Amount
+		converted money.Amount
+	}
+	items := make([]item, 0, len(list))
+	for i := range list {
+		pr := &list[i]
+		it := item{pr: pr}
+		if len(pr.Installments) > 0 {
+			for j := range pr.Installments {
+				in := &pr.Installments[j]
+				if in.IsOverdue(now) {
+					it.overdue += in.Remaining()
+				}
+			}
+		} else {
+			it.overdue = pr.RemainingAmount
+		}
+		if d := pr.NextDueDate(); d != nil {
+			it.due = *d
+			it.days = int(today.Sub(time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.Local)).Hours() / 24)
+		}
+		curr := pr.Currency
+		if curr == "" {
+			curr = "CNY"
+		}
+		it.converted = rb.convertRaw(it.overdue, curr, target, today)
+		items = append(items, it)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].days > items[j].days })
+
+	buckets := []struct {
+		label string
+		max   int
+	}{{"1–30 天", 30}, {"31–60 天", 60}, {"61–90 天", 90}, {"90 天以上", -1}}
+	counts := make([]int64, len(buckets))
+	sums := make([]money.Amount, len(buckets))
+	var total money.Amount
+	for _, it := range items {
+		b := len(buckets) - 1
+		for k, x := range buckets {
+			if x.max >= 0 && it.days <= x.max {
+				b = k
+				break
+			}
+		}
+		counts[b]++
+		sums[b] += it.converted
+		total += it.converted
+	}
+	aging := pdf.Section{Title: "超期应付款账龄", Rows: [][]any{{"超期天数", "笔数", "超期金额（" + target + "）"}}}
+	for k, x := range buckets {
+		aging.Rows = append(aging.Rows, []any{x.label, counts[k], sums[k].RoundFor(target)})
+	}
+	aging.Rows = append(aging.Rows, []any{"合计", int64(len(items)), total.RoundFor(target)})
+
+	title := "超期应付款明细"
+	if len(items) > reportOverdueMaxRows {
+		title = fmt.Sprintf("超期应付款明细（超期最久的 %d 笔，共 %d 笔）", reportOverdueMaxRows, len(items))
+		items = items[:reportOverdueMaxRows]
+	}
+	detail := pdf.Section{Title: title, Rows: [][]any{{"供应商", "基地", "单号/结算期", "最早未付到期日", "超期天数", "币种", "超期金额", "剩余应付", "超期金额（" + target + "）"}}}
+	for _, it := range items {
+		supplier := ""
+		if it.pr.Supplier != nil {
+			supplier = it.pr.Supplier.Name
+		}
+		ref := it.pr.PeriodMonth
+		if it.pr.PurchaseEntry != nil {
+			ref = it.pr.PurchaseEntry.OrderNumber
+		} else if ref == "" {
+			ref = it.pr.PeriodHalf
+		}
+		due := ""
+		if !it.due.IsZero() {
+			due = it.due.Format("2006-01-02")
+		}
+		detail.Rows = append(detail.Rows, []any{supplier, it.pr.Base.Name, ref, due, int64(it.days), it.pr.Currency,
+			it.overdue, it.pr.RemainingAmount, it.converted.RoundFor(target)})
+	}
+	return aging, detail, fmt.Sprintf("超期应付款：%d 笔，合计 %v %s", len(list), total.RoundFor(target), target)
+}
+
+// renderScheduledReport 渲染为文件内容；XLSX 将各表格依次写在同一工作表中
+func renderScheduledReport(format string, doc pdf.Document) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if format == "xlsx" {
+		rows := [][]any{{doc.Title}}
+		for _, n := range doc.Notes {
+			rows = append(rows, []any{n})
+		}
+		for _, s := range doc.Sections {
+			rows = append(rows, nil, []any{s.Title})
+			rows = append(rows, s.Rows...)
+		}
+		if err := xlsx.Write(&buf, "报表", rows); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", nil
+	}
+	if err := pdf.Write(&buf, doc); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "application/pdf", nil
+}
+
+// renderedReport 某基地范围的渲染结果（同一次发送内按基地范围复用）
+type renderedReport struct {
+	data        []byte
+	contentType string
+	summary     []string
+	err         error
+}
+
+// runReportSchedule 生成并发送一次报表，逐个收件人记录发送结果
+func runReportSchedule(s *models.ReportSchedule, trigger string, now time.Time) []models.ReportDelivery {
+	start, end := reportPeriodRange(defaultSchedulePeriod(s), now)
+	format := s.Format
+	if format == "" {
+		format = "pdf"
+	}
+	fileName := fmt.Sprintf("%s_%s_%s.%s", s.Name, start.Format("20060102"), end.Format("20060102"), format)
+	targets, deliveries := resolveReportRecipients(s)
+	cfg, cfgErr := mailer.FromEnv()
+
+	rendered := map[string]*renderedReport{}
+	for _, t := range targets {
+		key := baseIDsKey(t.bases)
+		rr, ok := rendered[key]
+		if !ok {
+			rr = &renderedReport{}
+			if rep, err := buildScheduledReport(s, t.bases, start, end, now); err != nil {
+				rr.err = err
+			} else {
+				rr.summary = rep.summary
+				rr.data, rr.contentType, rr.err = renderScheduledReport(format, rep.doc)
+			}
+			rendered[key] = rr
+		}
+		d := models.ReportDelivery{Recipient: t.email, UserID: t.userID, BaseIDs: key, FileName: fileName, FileSize: len(rr.data), Status: models.ReportDeliverySent}
+		err := rr.err
+		if err == nil {
+			err = cfgErr
+		}
+		if err == nil {
+			err = cfg.Send(&mailer.Message{
+				To:          []string{t.email},
+				Subject:     s.Name + "（" + start.Format("2006-01-02") + " 至 " + end.Format("2006-01-02") + "）",
+				Body:        strings.Join(rr.summary, "\n") + "\n\n详见附件。此邮件由系统自动发送，请勿回复。\n",
+				Attachments: []mailer.Attachment{{Name: fileName, ContentType: rr.contentType, Data: rr.data}},
+			})
+		}
+		if err != nil {
+			d.Status, d.Error = models.ReportDeliveryFailed, err.Error()
+		}
+		deliveries = append(deliveries, d)
+	}
+	for i := range deliveries {
+		d := &deliveries[i]
+		d.ScheduleID, d.Trigger, d.Format, d.PeriodStart, d.PeriodEnd = s.ID, trigger, format, start, end
+		if err := db.DB.Create(d).Error; err != nil {
+			log.Printf("warn: record report delivery for schedule %d failed: %v", s.ID, err)
+		}
+	}
+	return deliveries
+}
+
+// RunDueReportSchedules 发送已到期的定时报表（由 main 中的定时器调用）。
+// 先以条件更新推进 next_run_at 领取任务，多实例部署时同一次计划只发送一次
+func RunDueReportSchedules() {
+	now := time.Now()
+	var due []models.ReportSchedule
+	db.DB.Preload("Recipients").Where("enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).Find(&due)
+	for i := range due {
+		s := &due[i]
+		res := db.DB.Model(&models.ReportSchedule{}).Where("id = ? AND next_run_at = ?", s.ID, *s.NextRunAt).
+			Updates(map[string]interface{}{"next_run_at": nextReportRun(s, now), "last_run_at": now})
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+		failed := 0
+		deliveries := runReportSchedule(s, "schedule", now)
+		for _, d := range deliveries {
+			if d.Status == models.ReportDeliveryFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			log.Printf("warn: report schedule %q: %d of %d deliveries failed", s.Name, failed, len(deliveries))
+		}
+	}
+}
+
+// ListReportSchedules 定时报表列表（含收件人规则）
+func ListReportSchedules(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var rows []models.ReportSchedule
+	db.DB.Preload("Recipients").Preload("Recipients.Base").Order("name").Find(&rows)
+	_, cfgErr := mailer.FromEnv()
+	smtpError := ""
+	if cfgErr != nil {
+		smtpError = cfgErr.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"schedules":       rows,
+		"smtp_configured": cfgErr == nil,
+		"smtp_error":      smtpError,
+	})
+}
+
+// SaveReportSchedule 新增/修改定时报表（带 id 为修改），收件人规则整体替换
+func SaveReportSchedule(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		ID             uint     `json:"id"`
+		Name           string   `json:"name"`
+		Enabled        *bool    `json:"enabled"`
+		Frequency      string   `json:"frequency"`
+		Weekday        int      `json:"weekday"`
+		DayOfMonth     int      `json:"day_of_month"`
+		Hour           int      `json:"hour"`
+		Period         string   `json:"period"`
+		Format         string   `json:"format"`
+		TargetCurrency string   `json:"target_currency"`
+		ReportNames    []string `json:"report_names"`
+		Recipients     []struct {
+			BaseID *uint  `json:"base_id"`
+			Role   string `json:"role"`
+			UserID *uint  `json:"user_id"`
+			Email  string `json:"email"`
+		} `json:"recipients"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "报表名称不能为空", http.StatusBadRequest)
+		return
+	}
+	if req.Frequency == "" {
+		req.Frequency = models.ReportFrequencyWeekly
+	}
+	switch req.Frequency {
+	case models.ReportFrequencyDaily, models.ReportFrequencyWeekly, models.ReportFrequencyMonthly:
+	default:
+		http.Error(w, "frequency 应为 daily、weekly 或 monthly", http.StatusBadRequest)
+		return
+	}
+	if req.Weekday < 0 || req.Weekday > 6 {
+		http.Error(w, "weekday 应为 0（周日）到 6（周六）", http.StatusBadRequest)
+		return
+	}
+	if req.Frequency == models.ReportFrequencyMonthly && (req.DayOfMonth < 1 || req.DayOfMonth > 28) {
+		http.Error(w, "day_of_month 应为 1 到 28", http.StatusBadRequest)
+		return
+	}
+	if req.Hour < 0 || req.Hour > 23 {
+		http.Error(w, "hour 应为 0 到 23", http.StatusBadRequest)
+		return
+	}
+	if req.Period != "" && !containsString(reportPeriods, req.Period) {
+		http.Error(w, "period 仅支持 "+strings.Join(reportPeriods, "/"), http.StatusBadRequest)
+		return
+	}
+	if req.Format == "" {
+		req.Format = "pdf"
+	}
+	if req.Format != "pdf" && req.Format != "xlsx" {
+		http.Error(w, "格式应为 pdf 或 xlsx", http.StatusBadRequest)
+		return
+	}
+	req.TargetCurrency = strings.ToUpper(strings.TrimSpace(req.TargetCurrency))
+	if req.TargetCurrency == "" {
+		req.TargetCurrency = "CNY"
+	}
+	if !containsString(reportCurrencies, req.TargetCurrency) {
+		http.Error(w, "target_currency 仅支持 "+strings.Join(reportCurrencies, "/"), http.StatusBadRequest)
+		return
+	}
+	var names []string
+	for _, n := range req.ReportNames {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		if _, _, err := loadReportDefinition(n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		names = append(names, n)
+	}
+	if len(req.Recipients) == 0 {
+		http.Error(w, "至少需要一条收件人规则", http.StatusBadRequest)
+		return
+	}
+	recipients := make([]models.ReportRecipient, 0, len(req.Recipients))
+	for _, x := range req.Recipients {
+		x.Email = strings.TrimSpace(x.Email)
+		if x.Email == "" && x.Role == "" && x.UserID == nil {
+			http.Error(w, "收件人规则须指定邮箱、用户或角色", http.StatusBadRequest)
+			return
+		}
+		if x.Email != "" && !strings.Contains(x.Email, "@") {
+			http.Error(w, "邮箱格式错误："+x.Email, http.StatusBadRequest)
+			return
+		}
+		if x.BaseID != nil {
+			var base models.Base
+			if err := db.DB.First(&base, *x.BaseID).Error; err != nil {
+				http.Error(w, "指定的基地不存在", http.StatusBadRequest)
+				return
+			}
+		}
+		recipients = append(recipients, models.ReportRecipient{BaseID: x.BaseID, Role: x.Role, UserID: x.UserID, Email: x.Email})
+	}
+
+	var s models.ReportSchedule
+	if req.ID != 0 {
+		if err := db.DB.First(&s, req.ID).Error; err != nil {
+			http.Error(w, "定时报表不存在", http.StatusNotFound)
+			return
+		}
+	} else {
+		s.CreatedBy = claimUserID(claims)
+	}
+	s.Name = req.Name
+	s.Enabled = req.Enabled == nil || *req.Enabled
+	s.Frequency, s.Weekday, s.DayOfMonth, s.Hour = req.Frequency, req.Weekday, req.DayOfMonth, req.Hour
+	s.Period, s.Format, s.TargetCurrency = req.Period, req.Format, req.TargetCurrency
+	s.ReportNames = strings.Join(names, ",")
+	s.NextRunAt = nil
+	if s.Enabled {
+		next := nextReportRun(&s, time.Now())
+		s.NextRunAt = &next
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Omit("Recipients").Save(&s).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存定时报表失败（名称可能重复）", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Where("schedule_id = ?", s.ID).Delete(&models.ReportRecipient{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "更新收件人失败", http.StatusInternalServerError)
+		return
+	}
+	for i := range recipients {
+		recipients[i].ScheduleID = s.ID
+		if err := tx.Create(&recipients[i]).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "保存收件人失败", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	s.Recipients = recipients
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// DeleteReportSchedule 删除定时报表及其收件人规则（保留发送记录）
+func DeleteReportSchedule(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Where("schedule_id = ?", id).Delete(&models.ReportRecipient{}).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Delete(&models.ReportSchedule{}, id).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
+
+// RunReportScheduleNow 立即发送一次（不影响下次计划时间）；preview=1 时不发送邮件，直接下载报表文件
+// （base_id 可选，限定预览的基地）
+func RunReportScheduleNow(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var s models.ReportSchedule
+	if err := db.DB.Preload("Recipients").First(&s, id).Error; err != nil {
+		http.Error(w, "定时报表不存在", http.StatusNotFound)
+		return
+	}
+	now := time.Now()
+	if r.URL.Query().Get("preview") == "1" {
+		var bases []uint
+		if b, _ := strconv.ParseUint(r.URL.Query().Get("base_id"), 10, 64); b != 0 {
+			bases = []uint{uint(b)}
+		}
+		start, end := reportPeriodRange(defaultSchedulePeriod(&s), now)
+		rep, err := buildScheduledReport(&s, bases, start, end, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		format := s.Format
+		if format == "" {
+			format = "pdf"
+		}
+		data, contentType, err := renderScheduledReport(format, rep.doc)
+		if err != nil {
+			http.Error(w, "生成文件失败", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=report_"+start.Format("20060102")+"_"+end.Format("20060102")+"."+format)
+		w.Write(data)
+		return
+	}
+	deliveries := runReportSchedule(&s, "manual", now)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"deliveries": deliveries})
+}
+
+// ListReportDeliveries 报表发送记录，可按 schedule_id、status 筛选，按时间倒序分页
+func ListReportDeliveries(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	q := db.DB.Model(&models.ReportDelivery{})
+	if sid := r.URL.Query().Get("schedule_id"); sid != "" {
+		q = q.Where("schedule_id = ?", sid)
+	}
+	if st := r.URL.Query().Get("status"); st != "" {
+		q = q.Where("status = ?", st)
+	}
+	var total int64
+	q.Count(&total)
+	rows := []models.ReportDelivery{}
+	q.Order("created_at desc, id desc").Offset((page - 1) * limit).Limit(limit).Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"data":  rows,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+type revenueReq struct {
+	BaseID    uint         `json:"base_id"`
+	SectionID *uint        `json:"section_id"` // 可选，默认为录入人担任队长的分区；0 表示不指定
+	Date      string       `json:"date"`
+	Kind      string       `json:"kind"` // sale（默认）/ harvest
+	Item      string       `json:"item"`
+	Quantity  float64      `json:"quantity"`
+	Unit      string       `json:"unit"`
+	UnitPrice money.Amount `json:"unit_price"`
+	Amount    money.Amount `json:"amount"` // 可选：未填单价时直接填写金额
+	Currency  string       `json:"currency"`
+	Buyer     string       `json:"buyer"`
+	Note      string       `json:"note"`
+}
+
+// validateRevenue 校验并写入 rec（不含基地、分区）
+func validateRevenue(req revenueReq, rec *models.RevenueRecord) string {
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(req.Date))
+	if err != nil {
+		return "date 格式应为 YYYY-MM-DD"
+	}
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if kind == "" {
+		kind = models.RevenueKindSale
+	}
+	if kind != models.RevenueKindSale && kind != models.RevenueKindHarvest {
+		return "kind 仅支持 sale / harvest"
+	}
+	item := strings.TrimSpace(req.Item)
+	if item == "" {
+		return "产品/作物名称不能为空"
+	}
+	if req.Quantity < 0 || req.UnitPrice < 0 || req.Amount < 0 {
+		return "数量、单价、金额不能为负数"
+	}
+	cur := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if cur == "" {
+		cur = "CNY"
+	}
+	amount := req.Amount.RoundFor(cur)
+	if req.UnitPrice > 0 {
+		amount = req.UnitPrice.Mul(req.Quantity).RoundFor(cur)
+	}
+	if kind == models.RevenueKindSale && amount <= 0 {
+		return "销售记录须填写单价或金额"
+	}
+	if kind == models.RevenueKindHarvest && req.Quantity <= 0 {
+		return "收获记录须填写数量"
+	}
+	rec.Date = d
+	rec.Kind = kind
+	rec.Item = item
+	rec.Quantity = req.Quantity
+	rec.Unit = strings.TrimSpace(req.Unit)
+	rec.UnitPrice = req.UnitPrice
+	rec.Amount = amount
+	rec.Currency = cur
+	rec.Buyer = strings.TrimSpace(req.Buyer)
+	rec.Note = req.Note
+	return ""
+}
+
+// canEditRevenue 管理员可修改任意记录；其他用户须为本人录入且在其基地范围内
+func canEditRevenue(claims jwt.MapClaims, rec *models.RevenueRecord) bool {
+	if claimRole(claims) == "admin" {
+		return true
+	}
+	return rec.CreatedBy == claimUserID(claims) && containsUint(claimBaseIDs(claims), rec.BaseID)
+}
+
+// CreateRevenue 新增收入/产出记录
+func CreateRevenue(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var req revenueReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	uid := claimUserID(claims)
+	baseID, msg := resolveBaseID(claimRole(claims), claimBaseIDs(claims), req.BaseID)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	rec := models.RevenueRecord{BaseID: baseID, CreatedBy: uid}
+	if msg := validateRevenue(req, &rec); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if rec.SectionID, msg = resolveSectionID(baseID, req.SectionID, uid); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := periodLockMsg(baseID, rec.Date); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	var creator models.User
+	db.DB.Select("id, name").First(&creator, uid)
+	rec.CreatorName = creator.Name
+	if err := db.DB.Omit("Base", "Section").Create(&rec).Error; err != nil {
+		http.Error(w, "保存失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.Preload("Base").Preload("Section").First(&rec, rec.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// ListRevenue 收入/产出记录列表
+// 参数：start_date、end_date（默认本年初至今天）、base_id、section_id、kind、item（模糊）
+func ListRevenue(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	q := db.DB.Model(&models.RevenueRecord{}).
+		Where("date BETWEEN ? AND ?", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ?", bid)
+	}
+	if sid := r.URL.Query().Get("section_id"); sid != "" {
+		q = q.Where("section_id = ?", sid)
+	}
+	if k := r.URL.Query().Get("kind"); k != "" {
+		q = q.Where("kind = ?", k)
+	}
+	if item := strings.TrimSpace(r.URL.Query().Get("item")); item != "" {
+		q = q.Where("item LIKE ?", "%"+item+"%")
+	}
+	var rows []models.RevenueRecord
+	q.Preload("Base").Preload("Section").Order("date desc, id desc").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// UpdateRevenue 修改收入/产出记录，参数 id；基地不可修改
+func UpdateRevenue(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var rec models.RevenueRecord
+	if err := db.DB.First(&rec, id).Error; err != nil {
+		http.Error(w, "记录不存在", http.StatusNotFound)
+		return
+	}
+	if !canEditRevenue(claims, &rec) {
+		http.Error(w, "无权修改", http.StatusForbidden)
+		return
+	}
+	var req revenueReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	oldDate := rec.Date
+	if msg := validateRevenue(req, &rec); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if req.SectionID != nil {
+		var msg string
+		if rec.SectionID, msg = resolveSectionID(rec.BaseID, req.SectionID, 0); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	// 原日期与新日期所在期间均须未结账
+	if msg := periodLockMsg(rec.BaseID, oldDate, rec.Date); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	rec.UpdatedAt = time.Now()
+	if err := db.DB.Omit("Base", "Section").Save(&rec).Error; err != nil {
+		http.Error(w, "保存失败", http.StatusInternalServerError)
+		return
+	}
+	db.DB.Preload("Base").Preload("Section").First(&rec, rec.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// DeleteRevenue 删除收入/产出记录，参数 id
+func DeleteRevenue(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var rec models.RevenueRecord
+	if err := db.DB.First(&rec, id).Error; err != nil {
+		http.Error(w, "记录不存在", http.StatusNotFound)
+		return
+	}
+	if !canEditRevenue(claims, &rec) {
+		http.Error(w, "无权删除", http.StatusForbidden)
+		return
+	}
+	if msg := periodLockMsg(rec.BaseID, rec.Date); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	if err := db.DB.Delete(&rec).Error; err != nil {
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "删除成功"})
+}
+
+// BasePnL 基地损益（目标币种）
+type BasePnL struct {
+	BaseID      uint         `json:"base_id"`
+	Base        string       `json:"base"`
+	Revenue     money.Amount `json:"revenue"`      // 销售收入
+	OutputValue money.Amount `json:"output_value"` // 收获/产出估值（不计入收入）
+	Expense     money.Amount `json:"expense"`      // 开支（按分摊）
+	Requisition money.Amount `json:"requisition"`  // 物资领用成本
+	Purchase    money.Amount `json:"purchase"`     // 采购（include_purchases=1 时计入成本）
+	TotalCost   money.Amount `json:"total_cost"`
+	Margin      money.Amount `json:"margin"`
+	MarginPct   float64      `json:"margin_pct"` // 毛利率（%），无收入时为 0
+	Currency    string       `json:"currency"`
+}
+
+// pnlTotals 按基地逐日折算为目标币种后合计
+func pnlTotals(rb *rateBook, q *gorm.DB, target string) map[uint]money.Amount {
+	var rows []dailyBaseTotal
+	q.Scan(&rows)
+	out := map[uint]money.Amount{}
+	for _, x := range rows {
+		out[x.BaseID] += rb.convertRaw(x.Total, x.Curr, target, parseRateDay(x.Day))
+	}
+	for k, v := range out {
+		out[k] = v.RoundFor(target)
+	}
+	return out
+}
+
+// BaseProfitAndLoss 基地损益表：销售收入 − 成本（开支按分摊 + 物资领用，可选计入采购）
+// GET 参数：start_date、end_date（默认本年初至今天）、base_id、target_currency、include_purchases=1
+// 物资先采购入库、领用时计入成本，默认不重复计入采购；采购直接消耗的基地可设 include_purchases=1
+func BaseProfitAndLoss(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	target, msg := parseTargetCurrency(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	includePurchases := r.URL.Query().Get("include_purchases") == "1"
+	endExcl := end.AddDate(0, 0, 1)
+	scope := func(q *gorm.DB, col string) *gorm.DB {
+		if claimRole(claims) != "admin" {
+			ids := claimBaseIDs(claims)
+			if len(ids) == 0 {
+				return q.Where("1 = 0")
+			}
+			q = q.Where(col+" IN ?", ids)
+		}
+		if bid := r.URL.Query().Get("base_id"); bid != "" {
+			q = q.Where(col+" = ?", bid)
+		}
+		return q
+	}
+	rb := loadRateBook(db.DB)
+	daily := func(table, alias, dateCol, amountCol string) *gorm.DB {
+		return scope(db.DB.Table(table).
+			Select(alias+".base_id as base_id, "+recordCurrencySQL(alias)+" as curr, DATE_FORMAT("+alias+"."+dateCol+",'%Y-%m-%d') as day, COALESCE(SUM("+alias+"."+amountCol+"),0) as total").
+			Where(alias+"."+dateCol+" >= ? AND "+alias+"."+dateCol+" < ?", start, endExcl), alias+".base_id").
+			Group(alias + ".base_id, curr, day")
+	}
+	revenue := pnlTotals(rb, daily("revenue_records rv", "rv", "date", "amount").Where("rv.kind = ?", models.RevenueKindSale), target)
+	output := pnlTotals(rb, daily("revenue_records rv", "rv", "date", "amount").Where("rv.kind = ?", models.RevenueKindHarvest), target)
+	expense := pnlTotals(rb, daily(allocatedExpenses("be"), "be", "date", "amount").
+		Where("be.base_id IS NOT NULL AND be.status IN ?", models.ExpenseCountedStatuses), target)
+	requisition := pnlTotals(rb, daily("material_requisitions mr", "mr", "request_date", "total_amount"), target)
+	purchase := pnlTotals(rb, daily("purchase_entries pe", "pe", "purchase_date", "total_amount"), target)
+
+	ids := map[uint]bool{}
+	for _, m := range []map[uint]money.Amount{revenue, output, expense, requisition, purchase} {
+		for id := range m {
+			ids[id] = true
+		}
+	}
+	baseIDs := make([]uint, 0, len(ids))
+	for id := range ids {
+		baseIDs = append(baseIDs, id)
+	}
+	names := map[uint]string{}
+	if len(baseIDs) > 0 {
+		var bases []models.Base
+		db.DB.Select("id, name").Where("id IN ?", baseIDs).Find(&bases)
+		for _, b := range bases {
+			names[b.ID] = b.Name
+		}
+	}
+	out := make([]BasePnL, 0, len(baseIDs))
+	total := BasePnL{Base: "合计", Currency: target}
+	for _, id := range baseIDs {
+		p := BasePnL{
+			BaseID: id, Base: names[id], Currency: target,
+			Revenue: revenue[id], OutputValue: output[id], Expense: expense[id],
+			Requisition: requisition[id], Purchase: purchase[id],
+		}
+		p.TotalCost = p.Expense + p.Requisition
+		if includePurchases {
+			p.TotalCost += p.Purchase
+		}
+		p.Margin = p.Revenue - p.TotalCost
+		p.MarginPct = marginPercent(p.Margin, p.Revenue)
+		out = append(out, p)
+
+		total.Revenue += p.Revenue
+		total.OutputValue += p.OutputValue
+		total.Expense += p.Expense
+		total.Requisition += p.Requisition
+		total.Purchase += p.Purchase
+		total.TotalCost += p.TotalCost
+		total.Margin += p.Margin
+	}
+	total.MarginPct = marginPercent(total.Margin, total.Revenue)
+	sort.Slice(out, func(i, j int) bool { return out[i].Margin > out[j].Margin })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start_date":        start.Format("2006-01-02"),
+		"end_date":          end.Format("2006-01-02"),
+		"currency":          target,
+		"include_purchases": includePurchases,
+		"bases":             out,
+		"total":             total,
+	})
+}
+
+// marginPercent 毛利率（%），保留两位小数；收入为 0 时返回 0
+func marginPercent(margin, revenue money.Amount) float64 {
+	if revenue <= 0 {
+		return 0
+	}
+	p := margin.Float64() / revenue.Float64() * 100
+	if p < 0 {
+		return -float64(int64(-p*100+0.5)) / 100
+	}
+	return float64(int64(p*100+0.5)) / 100
+}
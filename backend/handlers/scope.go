@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claimRole 从 JWT 中读取角色（缺失时返回空串，避免断言panic）
+func claimRole(claims jwt.MapClaims) string {
+	if v, ok := claims["role"]; ok && v != nil {
+		if s, ok2 := v.(string); ok2 {
+			return s
+		}
+	}
+	return ""
+}
+
+// claimUserID 从 JWT 中读取用户ID（兼容 uid / user_id 两种键）
+func claimUserID(claims jwt.MapClaims) uint {
+	if v, ok := claims["uid"]; ok && v != nil {
+		if f, ok2 := v.(float64); ok2 {
+			return uint(f)
+		}
+	} else if v, ok := claims["user_id"]; ok && v != nil {
+		if f, ok2 := v.(float64); ok2 {
+			return uint(f)
+		}
+	}
+	return 0
+}
+
+// claimBaseIDs 将 JWT 中的 bases(基地代码列表) 映射为基地ID
+func claimBaseIDs(claims jwt.MapClaims) []uint {
+	var codes []string
+	if v, ok := claims["bases"]; ok && v != nil {
+		if arr, ok2 := v.([]interface{}); ok2 {
+			for _, x := range arr {
+				if s, ok3 := x.(string); ok3 {
+					codes = append(codes, s)
+				}
+			}
+		}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	var bs []models.Base
+	if err := db.DB.Where("code IN ?", codes).Find(&bs).Error; err != nil {
+		return nil
+	}
+	ids := make([]uint, 0, len(bs))
+	for _, b := range bs {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+// containsUint 判断 id 是否在集合内
+func containsUint(ids []uint, id uint) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveBaseID 解析并校验写入记录所属基地：admin 可任意指定；base_agent 仅限本人基地
+func resolveBaseID(role string, allowed []uint, requested uint) (uint, string) {
+	if role == "admin" {
+		if requested == 0 {
+			return 0, "必须指定基地"
+		}
+		var base models.Base
+		if err := db.DB.First(&base, requested).Error; err != nil {
+			return 0, "指定的基地不存在"
+		}
+		return requested, ""
+	}
+	if len(allowed) == 0 {
+		return 0, "当前用户未绑定基地"
+	}
+	if requested == 0 {
+		return allowed[0], ""
+	}
+	if !containsUint(allowed, requested) {
+		return 0, "无权操作该基地"
+	}
+	return requested, ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// resolveSectionID 确定单据所属分区：requested 非空时须为该基地的分区（0 表示不指定分区）；
+// 为空时默认取 uid 在该基地担任队长的分区
+func resolveSectionID(baseID uint, requested *uint, uid uint) (*uint, string) {
+	if requested != nil {
+		if *requested == 0 {
+			return nil, ""
+		}
+		var sec models.BaseSection
+		if err := db.DB.Select("id, base_id").First(&sec, *requested).Error; err != nil {
+			return nil, "指定的分区不存在"
+		}
+		if sec.BaseID != baseID {
+			return nil, "指定的分区不属于该基地"
+		}
+		id := sec.ID
+		return &id, ""
+	}
+	if baseID == 0 || uid == 0 {
+		return nil, ""
+	}
+	var sec models.BaseSection
+	if err := db.DB.Select("id").Where("base_id = ? AND leader_id = ?", baseID, uid).Order("id").First(&sec).Error; err != nil {
+		return nil, ""
+	}
+	id := sec.ID
+	return &id, ""
+}
+
+// SectionCost 分区（或队长）成本汇总，金额为目标币种
+type SectionCost struct {
+	BaseID      uint         `json:"base_id,omitempty"`
+	Base        string       `json:"base,omitempty"`
+	SectionID   *uint        `json:"section_id,omitempty"`
+	Section     string       `json:"section,omitempty"`
+	LeaderID    *uint        `json:"leader_id,omitempty"`
+	Leader      string       `json:"leader"`
+	Expense     money.Amount `json:"expense"`
+	Requisition money.Amount `json:"requisition"`
+	Total       money.Amount `json:"total"`
+	Share       float64      `json:"share"` // 占合计比例（%）
+	Currency    string       `json:"currency"`
+}
+
+// sectionDayTotal 按 分区+单据币种+日期 汇总的金额
+type sectionDayTotal struct {
+	BaseID    uint
+	SectionID *uint
+	Curr      string
+	Day       string
+	Total     money.Amount
+}
+
+// CostBySection 按分区或队长统计开支与物资申领成本，便于比较各分区（如 1区、2区）
+// GET 参数：start_date、end_date（默认本年初至今天）、base_id、group_by=section（默认）/ leader、target_currency
+// 开支按分摊行计入；未指定分区的单据归入各基地的“未分区”
+func CostBySection(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	target, msg := parseTargetCurrency(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "section"
+	}
+	if groupBy != "section" && groupBy != "leader" {
+		http.Error(w, "group_by 仅支持 section / leader", http.StatusBadRequest)
+		return
+	}
+	endExcl := end.AddDate(0, 0, 1)
+
+	scope := func(q *gorm.DB, col string) *gorm.DB {
+		if claimRole(claims) != "admin" {
+			ids := claimBaseIDs(claims)
+			if len(ids) == 0 {
+				return q.Where("1 = 0")
+			}
+			q = q.Where(col+" IN ?", ids)
+		}
+		if bid := r.URL.Query().Get("base_id"); bid != "" {
+			q = q.Where(col+" = ?", bid)
+		}
+		return q
+	}
+
+	var expRows []sectionDayTotal
+	eq := db.DB.Table(allocatedExpenses("be")).
+		Select("be.base_id as base_id, be.section_id as section_id, "+recordCurrencySQL("be")+" as curr, DATE_FORMAT(be.date,'%Y-%m-%d') as day, COALESCE(SUM(be.amount),0) as total").
+		Where("be.base_id IS NOT NULL AND be.date >= ? AND be.date < ?", start, endExcl).
+		Where("be.status IN ?", models.ExpenseCountedStatuses)
+	scope(eq, "be.base_id").Group("be.base_id, be.section_id, curr, day").Scan(&expRows)
+
+	var reqRows []sectionDayTotal
+	rq := db.DB.Table("material_requisitions mr").
+		Select("mr.base_id as base_id, mr.section_id as section_id, "+recordCurrencySQL("mr")+" as curr, DATE_FORMAT(mr.request_date,'%Y-%m-%d') as day, COALESCE(SUM(mr.total_amount),0) as total").
+		Where("mr.request_date >= ? AND mr.request_date < ?", start, endExcl)
+	scope(rq, "mr.base_id").Group("mr.base_id, mr.section_id, curr, day").Scan(&reqRows)
+
+	// 分区、基地、队长名称
+	var sections []models.BaseSection
+	db.DB.Select("id, name, base_id, leader_id").Find(&sections)
+	secByID := make(map[uint]models.BaseSection, len(sections))
+	leaderIDs := []uint{}
+	for _, s := range sections {
+		secByID[s.ID] = s
+		if s.LeaderID != nil {
+			leaderIDs = append(leaderIDs, *s.LeaderID)
+		}
+	}
+	leaderNames := map[uint]string{}
+	if len(leaderIDs) > 0 {
+		var users []models.User
+		db.DB.Select("id, name").Where("id IN ?", leaderIDs).Find(&users)
+		for _, u := range users {
+			leaderNames[u.ID] = u.Name
+		}
+	}
+	baseNames := map[uint]string{}
+	var bases []models.Base
+	db.DB.Select("id, name").Find(&bases)
+	for _, b := range bases {
+		baseNames[b.ID] = b.Name
+	}
+
+	rb := loadRateBook(db.DB)
+	idx := map[string]int{}
+	out := make([]SectionCost, 0)
+	at := func(row sectionDayTotal) *SectionCost {
+		var sec models.BaseSection
+		if row.SectionID != nil {
+			sec = secByID[*row.SectionID]
+		}
+		var key string
+		if groupBy == "leader" {
+			// 按队长汇总：无分区或分区无队长的单据按基地归入“未指定队长”
+			if sec.LeaderID != nil {
+				key = "l" + strconv.FormatUint(uint64(*sec.LeaderID), 10)
+			} else {
+				key = "b" + strconv.FormatUint(uint64(row.BaseID), 10)
+			}
+		} else if row.SectionID != nil {
+			key = "s" + strconv.FormatUint(uint64(*row.SectionID), 10)
+		} else {
+			key = "b" + strconv.FormatUint(uint64(row.BaseID), 10)
+		}
+		i, ok := idx[key]
+		if !ok {
+			i = len(out)
+			idx[key] = i
+			c := SectionCost{Currency: target, Leader: "未指定队长"}
+			if sec.LeaderID != nil {
+				c.LeaderID = sec.LeaderID
+				c.Leader = leaderNames[*sec.LeaderID]
+			}
+			switch {
+			case groupBy == "section":
+				c.BaseID, c.Base = row.BaseID, baseNames[row.BaseID]
+				c.Section = "未分区"
+				if sec.ID != 0 {
+					c.SectionID, c.Section = row.SectionID, sec.Name
+				}
+			case sec.LeaderID == nil:
+				c.BaseID, c.Base = row.BaseID, baseNames[row.BaseID]
+			}
+			out = append(out, c)
+		}
+		return &out[i]
+	}
+	for _, x := range expRows {
+		at(x).Expense += rb.convertRaw(x.Total, x.Curr, target, parseRateDay(x.Day))
+	}
+	for _, x := range reqRows {
+		at(x).Requisition += rb.convertRaw(x.Total, x.Curr, target, parseRateDay(x.Day))
+	}
+	var grand money.Amount
+	for i := range out {
+		out[i].Expense = out[i].Expense.RoundFor(target)
+		out[i].Requisition = out[i].Requisition.RoundFor(target)
+		out[i].Total = out[i].Expense + out[i].Requisition
+		grand += out[i].Total
+	}
+	for i := range out {
+		out[i].Share = budgetPercent(out[i].Total, grand)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Base != out[j].Base {
+			return out[i].Base < out[j].Base
+		}
+		return out[i].Total > out[j].Total
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start_date": start.Format("2006-01-02"),
+		"end_date":   end.Format("2006-01-02"),
+		"group_by":   groupBy,
+		"currency":   target,
+		"total":      grand,
+		"rows":       out,
+	})
+}
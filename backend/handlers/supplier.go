@@ -108,8 +108,18 @@ func GetSupplierDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 附带预付款/余额（基地代理仅看本人基地）
+	var baseIDs []uint
+	if role == "base_agent" {
+		baseIDs = claimBaseIDs(claims)
+	}
+	resp := struct {
+		models.Supplier
+		CreditBalances []SupplierCreditBalance `json:"credit_balances"`
+	}{supplier, supplierCreditBalances(supplier.ID, baseIDs)}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(supplier)
+	json.NewEncoder(w).Encode(resp)
 }
 
 // CreateSupplierRequest 创建供应商请求
@@ -122,6 +132,33 @@ type CreateSupplierRequest struct {
 	// 结算配置（可选）
 	SettlementType string `json:"settlement_type,omitempty"` // immediate | monthly | flexible
 	SettlementDay  *int   `json:"settlement_day,omitempty"`  // 1-31（月结日）
+	// 新应付款是否自动抵扣预付款/余额（默认是）
+	AutoApplyCredit *bool `json:"auto_apply_credit,omitempty"`
+	// 付款条件（可选）：net | eom，天数；现金折扣 X% / D 天
+	PaymentTermType string  `json:"payment_term_type,omitempty"`
+	PaymentTermDays int     `json:"payment_term_days,omitempty"`
+	DiscountPercent float64 `json:"discount_percent,omitempty"`
+	DiscountDays    int     `json:"discount_days,omitempty"`
+}
+
+// validatePaymentTerms 校验付款条件，返回错误信息（为空表示合法）
+func validatePaymentTerms(termType string, days int, discountPercent float64, discountDays int) string {
+	if termType != "" && termType != models.PaymentTermNet && termType != models.PaymentTermEOM {
+		return "付款条件类型无效"
+	}
+	if days < 0 || days > 365 {
+		return "付款天数需在0-365之间"
+	}
+	if discountPercent < 0 || discountPercent >= 100 {
+		return "现金折扣比例需在0-100之间"
+	}
+	if discountDays < 0 || (termType == models.PaymentTermNet && discountDays > days) {
+		return "折扣天数不能超过付款天数"
+	}
+	if discountPercent > 0 && discountDays == 0 {
+		return "设置现金折扣时需指定折扣天数"
+	}
+	return ""
 }
 
 // CreateSupplier 创建供应商
@@ -150,6 +187,11 @@ func CreateSupplier(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if msg := validatePaymentTerms(req.PaymentTermType, req.PaymentTermDays, req.DiscountPercent, req.DiscountDays); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
 	// 检查供应商名称是否已存在
 	var existingSupplier models.Supplier
 	if err := db.DB.Where("name = ?", req.Name).First(&existingSupplier).Error; err == nil {
@@ -179,6 +221,11 @@ func CreateSupplier(w http.ResponseWriter, r *http.Request) {
 			}
 			return nil
 		}(),
+		AutoApplyCredit: req.AutoApplyCredit == nil || *req.AutoApplyCredit,
+		PaymentTermType: req.PaymentTermType,
+		PaymentTermDays: req.PaymentTermDays,
+		DiscountPercent: req.DiscountPercent,
+		DiscountDays:    req.DiscountDays,
 	}
 
 	if err := db.DB.Create(&supplier).Error; err != nil {
@@ -199,6 +246,13 @@ type UpdateSupplierRequest struct {
 	Address        *string `json:"address,omitempty"`
 	SettlementType *string `json:"settlement_type,omitempty"`
 	SettlementDay  *int    `json:"settlement_day,omitempty"`
+	// 新应付款是否自动抵扣预付款/余额
+	AutoApplyCredit *bool `json:"auto_apply_credit,omitempty"`
+	// 付款条件
+	PaymentTermType *string  `json:"payment_term_type,omitempty"`
+	PaymentTermDays *int     `json:"payment_term_days,omitempty"`
+	DiscountPercent *float64 `json:"discount_percent,omitempty"`
+	DiscountDays    *int     `json:"discount_days,omitempty"`
 }
 
 // UpdateSupplier 更新供应商
@@ -285,6 +339,33 @@ func UpdateSupplier(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if req.AutoApplyCredit != nil {
+		updates["auto_apply_credit"] = *req.AutoApplyCredit
+	}
+	if req.PaymentTermType != nil || req.PaymentTermDays != nil || req.DiscountPercent != nil || req.DiscountDays != nil {
+		termType, days, pct, ddays := supplier.PaymentTermType, supplier.PaymentTermDays, supplier.DiscountPercent, supplier.DiscountDays
+		if req.PaymentTermType != nil {
+			termType = *req.PaymentTermType
+		}
+		if req.PaymentTermDays != nil {
+			days = *req.PaymentTermDays
+		}
+		if req.DiscountPercent != nil {
+			pct = *req.DiscountPercent
+		}
+		if req.DiscountDays != nil {
+			ddays = *req.DiscountDays
+		}
+		if msg := validatePaymentTerms(termType, days, pct, ddays); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		updates["payment_term_type"] = termType
+		updates["payment_term_days"] = days
+		updates["discount_percent"] = pct
+		updates["discount_days"] = ddays
+	}
+
 	if len(updates) > 0 {
 		if err := db.DB.Model(&supplier).Updates(updates).Error; err != nil {
 			http.Error(w, "更新供应商失败", http.StatusInternalServerError)
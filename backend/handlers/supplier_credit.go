@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SupplierCreditBalance 供应商预付款/余额（按基地+币种）
+type SupplierCreditBalance struct {
+	SupplierID uint         `json:"supplier_id"`
+	BaseID     uint         `json:"base_id"`
+	BaseName   string       `json:"base_name"`
+	Currency   string       `json:"currency"`
+	Balance    money.Amount `json:"balance"`
+}
+
+// supplierCreditBalance 某供应商在某基地某币种下的可用余额
+func supplierCreditBalance(q *gorm.DB, supplierID, baseID uint, currency string) money.Amount {
+	var bal money.Amount
+	q.Model(&models.SupplierCreditEntry{}).
+		Where("supplier_id = ? AND base_id = ? AND currency = ?", supplierID, baseID, currency).
+		Select("COALESCE(SUM(amount), 0)").Scan(&bal)
+	return bal
+}
+
+// lockSupplierCredit 锁定供应商行，使同一供应商的余额读取与增减依次进行（事务结束时释放），
+// 避免并发抵扣、删除预付款重复使用同一笔余额
+func lockSupplierCredit(tx *gorm.DB, supplierID uint) error {
+	var sup models.Supplier
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&sup, supplierID).Error; err != nil {
+		return errors.New("供应商不存在")
+	}
+	return nil
+}
+
+// supplierCreditBalances 某供应商各基地、各币种的余额；baseIDs 为空表示不限基地
+func supplierCreditBalances(supplierID uint, baseIDs []uint) []SupplierCreditBalance {
+	q := db.DB.Table("supplier_credit_entries sc").
+		Select("sc.supplier_id, sc.base_id, b.name as base_name, sc.currency, SUM(sc.amount) as balance").
+		Joins("LEFT JOIN bases b ON b.id = sc.base_id").
+		Where("sc.supplier_id = ?", supplierID).
+		Group("sc.supplier_id, sc.base_id, b.name, sc.currency").
+		Having("SUM(sc.amount) <> 0")
+	if baseIDs != nil {
+		q = q.Where("sc.base_id IN ?", baseIDs)
+	}
+	rows := []SupplierCreditBalance{}
+	q.Scan(&rows)
+	return rows
+}
+
+// applySupplierCredit 在事务内用供应商余额抵扣应付款，生成 credit 方式的还款记录。
+// amount<=0 表示尽可能多地抵扣；返回实际抵扣金额（余额不足或无需抵扣时为 0）。
+func applySupplierCredit(tx *gorm.DB, payable *models.PayableRecord, amount money.Amount, uid uint) (money.Amount, error) {
+	if payable.SupplierID == nil || payable.Status == models.PayableStatusPaid {
+		return 0, nil
+	}
+	if err := lockSupplierCredit(tx, *payable.SupplierID); err != nil {
+		return 0, err
+	}
+	bal := supplierCreditBalance(tx, *payable.SupplierID, payable.BaseID, payable.Currency)
+	use := money.Min(bal, payable.RemainingAmount)
+	if amount > 0 {
+		if amount > bal {
+			return 0, errors.New("预付款余额不足")
+		}
+		if amount > payable.RemainingAmount {
+			return 0, errors.New("抵扣金额不能超过剩余应付金额")
+		}
+		use = amount
+	}
+	use = use.RoundFor(payable.Currency)
+	if use <= 0 {
+		return 0, nil
+	}
+	payment := models.PaymentRecord{
+		PayableRecordID: payable.ID,
+		PaymentAmount:   use,
+		Currency:        payable.Currency,
+		PaymentDate:     time.Now(),
+		PaymentMethod:   models.PaymentMethodCredit,
+		Notes:           "预付款/余额抵扣",
+		CreatedBy:       uid,
+	}
+	if err := applyPayment(tx, payable, &payment); err != nil {
+		return 0, err
+	}
+	entry := models.SupplierCreditEntry{
+		SupplierID:      *payable.SupplierID,
+		BaseID:          payable.BaseID,
+		Currency:        payable.Currency,
+		Amount:          -use,
+		Kind:            models.SupplierCreditApplied,
+		EntryDate:       payment.PaymentDate,
+		PayableRecordID: &payable.ID,
+		PaymentRecordID: &payment.ID,
+		CreatedBy:       uid,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return 0, errors.New("记录余额抵扣失败")
+	}
+	return use, nil
+}
+
+// recordOverpayment 记录还款超出剩余应付的部分为供应商余额
+func recordOverpayment(tx *gorm.DB, payable *models.PayableRecord, payment *models.PaymentRecord, excess money.Amount) error {
+	entry := models.SupplierCreditEntry{
+		SupplierID:      *payable.SupplierID,
+		BaseID:          payable.BaseID,
+		Currency:        payable.Currency,
+		Amount:          excess,
+		Kind:            models.SupplierCreditOverpayment,
+		EntryDate:       payment.PaymentDate,
+		ReferenceNumber: payment.ReferenceNumber,
+		PayableRecordID: &payable.ID,
+		PaymentRecordID: &payment.ID,
+		Notes:           "超付转入余额",
+		CreatedBy:       payment.CreatedBy,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return errors.New("记录超付余额失败")
+	}
+	return postCreditJournal(tx, &entry)
+}
+
+// revertPaymentCredit 删除还款记录时回滚其关联的余额流水：
+// 抵扣产生的还款删除后余额恢复；超付形成的余额若已被使用则不允许删除
+func revertPaymentCredit(tx *gorm.DB, payment *models.PaymentRecord) error {
+	var entries []models.SupplierCreditEntry
+	if err := tx.Where("payment_record_id = ?", payment.ID).Find(&entries).Error; err != nil {
+		return errors.New("查询余额流水失败")
+	}
+	for _, e := range entries {
+		if e.Amount > 0 {
+			if err := lockSupplierCredit(tx, e.SupplierID); err != nil {
+				return err
+			}
+			if supplierCreditBalance(tx, e.SupplierID, e.BaseID, e.Currency) < e.Amount {
+				return errors.New("该笔超付形成的余额已被抵扣，请先撤销相关抵扣")
+			}
+		}
+		if err := tx.Delete(&models.SupplierCreditEntry{}, e.ID).Error; err != nil {
+			return errors.New("删除余额流水失败")
+		}
+		if err := removeJournal(tx, models.JournalSourceCredit, e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateSupplierPrepayment 登记供应商预付款（无对应应付款），计入供应商余额
+func CreateSupplierPrepayment(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	uid := claimUserID(claims)
+	if uid == 0 {
+		http.Error(w, "token缺少用户信息", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		SupplierID    uint         `json:"supplier_id"`
+		BaseID        uint         `json:"base_id"`
+		Amount        money.Amount `json:"amount"`
+		Currency      string       `json:"currency"`
+		PaymentDate   string       `json:"payment_date"`
+		PaymentMethod string       `json:"payment_method"`
+		Reference     string       `json:"reference"`
+		Note          string       `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "请求数据格式错误", http.StatusBadRequest)
+		return
+	}
+	if req.SupplierID == 0 || req.Amount <= 0 {
+		http.Error(w, "供应商和预付金额不能为空", http.StatusBadRequest)
+		return
+	}
+	var sup models.Supplier
+	if err := db.DB.First(&sup, req.SupplierID).Error; err != nil {
+		http.Error(w, "供应商不存在", http.StatusNotFound)
+		return
+	}
+	baseID, msg := resolveBaseID(role, claimBaseIDs(claims), req.BaseID)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	cur := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if cur == "" {
+		var base models.Base
+		if err := db.DB.First(&base, baseID).Error; err == nil && base.Currency != "" {
+			cur = base.Currency
+		} else {
+			cur = "CNY"
+		}
+	}
+	req.Amount = req.Amount.RoundFor(cur)
+	if role != "admin" && paymentNeedsApproval(cur, req.Amount) {
+		http.Error(w, "金额超过审批阈值，请由管理员登记预付款", http.StatusForbidden)
+		return
+	}
+	date := time.Now()
+	if req.PaymentDate != "" {
+		d, err := time.Parse("2006-01-02", req.PaymentDate)
+		if err != nil {
+			http.Error(w, "付款日期格式错误", http.StatusBadRequest)
+			return
+		}
+		date = d
+	}
+	if msg := periodLockMsg(baseID, date); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	method := req.PaymentMethod
+	if method == "" {
+		method = models.PaymentMethodBankTransfer
+	}
+	entry := models.SupplierCreditEntry{
+		SupplierID:      sup.ID,
+		BaseID:          baseID,
+		Currency:        cur,
+		Amount:          req.Amount,
+		Kind:            models.SupplierCreditPrepayment,
+		EntryDate:       date,
+		PaymentMethod:   method,
+		ReferenceNumber: req.Reference,
+		Notes:           req.Note,
+		CreatedBy:       uid,
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "登记预付款失败", http.StatusInternalServerError)
+		return
+	}
+	if err := postCreditJournal(tx, &entry); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"entry":   entry,
+		"balance": supplierCreditBalance(db.DB, sup.ID, baseID, cur),
+	})
+}
+
+// DeleteSupplierPrepayment 删除预付款登记（仅管理员；余额已被抵扣时不允许删除）
+func DeleteSupplierPrepayment(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以删除预付款", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var e models.SupplierCreditEntry
+	if err := db.DB.First(&e, id).Error; err != nil {
+		http.Error(w, "预付款记录不存在", http.StatusNotFound)
+		return
+	}
+	if e.Kind != models.SupplierCreditPrepayment {
+		http.Error(w, "只能删除预付款登记，超付与抵扣请通过还款记录处理", http.StatusBadRequest)
+		return
+	}
+	if msg := periodLockMsg(e.BaseID, e.EntryDate); msg != "" {
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	// 锁定供应商后再校验余额，避免与并发抵扣交错
+	if err := lockSupplierCredit(tx, e.SupplierID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if supplierCreditBalance(tx, e.SupplierID, e.BaseID, e.Currency) < e.Amount {
+		tx.Rollback()
+		http.Error(w, "该预付款已被抵扣，请先撤销相关抵扣", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Delete(&e).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	if err := removeJournal(tx, models.JournalSourceCredit, e.ID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
+
+// ApplySupplierCredit 手动用供应商余额抵扣应付款
+// 请求体：{payable_id, amount}，amount 省略或为0时按 min(余额, 剩余应付) 抵扣
+func ApplySupplierCredit(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	uid := claimUserID(claims)
+	var req struct {
+		PayableID uint         `json:"payable_id"`
+		Amount    money.Amount `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PayableID == 0 {
+		http.Error(w, "请求数据格式错误", http.StatusBadRequest)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	var payable models.PayableRecord
+	if err := lockPayable(tx, &payable, req.PayableID); err != nil {
+		tx.Rollback()
+		http.Error(w, "应付款记录不存在", http.StatusNotFound)
+		return
+	}
+	if role == "base_agent" && !containsUint(claimBaseIDs(claims), payable.BaseID) {
+		tx.Rollback()
+		http.Error(w, "无权处理此应付款记录", http.StatusForbidden)
+		return
+	}
+	if payable.SupplierID == nil {
+		tx.Rollback()
+		http.Error(w, "该应付款未关联供应商", http.StatusBadRequest)
+		return
+	}
+	if payable.Status == models.PayableStatusPaid {
+		tx.Rollback()
+		http.Error(w, "此应付款已付清，无法继续还款", http.StatusBadRequest)
+		return
+	}
+	applied, err := applySupplierCredit(tx, &payable, req.Amount, uid)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if applied == 0 {
+		tx.Rollback()
+		http.Error(w, "该供应商在此基地无可用余额", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"applied": applied,
+		"payable": payable,
+		"balance": supplierCreditBalance(db.DB, *payable.SupplierID, payable.BaseID, payable.Currency),
+	})
+}
+
+// SupplierStatementLine 供应商对账单明细
+type SupplierStatementLine struct {
+	Date      time.Time    `json:"date"`
+	Type      string       `json:"type"` // payable / payment / prepayment / overpayment / applied
+	BaseID    uint         `json:"base_id"`
+	Currency  string       `json:"currency"`
+	Amount    money.Amount `json:"amount"`
+	Reference string       `json:"reference,omitempty"`
+	PayableID *uint        `json:"payable_id,omitempty"`
+	PaymentID *uint        `json:"payment_id,omitempty"`
+	Notes     string       `json:"notes,omitempty"`
+}
+
+// SupplierStatementTotal 对账单按币种汇总
+type SupplierStatementTotal struct {
+	Currency      string       `json:"currency"`
+	Payable       money.Amount `json:"payable"`        // 期间应付
+	Paid          money.Amount `json:"paid"`           // 期间还款（不含余额抵扣）
+	Outstanding   money.Amount `json:"outstanding"`    // 当前剩余应付
+	CreditBalance money.Amount `json:"credit_balance"` // 当前预付款/余额
+	NetDue        money.Amount `json:"net_due"`        // 剩余应付 - 余额
+}
+
+// GetSupplierStatement 供应商对账单：应付、还款、预付款/余额流水，以及按币种的剩余应付与余额
+// 参数：id（供应商）、base_id、start_date、end_date
+func GetSupplierStatement(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	supplierID, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if supplierID == 0 {
+		http.Error(w, "无效的供应商ID", http.StatusBadRequest)
+		return
+	}
+	var sup models.Supplier
+	if err := db.DB.First(&sup, supplierID).Error; err != nil {
+		http.Error(w, "供应商不存在", http.StatusNotFound)
+		return
+	}
+	var baseIDs []uint
+	if role == "base_agent" {
+		baseIDs = claimBaseIDs(claims)
+	}
+	if bid, _ := strconv.ParseUint(r.URL.Query().Get("base_id"), 10, 64); bid != 0 {
+		if baseIDs != nil && !containsUint(baseIDs, uint(bid)) {
+			http.Error(w, "无权查看该基地", http.StatusForbidden)
+			return
+		}
+		baseIDs = []uint{uint(bid)}
+	}
+	start := r.URL.Query().Get("start_date")
+	end := r.URL.Query().Get("end_date")
+	scope := func(q *gorm.DB, col string) *gorm.DB {
+		if baseIDs != nil {
+			q = q.Where(col+" IN ?", baseIDs)
+		}
+		return q
+	}
+
+	lines := []SupplierStatementLine{}
+	totals := map[string]*SupplierStatementTotal{}
+	total := func(cur string) *SupplierStatementTotal {
+		if totals[cur] == nil {
+			totals[cur] = &SupplierStatementTotal{Currency: cur}
+		}
+		return totals[cur]
+	}
+
+	var payables []models.PayableRecord
+	pq := scope(db.DB.Where("supplier_id = ?", sup.ID), "base_id")
+	pq.Find(&payables)
+	for _, p := range payables {
+		total(p.Currency).Outstanding += p.RemainingAmount
+		d := p.CreatedAt.Format("2006-01-02")
+		if (start != "" && d < start) || (end != "" && d > end) {
+			continue
+		}
+		id := p.ID
+		total(p.Currency).Payable += p.TotalAmount
+		lines = append(lines, SupplierStatementLine{Date: p.CreatedAt, Type: "payable", BaseID: p.BaseID, Currency: p.Currency, Amount: p.TotalAmount, PayableID: &id})
+	}
+
+	var payments []models.PaymentRecord
+	mq := scope(db.DB.Joins("JOIN payable_records ON payment_records.payable_record_id = payable_records.id").
+		Where("payable_records.supplier_id = ?", sup.ID), "payable_records.base_id").
+		Where("payment_records.payment_method <> ?", models.PaymentMethodCredit)
+	if start != "" {
+		mq = mq.Where("payment_records.payment_date >= ?", start)
+	}
+	if end != "" {
+		mq = mq.Where("payment_records.payment_date <= ?", end)
+	}
+	mq.Preload("PayableRecord").Find(&payments)
+	for _, m := range payments {
+		pid, mid := m.PayableRecordID, m.ID
+		total(m.Currency).Paid += m.PaymentAmount
+		lines = append(lines, SupplierStatementLine{Date: m.PaymentDate, Type: "payment", BaseID: m.PayableRecord.BaseID, Currency: m.Currency, Amount: -m.PaymentAmount, Reference: m.ReferenceNumber, PayableID: &pid, PaymentID: &mid, Notes: m.Notes})
+	}
+
+	var entries []models.SupplierCreditEntry
+	cq := scope(db.DB.Where("supplier_id = ?", sup.ID), "base_id")
+	cq.Find(&entries)
+	for _, e := range entries {
+		total(e.Currency).CreditBalance += e.Amount
+		d := e.EntryDate.Format("2006-01-02")
+		if (start != "" && d < start) || (end != "" && d > end) {
+			continue
+		}
+		lines = append(lines, SupplierStatementLine{Date: e.EntryDate, Type: e.Kind, BaseID: e.BaseID, Currency: e.Currency, Amount: e.Amount, Reference: e.ReferenceNumber, PayableID: e.PayableRecordID, PaymentID: e.PaymentRecordID, Notes: e.Notes})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Date.Before(lines[j].Date) })
+	out := make([]SupplierStatementTotal, 0, len(totals))
+	for _, t := range totals {
+		t.NetDue = t.Outstanding - t.CreditBalance
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Currency < out[j].Currency })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"supplier": sup,
+		"lines":    lines,
+		"totals":   out,
+		"credit":   supplierCreditBalances(sup.ID, baseIDs),
+	})
+}
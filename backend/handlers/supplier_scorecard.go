@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// scorecardUnavailable 暂无数据来源的指标：系统尚无收货记录，无法统计准时交货与短缺/拒收数量
+var scorecardUnavailable = []string{"on_time_delivery", "short_quantity", "rejected_quantity"}
+
+// ScorecardPricePoint 某月的平均单价（目标币种 / 基准单位）
+type ScorecardPricePoint struct {
+	Month    string       `json:"month"`
+	Quantity float64      `json:"quantity"`
+	AvgPrice money.Amount `json:"avg_price"`
+}
+
+// ScorecardProduct 供应商某商品的采购量与价格走势
+type ScorecardProduct struct {
+	ProductName string                `json:"product_name"`
+	Quantity    float64               `json:"quantity"`
+	Spend       money.Amount          `json:"spend"`
+	AvgPrice    money.Amount          `json:"avg_price"`
+	FirstPrice  money.Amount          `json:"first_price"`
+	LastPrice   money.Amount          `json:"last_price"`
+	ChangePct   *float64              `json:"price_change_pct"` // 末月相对首月的单价变化（%），仅一个月有数据时为空
+	Trend       []ScorecardPricePoint `json:"trend"`
+}
+
+// ScorecardTerms 付款条件执行情况：按应付款到期日（有分期计划时按各期）统计是否按期付清
+type ScorecardTerms struct {
+	DueItems     int      `json:"due_items"`
+	PaidOnTime   int      `json:"paid_on_time"`
+	PaidLate     int      `json:"paid_late"`
+	OverdueOpen  int      `json:"overdue_open"`
+	AdherencePct *float64 `json:"adherence_pct"` // 按期付清 /（按期 + 逾期付清 + 逾期未付），无到期项时为空
+	AvgDaysLate  float64  `json:"avg_days_late"` // 逾期项的平均逾期天数（未付的计至今天）
+}
+
+// SupplierScorecard 供应商绩效
+type SupplierScorecard struct {
+	SupplierID         uint               `json:"supplier_id"`
+	Supplier           string             `json:"supplier"`
+	Currency           string             `json:"currency"`
+	Spend              money.Amount       `json:"spend"`
+	OrderCount         int64              `json:"order_count"`
+	AvgOrderValue      money.Amount       `json:"avg_order_value"`
+	SpendShare         float64            `json:"spend_share"` // 占全部供应商采购额比例（%）
+	Products           []ScorecardProduct `json:"products"`
+	PaymentTerms       ScorecardTerms     `json:"payment_terms"`
+	Outstanding        money.Amount       `json:"outstanding"` // 未付余额（按今日汇率折算）
+	OverdueOutstanding money.Amount       `json:"overdue_outstanding"`
+	OnTimeDeliveryPct  *float64           `json:"on_time_delivery_pct"`
+	ShortQuantity      *float64           `json:"short_quantity"`
+	RejectedQuantity   *float64           `json:"rejected_quantity"`
+}
+
+// dueItem 一个到期项：无分期的应付款，或分期计划中的一期
+type dueItem struct {
+	due time.Time
+	cum money.Amount // 截至本期的累计应付
+}
+
+// scorecardTerms 统计 [start, end) 内到期项的付款执行情况，返回逾期项的逾期天数合计；
+// payments 需按日期升序，已付金额含现金折扣
+func scorecardTerms(t *ScorecardTerms, items []dueItem, payments []models.PaymentRecord, start, end, today time.Time) float64 {
+	var lateDays float64
+	for _, it := range items {
+		if it.due.Before(start) || !it.due.Before(end) {
+			continue
+		}
+		var paid money.Amount
+		var settled time.Time
+		for _, p := range payments {
+			paid += p.PaymentAmount + p.DiscountAmount
+			if paid >= it.cum {
+				settled = p.PaymentDate
+				break
+			}
+		}
+		switch {
+		case !settled.IsZero() && !settled.After(it.due):
+			t.PaidOnTime++
+		case !settled.IsZero():
+			t.PaidLate++
+			lateDays += settled.Sub(it.due).Hours() / 24
+		case it.due.Before(today):
+			t.OverdueOpen++
+			lateDays += today.Sub(it.due).Hours() / 24
+		default:
+			continue
+		}
+		t.DueItems++
+	}
+	return lateDays
+}
+
+// GetSupplierScorecard 供应商绩效：采购额、订单数、各商品单价走势、付款条件执行情况与未付余额
+// GET 参数：
+//   - start_date、end_date（默认本年初至今天）、supplier_id、base_id、target_currency
+//   - products：每个供应商返回采购额最大的前 N 个商品（默认 10，0 表示全部）
+//
+// 准时交货、短缺/拒收数量需收货记录，暂无数据来源，返回空并列入 unavailable_metrics
+func GetSupplierScorecard(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	start, end, msg := parseLedgerRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	target, msg := parseTargetCurrency(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	topProducts := 10
+	if s := query.Get("products"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "products 应为非负整数", http.StatusBadRequest)
+			return
+		}
+		topProducts = n
+	}
+	var baseIDs []uint
+	if claimRole(claims) == "base_agent" {
+		baseIDs = claimBaseIDs(claims)
+	}
+	if bid, _ := strconv.ParseUint(query.Get("base_id"), 10, 64); bid != 0 {
+		if baseIDs != nil && !containsUint(baseIDs, uint(bid)) {
+			http.Error(w, "无权查看该基地", http.StatusForbidden)
+			return
+		}
+		baseIDs = []uint{uint(bid)}
+	}
+	supplierID, _ := strconv.ParseUint(query.Get("supplier_id"), 10, 64)
+	scope := func(q *gorm.DB, baseCol, supplierCol string) *gorm.DB {
+		if baseIDs != nil {
+			q = q.Where(baseCol+" IN ?", baseIDs)
+		}
+		if supplierID != 0 {
+			q = q.Where(supplierCol+" = ?", supplierID)
+		}
+		return q
+	}
+	endExcl := end.AddDate(0, 0, 1)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, end.Location())
+	rb := loadRateBook(db.DB)
+
+	var suppliers []models.Supplier
+	sq := db.DB.Select("id, name").Order("name")
+	if supplierID != 0 {
+		sq = sq.Where("id = ?", supplierID)
+	}
+	sq.Find(&suppliers)
+	cards := map[uint]*SupplierScorecard{}
+	card := func(id uint) *SupplierScorecard {
+		return cards[id]
+	}
+	for _, s := range suppliers {
+		cards[s.ID] = &SupplierScorecard{SupplierID: s.ID, Supplier: s.Name, Currency: target, Products: []ScorecardProduct{}}
+	}
+
+	// 采购额与订单数：逐日按当日汇率折算
+	var purRows []struct {
+		SupplierID uint
+		Curr       string
+		Day        string
+		Total      money.Amount
+		Cnt        int64
+	}
+	scope(db.DB.Table("purchase_entries pe"), "pe.base_id", "pe.supplier_id").
+		Select("pe.supplier_id as supplier_id, "+recordCurrencySQL("pe")+" as curr, DATE_FORMAT(pe.purchase_date,'%Y-%m-%d') as day, COALESCE(SUM(pe.total_amount),0) as total, COUNT(pe.id) as cnt").
+		Where("pe.supplier_id IS NOT NULL AND pe.purchase_date >= ? AND pe.purchase_date < ?", start, endExcl).
+		Group("pe.supplier_id, curr, day").Scan(&purRows)
+	var grand money.Amount
+	for _, x := range purRows {
+		c := card(x.SupplierID)
+		if c == nil {
+			continue
+		}
+		v := rb.convertRaw(x.Total, x.Curr, target, parseRateDay(x.Day))
+		c.Spend += v
+		c.OrderCount += x.Cnt
+		grand += v
+	}
+
+	// 商品单价走势：明细金额按当日汇率折算后按月汇总，单价 = 金额 / 基准单位数量
+	var itemRows []struct {
+		SupplierID  uint
+		ProductName string
+		Curr        string
+		Day         string
+		Amount      money.Amount
+		Qty         float64
+	}
+	scope(db.DB.Table("purchase_entry_items pei").Joins("JOIN purchase_entries pe ON pe.id = pei.purchase_entry_id"), "pe.base_id", "pe.supplier_id").
+		Select("pe.supplier_id as supplier_id, pei.product_name as product_name, "+recordCurrencySQL("pe")+" as curr, DATE_FORMAT(pe.purchase_date,'%Y-%m-%d') as day, COALESCE(SUM(pei.amount),0) as amount, COALESCE(SUM(COALESCE(NULLIF(pei.quantity_base,0), pei.quantity)),0) as qty").
+		Where("pe.supplier_id IS NOT NULL AND pe.purchase_date >= ? AND pe.purchase_date < ?", start, endExcl).
+		Group("pe.supplier_id, pei.product_name, curr, day").Scan(&itemRows)
+	type monthAgg struct {
+		amount money.Amount
+		qty    float64
+	}
+	type productKey struct {
+		supplier uint
+		name     string
+	}
+	productMonths := map[productKey]map[string]*monthAgg{}
+	for _, x := range itemRows {
+		if card(x.SupplierID) == nil || len(x.Day) < 7 {
+			continue
+		}
+		k := productKey{x.SupplierID, x.ProductName}
+		if productMonths[k] == nil {
+			productMonths[k] = map[string]*monthAgg{}
+		}
+		m := x.Day[:7]
+		if productMonths[k][m] == nil {
+			productMonths[k][m] = &monthAgg{}
+		}
+		productMonths[k][m].amount += rb.convertRaw(x.Amount, x.Curr, target, parseRateDay(x.Day))
+		productMonths[k][m].qty += x.Qty
+	}
+	unitPrice := func(amount money.Amount, qty float64) money.Amount {
+		if qty <= 0 {
+			return 0
+		}
+		return money.FromFloat(amount.Float64() / qty)
+	}
+	for k, months := range productMonths {
+		p := ScorecardProduct{ProductName: k.name, Trend: []ScorecardPricePoint{}}
+		keys := make([]string, 0, len(months))
+		for m := range months {
+			keys = append(keys, m)
+		}
+		sort.Strings(keys)
+		for _, m := range keys {
+			a := months[m]
+			p.Spend += a.amount
+			p.Quantity += a.qty
+			if a.qty > 0 {
+				p.Trend = append(p.Trend, ScorecardPricePoint{Month: m, Quantity: round3(a.qty), AvgPrice: unitPrice(a.amount, a.qty)})
+			}
+		}
+		p.AvgPrice = unitPrice(p.Spend, p.Quantity)
+		p.Spend = p.Spend.RoundFor(target)
+		p.Quantity = round3(p.Quantity)
+		if n := len(p.Trend); n > 0 {
+			p.FirstPrice, p.LastPrice = p.Trend[0].AvgPrice, p.Trend[n-1].AvgPrice
+			if n > 1 && p.FirstPrice > 0 {
+				pct := math.Round((p.LastPrice.Float64()/p.FirstPrice.Float64()-1)*10000) / 100
+				p.ChangePct = &pct
+			}
+		}
+		c := card(k.supplier)
+		c.Products = append(c.Products, p)
+	}
+
+	// 付款条件执行与未付余额
+	var payables []models.PayableRecord
+	scope(db.DB.Model(&models.PayableRecord{}), "base_id", "supplier_id").
+		Where("supplier_id IS NOT NULL").
+		Preload("Installments", orderedInstallments).
+		Preload("PaymentRecords", func(q *gorm.DB) *gorm.DB { return q.Order("payment_date asc, id asc") }).
+		Find(&payables)
+	lateDays := map[uint]float64{}
+	for _, p := range payables {
+		c := card(*p.SupplierID)
+		if c == nil {
+			continue
+		}
+		var items []dueItem
+		if len(p.Installments) > 0 {
+			var cum money.Amount
+			for _, in := range p.Installments {
+				cum += in.Amount
+				items = append(items, dueItem{due: in.DueDate, cum: cum})
+			}
+		} else if p.DueDate != nil {
+			items = append(items, dueItem{due: *p.DueDate, cum: p.TotalAmount})
+		}
+		lateDays[c.SupplierID] += scorecardTerms(&c.PaymentTerms, items, p.PaymentRecords, start, endExcl, today)
+
+		if p.Status == models.PayableStatusPaid || p.RemainingAmount <= 0 {
+			continue
+		}
+		c.Outstanding += rb.convertRaw(p.RemainingAmount, p.Currency, target, today)
+		// 逾期未付：有分期计划的取已到期各期的剩余，否则到期后整笔剩余
+		var overdue money.Amount
+		if len(p.Installments) > 0 {
+			for i := range p.Installments {
+				if p.Installments[i].IsOverdue(today) {
+					overdue += p.Installments[i].Remaining()
+				}
+			}
+		} else if p.DueDate != nil && p.DueDate.Before(today) {
+			overdue = p.RemainingAmount
+		}
+		c.OverdueOutstanding += rb.convertRaw(overdue, p.Currency, target, today)
+	}
+
+	out := make([]SupplierScorecard, 0, len(cards))
+	for _, s := range suppliers {
+		c := cards[s.ID]
+		if c.OrderCount == 0 && c.PaymentTerms.DueItems == 0 && c.Outstanding == 0 {
+			continue
+		}
+		c.Spend = c.Spend.RoundFor(target)
+		if c.OrderCount > 0 {
+			c.AvgOrderValue = money.FromFloat(c.Spend.Float64() / float64(c.OrderCount)).RoundFor(target)
+		}
+		c.SpendShare = budgetPercent(c.Spend, grand.RoundFor(target))
+		c.Outstanding = c.Outstanding.RoundFor(target)
+		c.OverdueOutstanding = c.OverdueOutstanding.RoundFor(target)
+		t := &c.PaymentTerms
+		if t.DueItems > 0 {
+			pct := math.Round(float64(t.PaidOnTime)/float64(t.DueItems)*10000) / 100
+			t.AdherencePct = &pct
+		}
+		if late := t.PaidLate + t.OverdueOpen; late > 0 {
+			t.AvgDaysLate = math.Round(lateDays[c.SupplierID]/float64(late)*10) / 10
+		}
+		sort.Slice(c.Products, func(i, j int) bool { return c.Products[i].Spend > c.Products[j].Spend })
+		if topProducts > 0 && len(c.Products) > topProducts {
+			c.Products = c.Products[:topProducts]
+		}
+		out = append(out, *c)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Spend > out[j].Spend })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start_date":          start.Format("2006-01-02"),
+		"end_date":            end.Format("2006-01-02"),
+		"currency":            target,
+		"total_spend":         grand.RoundFor(target),
+		"suppliers":           out,
+		"unavailable_metrics": scorecardUnavailable,
+	})
+}
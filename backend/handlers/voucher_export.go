@@ -0,0 +1,639 @@
+package handlers
+
+import (
+	"backend/db"
+	"backend/middleware"
+	"backend/models"
+	"backend/xlsx"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 凭证导出：将采购、还款、基地开支生成的自动凭证按列模板导出为 CSV/XLSX，
+// 供金蝶、用友等外部账套导入。导出后凭证记录批次号，不会重复导出。
+
+// voucherColumn 列模板中的一列
+type voucherColumn struct {
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+// voucherFields 可导出的字段
+var voucherFields = map[string]string{
+	"voucher_word": "凭证字（固定为“记”）",
+	"voucher_no":   "凭证号（批次内顺序号）",
+	"entry_id":     "凭证ID",
+	"date":         "凭证日期",
+	"period":       "会计期间",
+	"source_type":  "来源类型",
+	"source_id":    "来源单据ID",
+	"summary":      "摘要",
+	"account_code": "科目代码（按对照表转换）",
+	"account_name": "科目名称（按对照表转换）",
+	"debit":        "借方金额（CNY）",
+	"credit":       "贷方金额（CNY）",
+	"currency":     "原币币种",
+	"orig_amount":  "原币金额",
+	"rate":         "汇率",
+	"base_name":    "基地",
+	"preparer":     "制单人",
+}
+
+// defaultVoucherColumns 未指定模板时使用的列（金蝶 KIS 凭证引入格式）
+var defaultVoucherColumns = []voucherColumn{
+	{"凭证日期", "date"},
+	{"凭证字", "voucher_word"},
+	{"凭证号", "voucher_no"},
+	{"摘要", "summary"},
+	{"科目代码", "account_code"},
+	{"科目名称", "account_name"},
+	{"币别", "currency"},
+	{"汇率", "rate"},
+	{"原币金额", "orig_amount"},
+	{"借方金额", "debit"},
+	{"贷方金额", "credit"},
+	{"制单人", "preparer"},
+}
+
+// voucherExportSources 参与导出的凭证来源
+var voucherExportSources = []string{models.JournalSourcePurchase, models.JournalSourcePayment, models.JournalSourceExpense}
+
+var sourceTypeLabels = map[string]string{
+	models.JournalSourcePurchase: "采购",
+	models.JournalSourcePayment:  "付款",
+	models.JournalSourceExpense:  "费用",
+}
+
+func parseVoucherColumns(raw string) ([]voucherColumn, error) {
+	var cols []voucherColumn
+	if err := json.Unmarshal([]byte(raw), &cols); err != nil {
+		return nil, fmt.Errorf("列模板格式错误")
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("列模板不能为空")
+	}
+	for _, c := range cols {
+		if _, ok := voucherFields[c.Field]; !ok {
+			return nil, fmt.Errorf("不支持的字段：%s", c.Field)
+		}
+	}
+	return cols, nil
+}
+
+// ListVoucherTemplates 列模板列表，附带可用字段说明
+func ListVoucherTemplates(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	var rows []models.VoucherTemplate
+	db.DB.Order("name").Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"templates":       rows,
+		"fields":          voucherFields,
+		"default_columns": defaultVoucherColumns,
+	})
+}
+
+// UpsertVoucherTemplate 新增/修改列模板（仅管理员）；带 id 为修改
+func UpsertVoucherTemplate(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以维护导出模板", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		ID        uint            `json:"id"`
+		Name      string          `json:"name"`
+		Format    string          `json:"format"`
+		Columns   []voucherColumn `json:"columns"`
+		IsDefault bool            `json:"is_default"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "模板名称不能为空", http.StatusBadRequest)
+		return
+	}
+	if req.Format == "" {
+		req.Format = "xlsx"
+	}
+	if req.Format != "csv" && req.Format != "xlsx" {
+		http.Error(w, "格式应为 csv 或 xlsx", http.StatusBadRequest)
+		return
+	}
+	raw, _ := json.Marshal(req.Columns)
+	if _, err := parseVoucherColumns(string(raw)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var tpl models.VoucherTemplate
+	if req.ID != 0 {
+		if err := db.DB.First(&tpl, req.ID).Error; err != nil {
+			http.Error(w, "模板不存在", http.StatusNotFound)
+			return
+		}
+	}
+	tpl.Name = req.Name
+	tpl.Format = req.Format
+	tpl.Columns = string(raw)
+	tpl.IsDefault = req.IsDefault
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if tpl.IsDefault {
+		tx.Model(&models.VoucherTemplate{}).Where("is_default = ?", true).Update("is_default", false)
+	}
+	if err := tx.Save(&tpl).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "保存模板失败（名称可能重复）", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tpl)
+}
+
+// DeleteVoucherTemplate 删除列模板（仅管理员）
+func DeleteVoucherTemplate(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以维护导出模板", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err := db.DB.Delete(&models.VoucherTemplate{}, id).Error; err != nil {
+		http.Error(w, "删除失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
+
+// ListAccountMappings 科目对照表
+func ListAccountMappings(w http.ResponseWriter, r *http.Request) {
+	if _, err := middleware.ParseJWT(r); err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Preload("Base").Order("account_code")
+	if bid := r.URL.Query().Get("base_id"); bid != "" {
+		q = q.Where("base_id = ? OR base_id IS NULL", bid)
+	}
+	var rows []models.AccountMapping
+	q.Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// UpsertAccountMapping 新增/修改科目对照（仅管理员），按 account_code+base_id 唯一
+func UpsertAccountMapping(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以维护科目对照", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		AccountCode  string `json:"account_code"`
+		BaseID       *uint  `json:"base_id"`
+		ExternalCode string `json:"external_code"`
+		ExternalName string `json:"external_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	req.AccountCode = strings.TrimSpace(req.AccountCode)
+	req.ExternalCode = strings.TrimSpace(req.ExternalCode)
+	if req.AccountCode == "" || req.ExternalCode == "" {
+		http.Error(w, "科目代码和外部科目代码不能为空", http.StatusBadRequest)
+		return
+	}
+	var cnt int64
+	db.DB.Model(&models.Account{}).Where("code = ?", req.AccountCode).Count(&cnt)
+	if cnt == 0 {
+		http.Error(w, "科目不存在", http.StatusBadRequest)
+		return
+	}
+	if req.BaseID != nil && *req.BaseID == 0 {
+		req.BaseID = nil
+	}
+	var m models.AccountMapping
+	q := db.DB.Where("account_code = ?", req.AccountCode)
+	if req.BaseID == nil {
+		q = q.Where("base_id IS NULL")
+	} else {
+		q = q.Where("base_id = ?", *req.BaseID)
+	}
+	if err := q.First(&m).Error; err != nil {
+		m = models.AccountMapping{AccountCode: req.AccountCode, BaseID: req.BaseID}
+	}
+	m.ExternalCode = req.ExternalCode
+	m.ExternalName = strings.TrimSpace(req.ExternalName)
+	if err := db.DB.Save(&m).Error; err != nil {
+		http.Error(w, "保存科目对照失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// DeleteAccountMapping 删除科目对照（仅管理员）
+func DeleteAccountMapping(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以维护科目对照", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	db.DB.Delete(&models.AccountMapping{}, id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
+
+// resolveVoucherTemplate 按 template_id 取模板；未指定时取默认模板，均无则使用内置列
+func resolveVoucherTemplate(templateID uint) (*models.VoucherTemplate, []voucherColumn, error) {
+	var tpl models.VoucherTemplate
+	if templateID != 0 {
+		if err := db.DB.First(&tpl, templateID).Error; err != nil {
+			return nil, nil, fmt.Errorf("导出模板不存在")
+		}
+	} else if err := db.DB.Where("is_default = ?", true).First(&tpl).Error; err != nil {
+		return nil, defaultVoucherColumns, nil
+	}
+	cols, err := parseVoucherColumns(tpl.Columns)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tpl, cols, nil
+}
+
+// voucherRows 将凭证展开为导出行（每条分录一行）
+func voucherRows(entries []models.JournalEntry, cols []voucherColumn) [][]any {
+	accounts := map[string]string{}
+	var accs []models.Account
+	db.DB.Find(&accs)
+	for _, a := range accs {
+		accounts[a.Code] = a.Name
+	}
+	var mappings []models.AccountMapping
+	db.DB.Find(&mappings)
+	mapped := map[string]models.AccountMapping{}
+	for _, m := range mappings {
+		key := m.AccountCode
+		if m.BaseID != nil {
+			key += "@" + strconv.FormatUint(uint64(*m.BaseID), 10)
+		}
+		mapped[key] = m
+	}
+	bases := map[uint]string{}
+	var bs []models.Base
+	db.DB.Find(&bs)
+	for _, b := range bs {
+		bases[b.ID] = b.Name
+	}
+	users := map[uint]string{}
+	var us []models.User
+	db.DB.Select("id, name").Find(&us)
+	for _, u := range us {
+		users[u.ID] = u.Name
+	}
+
+	rows := [][]any{}
+	header := make([]any, len(cols))
+	for i, c := range cols {
+		header[i] = c.Header
+	}
+	rows = append(rows, header)
+	for n, e := range entries {
+		baseName := ""
+		baseKey := ""
+		if e.BaseID != nil {
+			baseName = bases[*e.BaseID]
+			baseKey = "@" + strconv.FormatUint(uint64(*e.BaseID), 10)
+		}
+		for _, l := range e.Lines {
+			code, name := l.AccountCode, accounts[l.AccountCode]
+			if m, ok := mapped[l.AccountCode+baseKey]; ok && baseKey != "" {
+				code, name = m.ExternalCode, m.ExternalName
+			} else if m, ok := mapped[l.AccountCode]; ok {
+				code, name = m.ExternalCode, m.ExternalName
+			}
+			if name == "" {
+				name = accounts[l.AccountCode]
+			}
+			summary := e.Description
+			if l.Memo != "" {
+				summary += " " + l.Memo
+			}
+			orig := l.OrigAmount.Abs()
+			row := make([]any, len(cols))
+			for i, c := range cols {
+				switch c.Field {
+				case "voucher_word":
+					row[i] = "记"
+				case "voucher_no":
+					row[i] = n + 1
+				case "entry_id":
+					row[i] = strconv.FormatUint(uint64(e.ID), 10)
+				case "date":
+					row[i] = e.EntryDate.Format("2006-01-02")
+				case "period":
+					row[i] = e.EntryDate.Format("2006-01")
+				case "source_type":
+					row[i] = sourceTypeLabels[e.SourceType]
+				case "source_id":
+					row[i] = strconv.FormatUint(uint64(e.SourceID), 10)
+				case "summary":
+					row[i] = strings.TrimSpace(summary)
+				case "account_code":
+					row[i] = code
+				case "account_name":
+					row[i] = name
+				case "debit":
+					row[i] = l.Debit
+				case "credit":
+					row[i] = l.Credit
+				case "currency":
+					row[i] = l.OrigCurrency
+				case "orig_amount":
+					row[i] = orig
+				case "rate":
+					row[i] = e.Rate
+				case "base_name":
+					row[i] = baseName
+				case "preparer":
+					row[i] = users[e.CreatedBy]
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// writeVoucherFile 输出导出文件
+func writeVoucherFile(w http.ResponseWriter, format, name string, rows [][]any) {
+	writeTableFile(w, format, name, "凭证", rows)
+}
+
+// writeTableFile 按 format（csv / xlsx）输出表格文件，name 为不含扩展名的文件名
+func writeTableFile(w http.ResponseWriter, format, name, sheet string, rows [][]any) {
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename="+name+".csv")
+		// UTF-8 BOM，便于 Excel 与财务软件识别中文
+		w.Write([]byte("\xEF\xBB\xBF"))
+		cw := csv.NewWriter(w)
+		for _, row := range rows {
+			rec := make([]string, len(row))
+			for i, v := range row {
+				switch x := v.(type) {
+				case float64:
+					rec[i] = strconv.FormatFloat(x, 'f', -1, 64)
+				case nil:
+				default:
+					rec[i] = fmt.Sprint(x)
+				}
+			}
+			_ = cw.Write(rec)
+		}
+		cw.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", "attachment; filename="+name+".xlsx")
+	if err := xlsx.Write(w, sheet, rows); err != nil {
+		http.Error(w, "生成文件失败", http.StatusInternalServerError)
+	}
+}
+
+// ExportVouchers 导出指定期间、基地尚未导出的凭证，并标记为已导出
+// 请求体：{start_date, end_date, base_id?, template_id?, format?}
+func ExportVouchers(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	role := claimRole(claims)
+	var req struct {
+		StartDate  string `json:"start_date"`
+		EndDate    string `json:"end_date"`
+		BaseID     uint   `json:"base_id"`
+		TemplateID uint   `json:"template_id"`
+		Format     string `json:"format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	start, err1 := time.Parse("2006-01-02", req.StartDate)
+	end, err2 := time.Parse("2006-01-02", req.EndDate)
+	if err1 != nil || err2 != nil || end.Before(start) {
+		http.Error(w, "start_date、end_date 必填，格式 YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	// 管理员可不指定基地（导出全部基地）；基地代理限本人基地
+	var baseID *uint
+	if role != "admin" || req.BaseID != 0 {
+		bid, msg := resolveBaseID(role, claimBaseIDs(claims), req.BaseID)
+		if msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		baseID = &bid
+	}
+	tpl, cols, err := resolveVoucherTemplate(req.TemplateID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := req.Format
+	if format == "" && tpl != nil {
+		format = tpl.Format
+	}
+	if format != "csv" {
+		format = "xlsx"
+	}
+
+	q := db.DB.Model(&models.JournalEntry{}).
+		Where("source_type IN ? AND export_id IS NULL AND entry_date >= ? AND entry_date <= ?",
+			voucherExportSources, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if baseID != nil {
+		q = q.Where("base_id = ?", *baseID)
+	}
+	var ids []uint
+	q.Pluck("id", &ids)
+	if len(ids) == 0 {
+		http.Error(w, "该期间没有待导出的凭证", http.StatusNotFound)
+		return
+	}
+
+	batch := models.VoucherExport{
+		BaseID:     baseID,
+		StartDate:  start,
+		EndDate:    end,
+		Format:     format,
+		EntryCount: len(ids),
+		CreatedBy:  claimUserID(claims),
+	}
+	if tpl != nil {
+		batch.TemplateID = &tpl.ID
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Create(&batch).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "创建导出批次失败", http.StatusInternalServerError)
+		return
+	}
+	res := tx.Model(&models.JournalEntry{}).Where("id IN ? AND export_id IS NULL", ids).Update("export_id", batch.ID)
+	if res.Error != nil || res.RowsAffected != int64(len(ids)) {
+		tx.Rollback()
+		http.Error(w, "部分凭证已被其他导出占用，请重试", http.StatusConflict)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+
+	var entries []models.JournalEntry
+	db.DB.Preload("Lines").Where("export_id = ?", batch.ID).Order("entry_date, id").Find(&entries)
+	writeVoucherFile(w, format, fmt.Sprintf("vouchers_%d", batch.ID), voucherRows(entries, cols))
+}
+
+// ListVoucherExports 导出批次列表
+func ListVoucherExports(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	q := db.DB.Preload("Base").Preload("Creator").Order("created_at desc")
+	if claimRole(claims) != "admin" {
+		ids := claimBaseIDs(claims)
+		if len(ids) == 0 {
+			q = q.Where("1 = 0")
+		} else {
+			q = q.Where("base_id IN ?", ids)
+		}
+	}
+	var rows []models.VoucherExport
+	q.Limit(200).Find(&rows)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// DownloadVoucherExport 重新下载某导出批次的文件（可另选模板与格式）
+func DownloadVoucherExport(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var batch models.VoucherExport
+	if err := db.DB.First(&batch, id).Error; err != nil {
+		http.Error(w, "导出批次不存在", http.StatusNotFound)
+		return
+	}
+	if claimRole(claims) != "admin" && (batch.BaseID == nil || !containsUint(claimBaseIDs(claims), *batch.BaseID)) {
+		http.Error(w, "无权访问该导出批次", http.StatusForbidden)
+		return
+	}
+	var templateID uint
+	if batch.TemplateID != nil {
+		templateID = *batch.TemplateID
+	}
+	if t, _ := strconv.ParseUint(r.URL.Query().Get("template_id"), 10, 64); t != 0 {
+		templateID = uint(t)
+	}
+	_, cols, err := resolveVoucherTemplate(templateID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := batch.Format
+	if f := r.URL.Query().Get("format"); f == "csv" || f == "xlsx" {
+		format = f
+	}
+	var entries []models.JournalEntry
+	db.DB.Preload("Lines").Where("export_id = ?", batch.ID).Order("entry_date, id").Find(&entries)
+	writeVoucherFile(w, format, fmt.Sprintf("vouchers_%d", batch.ID), voucherRows(entries, cols))
+}
+
+// RevokeVoucherExport 撤销导出批次（仅管理员）：凭证恢复为未导出，可修改来源单据后重新导出
+func RevokeVoucherExport(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseJWT(r)
+	if err != nil {
+		http.Error(w, "token无效", http.StatusUnauthorized)
+		return
+	}
+	if claimRole(claims) != "admin" {
+		http.Error(w, "只有管理员可以撤销导出", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	var batch models.VoucherExport
+	if err := db.DB.First(&batch, id).Error; err != nil {
+		http.Error(w, "导出批次不存在", http.StatusNotFound)
+		return
+	}
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		http.Error(w, "数据库事务启动失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Model(&models.JournalEntry{}).Where("export_id = ?", batch.ID).Update("export_id", nil).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "撤销导出标记失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Delete(&batch).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "删除导出批次失败", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		http.Error(w, "提交事务失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true})
+}
@@ -0,0 +1,204 @@
+// Package mailer 通过 SMTP 中继发送带附件的邮件。
+//
+// 配置取自环境变量：SMTP_HOST、SMTP_PORT（默认 25）、SMTP_USERNAME、SMTP_PASSWORD、SMTP_FROM（缺省为 SMTP_USERNAME），
+// SMTP_SECURITY 为 starttls（默认：服务器支持时升级为 TLS）、tls（直接 TLS 连接，常用于 465 端口）或 none（不加密）。
+// 本地测试可指向 MailHog、smtp4dev 等假 SMTP 服务器，如 SMTP_HOST=localhost SMTP_PORT=1025。
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config SMTP 中继配置
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	Security string // starttls / tls / none
+}
+
+// FromEnv 从环境变量读取配置；未配置 SMTP_HOST 或发件人时返回错误
+func FromEnv() (*Config, error) {
+	c := &Config{
+		Host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		Port:     strings.TrimSpace(os.Getenv("SMTP_PORT")),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     strings.TrimSpace(os.Getenv("SMTP_FROM")),
+		Security: strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_SECURITY"))),
+	}
+	if c.Host == "" {
+		return nil, errors.New("未配置 SMTP_HOST")
+	}
+	if c.Port == "" {
+		c.Port = "25"
+	}
+	if c.From == "" {
+		c.From = c.Username
+	}
+	if c.From == "" {
+		return nil, errors.New("未配置 SMTP_FROM")
+	}
+	switch c.Security {
+	case "":
+		c.Security = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return nil, errors.New("SMTP_SECURITY 应为 starttls、tls 或 none")
+	}
+	return c, nil
+}
+
+// Attachment 附件
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message 邮件：正文为纯文本
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// base64Lines 按 76 字符一行输出 base64
+func base64Lines(data []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for len(enc) > 76 {
+		b.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	b.WriteString(enc + "\r\n")
+	return b.Bytes()
+}
+
+// Build 生成 MIME 邮件（multipart/mixed：正文 + 附件）
+func Build(from *mail.Address, m *Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	to := make([]string, len(m.To))
+	for i, x := range m.To {
+		to[i] = (&mail.Address{Address: x}).String()
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%d@%s>\r\n", now.UnixNano(), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(base64Lines([]byte(m.Body)))
+	for _, a := range m.Attachments {
+		// 非 ASCII 文件名按 RFC 2231 编码
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		part.Write(base64Lines(a.Data))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Send 发送邮件
+func (c *Config) Send(m *Message) error {
+	if len(m.To) == 0 {
+		return errors.New("没有收件人")
+	}
+	from, err := mail.ParseAddress(c.From)
+	if err != nil {
+		return fmt.Errorf("发件人地址无效：%v", err)
+	}
+	msg, err := Build(from, m, time.Now())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(c.Host, c.Port)
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if c.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: c.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败：%v", err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	cl, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP 握手失败：%v", err)
+	}
+	defer cl.Close()
+	if c.Security == "starttls" {
+		if ok, _ := cl.Extension("STARTTLS"); ok {
+			if err := cl.StartTLS(&tls.Config{ServerName: c.Host}); err != nil {
+				return fmt.Errorf("STARTTLS 失败：%v", err)
+			}
+		}
+	}
+	if c.Username != "" {
+		if ok, _ := cl.Extension("AUTH"); !ok {
+			return errors.New("SMTP 服务器不支持认证")
+		}
+		if err := cl.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败：%v", err)
+		}
+	}
+	if err := cl.Mail(from.Address); err != nil {
+		return fmt.Errorf("发件人被拒绝：%v", err)
+	}
+	for _, to := range m.To {
+		if err := cl.Rcpt(to); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝：%v", to, err)
+		}
+	}
+	wc, err := cl.Data()
+	if err != nil {
+		return fmt.Errorf("发送邮件失败：%v", err)
+	}
+	if _, err := wc.Write(msg); err != nil {
+		wc.Close()
+		return fmt.Errorf("发送邮件失败：%v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败：%v", err)
+	}
+	return cl.Quit()
+}
@@ -2,17 +2,23 @@ package main
 
 import (
 	"backend/db"
+	"backend/handlers"
 	"backend/idgen"
 	"backend/models"
+	"backend/money"
 	"backend/routes"
 	"bufio"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func loadEnv() {
@@ -59,6 +65,8 @@ func main() {
 
 	idgen.MustInitFromEnv()
 	db.Init()
+	migrateMoneyColumns()
+	backfillSupplierAutoApplyCredit()
 	db.DB.AutoMigrate(
 		&models.User{},
 		&models.UserBase{},
@@ -76,6 +84,36 @@ func main() {
 		&models.Supplier{},
 		&models.MaterialRequisition{},
 		&models.ExchangeRate{},
+		&models.ExchangeRateHistory{},
+		&models.RealizedFX{},
+		&models.BankStatement{},
+		&models.BankStatementLine{},
+		&models.PaymentApprovalThreshold{},
+		&models.PaymentRequest{},
+		&models.PayableInstallment{},
+		&models.SupplierCreditEntry{},
+		&models.AccountingPeriod{},
+		&models.AccountingPeriodLog{},
+		&models.Account{},
+		&models.JournalEntry{},
+		&models.JournalLine{},
+		&models.VoucherTemplate{},
+		&models.AccountMapping{},
+		&models.VoucherExport{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.ExpenseApprover{},
+		&models.ExpenseReimbursement{},
+		&models.ExpenseAllocation{},
+		&models.AllocationRule{},
+		&models.AllocationRuleLine{},
+		&models.RevenueRecord{},
+		&models.MVSupplierMonthlySpend{},
+		&models.MVBaseExpenseMonth{},
+		&models.ReportDefinition{},
+		&models.ReportSchedule{},
+		&models.ReportRecipient{},
+		&models.ReportDelivery{},
 	)
 	ensureUserBaseSchema()
 
@@ -92,6 +130,70 @@ func main() {
 		db.DB.Create(&models.ExchangeRate{Currency: "THB", RateToCNY: 1.0 / 4.47})
 	}
 
+	// Backfill rate history: a currency without history keeps its current rate
+	// as the rate effective since the earliest date, so past reports are unchanged
+	var currentRates []models.ExchangeRate
+	db.DB.Find(&currentRates)
+	for _, er := range currentRates {
+		db.DB.Model(&models.ExchangeRateHistory{}).Where("currency = ?", er.Currency).Count(&cnt)
+		if cnt == 0 {
+			db.DB.Create(&models.ExchangeRateHistory{Currency: er.Currency, RateToCNY: er.RateToCNY, EffectiveDate: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)})
+		}
+	}
+
+	// Backfill CNY snapshots on documents recorded before snapshots existed
+	if n := handlers.BackfillRateSnapshots(db.DB); n > 0 {
+		log.Printf("info: backfilled rate snapshots on %d documents", n)
+	}
+
+	// Build monthly aggregates on first start; afterwards they are refreshed as documents change
+	if n := handlers.EnsureMonthlyAggregates(); n > 0 {
+		log.Printf("info: built monthly aggregates for %d months", n)
+	}
+	// Optional periodic refresh of the current and previous month as a safety net
+	if iv := os.Getenv("MV_REFRESH_INTERVAL"); iv != "" {
+		if d, err := time.ParseDuration(iv); err == nil && d > 0 {
+			go func() {
+				ticker := time.NewTicker(d)
+				defer ticker.Stop()
+				for range ticker.C {
+					now := time.Now()
+					for _, m := range []string{now.AddDate(0, -1, 0).Format("2006-01"), now.Format("2006-01")} {
+						if err := handlers.RecomputeMonthly(m); err != nil {
+							log.Printf("warn: recompute monthly aggregates for %s failed: %v", m, err)
+						}
+					}
+				}
+			}()
+		}
+	}
+
+	// Scheduled email reports: check for due schedules every minute by default;
+	// REPORT_SCHEDULER_INTERVAL overrides the interval, 0 disables the scheduler
+	reportInterval := time.Minute
+	if iv := os.Getenv("REPORT_SCHEDULER_INTERVAL"); iv != "" {
+		if d, err := time.ParseDuration(iv); err == nil {
+			reportInterval = d
+		}
+	}
+	if reportInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(reportInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				handlers.RunDueReportSchedules()
+			}
+		}()
+	}
+
+	// Seed system chart of accounts used by auto-posted journals
+	for _, acc := range models.DefaultAccounts() {
+		db.DB.Model(&models.Account{}).Where("code = ?", acc.Code).Count(&cnt)
+		if cnt == 0 {
+			db.DB.Create(&acc)
+		}
+	}
+
 	// Seed default admin user if not exists
 	var userCnt int64
 	db.DB.Model(&models.User{}).Where("name = ?", "admin").Count(&userCnt)
@@ -155,3 +257,151 @@ func ensureUserBaseSchema() {
 		}
 	}
 }
+
+// backfillSupplierAutoApplyCredit 首次新增 suppliers.auto_apply_credit 列时，把已有供应商设为自动抵扣（与新建供应商的默认值一致）；
+// 该列没有数据库默认值，直接交给 AutoMigrate 添加会使已有供应商全部为 false
+func backfillSupplierAutoApplyCredit() {
+	migrator := db.DB.Migrator()
+	if !migrator.HasTable(&models.Supplier{}) || migrator.HasColumn(&models.Supplier{}, "auto_apply_credit") {
+		return
+	}
+	if err := migrator.AddColumn(&models.Supplier{}, "AutoApplyCredit"); err != nil {
+		log.Println("error: add suppliers.auto_apply_credit column failed:", err)
+		return
+	}
+	if err := db.DB.Exec("UPDATE suppliers SET auto_apply_credit = ?", true).Error; err != nil {
+		log.Println("error: backfill suppliers.auto_apply_credit failed:", err)
+		return
+	}
+	log.Println("info: added suppliers.auto_apply_credit column, existing suppliers default to auto-apply")
+}
+
+// moneyColumn 历史上以 double 保存、现改为 decimal 的金额列
+type moneyColumn struct {
+	model  interface{}
+	field  string
+	places int // 新列的小数位
+}
+
+// migrateMoneyColumns 在 AutoMigrate 之前把 double 金额列改为 decimal，并逐行校验值是否保留：
+// 先把原值备份到 money_column_backups，改列后读回比对（预期值为原值按新精度四舍五入），
+// 原值小数位超出新精度的记为 rounded，读回不一致的记为 mismatch 并输出日志。
+func migrateMoneyColumns() {
+	columns := []moneyColumn{
+		{&models.PurchaseEntry{}, "TotalAmount", 2},
+		{&models.PurchaseEntryItem{}, "UnitPrice", 4},
+		{&models.PurchaseEntryItem{}, "Amount", 2},
+		{&models.BaseExpense{}, "Amount", 2},
+	}
+	migrator := db.DB.Migrator()
+	if err := db.DB.AutoMigrate(&models.MoneyColumnBackup{}); err != nil {
+		log.Println("error: create money_column_backups table failed:", err)
+		return
+	}
+	for _, c := range columns {
+		if !migrator.HasTable(c.model) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db.DB}
+		if err := stmt.Parse(c.model); err != nil {
+			log.Println("error: parse model for money migration failed:", err)
+			continue
+		}
+		field := stmt.Schema.LookUpField(c.field)
+		table, column := stmt.Schema.Table, field.DBName
+		types, err := migrator.ColumnTypes(c.model)
+		if err != nil {
+			log.Printf("error: inspect %s columns failed: %v", table, err)
+			continue
+		}
+		current := ""
+		for _, t := range types {
+			if t.Name() == column {
+				current = strings.ToLower(t.DatabaseTypeName())
+			}
+		}
+		if current == "" || current == "decimal" {
+			continue
+		}
+
+		type rawRow struct {
+			ID    uint
+			Value *string
+		}
+		var before []rawRow
+		if err := db.DB.Raw(fmt.Sprintf("SELECT id, CAST(`%s` AS CHAR) AS value FROM `%s`", column, table)).Scan(&before).Error; err != nil {
+			log.Printf("error: read %s.%s before migration failed: %v", table, column, err)
+			continue
+		}
+		expected := make(map[uint]money.Amount, len(before))
+		backups := make([]models.MoneyColumnBackup, 0, len(before))
+		for _, r := range before {
+			if r.Value == nil {
+				continue
+			}
+			f, err := strconv.ParseFloat(*r.Value, 64)
+			if err != nil {
+				log.Printf("error: %s.%s id=%d has unparsable value %q, migration skipped", table, column, r.ID, *r.Value)
+				backups = nil
+				break
+			}
+			want := money.FromFloat(f).Round(c.places)
+			expected[r.ID] = want
+			backups = append(backups, models.MoneyColumnBackup{
+				SourceTable: table,
+				ColumnName:  column,
+				RowID:       r.ID,
+				Original:    *r.Value,
+				// double 本身的尾数误差（如 0.30000000000000004）不算取整
+				Rounded: math.Abs(f-want.Float64()) > 1e-9*math.Max(1, math.Abs(f)),
+			})
+		}
+		if backups == nil {
+			continue
+		}
+		// 上次改列失败遗留的备份以本次读取为准
+		db.DB.Where("source_table = ? AND column_name = ?", table, column).Delete(&models.MoneyColumnBackup{})
+		if err := db.DB.CreateInBatches(&backups, 500).Error; err != nil {
+			log.Printf("error: backup %s.%s failed, migration skipped: %v", table, column, err)
+			continue
+		}
+		if err := migrator.AlterColumn(c.model, c.field); err != nil {
+			log.Printf("error: alter %s.%s to decimal failed: %v", table, column, err)
+			continue
+		}
+
+		type migratedRow struct {
+			ID    uint
+			Value money.Amount
+		}
+		var after []migratedRow
+		db.DB.Raw(fmt.Sprintf("SELECT id, `%s` AS value FROM `%s`", column, table)).Scan(&after)
+		rounded, mismatched := 0, 0
+		for _, r := range after {
+			want, ok := expected[r.ID]
+			if !ok {
+				continue
+			}
+			if r.Value != want {
+				mismatched++
+				log.Printf("error: %s.%s id=%d expected %s, got %s after migration", table, column, r.ID, want.StringFixed(c.places), r.Value.StringFixed(c.places))
+				db.DB.Model(&models.MoneyColumnBackup{}).
+					Where("source_table = ? AND column_name = ? AND row_id = ?", table, column, r.ID).
+					Update("mismatch", true)
+			}
+			delete(expected, r.ID)
+		}
+		db.DB.Exec(fmt.Sprintf("UPDATE money_column_backups b JOIN `%s` t ON t.id = b.row_id "+
+			"SET b.migrated = CAST(t.`%s` AS CHAR) WHERE b.source_table = ? AND b.column_name = ?", table, column), table, column)
+		for _, b := range backups {
+			if b.Rounded {
+				rounded++
+			}
+		}
+		if len(expected) > 0 {
+			log.Printf("error: %s.%s %d rows missing after migration", table, column, len(expected))
+		}
+		log.Printf("info: migrated %s.%s from %s to decimal: %d rows, %d rounded to %d places, %d mismatched (originals kept in money_column_backups)",
+			table, column, current, len(after), rounded, c.places, mismatched)
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccountingPeriod 会计期间（按基地、按月）：结账后该期间内的业务记录不可新增、修改或删除
+type AccountingPeriod struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	BaseID     uint       `gorm:"uniqueIndex:idx_base_period;not null" json:"base_id"`
+	Base       Base       `gorm:"foreignKey:BaseID" json:"base"`
+	Period     string     `gorm:"uniqueIndex:idx_base_period;size:7;not null" json:"period"` // YYYY-MM
+	Status     string     `gorm:"size:10;default:'open';index" json:"status"`                // open / closed
+	ClosedBy   *uint      `json:"closed_by,omitempty"`
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+	ReopenedBy *uint      `json:"reopened_by,omitempty"`
+	ReopenedAt *time.Time `json:"reopened_at,omitempty"`
+	Note       string     `gorm:"type:text" json:"note"` // 最近一次结账/反结账说明
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (ap *AccountingPeriod) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&ap.ID)
+}
+
+// AccountingPeriodLog 会计期间结账/反结账审计记录
+type AccountingPeriodLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	PeriodID  uint      `gorm:"index;not null" json:"period_id"`
+	BaseID    uint      `gorm:"index;not null" json:"base_id"`
+	Period    string    `gorm:"size:7;not null" json:"period"`
+	Action    string    `gorm:"size:10;not null" json:"action"` // close / reopen
+	Note      string    `gorm:"type:text" json:"note"`
+	UserID    uint      `gorm:"not null" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (al *AccountingPeriodLog) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&al.ID)
+}
+
+// AccountingPeriod 状态常量
+const (
+	PeriodStatusOpen   = "open"
+	PeriodStatusClosed = "closed"
+)
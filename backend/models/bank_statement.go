@@ -0,0 +1,67 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BankStatement 银行对账单导入批次
+type BankStatement struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	BaseID     uint      `gorm:"index;not null" json:"base_id"` // 所属基地ID
+	Base       Base      `gorm:"foreignKey:BaseID" json:"base"`
+	BankName   string    `gorm:"size:100" json:"bank_name"`          // 银行名称
+	AccountNo  string    `gorm:"size:64" json:"account_no"`          // 账号（可选）
+	Currency   string    `gorm:"size:8;default:CNY" json:"currency"` // 默认币种（行内未给出时使用）
+	Format     string    `gorm:"size:8" json:"format"`               // csv / ofx
+	FileName   string    `gorm:"size:255" json:"file_name"`
+	LineCount  int       `json:"line_count"`
+	ImportedBy uint      `gorm:"not null" json:"imported_by"`
+	Importer   User      `gorm:"foreignKey:ImportedBy" json:"importer"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (bs *BankStatement) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&bs.ID)
+}
+
+// BankStatementLine 对账单流水行及其匹配结果
+type BankStatementLine struct {
+	ID           uint         `gorm:"primaryKey" json:"id"`
+	StatementID  uint         `gorm:"index;not null" json:"statement_id"`
+	BaseID       uint         `gorm:"index;not null" json:"base_id"`
+	TxnDate      time.Time    `gorm:"type:date;not null" json:"txn_date"`
+	Amount       money.Amount `gorm:"type:decimal(18,2);not null" json:"amount"` // 正数入账，负数出账
+	Currency     string       `gorm:"size:8;default:CNY" json:"currency"`
+	Counterparty string       `gorm:"size:255" json:"counterparty"`
+	Reference    string       `gorm:"size:100;index" json:"reference"`
+	Description  string       `gorm:"type:text" json:"description"`
+	// 匹配状态：unmatched(未匹配) / proposed(已建议) / confirmed(已确认并生成还款) / duplicate(参考号已存在) / ignored(忽略)
+	Status string `gorm:"size:20;default:'unmatched';index" json:"status"`
+	// 建议匹配的应付款及得分（0-100）
+	MatchedPayableID *uint          `json:"matched_payable_id,omitempty"`
+	MatchedPayable   *PayableRecord `gorm:"foreignKey:MatchedPayableID" json:"matched_payable,omitempty"`
+	MatchScore       int            `json:"match_score"`
+	// 确认后生成的还款记录，或参考号重复时对应的已有还款记录
+	PaymentRecordID *uint      `json:"payment_record_id,omitempty"`
+	ConfirmedBy     *uint      `json:"confirmed_by,omitempty"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (bl *BankStatementLine) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&bl.ID)
+}
+
+// BankStatementLine 状态常量
+const (
+	BankLineStatusUnmatched = "unmatched"
+	BankLineStatusProposed  = "proposed"
+	BankLineStatusConfirmed = "confirmed"
+	BankLineStatusDuplicate = "duplicate"
+	BankLineStatusIgnored   = "ignored"
+)
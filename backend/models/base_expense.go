@@ -1,6 +1,7 @@
 package models
 
 import (
+	"backend/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,7 +14,7 @@ type BaseExpense struct {
 	Date        time.Time       `json:"date"`                                    // 发生日期
 	CategoryID  uint            `gorm:"not null" json:"category_id"`             // 费用类别ID
 	Category    ExpenseCategory `gorm:"foreignKey:CategoryID" json:"category"`   // 关联的费用类别
-	Amount      float64         `json:"amount"`
+	Amount      money.Amount    `gorm:"type:decimal(15,2)" json:"amount"`
 	Currency    string          `gorm:"size:8;default:CNY" json:"currency"`
 	Detail      string          `json:"detail"`
 	CreatedBy   uint            `json:"created_by"`
@@ -21,6 +22,45 @@ type BaseExpense struct {
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 	ReceiptPath string          `gorm:"size:255" json:"receipt_path,omitempty"` // 票据相对路径，例如 /upload/2025-09-25/xxxxx.jpg
+	// 创建时的折算快照：1 原币 = rate_to_cny CNY，amount_cny 为折算后的人民币金额
+	RateToCNY float64      `gorm:"type:decimal(18,6);default:0" json:"rate_to_cny"`
+	AmountCNY money.Amount `gorm:"type:decimal(15,2);default:0" json:"amount_cny"`
+	// 审批与报销：submitted → approved / rejected → reimbursed；仅 approved / reimbursed 计入费用
+	Status          string     `gorm:"size:20;default:'approved';index" json:"status"`
+	PaidBy          string     `gorm:"size:10;default:'company'" json:"paid_by"` // company 公司支付 / employee 员工垫付（需报销）
+	ApprovedBy      *uint      `json:"approved_by,omitempty"`
+	ApprovedAt      *time.Time `json:"approved_at,omitempty"`
+	RejectedBy      *uint      `json:"rejected_by,omitempty"`
+	RejectedAt      *time.Time `json:"rejected_at,omitempty"`
+	RejectReason    string     `gorm:"size:255" json:"reject_reason,omitempty"`
+	ReimbursementID *uint      `gorm:"index" json:"reimbursement_id,omitempty"`
+	// 分摊到多个基地/分区（为空表示全额计入 BaseID）
+	Allocations []ExpenseAllocation `gorm:"foreignKey:ExpenseID" json:"allocations,omitempty"`
+	// 所属分区（可选），录入人为分区队长时默认为其分区
+	SectionID *uint        `gorm:"index" json:"section_id,omitempty"`
+	Section   *BaseSection `gorm:"foreignKey:SectionID" json:"section,omitempty"`
+}
+
+// 开支状态
+const (
+	ExpenseStatusSubmitted  = "submitted"
+	ExpenseStatusApproved   = "approved"
+	ExpenseStatusRejected   = "rejected"
+	ExpenseStatusReimbursed = "reimbursed"
+)
+
+// 开支付款方
+const (
+	ExpensePaidByCompany  = "company"
+	ExpensePaidByEmployee = "employee"
+)
+
+// ExpenseCountedStatuses 计入费用（统计、预算、凭证）的开支状态
+var ExpenseCountedStatuses = []string{ExpenseStatusApproved, ExpenseStatusReimbursed}
+
+// Counted 是否已计入费用
+func (b *BaseExpense) Counted() bool {
+	return b.Status == "" || b.Status == ExpenseStatusApproved || b.Status == ExpenseStatusReimbursed
 }
 
 func (b *BaseExpense) BeforeCreate(tx *gorm.DB) error {
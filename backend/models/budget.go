@@ -0,0 +1,90 @@
+package models
+
+import (
+	"backend/money"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BudgetPeriodMonth = "month"
+	BudgetPeriodYear  = "year"
+)
+
+// Budget 基地预算（按月或按年）：CategoryID 为空表示该基地全部开支类别；
+// 仅基地级预算（不限类别）可选择计入采购与物资申领
+type Budget struct {
+	ID                  uint             `gorm:"primaryKey" json:"id"`
+	BaseID              uint             `gorm:"index:idx_budget_scope;not null" json:"base_id"`
+	Base                Base             `gorm:"foreignKey:BaseID" json:"base"`
+	CategoryID          *uint            `gorm:"index:idx_budget_scope" json:"category_id,omitempty"`
+	Category            *ExpenseCategory `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	PeriodType          string           `gorm:"size:10;index:idx_budget_scope;not null" json:"period_type"` // month / year
+	Period              string           `gorm:"size:7;index:idx_budget_scope;not null" json:"period"`       // YYYY-MM 或 YYYY
+	Amount              money.Amount     `gorm:"type:decimal(15,2);not null" json:"amount"`
+	Currency            string           `gorm:"size:8;default:CNY" json:"currency"`
+	IncludePurchases    bool             `gorm:"default:false" json:"include_purchases"`
+	IncludeRequisitions bool             `gorm:"default:false" json:"include_requisitions"`
+	AlertPercents       string           `gorm:"size:50;default:'80,100'" json:"alert_percents"` // 预警比例（逗号分隔，如 50,80,100）
+	Hard                bool             `gorm:"default:false" json:"hard"`                      // 硬预算：新增开支超出时拒绝
+	Note                string           `gorm:"type:text" json:"note"`
+	CreatedBy           uint             `json:"created_by"`
+	CreatedAt           time.Time        `json:"created_at"`
+	UpdatedAt           time.Time        `json:"updated_at"`
+}
+
+func (b *Budget) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&b.ID)
+}
+
+// Range 预算期间 [start, end)
+func (b *Budget) Range() (time.Time, time.Time) {
+	if b.PeriodType == BudgetPeriodYear {
+		t, _ := time.Parse("2006", b.Period)
+		return t, t.AddDate(1, 0, 0)
+	}
+	t, _ := time.Parse("2006-01", b.Period)
+	return t, t.AddDate(0, 1, 0)
+}
+
+// Thresholds 预警比例（升序、去重，忽略无效项）
+func (b *Budget) Thresholds() []int {
+	var out []int
+	for _, s := range strings.Split(b.AlertPercents, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			continue
+		}
+		i := 0
+		for i < len(out) && out[i] < n {
+			i++
+		}
+		if i < len(out) && out[i] == n {
+			continue
+		}
+		out = append(out[:i], append([]int{n}, out[i:]...)...)
+	}
+	return out
+}
+
+// BudgetAlert 预算预警：实际支出首次达到某预警比例时记录（每个预算每个比例一条）
+type BudgetAlert struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	BudgetID       uint         `gorm:"uniqueIndex:idx_budget_threshold;not null" json:"budget_id"`
+	Budget         Budget       `gorm:"foreignKey:BudgetID" json:"budget"`
+	BaseID         uint         `gorm:"index;not null" json:"base_id"`
+	Threshold      int          `gorm:"uniqueIndex:idx_budget_threshold;not null" json:"threshold"` // 达到的预警比例（%）
+	Actual         money.Amount `gorm:"type:decimal(15,2)" json:"actual"`                           // 触发时的实际支出（预算币种）
+	Percent        float64      `gorm:"type:decimal(8,2)" json:"percent"`
+	Acknowledged   bool         `gorm:"default:false;index" json:"acknowledged"`
+	AcknowledgedBy *uint        `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time   `json:"acknowledged_at,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+func (a *BudgetAlert) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&a.ID)
+}
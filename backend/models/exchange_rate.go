@@ -1,6 +1,7 @@
 package models
 
 import (
+	"backend/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,3 +19,46 @@ type ExchangeRate struct {
 func (er *ExchangeRate) BeforeCreate(tx *gorm.DB) error {
 	return assignSnowflakeID(&er.ID)
 }
+
+// ExchangeRateHistory 汇率历史：每条记录自 effective_date 起生效，直到下一条生效日期为止。
+// ExchangeRate 保留为各币种的当前汇率（最近生效的一条）。
+type ExchangeRateHistory struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Currency      string    `gorm:"size:8;not null;uniqueIndex:idx_rate_effective" json:"currency"`
+	RateToCNY     float64   `gorm:"type:decimal(18,6);not null" json:"rate_to_cny"`
+	EffectiveDate time.Time `gorm:"type:date;not null;uniqueIndex:idx_rate_effective" json:"effective_date"`
+	CreatedBy     uint      `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (eh *ExchangeRateHistory) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&eh.ID)
+}
+
+// RealizedFX 已实现汇兑损益：应付款按入账汇率冲销、按付款日汇率支付所产生的本位币差额。
+// 每笔还款至多一条，随还款凭证重建；GainLossCNY 为正表示汇兑收益，为负表示汇兑损失。
+type RealizedFX struct {
+	ID              uint         `gorm:"primaryKey" json:"id"`
+	PaymentRecordID uint         `gorm:"uniqueIndex;not null" json:"payment_record_id"`
+	PayableRecordID uint         `gorm:"index;not null" json:"payable_record_id"`
+	BaseID          uint         `gorm:"index;not null" json:"base_id"`
+	Base            Base         `gorm:"foreignKey:BaseID" json:"base"`
+	SupplierID      *uint        `json:"supplier_id,omitempty"`
+	Supplier        *Supplier    `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+	Currency        string       `gorm:"size:8;not null" json:"currency"`
+	SettledAmount   money.Amount `gorm:"type:decimal(15,2);not null" json:"settled_amount"` // 冲销的应付原币金额（含现金折扣）
+	BookedRate      float64      `gorm:"type:decimal(18,6);not null" json:"booked_rate"`
+	PaymentRate     float64      `gorm:"type:decimal(18,6);not null" json:"payment_rate"`
+	GainLossCNY     money.Amount `gorm:"type:decimal(15,2);not null" json:"gain_loss_cny"`
+	PaymentDate     time.Time    `gorm:"type:date;not null;index" json:"payment_date"`
+	CreatedAt       time.Time    `json:"created_at"`
+}
+
+func (rf *RealizedFX) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&rf.ID)
+}
+
+// TableName 指定表名
+func (RealizedFX) TableName() string {
+	return "realized_fx_records"
+}
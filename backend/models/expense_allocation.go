@@ -0,0 +1,58 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExpenseAllocation 开支分摊行：共享费用按比例分摊到多个基地/分区；
+// 有分摊行的开支在统计分析中按分摊行计入，无分摊行时全额计入开支所属基地
+type ExpenseAllocation struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	ExpenseID uint         `gorm:"index;not null" json:"expense_id"`
+	BaseID    uint         `gorm:"index;not null" json:"base_id"`
+	Base      Base         `gorm:"foreignKey:BaseID" json:"base"`
+	SectionID *uint        `gorm:"index" json:"section_id,omitempty"`
+	Section   *BaseSection `gorm:"foreignKey:SectionID" json:"section,omitempty"`
+	Percent   float64      `gorm:"type:decimal(9,6);not null" json:"percent"` // 分摊比例（%），开支金额变动时按比例重算
+	Amount    money.Amount `gorm:"type:decimal(15,2);not null" json:"amount"` // 分摊金额（开支原币）
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func (ea *ExpenseAllocation) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&ea.ID)
+}
+
+// AllocationRule 可复用的分摊规则（如按人数、按面积）：各行权重占合计的比例即分摊比例
+type AllocationRule struct {
+	ID        uint                 `gorm:"primaryKey" json:"id"`
+	Name      string               `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Basis     string               `gorm:"size:20;default:'custom'" json:"basis"` // headcount 人数 / area 面积 / custom 自定义
+	Status    string               `gorm:"size:10;default:'active'" json:"status"`
+	Note      string               `gorm:"type:text" json:"note"`
+	CreatedBy uint                 `json:"created_by"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Lines     []AllocationRuleLine `gorm:"foreignKey:RuleID" json:"lines"`
+}
+
+func (ar *AllocationRule) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&ar.ID)
+}
+
+// AllocationRuleLine 分摊规则行
+type AllocationRuleLine struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	RuleID    uint         `gorm:"index;not null" json:"rule_id"`
+	BaseID    uint         `gorm:"not null" json:"base_id"`
+	Base      Base         `gorm:"foreignKey:BaseID" json:"base"`
+	SectionID *uint        `json:"section_id,omitempty"`
+	Section   *BaseSection `gorm:"foreignKey:SectionID" json:"section,omitempty"`
+	Weight    float64      `gorm:"type:decimal(15,4);not null" json:"weight"` // 权重：人数、面积或百分比
+}
+
+func (arl *AllocationRuleLine) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&arl.ID)
+}
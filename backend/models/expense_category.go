@@ -7,12 +7,16 @@ import (
 )
 
 type ExpenseCategory struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"not null;unique;size:50" json:"name"`    // 类别名称
-	Code      *string   `gorm:"size:20;unique" json:"code,omitempty"`   // 类别代码，可选
-	Status    string    `gorm:"size:20;default:'active'" json:"status"` // 状态: active/inactive
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID     uint    `gorm:"primaryKey" json:"id"`
+	Name   string  `gorm:"not null;unique;size:50" json:"name"`    // 类别名称
+	Code   *string `gorm:"size:20;unique" json:"code,omitempty"`   // 类别代码，可选
+	Status string  `gorm:"size:20;default:'active'" json:"status"` // 状态: active/inactive
+	// 记账科目代码，自动凭证借记该科目；为空时使用管理费用
+	AccountCode *string   `gorm:"size:20" json:"account_code,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// 上级类别（为空表示顶级），如 运营 > 燃油 > 柴油；统计时上级类别包含全部下级
+	ParentID *uint `gorm:"index" json:"parent_id,omitempty"`
 }
 
 func (ec *ExpenseCategory) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExpenseApprover 基地开支审批人：配置了审批人的基地，非管理员录入的开支需审批后才计入费用
+type ExpenseApprover struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BaseID    uint      `gorm:"uniqueIndex:idx_expense_approver;not null" json:"base_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_expense_approver;not null" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ea *ExpenseApprover) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&ea.ID)
+}
+
+// ExpenseReimbursement 报销付款：一次向一名员工支付其在同一基地、同一币种下多笔已审批的垫付开支
+type ExpenseReimbursement struct {
+	ID              uint          `gorm:"primaryKey" json:"id"`
+	BaseID          uint          `gorm:"index;not null" json:"base_id"`
+	Base            Base          `gorm:"foreignKey:BaseID" json:"base"`
+	EmployeeID      uint          `gorm:"index;not null" json:"employee_id"`
+	Employee        User          `gorm:"foreignKey:EmployeeID" json:"employee"`
+	Currency        string        `gorm:"size:8;default:CNY" json:"currency"`
+	TotalAmount     money.Amount  `gorm:"type:decimal(15,2);not null" json:"total_amount"`
+	PaymentDate     time.Time     `gorm:"type:date;not null" json:"payment_date"`
+	PaymentMethod   string        `gorm:"size:20;default:'bank_transfer'" json:"payment_method"`
+	ReferenceNumber string        `gorm:"size:100" json:"reference_number"`
+	Notes           string        `gorm:"type:text" json:"notes"`
+	CreatedBy       uint          `gorm:"not null" json:"created_by"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Expenses        []BaseExpense `gorm:"foreignKey:ReimbursementID" json:"expenses,omitempty"`
+	// 付款时的折算快照：1 原币 = rate_to_cny CNY
+	RateToCNY float64      `gorm:"type:decimal(18,6);default:0" json:"rate_to_cny"`
+	AmountCNY money.Amount `gorm:"type:decimal(15,2);default:0" json:"amount_cny"`
+}
+
+func (er *ExpenseReimbursement) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&er.ID)
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Account 会计科目
+type Account struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Code      string    `gorm:"uniqueIndex;size:20;not null" json:"code"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Type      string    `gorm:"size:20;not null" json:"type"` // asset / liability / equity / income / expense
+	Status    string    `gorm:"size:10;default:'active'" json:"status"`
+	System    bool      `gorm:"default:false" json:"system"` // 系统内置科目，自动凭证依赖，不可删除
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (a *Account) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&a.ID)
+}
+
+// JournalEntry 记账凭证：由业务单据自动生成，source_type+source_id 唯一
+type JournalEntry struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	BaseID      *uint     `gorm:"index" json:"base_id,omitempty"`
+	Base        *Base     `gorm:"foreignKey:BaseID" json:"base,omitempty"`
+	EntryDate   time.Time `gorm:"type:date;not null;index" json:"entry_date"`
+	SourceType  string    `gorm:"size:20;not null;uniqueIndex:idx_journal_source" json:"source_type"`
+	SourceID    uint      `gorm:"not null;uniqueIndex:idx_journal_source" json:"source_id"`
+	Description string    `gorm:"size:255" json:"description"`
+	Currency    string    `gorm:"size:8;default:CNY" json:"currency"`       // 单据原币
+	Rate        float64   `gorm:"type:decimal(18,6);default:1" json:"rate"` // 记账汇率（1 原币 = rate CNY）
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	// 已导出至外部账套的凭证批次；导出后来源单据不可再修改
+	ExportID *uint         `gorm:"index" json:"export_id,omitempty"`
+	Lines    []JournalLine `gorm:"foreignKey:EntryID" json:"lines"`
+}
+
+func (je *JournalEntry) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&je.ID)
+}
+
+// JournalLine 凭证分录：借贷金额均为本位币（CNY），同时保留原币金额
+type JournalLine struct {
+	ID           uint         `gorm:"primaryKey" json:"id"`
+	EntryID      uint         `gorm:"index;not null" json:"entry_id"`
+	AccountCode  string       `gorm:"size:20;not null;index" json:"account_code"`
+	Debit        money.Amount `gorm:"type:decimal(18,2);default:0" json:"debit"`
+	Credit       money.Amount `gorm:"type:decimal(18,2);default:0" json:"credit"`
+	OrigCurrency string       `gorm:"size:8" json:"orig_currency"`
+	OrigAmount   money.Amount `gorm:"type:decimal(18,2);default:0" json:"orig_amount"` // 原币金额（借正贷负）
+	Memo         string       `gorm:"size:255" json:"memo"`
+}
+
+func (jl *JournalLine) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&jl.ID)
+}
+
+// 科目类型
+const (
+	AccountTypeAsset     = "asset"
+	AccountTypeLiability = "liability"
+	AccountTypeEquity    = "equity"
+	AccountTypeIncome    = "income"
+	AccountTypeExpense   = "expense"
+)
+
+// 自动凭证使用的系统科目
+const (
+	AccountCash           = "1001" // 库存现金
+	AccountBank           = "1002" // 银行存款
+	AccountPrepayment     = "1123" // 预付账款
+	AccountInventory      = "1405" // 库存商品
+	AccountPayable        = "2202" // 应付账款
+	AccountOtherPayable   = "2241" // 其他应付款
+	AccountCost           = "6401" // 主营业务成本（领用出库）
+	AccountAdminExpense   = "6602" // 管理费用（费用类别未配置科目时的默认科目）
+	AccountFinanceExpense = "6603" // 财务费用（现金折扣冲减）
+	AccountFXGainLoss     = "6061" // 汇兑损益
+)
+
+// 凭证来源类型
+const (
+	JournalSourcePurchase    = "purchase"
+	JournalSourceExpense     = "expense"
+	JournalSourceRequisition = "requisition"
+	JournalSourcePayment     = "payment"
+	JournalSourceCredit      = "credit" // 预付款 / 超付转余额
+	JournalSourceReimburse   = "reimbursement"
+)
+
+// DefaultAccounts 系统内置科目表（启动时补齐缺失科目）
+func DefaultAccounts() []Account {
+	return []Account{
+		{Code: AccountCash, Name: "库存现金", Type: AccountTypeAsset, System: true},
+		{Code: AccountBank, Name: "银行存款", Type: AccountTypeAsset, System: true},
+		{Code: AccountPrepayment, Name: "预付账款", Type: AccountTypeAsset, System: true},
+		{Code: AccountInventory, Name: "库存商品", Type: AccountTypeAsset, System: true},
+		{Code: AccountPayable, Name: "应付账款", Type: AccountTypeLiability, System: true},
+		{Code: AccountOtherPayable, Name: "其他应付款", Type: AccountTypeLiability, System: true},
+		{Code: "4001", Name: "实收资本", Type: AccountTypeEquity, System: true},
+		{Code: AccountFXGainLoss, Name: "汇兑损益", Type: AccountTypeIncome, System: true},
+		{Code: AccountCost, Name: "主营业务成本", Type: AccountTypeExpense, System: true},
+		{Code: AccountAdminExpense, Name: "管理费用", Type: AccountTypeExpense, System: true},
+		{Code: AccountFinanceExpense, Name: "财务费用", Type: AccountTypeExpense, System: true},
+	}
+}
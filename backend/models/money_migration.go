@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MoneyColumnBackup 金额列由 double 迁移为 decimal 前的原值备份（逐行），用于核对与必要时恢复
+type MoneyColumnBackup struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SourceTable string    `gorm:"size:64;index:idx_money_backup;not null" json:"source_table"`
+	ColumnName  string    `gorm:"size:64;index:idx_money_backup;not null" json:"column_name"`
+	RowID       uint      `gorm:"index:idx_money_backup;not null" json:"row_id"`
+	Original    string    `gorm:"size:40;not null" json:"original"` // 迁移前的原值（文本）
+	Migrated    string    `gorm:"size:40" json:"migrated"`          // 迁移后读回的值
+	Rounded     bool      `gorm:"default:false" json:"rounded"`     // 原值小数位超过新列精度，迁移时被四舍五入
+	Mismatch    bool      `gorm:"default:false" json:"mismatch"`    // 迁移后的值与预期（原值按新精度取整）不一致
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (MoneyColumnBackup) TableName() string { return "money_column_backups" }
+
+func (b *MoneyColumnBackup) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&b.ID)
+}
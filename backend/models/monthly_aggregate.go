@@ -0,0 +1,53 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 月度物化汇总表：按月预先汇总的金额，由原始单据重算生成（见 handlers.RecomputeMonthly），不直接编辑。
+// 除原币金额外，另存按单据当日生效汇率折算为各报表币种（CNY/LAK/THB）的金额，读取时无需逐日折算。
+
+// MVSupplierMonthlySpend 供应商+基地+单据币种 的月度采购与付款
+type MVSupplierMonthlySpend struct {
+	ID            uint         `gorm:"primaryKey" json:"id"`
+	SupplierID    uint         `gorm:"uniqueIndex:uq_mv_sms;not null" json:"supplier_id"` // 0 表示未指定供应商
+	BaseID        uint         `gorm:"uniqueIndex:uq_mv_sms;index:idx_mv_sms_month_base,priority:2;not null" json:"base_id"`
+	Month         string       `gorm:"size:7;uniqueIndex:uq_mv_sms;index:idx_mv_sms_month_base,priority:1;not null" json:"month"` // YYYY-MM
+	Currency      string       `gorm:"size:8;uniqueIndex:uq_mv_sms;not null" json:"currency"`
+	TotalPurchase money.Amount `gorm:"type:decimal(18,4);not null;default:0" json:"total_purchase"`
+	PurchaseCount int64        `gorm:"not null;default:0" json:"purchase_count"`
+	TotalPaid     money.Amount `gorm:"type:decimal(18,4);not null;default:0" json:"total_paid"` // 当月付款（不含供应商余额抵扣）
+	PurchaseCNY   money.Amount `gorm:"column:purchase_cny;type:decimal(18,4);not null;default:0" json:"purchase_cny"`
+	PurchaseLAK   money.Amount `gorm:"column:purchase_lak;type:decimal(18,4);not null;default:0" json:"purchase_lak"`
+	PurchaseTHB   money.Amount `gorm:"column:purchase_thb;type:decimal(18,4);not null;default:0" json:"purchase_thb"`
+	GeneratedAt   time.Time    `json:"generated_at"`
+}
+
+func (MVSupplierMonthlySpend) TableName() string { return "mv_supplier_monthly_spend" }
+
+// MVBaseExpenseMonth 基地+开支类别+单据币种 的月度开支（按分摊计入各基地，仅含已计入费用的状态）
+type MVBaseExpenseMonth struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	BaseID      uint         `gorm:"uniqueIndex:uq_mv_bem;not null" json:"base_id"`
+	CategoryID  uint         `gorm:"uniqueIndex:uq_mv_bem;not null" json:"category_id"`
+	Month       string       `gorm:"size:7;uniqueIndex:uq_mv_bem;index;not null" json:"month"`
+	Currency    string       `gorm:"size:8;uniqueIndex:uq_mv_bem;not null" json:"currency"`
+	TotalAmount money.Amount `gorm:"type:decimal(18,4);not null;default:0" json:"total_amount"`
+	AmountCNY   money.Amount `gorm:"column:amount_cny;type:decimal(18,4);not null;default:0" json:"amount_cny"`
+	AmountLAK   money.Amount `gorm:"column:amount_lak;type:decimal(18,4);not null;default:0" json:"amount_lak"`
+	AmountTHB   money.Amount `gorm:"column:amount_thb;type:decimal(18,4);not null;default:0" json:"amount_thb"`
+	GeneratedAt time.Time    `json:"generated_at"`
+}
+
+func (MVBaseExpenseMonth) TableName() string { return "mv_base_expense_month" }
+
+func (m *MVSupplierMonthlySpend) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&m.ID)
+}
+
+func (m *MVBaseExpenseMonth) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&m.ID)
+}
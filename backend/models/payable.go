@@ -1,6 +1,7 @@
 package models
 
 import (
+	"backend/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,12 +18,16 @@ type PayableRecord struct {
 	Supplier        *Supplier      `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`                       // 关联的供应商
 	BaseID          uint           `gorm:"not null" json:"base_id"`                                               // 基地ID
 	Base            Base           `gorm:"foreignKey:BaseID" json:"base"`                                         // 关联的基地
-	TotalAmount     float64        `gorm:"type:decimal(15,2);not null" json:"total_amount"`                       // 应付总金额
-	PaidAmount      float64        `gorm:"type:decimal(15,2);default:0" json:"paid_amount"`                       // 已付金额
+	TotalAmount     money.Amount   `gorm:"type:decimal(15,2);not null" json:"total_amount"`                       // 应付总金额
+	PaidAmount      money.Amount   `gorm:"type:decimal(15,2);default:0" json:"paid_amount"`                       // 已付金额
 	Currency        string         `gorm:"size:8;default:CNY" json:"currency"`                                    // 币种
-	RemainingAmount float64        `gorm:"type:decimal(15,2);not null" json:"remaining_amount"`                   // 剩余欠款
+	RemainingAmount money.Amount   `gorm:"type:decimal(15,2);not null" json:"remaining_amount"`                   // 剩余欠款
 	Status          string         `gorm:"type:enum('pending','partial','paid');default:'pending'" json:"status"` // 状态
 	DueDate         *time.Time     `json:"due_date"`                                                              // 到期日期
+	// 现金折扣条件（生成应付款时按供应商付款条件快照）及已享受的折扣
+	DiscountPercent  float64      `gorm:"type:decimal(5,2);default:0" json:"discount_percent"`
+	DiscountDeadline *time.Time   `json:"discount_deadline,omitempty"`
+	DiscountTaken    money.Amount `gorm:"type:decimal(15,2);default:0" json:"discount_taken"`
 	// 结算周期：支持按月聚合（YYYY-MM），或灵活结算（为空）
 	PeriodMonth string `gorm:"size:7" json:"period_month,omitempty"`
 	// 半年周期：YYYY-H1 或 YYYY-H2，用于灵活结算按半年累计
@@ -34,6 +39,8 @@ type PayableRecord struct {
 	PaymentRecords []PaymentRecord `gorm:"foreignKey:PayableRecordID" json:"payment_records"` // 还款记录
 	// 关联的采购链接（聚合模式）
 	Links []PayableLink `gorm:"foreignKey:PayableRecordID" json:"links,omitempty"`
+	// 分期计划（可选）：设置后超期判断以各期到期日为准
+	Installments []PayableInstallment `gorm:"foreignKey:PayableRecordID" json:"installments,omitempty"`
 }
 
 func (pr *PayableRecord) BeforeCreate(tx *gorm.DB) error {
@@ -43,17 +50,21 @@ func (pr *PayableRecord) BeforeCreate(tx *gorm.DB) error {
 // PaymentRecord 还款记录模型
 type PaymentRecord struct {
 	ID              uint          `gorm:"primaryKey" json:"id"`
-	PayableRecordID uint          `gorm:"not null" json:"payable_record_id"`                                                               // 关联应付款记录ID
-	PayableRecord   PayableRecord `gorm:"foreignKey:PayableRecordID" json:"-"`                                                             // 关联的应付款记录
-	PaymentAmount   float64       `gorm:"type:decimal(15,2);not null" json:"payment_amount"`                                               // 还款金额
-	Currency        string        `gorm:"size:8;default:CNY" json:"currency"`                                                              // 币种
-	PaymentDate     time.Time     `gorm:"type:date;not null" json:"payment_date"`                                                          // 还款日期
-	PaymentMethod   string        `gorm:"type:enum('cash','bank_transfer','check','other');default:'bank_transfer'" json:"payment_method"` // 还款方式
-	ReferenceNumber string        `gorm:"size:100" json:"reference_number"`                                                                // 参考号
-	Notes           string        `gorm:"type:text" json:"notes"`                                                                          // 还款备注
-	CreatedBy       uint          `gorm:"not null" json:"created_by"`                                                                      // 操作人ID
-	Creator         User          `gorm:"foreignKey:CreatedBy" json:"creator"`                                                             // 操作人
+	PayableRecordID uint          `gorm:"not null" json:"payable_record_id"`                                                                        // 关联应付款记录ID
+	PayableRecord   PayableRecord `gorm:"foreignKey:PayableRecordID" json:"-"`                                                                      // 关联的应付款记录
+	PaymentAmount   money.Amount  `gorm:"type:decimal(15,2);not null" json:"payment_amount"`                                                        // 还款金额
+	Currency        string        `gorm:"size:8;default:CNY" json:"currency"`                                                                       // 币种
+	PaymentDate     time.Time     `gorm:"type:date;not null" json:"payment_date"`                                                                   // 还款日期
+	PaymentMethod   string        `gorm:"type:enum('cash','bank_transfer','check','other','credit');default:'bank_transfer'" json:"payment_method"` // 还款方式（credit 为预付款/余额抵扣）
+	ReferenceNumber string        `gorm:"size:100" json:"reference_number"`                                                                         // 参考号
+	Notes           string        `gorm:"type:text" json:"notes"`                                                                                   // 还款备注
+	DiscountAmount  money.Amount  `gorm:"type:decimal(15,2);default:0" json:"discount_amount"`                                                      // 本次享受的现金折扣
+	CreatedBy       uint          `gorm:"not null" json:"created_by"`                                                                               // 操作人ID
+	Creator         User          `gorm:"foreignKey:CreatedBy" json:"creator"`                                                                      // 操作人
 	CreatedAt       time.Time     `json:"created_at"`
+	// 创建时的折算快照：1 原币 = rate_to_cny CNY，amount_cny 为折算后的人民币金额
+	RateToCNY float64      `gorm:"type:decimal(18,6);default:0" json:"rate_to_cny"`
+	AmountCNY money.Amount `gorm:"type:decimal(15,2);default:0" json:"amount_cny"`
 }
 
 func (pmr *PaymentRecord) BeforeCreate(tx *gorm.DB) error {
@@ -71,9 +82,18 @@ type Supplier struct {
 	// 结算配置：immediate(即付)、monthly(月结)、flexible(不定期)
 	SettlementType string `gorm:"size:20;default:'flexible'" json:"settlement_type"`
 	// 月结日（1-31，可空），仅当 SettlementType=monthly 时有意义
-	SettlementDay *int      `json:"settlement_day"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	SettlementDay *int `json:"settlement_day"`
+	// 新应付款生成时是否自动抵扣该供应商的预付款/余额（默认开启，由创建处设置；
+	// 不用 default 标签，否则 false 会在 INSERT 时被省略而取数据库默认值）
+	AutoApplyCredit bool `json:"auto_apply_credit"`
+	// 付款条件（可选，为空时沿用结算方式的默认到期规则）：
+	// net(发票日+N天) / eom(月末+N天)；现金折扣：D 天内付款享受 X% 折扣
+	PaymentTermType string    `gorm:"size:10" json:"payment_term_type"`
+	PaymentTermDays int       `gorm:"default:0" json:"payment_term_days"`
+	DiscountPercent float64   `gorm:"type:decimal(5,2);default:0" json:"discount_percent"`
+	DiscountDays    int       `gorm:"default:0" json:"discount_days"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 func (s *Supplier) BeforeCreate(tx *gorm.DB) error {
@@ -93,11 +113,12 @@ const (
 	PaymentMethodBankTransfer = "bank_transfer" // 银行转账
 	PaymentMethodCheck        = "check"         // 支票
 	PaymentMethodOther        = "other"         // 其他
+	PaymentMethodCredit       = "credit"        // 预付款/余额抵扣
 )
 
-// UpdateAmounts 更新应付款金额和状态
+// UpdateAmounts 更新应付款金额和状态（已享受的现金折扣视同已结清）
 func (pr *PayableRecord) UpdateAmounts() {
-	pr.RemainingAmount = pr.TotalAmount - pr.PaidAmount
+	pr.RemainingAmount = pr.TotalAmount - pr.PaidAmount - pr.DiscountTaken
 
 	if pr.RemainingAmount <= 0 {
 		pr.Status = PayableStatusPaid
@@ -109,12 +130,43 @@ func (pr *PayableRecord) UpdateAmounts() {
 	}
 }
 
-// IsOverdue 检查是否超期
+// IsOverdue 检查是否超期（有分期计划时，任一期超期未付清即为超期；需预加载 Installments）
 func (pr *PayableRecord) IsOverdue() bool {
-	if pr.DueDate == nil || pr.Status == PayableStatusPaid {
+	if pr.Status == PayableStatusPaid {
 		return false
 	}
-	return time.Now().After(*pr.DueDate)
+	now := time.Now()
+	if len(pr.Installments) > 0 {
+		for i := range pr.Installments {
+			if pr.Installments[i].IsOverdue(now) {
+				return true
+			}
+		}
+		return false
+	}
+	if pr.DueDate == nil {
+		return false
+	}
+	return now.After(*pr.DueDate)
+}
+
+// NextDueDate 下一个未付清的到期日：有分期计划时取最早未付清一期，否则为 DueDate
+func (pr *PayableRecord) NextDueDate() *time.Time {
+	if len(pr.Installments) > 0 {
+		var next *time.Time
+		for i := range pr.Installments {
+			it := &pr.Installments[i]
+			if it.Status == PayableStatusPaid {
+				continue
+			}
+			if next == nil || it.DueDate.Before(*next) {
+				d := it.DueDate
+				next = &d
+			}
+		}
+		return next
+	}
+	return pr.DueDate
 }
 
 // GetStatusText 获取状态文本
@@ -142,6 +194,8 @@ func (pmr *PaymentRecord) GetPaymentMethodText() string {
 		return "支票"
 	case PaymentMethodOther:
 		return "其他"
+	case PaymentMethodCredit:
+		return "余额抵扣"
 	default:
 		return "未知方式"
 	}
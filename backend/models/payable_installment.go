@@ -0,0 +1,55 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PayableInstallment 应付款分期计划：一条应付款可按约定拆成多期，各期有独立到期日与状态
+type PayableInstallment struct {
+	ID              uint         `gorm:"primaryKey" json:"id"`
+	PayableRecordID uint         `gorm:"index;not null" json:"payable_record_id"`
+	Seq             int          `gorm:"not null" json:"seq"`                             // 期次（从1开始，按到期日排序）
+	DueDate         time.Time    `gorm:"type:date;not null;index" json:"due_date"`        // 本期到期日
+	Amount          money.Amount `gorm:"type:decimal(15,2);not null" json:"amount"`       // 本期应付
+	PaidAmount      money.Amount `gorm:"type:decimal(15,2);default:0" json:"paid_amount"` // 本期已付
+	Status          string       `gorm:"size:20;default:'pending';index" json:"status"`   // pending / partial / paid
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+func (pi *PayableInstallment) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&pi.ID)
+}
+
+// Remaining 本期剩余未付金额
+func (pi *PayableInstallment) Remaining() money.Amount {
+	return money.Max(pi.Amount-pi.PaidAmount, 0)
+}
+
+// IsOverdue 本期是否已超期未付清
+func (pi *PayableInstallment) IsOverdue(now time.Time) bool {
+	return pi.Status != PayableStatusPaid && pi.DueDate.Before(now)
+}
+
+// AllocateInstallmentPayments 将累计已付金额按期次顺序分摊到各期，并回写每期的已付与状态。
+// items 需已按期次排序；超出分期合计的部分不分摊。
+func AllocateInstallmentPayments(items []PayableInstallment, paid money.Amount) {
+	left := paid
+	for i := range items {
+		it := &items[i]
+		applied := money.Max(money.Min(it.Amount, left), 0)
+		it.PaidAmount = applied
+		left -= applied
+		switch {
+		case applied >= it.Amount:
+			it.Status = PayableStatusPaid
+		case applied > 0:
+			it.Status = PayableStatusPartial
+		default:
+			it.Status = PayableStatusPending
+		}
+	}
+}
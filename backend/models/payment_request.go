@@ -0,0 +1,59 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentApprovalThreshold 付款审批阈值（按币种）：单笔金额超过阈值的付款需管理员审批
+type PaymentApprovalThreshold struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	Currency  string       `gorm:"unique;size:8;not null" json:"currency"`
+	Amount    money.Amount `gorm:"type:decimal(18,2);not null" json:"amount"` // 超过该金额（不含）需审批
+	UpdatedBy uint         `json:"updated_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+func (pt *PaymentApprovalThreshold) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&pt.ID)
+}
+
+// PaymentRequest 付款申请：超过阈值的付款先以申请形式提交，审批通过后生成还款记录
+type PaymentRequest struct {
+	ID              uint          `gorm:"primaryKey" json:"id"`
+	PayableRecordID uint          `gorm:"index;not null" json:"payable_record_id"`
+	PayableRecord   PayableRecord `gorm:"foreignKey:PayableRecordID" json:"payable_record"`
+	BaseID          uint          `gorm:"index;not null" json:"base_id"`
+	Amount          money.Amount  `gorm:"type:decimal(15,2);not null" json:"amount"`
+	Currency        string        `gorm:"size:8;default:CNY" json:"currency"`
+	PaymentDate     time.Time     `gorm:"type:date;not null" json:"payment_date"`
+	PaymentMethod   string        `gorm:"size:20;default:'bank_transfer'" json:"payment_method"`
+	ReferenceNumber string        `gorm:"size:100" json:"reference_number"`
+	Notes           string        `gorm:"type:text" json:"notes"`
+	// 状态：pending(待审批) / approved(已批准) / rejected(已驳回)
+	Status      string     `gorm:"size:20;default:'pending';index" json:"status"`
+	RequestedBy uint       `gorm:"not null" json:"requested_by"`
+	Requester   User       `gorm:"foreignKey:RequestedBy" json:"requester"`
+	ApproverID  *uint      `json:"approver_id,omitempty"`
+	Approver    *User      `gorm:"foreignKey:ApproverID" json:"approver,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	Comment     string     `gorm:"type:text" json:"comment"` // 审批意见（驳回时保留原因）
+	// 审批通过后生成的还款记录
+	PaymentRecordID *uint     `json:"payment_record_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (pr *PaymentRequest) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&pr.ID)
+}
+
+// PaymentRequest 状态常量
+const (
+	PaymentRequestPending  = "pending"
+	PaymentRequestApproved = "approved"
+	PaymentRequestRejected = "rejected"
+)
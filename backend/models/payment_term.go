@@ -0,0 +1,65 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+)
+
+// 付款条件类型
+const (
+	PaymentTermNet = "net" // 发票日 + N 天
+	PaymentTermEOM = "eom" // 发票当月月末 + N 天
+)
+
+// HasPaymentTerms 供应商是否配置了付款条件
+func (s *Supplier) HasPaymentTerms() bool {
+	return s.PaymentTermType == PaymentTermNet || s.PaymentTermType == PaymentTermEOM
+}
+
+// TermsDueDate 按付款条件计算到期日（未配置付款条件时返回 nil）
+func (s *Supplier) TermsDueDate(invoiceDate time.Time) *time.Time {
+	var due time.Time
+	switch s.PaymentTermType {
+	case PaymentTermNet:
+		due = invoiceDate.AddDate(0, 0, s.PaymentTermDays)
+	case PaymentTermEOM:
+		y, m, _ := invoiceDate.Date()
+		endOfMonth := time.Date(y, m, 1, 0, 0, 0, 0, invoiceDate.Location()).AddDate(0, 1, -1)
+		due = endOfMonth.AddDate(0, 0, s.PaymentTermDays)
+	default:
+		return nil
+	}
+	return &due
+}
+
+// TermsDiscountDeadline 现金折扣截止日（未配置折扣时返回 nil）
+func (s *Supplier) TermsDiscountDeadline(invoiceDate time.Time) *time.Time {
+	if s.DiscountPercent <= 0 || s.DiscountDays <= 0 {
+		return nil
+	}
+	d := invoiceDate.AddDate(0, 0, s.DiscountDays)
+	return &d
+}
+
+// EligibleDiscount 计算一笔付款可享受的现金折扣：
+// 在折扣截止日（含）前付款，且本次付款加折扣足以结清剩余应付时，折扣为剩余应付 × X%（按币种取整）
+func (pr *PayableRecord) EligibleDiscount(amount money.Amount, paymentDate time.Time) money.Amount {
+	if pr.DiscountPercent <= 0 || pr.DiscountDeadline == nil || pr.Status == PayableStatusPaid {
+		return 0
+	}
+	if paymentDate.After(*pr.DiscountDeadline) {
+		return 0
+	}
+	discount := pr.RemainingAmount.Percent(pr.DiscountPercent).RoundFor(pr.Currency)
+	if amount+discount < pr.RemainingAmount {
+		return 0
+	}
+	// 付款本身已足额时不再叠加折扣
+	if amount+discount > pr.RemainingAmount {
+		discount = pr.RemainingAmount - amount
+	}
+	if discount <= 0 {
+		return 0
+	}
+	return discount
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"backend/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,7 +13,7 @@ type PurchaseEntry struct {
 	Supplier     *Supplier           `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`    // 关联的供应商
 	OrderNumber  string              `json:"order_number"`
 	PurchaseDate time.Time           `json:"purchase_date"`
-	TotalAmount  float64             `json:"total_amount"`
+	TotalAmount  money.Amount        `gorm:"type:decimal(15,2)" json:"total_amount"`
 	Currency     string              `gorm:"size:8;default:CNY" json:"currency"`
 	Receiver     string              `json:"receiver"`
 	BaseID       uint                `gorm:"not null" json:"base_id"`       // 所属基地ID
@@ -23,6 +24,9 @@ type PurchaseEntry struct {
 	UpdatedAt    time.Time           `json:"updated_at"`
 	Items        []PurchaseEntryItem `gorm:"foreignKey:PurchaseEntryID" json:"items"`
 	ReceiptPath  string              `gorm:"size:255" json:"receipt_path,omitempty"`
+	// 创建时的折算快照：1 原币 = rate_to_cny CNY，amount_cny 为折算后的人民币金额
+	RateToCNY float64      `gorm:"type:decimal(18,6);default:0" json:"rate_to_cny"`
+	AmountCNY money.Amount `gorm:"type:decimal(15,2);default:0" json:"amount_cny"`
 }
 
 func (pe *PurchaseEntry) BeforeCreate(tx *gorm.DB) error {
@@ -30,14 +34,14 @@ func (pe *PurchaseEntry) BeforeCreate(tx *gorm.DB) error {
 }
 
 type PurchaseEntryItem struct {
-	ID              uint    `gorm:"primaryKey" json:"id"`
-	PurchaseEntryID uint    `json:"purchase_entry_id"`
-	ProductName     string  `json:"product_name"`
-	Unit            string  `json:"unit,omitempty"`
-	Quantity        float64 `json:"quantity"`
-	UnitPrice       float64 `json:"unit_price"`
-	Amount          float64 `json:"amount"`
-	QuantityBase    float64 `json:"quantity_base,omitempty"`
+	ID              uint         `gorm:"primaryKey" json:"id"`
+	PurchaseEntryID uint         `json:"purchase_entry_id"`
+	ProductName     string       `json:"product_name"`
+	Unit            string       `json:"unit,omitempty"`
+	Quantity        float64      `json:"quantity"`
+	UnitPrice       money.Amount `gorm:"type:decimal(18,4)" json:"unit_price"`
+	Amount          money.Amount `gorm:"type:decimal(15,2)" json:"amount"`
+	QuantityBase    float64      `json:"quantity_base,omitempty"`
 }
 
 func (pei *PurchaseEntryItem) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReportDefinition 保存的自定义报表定义：Definition 为 JSON（事实表、维度、度量、筛选、排序等，见 handlers.reportDef），
+// 按名称复用；执行时的基地范围取决于执行者角色，而非保存者
+type ReportDefinition struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:100;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	Definition  string    `gorm:"type:text;not null" json:"definition"`
+	CreatedBy   uint      `gorm:"index;not null" json:"created_by"`
+	Creator     User      `gorm:"foreignKey:CreatedBy" json:"creator"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (rd *ReportDefinition) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&rd.ID)
+}
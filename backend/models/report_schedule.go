@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 定时报表频率
+const (
+	ReportFrequencyDaily   = "daily"
+	ReportFrequencyWeekly  = "weekly"
+	ReportFrequencyMonthly = "monthly"
+)
+
+// 报表发送状态
+const (
+	ReportDeliverySent    = "sent"
+	ReportDeliveryFailed  = "failed"
+	ReportDeliverySkipped = "skipped"
+)
+
+// ReportSchedule 定时邮件报表：按频率生成各基地支出汇总与超期应付款（可附加已保存的自定义报表），
+// 渲染为 PDF/XLSX 后经 SMTP 发送；每位收件人只收到其可见基地的数据
+type ReportSchedule struct {
+	ID             uint              `gorm:"primaryKey" json:"id"`
+	Name           string            `gorm:"uniqueIndex;size:100;not null" json:"name"`
+	Enabled        bool              `json:"enabled"`
+	Frequency      string            `gorm:"size:10;default:'weekly'" json:"frequency"` // daily / weekly / monthly
+	Weekday        int               `json:"weekday"`                                   // weekly：0=周日 … 6=周六
+	DayOfMonth     int               `json:"day_of_month"`                              // monthly：1–28
+	Hour           int               `json:"hour"`                                      // 发送时刻（服务器本地时间，0–23）
+	Period         string            `gorm:"size:20" json:"period"`                     // 报表期间（同自定义报表 period），为空按频率取上一周期
+	Format         string            `gorm:"size:10;default:'pdf'" json:"format"`       // pdf / xlsx
+	TargetCurrency string            `gorm:"size:8;default:CNY" json:"target_currency"`
+	ReportNames    string            `gorm:"size:500" json:"report_names"` // 附加的已保存报表名称（逗号分隔）
+	NextRunAt      *time.Time        `gorm:"index" json:"next_run_at,omitempty"`
+	LastRunAt      *time.Time        `json:"last_run_at,omitempty"`
+	Recipients     []ReportRecipient `gorm:"foreignKey:ScheduleID" json:"recipients"`
+	CreatedBy      uint              `json:"created_by"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+func (rs *ReportSchedule) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&rs.ID)
+}
+
+// ReportRecipient 收件人规则：Email 为外部地址；否则按 UserID，或按 Role（+ BaseID）匹配用户并取其邮箱。
+// BaseID 同时限定报表内容的基地范围
+type ReportRecipient struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	ScheduleID uint   `gorm:"index;not null" json:"schedule_id"`
+	BaseID     *uint  `json:"base_id,omitempty"`
+	Base       *Base  `gorm:"foreignKey:BaseID" json:"base,omitempty"`
+	Role       string `gorm:"size:20" json:"role,omitempty"`
+	UserID     *uint  `json:"user_id,omitempty"`
+	Email      string `gorm:"size:255" json:"email,omitempty"`
+}
+
+func (rr *ReportRecipient) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&rr.ID)
+}
+
+// ReportDelivery 报表发送记录（每位收件人每次一条）
+type ReportDelivery struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ScheduleID  uint      `gorm:"index;not null" json:"schedule_id"`
+	Trigger     string    `gorm:"size:10" json:"trigger"` // schedule 定时 / manual 手动
+	Recipient   string    `gorm:"size:255" json:"recipient"`
+	UserID      *uint     `json:"user_id,omitempty"`
+	BaseIDs     string    `gorm:"size:255" json:"base_ids"` // 报表包含的基地（逗号分隔，空表示全部）
+	PeriodStart time.Time `gorm:"type:date" json:"period_start"`
+	PeriodEnd   time.Time `gorm:"type:date" json:"period_end"`
+	Format      string    `gorm:"size:10" json:"format"`
+	FileName    string    `gorm:"size:255" json:"file_name"`
+	FileSize    int       `json:"file_size"`
+	Status      string    `gorm:"size:10;index" json:"status"` // sent / failed / skipped
+	Error       string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
+
+func (rd *ReportDelivery) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&rd.ID)
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 产出记录类型
+const (
+	RevenueKindSale    = "sale"    // 销售：计入收入
+	RevenueKindHarvest = "harvest" // 收获/产出：仅记录产量及估值，不计入收入
+)
+
+// RevenueRecord 基地收入/产出记录（销售、收获），用于基地损益统计；不生成记账凭证
+type RevenueRecord struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	BaseID      uint         `gorm:"index;not null" json:"base_id"`
+	Base        Base         `gorm:"foreignKey:BaseID" json:"base"`
+	SectionID   *uint        `gorm:"index" json:"section_id,omitempty"`
+	Section     *BaseSection `gorm:"foreignKey:SectionID" json:"section,omitempty"`
+	Date        time.Time    `gorm:"type:date;not null;index" json:"date"`
+	Kind        string       `gorm:"size:10;default:'sale';index" json:"kind"` // sale / harvest
+	Item        string       `gorm:"size:100;not null" json:"item"`            // 产品/作物名称
+	Quantity    float64      `gorm:"type:decimal(15,4);default:0" json:"quantity"`
+	Unit        string       `gorm:"size:20" json:"unit"`
+	UnitPrice   money.Amount `gorm:"type:decimal(18,4);default:0" json:"unit_price"`
+	Amount      money.Amount `gorm:"type:decimal(15,2);default:0" json:"amount"` // 数量×单价，按币种取整
+	Currency    string       `gorm:"size:8;default:CNY" json:"currency"`
+	Buyer       string       `gorm:"size:100" json:"buyer"`
+	Note        string       `gorm:"type:text" json:"note"`
+	CreatedBy   uint         `json:"created_by"`
+	CreatorName string       `gorm:"size:100" json:"creator_name"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+func (rr *RevenueRecord) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&rr.ID)
+}
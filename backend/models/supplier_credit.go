@@ -0,0 +1,43 @@
+package models
+
+import (
+	"backend/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SupplierCreditEntry 供应商预付款/余额流水：正数为增加（预付、超付），负数为抵扣应付款
+// 余额按 供应商+基地+币种 汇总
+type SupplierCreditEntry struct {
+	ID         uint         `gorm:"primaryKey" json:"id"`
+	SupplierID uint         `gorm:"index;not null" json:"supplier_id"`
+	Supplier   Supplier     `gorm:"foreignKey:SupplierID" json:"supplier"`
+	BaseID     uint         `gorm:"index;not null" json:"base_id"`
+	Base       Base         `gorm:"foreignKey:BaseID" json:"base"`
+	Currency   string       `gorm:"size:8;default:CNY" json:"currency"`
+	Amount     money.Amount `gorm:"type:decimal(15,2);not null" json:"amount"`
+	Kind       string       `gorm:"size:20;not null;index" json:"kind"` // prepayment / overpayment / applied
+	EntryDate  time.Time    `gorm:"type:date;not null" json:"entry_date"`
+	// 预付款的付款信息（仅 prepayment）
+	PaymentMethod   string `gorm:"size:20" json:"payment_method,omitempty"`
+	ReferenceNumber string `gorm:"size:100" json:"reference_number,omitempty"`
+	// 关联：超付来源的还款记录 / 抵扣生成的还款记录及对应应付款
+	PayableRecordID *uint     `gorm:"index" json:"payable_record_id,omitempty"`
+	PaymentRecordID *uint     `gorm:"index" json:"payment_record_id,omitempty"`
+	Notes           string    `gorm:"type:text" json:"notes"`
+	CreatedBy       uint      `gorm:"not null" json:"created_by"`
+	Creator         User      `gorm:"foreignKey:CreatedBy" json:"creator"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (sc *SupplierCreditEntry) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&sc.ID)
+}
+
+// SupplierCreditEntry 类型常量
+const (
+	SupplierCreditPrepayment  = "prepayment"  // 预付款（无对应应付款）
+	SupplierCreditOverpayment = "overpayment" // 还款超出剩余应付的部分
+	SupplierCreditApplied     = "applied"     // 抵扣应付款
+)
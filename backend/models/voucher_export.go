@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// VoucherTemplate 凭证导出列模板：Columns 为 JSON 数组 [{"header":"凭证日期","field":"date"}, ...]
+type VoucherTemplate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;size:50;not null" json:"name"`
+	Format    string    `gorm:"size:10;default:'xlsx'" json:"format"` // csv / xlsx
+	Columns   string    `gorm:"type:text;not null" json:"columns"`
+	IsDefault bool      `gorm:"default:false" json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (vt *VoucherTemplate) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&vt.ID)
+}
+
+// AccountMapping 科目对照表：本系统科目 → 外部账套科目；BaseID 为空表示通用对照，基地对照优先
+type AccountMapping struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	AccountCode  string    `gorm:"size:20;not null;uniqueIndex:idx_account_mapping" json:"account_code"`
+	BaseID       *uint     `gorm:"uniqueIndex:idx_account_mapping" json:"base_id,omitempty"`
+	Base         *Base     `gorm:"foreignKey:BaseID" json:"base,omitempty"`
+	ExternalCode string    `gorm:"size:50;not null" json:"external_code"`
+	ExternalName string    `gorm:"size:100" json:"external_name"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (am *AccountMapping) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&am.ID)
+}
+
+// VoucherExport 凭证导出批次；导出后对应凭证记录 export_id，不会被再次导出
+type VoucherExport struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	BaseID     *uint     `gorm:"index" json:"base_id,omitempty"`
+	Base       *Base     `gorm:"foreignKey:BaseID" json:"base,omitempty"`
+	StartDate  time.Time `gorm:"type:date" json:"start_date"`
+	EndDate    time.Time `gorm:"type:date" json:"end_date"`
+	TemplateID *uint     `json:"template_id,omitempty"`
+	Format     string    `gorm:"size:10" json:"format"`
+	EntryCount int       `json:"entry_count"`
+	CreatedBy  uint      `gorm:"not null" json:"created_by"`
+	Creator    User      `gorm:"foreignKey:CreatedBy" json:"creator"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (ve *VoucherExport) BeforeCreate(tx *gorm.DB) error {
+	return assignSnowflakeID(&ve.ID)
+}
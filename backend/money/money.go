@@ -0,0 +1,294 @@
+// Package money 定点金额类型，替代 float64 保存与计算金额。
+//
+// Amount 以万分之一为最小单位存为 int64：金额列为 decimal(15,2)、单价列为 decimal(18,4)，
+// 两者都能无损读写；加减比较为整数运算，不再需要 0.000001 之类的容差。
+// 与汇率、数量相乘时先按 float64 计算再四舍五入回定点数，结果再按币种规则取整（Round）。
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount 定点金额（单位：1/10000）
+type Amount int64
+
+const (
+	scale  = 10000
+	places = 4
+)
+
+// Decimals 币种的金额小数位：LAK 为 0，其余（CNY、THB 等）为 2
+func Decimals(currency string) int {
+	switch strings.ToUpper(strings.TrimSpace(currency)) {
+	case "LAK":
+		return 0
+	}
+	return 2
+}
+
+// FromFloat 由 float64 转换（四舍五入到 4 位小数）
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * scale))
+}
+
+// FromInt 整数金额
+func FromInt(n int64) Amount {
+	return Amount(n * scale)
+}
+
+// Parse 精确解析十进制字符串（如 "1234.56"、"-0.5"），超过 4 位的小数四舍五入
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("金额为空")
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	if strings.ContainsAny(s, "eE") {
+		// 科学计数法（如数据库驱动返回的 double）按 float 处理
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效金额: %s", s)
+		}
+		a := FromFloat(f)
+		if neg {
+			a = -a
+		}
+		return a, nil
+	}
+	intPart, frac, _ := strings.Cut(s, ".")
+	if intPart == "" && frac == "" {
+		return 0, fmt.Errorf("无效金额: %s", s)
+	}
+	var n int64
+	for _, c := range intPart {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("无效金额: %s", s)
+		}
+		if n > (math.MaxInt64/scale-9)/10 {
+			return 0, fmt.Errorf("金额超出范围: %s", s)
+		}
+		n = n*10 + int64(c-'0')
+	}
+	n *= scale
+	var f int64
+	roundUp := false
+	for i, c := range frac {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("无效金额: %s", s)
+		}
+		if i < places {
+			f = f*10 + int64(c-'0')
+		} else if i == places {
+			roundUp = c >= '5'
+		}
+	}
+	for i := len(frac); i < places; i++ {
+		f *= 10
+	}
+	n += f
+	if roundUp {
+		n++
+	}
+	if neg {
+		n = -n
+	}
+	return Amount(n), nil
+}
+
+// MustParse 解析常量金额，格式错误时 panic
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Float64 转为 float64（仅用于与汇率、数量相乘或输出统计）
+func (a Amount) Float64() float64 {
+	return float64(a) / scale
+}
+
+// Round 四舍五入（远离零）到 n 位小数
+func (a Amount) Round(n int) Amount {
+	if n >= places {
+		return a
+	}
+	if n < 0 {
+		n = 0
+	}
+	unit := int64(1)
+	for i := n; i < places; i++ {
+		unit *= 10
+	}
+	v := int64(a)
+	half := unit / 2
+	if v >= 0 {
+		return Amount((v + half) / unit * unit)
+	}
+	return Amount(-((-v + half) / unit * unit))
+}
+
+// RoundFor 按币种规则取整
+func (a Amount) RoundFor(currency string) Amount {
+	return a.Round(Decimals(currency))
+}
+
+// Mul 乘以数量或汇率，结果保留 4 位小数
+func (a Amount) Mul(f float64) Amount {
+	return FromFloat(a.Float64() * f)
+}
+
+// Percent 按百分比计算（如 2.5 表示 2.5%）
+func (a Amount) Percent(p float64) Amount {
+	return a.Mul(p / 100)
+}
+
+// Neg 相反数
+func (a Amount) Neg() Amount { return -a }
+
+// Abs 绝对值
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Sign 符号：-1、0、1
+func (a Amount) Sign() int {
+	switch {
+	case a > 0:
+		return 1
+	case a < 0:
+		return -1
+	}
+	return 0
+}
+
+// IsZero 是否为零
+func (a Amount) IsZero() bool { return a == 0 }
+
+// Min 较小值
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max 较大值
+func Max(a, b Amount) Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// StringFixed 固定 n 位小数的字符串（先四舍五入）
+func (a Amount) StringFixed(n int) string {
+	if n > places {
+		n = places
+	}
+	if n < 0 {
+		n = 0
+	}
+	v := int64(a.Round(n))
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	s := sign + strconv.FormatInt(v/scale, 10)
+	if n == 0 {
+		return s
+	}
+	frac := fmt.Sprintf("%04d", v%scale)
+	return s + "." + frac[:n]
+}
+
+// String 十进制字符串：至少 2 位小数，去掉多余的末尾 0
+func (a Amount) String() string {
+	s := a.StringFixed(places)
+	for strings.HasSuffix(s, "0") && len(s)-strings.IndexByte(s, '.') > 3 {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// MarshalJSON 输出为 JSON 数字（不经过 float64，避免 0.30000000000000004 之类的尾数）
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON 接受数字、数字字符串或 null
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "null" {
+		*a = 0
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+		if s == "" {
+			*a = 0
+			return nil
+		}
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Scan 读取数据库 decimal / double / 整数列
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		p, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = p
+		return nil
+	case string:
+		p, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = p
+		return nil
+	case float64:
+		*a = FromFloat(v)
+		return nil
+	case float32:
+		*a = FromFloat(float64(v))
+		return nil
+	case int64:
+		*a = FromInt(v)
+		return nil
+	}
+	return fmt.Errorf("无法将 %T 转换为金额", src)
+}
+
+// Value 以十进制字符串写入，由数据库按列精度保存
+func (a Amount) Value() (driver.Value, error) {
+	return a.StringFixed(places), nil
+}
@@ -0,0 +1,226 @@
+package money
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{"0", 0},
+		{"1", 10000},
+		{"1234.56", 12345600},
+		{"0.0001", 1},
+		{".5", 5000},
+		{"+2.5", 25000},
+		{" 3.14 ", 31400},
+		{"1.23455", 12346}, // 第 5 位小数四舍五入
+		{"1.23454", 12345}, // 第 5 位以下舍去
+		{"0.99995", 10000}, // 进位到整数
+		{"-0.5", -5000},
+		{"-1234.56", -12345600},
+		{"-1.23455", -12346}, // 负数远离零舍入
+		{"1e3", 10000000},
+		{"-1.5E2", -1500000},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{"", "-", ".", "abc", "1.2.3", "12a", "1,000", "99999999999999999999"} {
+		if got, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"1.005", 2, "1.01"},
+		{"1.0049", 2, "1"},
+		{"-1.005", 2, "-1.01"},
+		{"2.5", 0, "3"},
+		{"-2.5", 0, "-3"},
+		{"1.23456", 4, "1.2346"},
+		{"1.2345", 6, "1.2345"},
+		{"1.5", -1, "2"},
+	}
+	for _, tt := range tests {
+		got := MustParse(tt.in).Round(tt.n)
+		if want := MustParse(tt.want); got != want {
+			t.Errorf("%s.Round(%d) = %s, want %s", tt.in, tt.n, got, want)
+		}
+	}
+}
+
+func TestRoundFor(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     string
+	}{
+		{"1234.565", "CNY", "1234.57"},
+		{"1234.564", "THB", "1234.56"},
+		{"1234.5", "LAK", "1235"},
+		{"1234.4999", "LAK", "1234"},
+		{"-1234.5", "LAK", "-1235"},
+		{"1234.5", " lak ", "1235"},
+		{"0.125", "", "0.13"},
+	}
+	for _, tt := range tests {
+		got := MustParse(tt.in).RoundFor(tt.currency)
+		if want := MustParse(tt.want); got != want {
+			t.Errorf("%s.RoundFor(%q) = %s, want %s", tt.in, tt.currency, got, want)
+		}
+	}
+}
+
+func TestStringFixed(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"1234.5", 2, "1234.50"},
+		{"1234.5", 0, "1235"},
+		{"-0.005", 2, "-0.01"},
+		{"-0.004", 2, "0.00"},
+		{"0.0001", 4, "0.0001"},
+		{"7", 9, "7.0000"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.in).StringFixed(tt.n); got != tt.want {
+			t.Errorf("%s.StringFixed(%d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.00"},
+		{12345600, "1234.56"},
+		{12345, "1.2345"},
+		{12340, "1.234"},
+		{-5000, "-0.50"},
+		{FromInt(-3), "-3.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestMulPercent(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want string
+	}{
+		{"mul rate", MustParse("100").Mul(0.0003456), "0.0346"},
+		{"mul qty", MustParse("12.34").Mul(3), "37.02"},
+		{"mul negative", MustParse("-10.01").Mul(1.5), "-15.015"},
+		{"percent", MustParse("1000").Percent(2.5), "25"},
+		{"percent fraction", MustParse("333.33").Percent(3), "9.9999"},
+	}
+	for _, tt := range tests {
+		if want := MustParse(tt.want); tt.got != want {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{`1234.56`, 12345600},
+		{`"-0.5"`, -5000},
+		{`""`, 0},
+		{`null`, 0},
+		{`0.1`, 1000},
+	}
+	for _, tt := range tests {
+		var a Amount = 99
+		if err := a.UnmarshalJSON([]byte(tt.in)); err != nil {
+			t.Errorf("UnmarshalJSON(%s) error: %v", tt.in, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("UnmarshalJSON(%s) = %d, want %d", tt.in, a, tt.want)
+		}
+		b, _ := a.MarshalJSON()
+		var back Amount
+		if err := back.UnmarshalJSON(b); err != nil || back != a {
+			t.Errorf("JSON round-trip of %s: got %d (%v)", tt.in, back, err)
+		}
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	// Value 写出的字符串经 Scan 读回应保持不变
+	for _, a := range []Amount{0, 1, -1, 12345600, -12345678, MustParse("99999999999.9999"), MustParse("-0.0001")} {
+		v, err := a.Value()
+		if err != nil {
+			t.Fatalf("Amount(%d).Value() error: %v", int64(a), err)
+		}
+		var back Amount
+		if err := back.Scan(v); err != nil {
+			t.Errorf("Scan(%v) error: %v", v, err)
+			continue
+		}
+		if back != a {
+			t.Errorf("Value/Scan round-trip: %d -> %v -> %d", int64(a), v, int64(back))
+		}
+	}
+
+	// 各数据库驱动可能返回的类型
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{nil, 0},
+		{[]byte("1234.56"), 12345600},
+		{"-0.50", -5000},
+		{float64(0.1), 1000},
+		{float32(2.5), 25000},
+		{int64(-7), -70000},
+		{"1.5e2", 1500000},
+	}
+	for _, tt := range tests {
+		var a Amount = 99
+		if err := a.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%#v) error: %v", tt.src, err)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("Scan(%#v) = %d, want %d", tt.src, a, tt.want)
+		}
+	}
+
+	var a Amount
+	if err := a.Scan(true); err == nil {
+		t.Error("Scan(bool) should fail")
+	}
+	var _ driver.Valuer = Amount(0)
+}
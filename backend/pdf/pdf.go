@@ -0,0 +1,262 @@
+// Package pdf 生成简单的表格报表 PDF（A4 横向），用于定时邮件报表。
+//
+// 文字使用 PDF 阅读器内置的 STSong-Light 中文字体（Adobe-GB1，UniGB-UCS2-H 编码），不嵌入字体文件，
+// 只支持基本多文种平面内的字符。版面为标题、说明行与若干表格；表格超出页面时自动换页并重复表头，
+// 列宽按内容估算，超出页面宽度时按比例收窄并截断过长的文字。
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Section 一个表格：Rows 首行为表头；字符串左对齐，其余（数值、金额）右对齐
+type Section struct {
+	Title string
+	Rows  [][]any
+}
+
+// Document 报表内容
+type Document struct {
+	Title    string
+	Notes    []string
+	Sections []Section
+}
+
+const (
+	pageW     = 842.0 // A4 横向
+	pageH     = 595.0
+	margin    = 36.0
+	bodySize  = 9.0
+	rowH      = bodySize * 1.7
+	cellPad   = 4.0
+	titleSize = 16.0
+	headSize  = 12.0
+)
+
+// textWidth 估算文字宽度：ASCII 字符按半角（W 数组中 CID 1–95 宽 500），其余按全角
+func textWidth(s string, size float64) float64 {
+	w := 0.0
+	for _, r := range s {
+		if r < 0x80 {
+			w += 0.5
+		} else {
+			w += 1
+		}
+	}
+	return w * size
+}
+
+// fit 截断到不超过 width，截断时末尾加省略号
+func fit(s string, width, size float64) string {
+	if textWidth(s, size) <= width {
+		return s
+	}
+	rs := []rune(s)
+	for len(rs) > 0 && textWidth(string(rs)+"…", size) > width {
+		rs = rs[:len(rs)-1]
+	}
+	return string(rs) + "…"
+}
+
+// cellText 单元格文本；第二个返回值表示是否右对齐
+func cellText(v any) (string, bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return x, false
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), true
+	}
+	return fmt.Sprint(v), true
+}
+
+// hexText 以 UTF-16BE 十六进制串表示文字（UniGB-UCS2-H 编码）
+func hexText(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		if r > 0xFFFF || r < 0x20 {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+type layout struct {
+	pages []*bytes.Buffer
+	cur   *bytes.Buffer
+	y     float64
+}
+
+func (l *layout) newPage() {
+	l.cur = &bytes.Buffer{}
+	l.pages = append(l.pages, l.cur)
+	l.y = pageH - margin
+}
+
+// need 剩余高度不足 h 时换页，返回是否换页
+func (l *layout) need(h float64) bool {
+	if l.y-h < margin+rowH {
+		l.newPage()
+		return true
+	}
+	return false
+}
+
+func (l *layout) text(x, y, size float64, s string) {
+	fmt.Fprintf(l.cur, "BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n", size, x, y, hexText(s))
+}
+
+func (l *layout) rule(x1, x2, y float64) {
+	fmt.Fprintf(l.cur, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y, x2, y)
+}
+
+// widths 各列宽度：按内容估算，总宽超出可用宽度时按比例收窄
+func widths(rows [][]any) []float64 {
+	n := 0
+	for _, row := range rows {
+		if len(row) > n {
+			n = len(row)
+		}
+	}
+	out := make([]float64, n)
+	for _, row := range rows {
+		for i, v := range row {
+			s, _ := cellText(v)
+			if w := textWidth(s, bodySize) + 2*cellPad; w > out[i] {
+				out[i] = w
+			}
+		}
+	}
+	total := 0.0
+	for _, w := range out {
+		total += w
+	}
+	if avail := pageW - 2*margin; total > avail {
+		for i := range out {
+			out[i] *= avail / total
+		}
+	}
+	return out
+}
+
+func (l *layout) row(row []any, ws []float64, header bool) {
+	y := l.y - rowH
+	if header {
+		total := 0.0
+		for _, w := range ws {
+			total += w
+		}
+		fmt.Fprintf(l.cur, "0.9 g %.2f %.2f %.2f %.2f re f 0 g\n", margin, y, total, rowH)
+	}
+	x := margin
+	for i, w := range ws {
+		var v any
+		if i < len(row) {
+			v = row[i]
+		}
+		s, right := cellText(v)
+		s = fit(s, w-2*cellPad, bodySize)
+		tx := x + cellPad
+		if right && !header {
+			tx = x + w - cellPad - textWidth(s, bodySize)
+		}
+		l.text(tx, y+(rowH-bodySize)/2+1, bodySize, s)
+		x += w
+	}
+	l.y = y
+	if header {
+		l.rule(margin, x, y)
+	}
+}
+
+func (l *layout) section(s Section) {
+	if len(s.Rows) == 0 {
+		return
+	}
+	ws := widths(s.Rows)
+	l.need(headSize*2 + rowH*2)
+	l.y -= headSize * 1.5
+	l.text(margin, l.y, headSize, s.Title)
+	l.y -= headSize * 0.5
+	l.row(s.Rows[0], ws, true)
+	for _, r := range s.Rows[1:] {
+		if l.need(rowH) {
+			l.row(s.Rows[0], ws, true)
+		}
+		l.row(r, ws, false)
+	}
+	total := 0.0
+	for _, w := range ws {
+		total += w
+	}
+	l.rule(margin, margin+total, l.y)
+	l.y -= rowH
+}
+
+// Write 将报表写为 PDF
+func Write(w io.Writer, doc Document) error {
+	l := &layout{}
+	l.newPage()
+	l.y -= titleSize
+	l.text(margin, l.y, titleSize, doc.Title)
+	l.y -= titleSize * 0.8
+	for _, n := range doc.Notes {
+		l.need(rowH)
+		l.y -= rowH
+		l.text(margin, l.y, bodySize, n)
+	}
+	for _, s := range doc.Sections {
+		l.section(s)
+	}
+	for i, p := range l.pages {
+		footer := fmt.Sprintf("第 %d / %d 页", i+1, len(l.pages))
+		fmt.Fprintf(p, "BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n", bodySize, pageW-margin-textWidth(footer, bodySize), margin/2, hexText(footer))
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	// 1 目录，2 页面树，3–5 字体，之后每页占两个对象（页面、内容流）
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	obj("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	obj("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>")
+	obj("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, p := range l.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageW, pageH, 7+2*i))
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		if _, err := zw.Write(p.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.String()))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -49,10 +49,35 @@ func SetupRouter() *http.ServeMux {
 	mux.HandleFunc("/api/expense/list", middleware.AuthMiddleware(handlers.ListExpense, "admin", "base_agent", "captain"))
 	mux.HandleFunc("/api/expense/update", middleware.AuthMiddleware(handlers.UpdateExpense, "admin", "base_agent", "captain"))
 	mux.HandleFunc("/api/expense/delete", middleware.AuthMiddleware(handlers.DeleteExpense, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/expense/import", middleware.AuthMiddleware(handlers.ImportExpenses, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/expense/export", middleware.AuthMiddleware(handlers.ExportExpenses, "admin", "base_agent", "captain"))
 	mux.HandleFunc("/api/expense/batch-delete", middleware.AuthMiddleware(handlers.BatchDeleteExpense, "admin", "base_agent", "captain"))
 	mux.HandleFunc("/api/expense/stats", middleware.AuthMiddleware(handlers.StatExpense, "admin", "base_agent"))
 	// 票据上传（基地开支）
 	mux.HandleFunc("/api/expense/upload-receipt", middleware.AuthMiddleware(handlers.UploadExpenseReceipt, "admin", "base_agent", "captain"))
+	// 开支审批与报销
+	mux.HandleFunc("/api/expense/approver/list", middleware.AuthMiddleware(handlers.ListExpenseApprovers, "admin", "base_agent"))
+	mux.HandleFunc("/api/expense/approver/set", middleware.AuthMiddleware(handlers.SetExpenseApprovers, "admin"))
+	mux.HandleFunc("/api/expense/approval/queue", middleware.AuthMiddleware(handlers.ExpenseApprovalQueue, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/expense/approve", middleware.AuthMiddleware(handlers.ApproveExpenses, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/expense/reject", middleware.AuthMiddleware(handlers.RejectExpenses, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/expense/reimbursement/create", middleware.AuthMiddleware(handlers.CreateReimbursement, "admin", "base_agent"))
+	mux.HandleFunc("/api/expense/reimbursement/list", middleware.AuthMiddleware(handlers.ListReimbursements, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/expense/reimbursement/delete", middleware.AuthMiddleware(handlers.DeleteReimbursement, "admin"))
+	mux.HandleFunc("/api/expense/reimbursement/balances", middleware.AuthMiddleware(handlers.ReimbursementBalances, "admin", "base_agent", "captain"))
+	// 开支跨基地/分区分摊与可复用的分摊规则
+	mux.HandleFunc("/api/expense/allocation/get", middleware.AuthMiddleware(handlers.GetExpenseAllocation, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/expense/allocation/set", middleware.AuthMiddleware(handlers.SetExpenseAllocation, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/allocation-rule/list", middleware.AuthMiddleware(handlers.ListAllocationRules, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/allocation-rule/create", middleware.AuthMiddleware(handlers.CreateAllocationRule, "admin"))
+	mux.HandleFunc("/api/allocation-rule/update", middleware.AuthMiddleware(handlers.UpdateAllocationRule, "admin"))
+	mux.HandleFunc("/api/allocation-rule/delete", middleware.AuthMiddleware(handlers.DeleteAllocationRule, "admin"))
+
+	// 收入/产值记录（基地损益的收入来源）
+	mux.HandleFunc("/api/revenue/create", middleware.AuthMiddleware(handlers.CreateRevenue, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/revenue/list", middleware.AuthMiddleware(handlers.ListRevenue, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/revenue/update", middleware.AuthMiddleware(handlers.UpdateRevenue, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/revenue/delete", middleware.AuthMiddleware(handlers.DeleteRevenue, "admin", "base_agent", "captain"))
 
 	// 费用类别管理（仅管理员可创建、更新、删除）
 	mux.HandleFunc("/api/expense-category/create", middleware.AuthMiddleware(handlers.CreateExpenseCategory, "admin"))
@@ -60,6 +85,7 @@ func SetupRouter() *http.ServeMux {
 	mux.HandleFunc("/api/expense-category/get", middleware.AuthMiddleware(handlers.GetExpenseCategory, "admin", "base_agent", "captain"))
 	mux.HandleFunc("/api/expense-category/update", middleware.AuthMiddleware(handlers.UpdateExpenseCategory, "admin"))
 	mux.HandleFunc("/api/expense-category/delete", middleware.AuthMiddleware(handlers.DeleteExpenseCategory, "admin"))
+	mux.HandleFunc("/api/expense-category/move", middleware.AuthMiddleware(handlers.MoveExpenseCategory, "admin"))
 
 	// 基地管理（仅管理员）
 	mux.HandleFunc("/api/base/create", middleware.AuthMiddleware(handlers.CreateBase, "admin"))
@@ -94,6 +120,11 @@ func SetupRouter() *http.ServeMux {
 	mux.HandleFunc("/api/supplier/create", middleware.AuthMiddleware(handlers.CreateSupplier, "admin", "base_agent", "warehouse_admin"))
 	mux.HandleFunc("/api/supplier/update", middleware.AuthMiddleware(handlers.UpdateSupplier, "admin", "base_agent", "warehouse_admin"))
 	mux.HandleFunc("/api/supplier/delete", middleware.AuthMiddleware(handlers.DeleteSupplier, "admin", "warehouse_admin"))
+	mux.HandleFunc("/api/supplier/scorecard", middleware.AuthMiddleware(handlers.GetSupplierScorecard, "admin", "base_agent", "warehouse_admin"))
+	mux.HandleFunc("/api/supplier/statement", middleware.AuthMiddleware(handlers.GetSupplierStatement, "admin", "base_agent"))
+	mux.HandleFunc("/api/supplier/prepayment/create", middleware.AuthMiddleware(handlers.CreateSupplierPrepayment, "admin", "base_agent"))
+	mux.HandleFunc("/api/supplier/prepayment/delete", middleware.AuthMiddleware(handlers.DeleteSupplierPrepayment, "admin"))
+	mux.HandleFunc("/api/supplier/credit/apply", middleware.AuthMiddleware(handlers.ApplySupplierCredit, "admin", "base_agent"))
 
 	// 应付款管理
 	mux.HandleFunc("/api/payable/list", middleware.AuthMiddleware(handlers.ListPayable, "admin", "base_agent"))
@@ -102,25 +133,105 @@ func SetupRouter() *http.ServeMux {
 	mux.HandleFunc("/api/payable/overdue", middleware.AuthMiddleware(handlers.GetOverduePayables, "admin", "base_agent"))
 	mux.HandleFunc("/api/payable/detail", middleware.AuthMiddleware(handlers.GetPayableDetail, "admin", "base_agent"))
 	mux.HandleFunc("/api/payable/delete", middleware.AuthMiddleware(handlers.DeletePayable, "admin"))
+	mux.HandleFunc("/api/payable/installments", middleware.AuthMiddleware(handlers.SetPayableInstallments, "admin", "base_agent"))
 
 	// 还款记录管理
 	mux.HandleFunc("/api/payment/create", middleware.AuthMiddleware(handlers.CreatePayment, "admin", "base_agent"))
 	mux.HandleFunc("/api/payment/list", middleware.AuthMiddleware(handlers.ListPayments, "admin", "base_agent"))
 	mux.HandleFunc("/api/payment/delete", middleware.AuthMiddleware(handlers.DeletePayment, "admin"))
 
+	// 会计期间（按基地按月结账；反结账仅管理员）
+	mux.HandleFunc("/api/period/list", middleware.AuthMiddleware(handlers.ListAccountingPeriods, "admin", "base_agent"))
+	mux.HandleFunc("/api/period/logs", middleware.AuthMiddleware(handlers.ListAccountingPeriodLogs, "admin", "base_agent"))
+	mux.HandleFunc("/api/period/close", middleware.AuthMiddleware(handlers.CloseAccountingPeriod, "admin", "base_agent"))
+	mux.HandleFunc("/api/period/reopen", middleware.AuthMiddleware(handlers.ReopenAccountingPeriod, "admin"))
+
+	// 总账：科目表、凭证、科目余额表、明细账
+	mux.HandleFunc("/api/ledger/accounts", middleware.AuthMiddleware(handlers.ListAccounts, "admin", "base_agent"))
+	mux.HandleFunc("/api/ledger/account/upsert", middleware.AuthMiddleware(handlers.UpsertAccount, "admin"))
+	mux.HandleFunc("/api/ledger/account/delete", middleware.AuthMiddleware(handlers.DeleteAccount, "admin"))
+	mux.HandleFunc("/api/ledger/journals", middleware.AuthMiddleware(handlers.ListJournalEntries, "admin", "base_agent"))
+	mux.HandleFunc("/api/ledger/trial-balance", middleware.AuthMiddleware(handlers.GetTrialBalance, "admin", "base_agent"))
+	mux.HandleFunc("/api/ledger/detail", middleware.AuthMiddleware(handlers.GetAccountLedger, "admin", "base_agent"))
+	mux.HandleFunc("/api/ledger/rebuild", middleware.AuthMiddleware(handlers.RebuildLedger, "admin"))
+
+	// 凭证导出（外部账套）：列模板、科目对照、导出批次
+	mux.HandleFunc("/api/voucher/template/list", middleware.AuthMiddleware(handlers.ListVoucherTemplates, "admin", "base_agent"))
+	mux.HandleFunc("/api/voucher/template/upsert", middleware.AuthMiddleware(handlers.UpsertVoucherTemplate, "admin"))
+	mux.HandleFunc("/api/voucher/template/delete", middleware.AuthMiddleware(handlers.DeleteVoucherTemplate, "admin"))
+	mux.HandleFunc("/api/voucher/mapping/list", middleware.AuthMiddleware(handlers.ListAccountMappings, "admin", "base_agent"))
+	mux.HandleFunc("/api/voucher/mapping/upsert", middleware.AuthMiddleware(handlers.UpsertAccountMapping, "admin"))
+	mux.HandleFunc("/api/voucher/mapping/delete", middleware.AuthMiddleware(handlers.DeleteAccountMapping, "admin"))
+	mux.HandleFunc("/api/voucher/export", middleware.AuthMiddleware(handlers.ExportVouchers, "admin", "base_agent"))
+	mux.HandleFunc("/api/voucher/export/list", middleware.AuthMiddleware(handlers.ListVoucherExports, "admin", "base_agent"))
+	mux.HandleFunc("/api/voucher/export/download", middleware.AuthMiddleware(handlers.DownloadVoucherExport, "admin", "base_agent"))
+	mux.HandleFunc("/api/voucher/export/revoke", middleware.AuthMiddleware(handlers.RevokeVoucherExport, "admin"))
+
+	// 付款申请与审批（超过阈值的付款需管理员审批）
+	mux.HandleFunc("/api/payment-request/create", middleware.AuthMiddleware(handlers.SubmitPaymentRequest, "admin", "base_agent"))
+	mux.HandleFunc("/api/payment-request/list", middleware.AuthMiddleware(handlers.ListPaymentRequests, "admin", "base_agent"))
+	mux.HandleFunc("/api/payment-request/queue", middleware.AuthMiddleware(handlers.PaymentRequestQueue, "admin", "base_agent"))
+	mux.HandleFunc("/api/payment-request/approve", middleware.AuthMiddleware(handlers.ApprovePaymentRequest, "admin"))
+	mux.HandleFunc("/api/payment-request/reject", middleware.AuthMiddleware(handlers.RejectPaymentRequest, "admin"))
+	mux.HandleFunc("/api/payment-threshold/list", middleware.AuthMiddleware(handlers.ListPaymentThresholds, "admin", "base_agent"))
+	mux.HandleFunc("/api/payment-threshold/upsert", middleware.AuthMiddleware(handlers.UpsertPaymentThreshold, "admin"))
+	mux.HandleFunc("/api/payment-threshold/delete", middleware.AuthMiddleware(handlers.DeletePaymentThreshold, "admin"))
+
+	// 银行对账单导入与还款匹配
+	mux.HandleFunc("/api/bank-statement/import", middleware.AuthMiddleware(handlers.ImportBankStatement, "admin", "base_agent"))
+	mux.HandleFunc("/api/bank-statement/list", middleware.AuthMiddleware(handlers.ListBankStatements, "admin", "base_agent"))
+	mux.HandleFunc("/api/bank-statement/lines", middleware.AuthMiddleware(handlers.ListBankStatementLines, "admin", "base_agent"))
+	mux.HandleFunc("/api/bank-statement/rematch", middleware.AuthMiddleware(handlers.RematchBankStatement, "admin", "base_agent"))
+	mux.HandleFunc("/api/bank-statement/confirm", middleware.AuthMiddleware(handlers.ConfirmBankLines, "admin", "base_agent"))
+	mux.HandleFunc("/api/bank-statement/ignore", middleware.AuthMiddleware(handlers.IgnoreBankLine, "admin", "base_agent"))
+
+	// 预算：按基地/类别的月度、年度预算，执行报表与预警
+	mux.HandleFunc("/api/budget/list", middleware.AuthMiddleware(handlers.ListBudgets, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/budget/create", middleware.AuthMiddleware(handlers.CreateBudget, "admin"))
+	mux.HandleFunc("/api/budget/update", middleware.AuthMiddleware(handlers.UpdateBudget, "admin"))
+	mux.HandleFunc("/api/budget/delete", middleware.AuthMiddleware(handlers.DeleteBudget, "admin"))
+	mux.HandleFunc("/api/budget/report", middleware.AuthMiddleware(handlers.BudgetReport, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/budget/alerts", middleware.AuthMiddleware(handlers.ListBudgetAlerts, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/budget/alerts/ack", middleware.AuthMiddleware(handlers.AcknowledgeBudgetAlert, "admin", "base_agent"))
+
 	// 统计分析
 	mux.HandleFunc("/api/analytics/summary", middleware.AuthMiddleware(handlers.AnalyticsSummary, "admin", "base_agent", "captain"))
 	// 每基地开支（可按类别筛选）
 	mux.HandleFunc("/api/analytics/expense-by-base", middleware.AuthMiddleware(handlers.ExpenseByBaseDetail, "admin", "base_agent", "captain"))
 	// 每基地物资申领（可按商品筛选）
 	mux.HandleFunc("/api/analytics/requisition-by-base", middleware.AuthMiddleware(handlers.RequisitionByBase, "admin", "base_agent", "captain"))
+	// 分区/队长成本分析
+	mux.HandleFunc("/api/analytics/cost-by-section", middleware.AuthMiddleware(handlers.CostBySection, "admin", "base_agent", "captain"))
+	// 基地损益（收入/产值与成本）
+	mux.HandleFunc("/api/analytics/pnl", middleware.AuthMiddleware(handlers.BaseProfitAndLoss, "admin", "base_agent"))
+	// 时间序列（按日/周/月，可分组并含同比）
+	mux.HandleFunc("/api/analytics/timeseries", middleware.AuthMiddleware(handlers.AnalyticsTimeseries, "admin", "base_agent", "captain"))
+	// 月度汇总表：手动刷新与一致性校验
+	mux.HandleFunc("/api/analytics/mv/refresh", middleware.AuthMiddleware(handlers.RefreshMonthlyAggregates, "admin"))
+	mux.HandleFunc("/api/analytics/mv/check", middleware.AuthMiddleware(handlers.CheckMonthlyAggregates, "admin"))
+	// 自定义报表
+	mux.HandleFunc("/api/analytics/report/run", middleware.AuthMiddleware(handlers.RunReport, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/analytics/report/list", middleware.AuthMiddleware(handlers.ListReportDefinitions, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/analytics/report/save", middleware.AuthMiddleware(handlers.SaveReportDefinition, "admin", "base_agent", "captain"))
+	mux.HandleFunc("/api/analytics/report/delete", middleware.AuthMiddleware(handlers.DeleteReportDefinition, "admin", "base_agent", "captain"))
+	// 定时报表
+	mux.HandleFunc("/api/analytics/schedule/list", middleware.AuthMiddleware(handlers.ListReportSchedules, "admin"))
+	mux.HandleFunc("/api/analytics/schedule/save", middleware.AuthMiddleware(handlers.SaveReportSchedule, "admin"))
+	mux.HandleFunc("/api/analytics/schedule/delete", middleware.AuthMiddleware(handlers.DeleteReportSchedule, "admin"))
+	mux.HandleFunc("/api/analytics/schedule/run", middleware.AuthMiddleware(handlers.RunReportScheduleNow, "admin"))
+	mux.HandleFunc("/api/analytics/schedule/deliveries", middleware.AuthMiddleware(handlers.ListReportDeliveries, "admin"))
 
 	// 汇率管理
 	mux.HandleFunc("/api/rate/list", handlers.ListExchangeRates)
 	mux.HandleFunc("/api/rate/upsert", middleware.AuthMiddleware(handlers.UpsertExchangeRate, "admin"))
+	mux.HandleFunc("/api/rate/history", handlers.ListExchangeRateHistory)
+	mux.HandleFunc("/api/rate/history/delete", middleware.AuthMiddleware(handlers.DeleteExchangeRateHistory, "admin"))
+	// 已实现汇兑损益
+	mux.HandleFunc("/api/fx/realized", middleware.AuthMiddleware(handlers.ListRealizedFX, "admin", "base_agent"))
 
 	// 库存与申领
 	mux.HandleFunc("/api/inventory/list", middleware.AuthMiddleware(handlers.InventoryList, "admin", "base_agent", "captain", "warehouse_admin"))
+	mux.HandleFunc("/api/inventory/consumption", middleware.AuthMiddleware(handlers.ConsumptionForecast, "admin", "base_agent", "captain", "warehouse_admin"))
 	mux.HandleFunc("/api/inventory/requisition/create", middleware.AuthMiddleware(handlers.CreateRequisition, "admin", "base_agent", "captain", "warehouse_admin"))
 	mux.HandleFunc("/api/inventory/requisition/update", middleware.AuthMiddleware(handlers.UpdateRequisition, "admin", "base_agent", "captain", "warehouse_admin"))
 	mux.HandleFunc("/api/inventory/requisition/delete", middleware.AuthMiddleware(handlers.DeleteRequisition, "admin", "base_agent", "captain", "warehouse_admin"))
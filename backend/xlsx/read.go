@@ -0,0 +1,218 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 读取限制：防止压缩炸弹或超大行列号耗尽内存
+const (
+	MaxPartSize = 64 << 20 // 单个 XML 部件解压后的最大字节数
+	MaxRows     = 1048576  // Excel 工作表最大行数
+	MaxCols     = 16384    // Excel 工作表最大列数（XFD）
+	MaxReadRows = 100000   // Read 接受的最大行数（含空行）
+)
+
+type xmlWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xmlRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xmlText 富文本单元格由多个 <r><t> 片段组成
+type xmlText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xmlText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xmlSST struct {
+	Items []xmlText `xml:"si"`
+}
+
+type xmlSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref string  `xml:"r,attr"`
+			T   string  `xml:"t,attr"`
+			V   string  `xml:"v"`
+			Is  xmlText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(io.LimitReader(rc, MaxPartSize+1))
+			if err != nil {
+				return nil, err
+			}
+			if len(data) > MaxPartSize {
+				return nil, fmt.Errorf("%s 超过 %d MB", name, MaxPartSize>>20)
+			}
+			return data, nil
+		}
+	}
+	return nil, errors.New("缺少 " + name)
+}
+
+// firstSheetPath 工作簿中第一个工作表的路径（无法解析时退回 xl/worksheets/sheet1.xml）
+func firstSheetPath(zr *zip.Reader) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+	data, err := readZipFile(zr, "xl/workbook.xml")
+	if err != nil {
+		return fallback
+	}
+	var wb xmlWorkbook
+	if xml.Unmarshal(data, &wb) != nil || len(wb.Sheets) == 0 {
+		return fallback
+	}
+	data, err = readZipFile(zr, "xl/_rels/workbook.xml.rels")
+	if err != nil {
+		return fallback
+	}
+	var rels xmlRels
+	if xml.Unmarshal(data, &rels) != nil {
+		return fallback
+	}
+	for _, r := range rels.Rels {
+		if r.ID == wb.Sheets[0].RID {
+			if strings.HasPrefix(r.Target, "/") {
+				return strings.TrimPrefix(r.Target, "/")
+			}
+			return path.Join("xl", r.Target)
+		}
+	}
+	return fallback
+}
+
+// colIndex 单元格引用（如 "AB12"）的列序号（从 0 开始），无法解析返回 -1，超出 MaxCols 返回 MaxCols
+func colIndex(ref string) int {
+	n := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		n = n*26 + int(ref[i]-'A'+1)
+		if n > MaxCols {
+			return MaxCols
+		}
+	}
+	if i == 0 {
+		return -1
+	}
+	return n - 1
+}
+
+// Read 读取 .xlsx 第一个工作表为字符串二维表：共享字符串、内联字符串与数值均按文本返回，
+// 空行保留为空切片以保持行号对应。日期单元格为序列号数值，可用 DateFromSerial 转换。
+// 行号、列号超出 Excel 上限或总行数超过 MaxReadRows 时返回错误。
+func Read(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("不是有效的 xlsx 文件")
+	}
+	var shared []string
+	if sstData, err := readZipFile(zr, "xl/sharedStrings.xml"); err == nil {
+		var sst xmlSST
+		if err := xml.Unmarshal(sstData, &sst); err != nil {
+			return nil, errors.New("共享字符串表格式错误")
+		}
+		for _, it := range sst.Items {
+			shared = append(shared, it.String())
+		}
+	}
+	sheetData, err := readZipFile(zr, firstSheetPath(zr))
+	if err != nil {
+		return nil, err
+	}
+	var sheet xmlSheet
+	if err := xml.Unmarshal(sheetData, &sheet); err != nil {
+		return nil, errors.New("工作表格式错误")
+	}
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		if row.R > MaxRows {
+			return nil, fmt.Errorf("行号 %d 超出工作表范围", row.R)
+		}
+		idx := row.R - 1
+		if idx < len(rows) {
+			idx = len(rows)
+		}
+		if idx >= MaxReadRows {
+			return nil, fmt.Errorf("工作表超过 %d 行", MaxReadRows)
+		}
+		for len(rows) < idx {
+			rows = append(rows, nil)
+		}
+		var rec []string
+		for ci, c := range row.Cells {
+			col := colIndex(c.Ref)
+			if col < 0 {
+				col = ci
+			}
+			if col >= MaxCols {
+				return nil, errors.New("列号超出工作表范围: " + c.Ref)
+			}
+			var v string
+			switch c.T {
+			case "s":
+				i, err := strconv.Atoi(strings.TrimSpace(c.V))
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, errors.New("共享字符串索引无效: " + c.Ref)
+				}
+				v = shared[i]
+			case "inlineStr":
+				v = c.Is.String()
+			default:
+				v = c.V
+			}
+			for len(rec) <= col {
+				rec = append(rec, "")
+			}
+			rec[col] = v
+		}
+		rows = append(rows, rec)
+	}
+	return rows, nil
+}
+
+// DateFromSerial Excel 日期序列号（1900 日期系统）转日期
+func DateFromSerial(f float64) time.Time {
+	days := math.Floor(f)
+	return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(days))
+}